@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite"
+	"github.com/VariableSan/gia-sso/pkg/validator"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -12,10 +18,23 @@ import (
 
 func main() {
 	var storagePath, migrationsPath, migrationsTable string
+	var canonicalizeEmails, providerRules bool
 
 	flag.StringVar(&storagePath, "storage-path", "", "path to storage")
 	flag.StringVar(&migrationsPath, "migrations-path", "", "path to migrations")
 	flag.StringVar(&migrationsTable, "migrations-table", "migrations", "name of migrations table")
+	flag.BoolVar(
+		&canonicalizeEmails,
+		"canonicalize-emails",
+		false,
+		"recompute the normalized emails of all users after migrating, e.g. after changing email.provider_rules",
+	)
+	flag.BoolVar(
+		&providerRules,
+		"email-provider-rules",
+		false,
+		"apply mailbox provider rules when canonicalizing emails, as email.provider_rules does",
+	)
 	flag.Parse()
 
 	if storagePath == "" {
@@ -34,13 +53,42 @@ func main() {
 	}
 
 	if err := m.Up(); err != nil {
-		if errors.Is(err, migrate.ErrNoChange) {
-			fmt.Println("no migrations to apply")
-			return
+		if !errors.Is(err, migrate.ErrNoChange) {
+			panic(err)
 		}
+		fmt.Println("no migrations to apply")
+	} else {
+		fmt.Println("migrations applied successfully")
+	}
 
-		panic(err)
+	if canonicalizeEmails {
+		if err := canonicalize(storagePath, providerRules); err != nil {
+			panic(err)
+		}
 	}
+}
+
+// canonicalize brings the stored normalized emails in line with the
+// normalization rules. It runs in one transaction, which an interrupt rolls
+// back.
+func canonicalize(storagePath string, providerRules bool) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	storage, err := sqlite.New(storagePath)
+	if err != nil {
+		return err
+	}
+	defer storage.Stop()
+
+	normalizer := validator.EmailNormalizer{ProviderRules: providerRules}
+
+	updated, disabled, err := storage.CanonicalizeEmails(ctx, normalizer.Normalize)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("canonicalized %d emails, disabled %d accounts with duplicate emails\n", updated, disabled)
 
-	fmt.Println("migrations applied successfully")
+	return nil
 }
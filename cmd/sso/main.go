@@ -21,15 +21,12 @@ func main() {
 		slog.Int("port", cfg.GRPC.Port),
 	)
 
-	application := app.New(
-		log,
-		cfg.GRPC.Host,
-		cfg.GRPC.Port,
-		cfg.StoragePath,
-		cfg.TokenTTL,
-	)
+	application := app.New(log, cfg)
 
 	go application.GRPCSrv.MustRun()
+	go application.HTTPSrv.MustRun()
+	go application.Purger.Run()
+	go application.Logouts.Run()
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
@@ -43,6 +40,9 @@ func main() {
 	}
 
 	application.GRPCSrv.Stop()
+	application.HTTPSrv.Stop()
+	application.Purger.Stop()
+	application.Logouts.Stop()
 
 	log.Info("application stopped")
 }
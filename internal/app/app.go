@@ -1,35 +1,411 @@
 package app
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log/slog"
-	"time"
+	"net/url"
+	"os"
 
 	grpcapp "github.com/VariableSan/gia-sso/internal/app/grpc"
+	httpapp "github.com/VariableSan/gia-sso/internal/app/http"
+	logoutapp "github.com/VariableSan/gia-sso/internal/app/logout"
+	purgerapp "github.com/VariableSan/gia-sso/internal/app/purger"
+	"github.com/VariableSan/gia-sso/internal/config"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
 	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/services/directory"
+	"github.com/VariableSan/gia-sso/internal/services/mail"
+	"github.com/VariableSan/gia-sso/internal/services/oauth"
+	"github.com/VariableSan/gia-sso/internal/services/saml"
+	"github.com/VariableSan/gia-sso/internal/services/scim"
+	"github.com/VariableSan/gia-sso/internal/services/sms"
+	"github.com/VariableSan/gia-sso/internal/services/upstream"
 	"github.com/VariableSan/gia-sso/internal/storage/sqlite"
+	"github.com/VariableSan/gia-sso/pkg/clientip"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/validator"
 )
 
 type App struct {
 	GRPCSrv *grpcapp.App
+	HTTPSrv *httpapp.App
+	Purger  *purgerapp.App
+	Logouts *logoutapp.App
 }
 
 func New(
 	log *slog.Logger,
-	grpcHost string,
-	grpcPort int,
-	storagePath string,
-	tokenTTL time.Duration,
+	cfg *config.Config,
 ) *App {
-	storage, err := sqlite.New(storagePath)
+	storage, err := sqlite.New(cfg.StoragePath)
 	if err != nil {
 		panic(err)
 	}
 
-	authService := auth.New(log, storage, tokenTTL)
+	passwordPolicy, err := newPasswordPolicy(cfg.PasswordPolicy)
+	if err != nil {
+		panic(err)
+	}
+
+	emailDomains, err := validator.NewEmailDomainPolicy(
+		cfg.Email.AllowedDomains,
+		cfg.Email.DeniedDomains,
+		cfg.Email.DeniedDomainsPath,
+	)
+	if err != nil {
+		panic(fmt.Errorf("failed to load email domain lists: %w", err))
+	}
+	validator.SetEmailDomainPolicy(emailDomains)
+
+	var userDirectory auth.Directory
+	if cfg.LDAP.URL != "" {
+		ldapDirectory, err := newDirectory(log, cfg.LDAP)
+		if err != nil {
+			panic(fmt.Errorf("failed to configure ldap: %w", err))
+		}
+		userDirectory = ldapDirectory
+	}
+
+	emailLogin, err := newEmailLogin(cfg.EmailLogin)
+	if err != nil {
+		panic(err)
+	}
+
+	mailer, err := newMailer(log, cfg.Mail)
+	if err != nil {
+		panic(err)
+	}
+
+	registration, err := newRegistration(cfg.Registration)
+	if err != nil {
+		panic(err)
+	}
+
+	phone, smsSender, err := newSMS(log, cfg.SMS)
+	if err != nil {
+		panic(err)
+	}
+
+	claimMapping := jwt.ClaimMapping(cfg.TokenClaims)
+	if err := claimMapping.Validate(); err != nil {
+		panic(fmt.Errorf("invalid token_claims: %w", err))
+	}
+
+	authService := auth.New(log, storage, auth.Config{
+		JWTSecret:           cfg.JWTSecret,
+		TokenTTL:            cfg.TokenTTL,
+		RefreshTokenTTL:     cfg.RefreshTokenTTL,
+		StepUpTokenTTL:      cfg.StepUpTokenTTL,
+		DeletionGracePeriod: cfg.Accounts.DeletionGracePeriod,
+		PasswordPolicy:      passwordPolicy,
+		EmailNormalizer: validator.EmailNormalizer{
+			ProviderRules: cfg.Email.ProviderRules,
+		},
+		Directory:    userDirectory,
+		EmailLogin:   emailLogin,
+		Mailer:       mailer,
+		Registration: registration,
+		ClaimMapping: claimMapping,
+		Phone:        phone,
+		SMSSender:    smsSender,
+		APIKeyScopes: cfg.APIKeyScopes,
+	})
+
+	signingKey, err := jwt.LoadOrCreateSigningKey(cfg.OAuth.SigningKeyPath)
+	if err != nil {
+		panic(fmt.Errorf("failed to load signing key: %w", err))
+	}
+
+	oauthService := oauth.New(log, storage, authService, oauth.Config{
+		Issuer:        cfg.HTTP.PublicURL,
+		SigningKey:    signingKey,
+		JWTSecret:     cfg.JWTSecret,
+		TokenTTL:      cfg.TokenTTL,
+		CodeTTL:       cfg.OAuth.CodeTTL,
+		DeviceCodeTTL: cfg.OAuth.DeviceCodeTTL,
+		PollInterval:  cfg.OAuth.DevicePollInterval,
+
+		LogoutTimeout:       cfg.OAuth.BackchannelLogout.Timeout,
+		LogoutRetryInterval: cfg.OAuth.BackchannelLogout.RetryInterval,
+		MaxLogoutAttempts:   cfg.OAuth.BackchannelLogout.MaxAttempts,
+		RegistrationToken:   cfg.OAuth.RegistrationToken,
+	})
+
+	upstreamService := upstream.New(log, storage, authService, upstream.Config{
+		CallbackURL: cfg.HTTP.PublicURL + "/upstream/callback",
+		LinkURL:     cfg.HTTP.PublicURL + "/upstream/link",
+		Providers:   upstreamProviders(cfg.Upstream.Providers),
+		Timeout:     cfg.Upstream.Timeout,
+		LoginTTL:    cfg.Upstream.LoginTTL,
+	})
+
+	samlService, err := saml.New(log, storage, saml.Config{
+		EntityID:     cfg.HTTP.PublicURL + "/saml/metadata",
+		SSOURL:       cfg.HTTP.PublicURL + "/saml/sso",
+		SigningKey:   signingKey,
+		AssertionTTL: cfg.SAML.AssertionTTL,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	scimService := scim.New(log, storage, scim.Config{
+		Token:      cfg.SCIM.Token,
+		BaseURL:    cfg.HTTP.PublicURL + "/scim/v2",
+		MaxResults: cfg.SCIM.MaxResults,
+		EmailNormalizer: validator.EmailNormalizer{
+			ProviderRules: cfg.Email.ProviderRules,
+		},
+	})
+
+	trustedProxies, err := clientip.ParseProxies(cfg.TrustedProxies)
+	if err != nil {
+		panic(fmt.Errorf("invalid trusted_proxies: %w", err))
+	}
+
+	grpcApp := grpcapp.New(
+		log,
+		authService,
+		oauthService,
+		upstreamService,
+		samlService,
+		trustedProxies,
+		cfg.GRPC.Host,
+		cfg.GRPC.Port,
+	)
+
+	httpApp := httpapp.New(
+		log,
+		oauthService,
+		authService,
+		upstreamService,
+		samlService,
+		scimService,
+		cfg.SCIM.MaxResults,
+		cfg.HTTP.PublicURL,
+		trustedProxies,
+		cfg.HTTP.Host,
+		cfg.HTTP.Port,
+		cfg.HTTP.Timeout,
+	)
+
+	purgerApp := purgerapp.New(log, authService, cfg.Accounts.PurgeInterval)
 
-	grpcApp := grpcapp.New(log, authService, grpcHost, grpcPort)
+	logoutApp := logoutapp.New(log, oauthService, cfg.OAuth.BackchannelLogout.Interval)
 
 	return &App{
 		GRPCSrv: grpcApp,
+		HTTPSrv: httpApp,
+		Purger:  purgerApp,
+		Logouts: logoutApp,
 	}
 }
+
+func upstreamProviders(cfg []config.UpstreamProviderConfig) []upstream.ProviderConfig {
+	providers := make([]upstream.ProviderConfig, 0, len(cfg))
+	seen := make(map[string]bool, len(cfg))
+	for _, provider := range cfg {
+		if provider.ID == "" || provider.Issuer == "" || provider.ClientID == "" {
+			panic("upstream providers need an id, issuer and client_id")
+		}
+		if provider.ID == models.ProviderLDAP {
+			panic("upstream provider id is reserved: " + provider.ID)
+		}
+		if seen[provider.ID] {
+			panic("duplicate upstream provider id: " + provider.ID)
+		}
+		seen[provider.ID] = true
+
+		providers = append(providers, upstream.ProviderConfig{
+			ID:           provider.ID,
+			Name:         provider.Name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			Scopes:       provider.Scopes,
+		})
+	}
+
+	return providers
+}
+
+func newDirectory(log *slog.Logger, cfg config.LDAPConfig) (*directory.Directory, error) {
+	for group, role := range cfg.GroupRoles {
+		if role != models.RoleAdmin {
+			return nil, fmt.Errorf("unknown role %q for group %q", role, group)
+		}
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CACertPath != "" {
+		certs, err := os.ReadFile(cfg.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		if !roots.AppendCertsFromPEM(certs) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.CACertPath)
+		}
+	}
+
+	return directory.New(log, directory.Config{
+		URL:          cfg.URL,
+		StartTLS:     cfg.StartTLS,
+		TLS:          &tls.Config{RootCAs: roots},
+		Timeout:      cfg.Timeout,
+		BindDN:       cfg.BindDN,
+		BindPassword: cfg.BindPassword,
+		UserDN:       cfg.UserDN,
+		BaseDN:       cfg.BaseDN,
+		UserFilter:   cfg.UserFilter,
+		Attributes: directory.Attributes{
+			ID:     cfg.IDAttribute,
+			Email:  cfg.EmailAttribute,
+			Groups: cfg.GroupAttribute,
+		},
+		GroupRoles: cfg.GroupRoles,
+	})
+}
+
+func newEmailLogin(cfg config.EmailLoginConfig) (auth.EmailLoginConfig, error) {
+	method := models.EmailLoginMethod(cfg.Method)
+	switch method {
+	case "", models.EmailLoginCode:
+	case models.EmailLoginLink:
+		link, err := url.Parse(cfg.LinkURL)
+		if err != nil || !link.IsAbs() {
+			return auth.EmailLoginConfig{}, fmt.Errorf("email login link_url must be an absolute URL")
+		}
+	default:
+		return auth.EmailLoginConfig{}, fmt.Errorf("unknown email login method %q", cfg.Method)
+	}
+
+	if cfg.MaxAttempts < 1 {
+		return auth.EmailLoginConfig{}, fmt.Errorf("email login max_attempts must be at least 1")
+	}
+
+	return auth.EmailLoginConfig{
+		Method:         method,
+		LinkURL:        cfg.LinkURL,
+		TTL:            cfg.TTL,
+		MaxAttempts:    cfg.MaxAttempts,
+		ResendInterval: cfg.ResendInterval,
+	}, nil
+}
+
+func newRegistration(cfg config.RegistrationConfig) (auth.RegistrationConfig, error) {
+	mode := models.RegistrationMode(cfg.Mode)
+	switch mode {
+	case models.RegistrationOpen, models.RegistrationInviteOnly, models.RegistrationClosed:
+	case models.RegistrationDomainRestricted:
+		if len(cfg.Domains) == 0 {
+			return auth.RegistrationConfig{}, fmt.Errorf("domain_restricted registration needs domains")
+		}
+	default:
+		return auth.RegistrationConfig{}, fmt.Errorf("unknown registration mode %q", cfg.Mode)
+	}
+
+	domains, err := validator.NewEmailDomainPolicy(cfg.Domains, nil, "")
+	if err != nil {
+		return auth.RegistrationConfig{}, fmt.Errorf("invalid registration domains: %w", err)
+	}
+
+	return auth.RegistrationConfig{
+		Mode:          mode,
+		Domains:       domains,
+		InvitationTTL: cfg.InvitationTTL,
+		InvitationURL: cfg.InvitationURL,
+	}, nil
+}
+
+func newMailer(log *slog.Logger, cfg config.MailConfig) (auth.Mailer, error) {
+	switch cfg.Driver {
+	case "log":
+		return mail.NewLogSender(log), nil
+	case "smtp":
+		if cfg.Host == "" || cfg.From == "" {
+			return nil, fmt.Errorf("smtp mail needs a host and from address")
+		}
+
+		return mail.NewSMTPSender(mail.SMTPConfig{
+			Host:     cfg.Host,
+			Port:     cfg.Port,
+			Username: cfg.Username,
+			Password: cfg.Password,
+			From:     cfg.From,
+			Timeout:  cfg.Timeout,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+func newSMS(log *slog.Logger, cfg config.SMSConfig) (auth.PhoneConfig, auth.SMSSender, error) {
+	var sender auth.SMSSender
+	switch cfg.Driver {
+	case "":
+		return auth.PhoneConfig{}, nil, nil
+	case "log":
+		sender = sms.NewLogSender(log)
+	case "file":
+		if cfg.Path == "" {
+			return auth.PhoneConfig{}, nil, fmt.Errorf("file sms driver needs a path")
+		}
+		sender = sms.NewFileSender(cfg.Path)
+	case "http":
+		gateway, err := url.Parse(cfg.URL)
+		if err != nil || !gateway.IsAbs() {
+			return auth.PhoneConfig{}, nil, fmt.Errorf("http sms driver needs an absolute url")
+		}
+		sender = sms.NewHTTPSender(sms.HTTPConfig{
+			URL:       cfg.URL,
+			AuthToken: cfg.AuthToken,
+			From:      cfg.From,
+			Timeout:   cfg.Timeout,
+		})
+	default:
+		return auth.PhoneConfig{}, nil, fmt.Errorf("unknown sms driver %q", cfg.Driver)
+	}
+
+	if cfg.MaxAttempts < 1 || cfg.HourlyLimit < 1 {
+		return auth.PhoneConfig{}, nil, fmt.Errorf("sms max_attempts and hourly_limit must be at least 1")
+	}
+
+	return auth.PhoneConfig{
+		TTL:            cfg.CodeTTL,
+		MaxAttempts:    cfg.MaxAttempts,
+		ResendInterval: cfg.ResendInterval,
+		HourlyLimit:    cfg.HourlyLimit,
+	}, sender, nil
+}
+
+func newPasswordPolicy(cfg config.PasswordPolicyConfig) (auth.PasswordPolicy, error) {
+	policy := auth.PasswordPolicy{
+		PasswordPolicy: validator.PasswordPolicy{
+			MinLength:     cfg.MinLength,
+			MaxLength:     cfg.MaxLength,
+			RequireUpper:  cfg.RequireUpper,
+			RequireLower:  cfg.RequireLower,
+			RequireDigit:  cfg.RequireDigit,
+			RequireSymbol: cfg.RequireSymbol,
+			RejectEmail:   cfg.RejectEmail,
+		},
+		HistorySize: cfg.HistorySize,
+		MaxAge:      cfg.MaxAge,
+	}
+
+	if cfg.BreachedListPath != "" {
+		breached, err := validator.LoadBreachedPasswords(cfg.BreachedListPath)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("failed to load breached passwords: %w", err)
+		}
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
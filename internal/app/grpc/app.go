@@ -6,6 +6,7 @@ import (
 	"net"
 
 	authgrpc "github.com/VariableSan/gia-sso/internal/grpc/auth"
+	"github.com/VariableSan/gia-sso/pkg/clientip"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -20,12 +21,16 @@ type App struct {
 func New(
 	log *slog.Logger,
 	authService authgrpc.Auth,
+	oauthService authgrpc.OAuth,
+	upstreamService authgrpc.Upstream,
+	samlService authgrpc.SAML,
+	trustedProxies *clientip.Proxies,
 	host string,
 	port int,
 ) *App {
 	gRPCServer := grpc.NewServer()
 
-	authgrpc.Register(gRPCServer, authService)
+	authgrpc.Register(gRPCServer, authService, oauthService, upstreamService, samlService, trustedProxies)
 	reflection.Register(gRPCServer)
 
 	return &App{
@@ -0,0 +1,105 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	oauthhttp "github.com/VariableSan/gia-sso/internal/http/oauth"
+	scimhttp "github.com/VariableSan/gia-sso/internal/http/scim"
+	"github.com/VariableSan/gia-sso/pkg/clientip"
+)
+
+// shutdownTimeout bounds how long Stop waits for in-flight requests.
+const shutdownTimeout = 10 * time.Second
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	host       string
+	port       int
+}
+
+func New(
+	log *slog.Logger,
+	oauthService oauthhttp.OAuth,
+	authService oauthhttp.Auth,
+	upstreamService oauthhttp.Upstream,
+	samlService oauthhttp.SAML,
+	scimService scimhttp.SCIM,
+	scimMaxResults int,
+	publicURL string,
+	trustedProxies *clientip.Proxies,
+	host string,
+	port int,
+	timeout time.Duration,
+) *App {
+	mux := http.NewServeMux()
+
+	oauthhttp.Register(mux, log, oauthService, authService, upstreamService, samlService, oauthhttp.Config{
+		PublicURL:      publicURL,
+		TrustedProxies: trustedProxies,
+	})
+	scimhttp.Register(mux, log, scimService, scimhttp.Config{
+		MaxResults: scimMaxResults,
+	})
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: timeout,
+			ReadTimeout:       timeout,
+			WriteTimeout:      timeout,
+		},
+		host: host,
+		port: port,
+	}
+}
+
+func (app *App) MustRun() {
+	if err := app.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (app *App) Run() error {
+	const operation = "httpapp.Run"
+
+	log := app.log.With(
+		slog.String("operation", operation),
+		slog.Int("port", app.port),
+	)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", app.host, app.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log.Info("http server is running", slog.String("addr", listener.Addr().String()))
+
+	if err := app.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+func (app *App) Stop() {
+	const operation = "httpapp.Stop"
+
+	log := app.log.With(slog.String("operation", operation))
+
+	log.Info("stopping HTTP server", slog.Int("port", app.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := app.httpServer.Shutdown(ctx); err != nil {
+		log.Error("failed to stop HTTP server gracefully", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,72 @@
+package logoutapp
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type Notifier interface {
+	DeliverLogoutNotifications(ctx context.Context) (int, error)
+}
+
+// App periodically delivers queued back-channel logout tokens to clients.
+type App struct {
+	log      *slog.Logger
+	notifier Notifier
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func New(
+	log *slog.Logger,
+	notifier Notifier,
+	interval time.Duration,
+) *App {
+	return &App{
+		log:      log,
+		notifier: notifier,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (app *App) Run() {
+	const operation = "logoutapp.Run"
+
+	log := app.log.With(
+		slog.String("operation", operation),
+	)
+
+	defer close(app.done)
+
+	log.Info("back-channel logout delivery is running", slog.Duration("interval", app.interval))
+
+	ticker := time.NewTicker(app.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := app.notifier.DeliverLogoutNotifications(context.Background()); err != nil {
+			log.Error("failed to deliver back-channel logouts", slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-app.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *App) Stop() {
+	const operation = "logoutapp.Stop"
+
+	app.log.
+		With(slog.String("operation", operation)).
+		Info("stopping back-channel logout delivery")
+
+	close(app.stop)
+	<-app.done
+}
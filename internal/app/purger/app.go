@@ -0,0 +1,72 @@
+package purgerapp
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type Purger interface {
+	PurgeDeletedUsers(ctx context.Context) (int64, error)
+}
+
+// App periodically purges accounts whose deletion grace period is over.
+type App struct {
+	log      *slog.Logger
+	purger   Purger
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func New(
+	log *slog.Logger,
+	purger Purger,
+	interval time.Duration,
+) *App {
+	return &App{
+		log:      log,
+		purger:   purger,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (app *App) Run() {
+	const operation = "purgerapp.Run"
+
+	log := app.log.With(
+		slog.String("operation", operation),
+	)
+
+	defer close(app.done)
+
+	log.Info("account purger is running", slog.Duration("interval", app.interval))
+
+	ticker := time.NewTicker(app.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := app.purger.PurgeDeletedUsers(context.Background()); err != nil {
+			log.Error("failed to purge deleted accounts", slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-app.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *App) Stop() {
+	const operation = "purgerapp.Stop"
+
+	app.log.
+		With(slog.String("operation", operation)).
+		Info("stopping account purger")
+
+	close(app.stop)
+	<-app.done
+}
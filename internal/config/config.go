@@ -9,10 +9,33 @@ import (
 )
 
 type Config struct {
-	Env         string        `yaml:"env" env-default:"local"`
-	StoragePath string        `yaml:"storage_path" env-required:"true"`
-	TokenTTL    time.Duration `yaml:"token_ttl" env-required:"true"`
-	GRPC        GRPCConfig    `yaml:"grpc"`
+	Env             string               `yaml:"env" env-default:"local"`
+	StoragePath     string               `yaml:"storage_path" env-required:"true"`
+	TokenTTL        time.Duration        `yaml:"token_ttl" env-required:"true"`
+	RefreshTokenTTL time.Duration        `yaml:"refresh_token_ttl" env-default:"720h"`
+	StepUpTokenTTL  time.Duration        `yaml:"step_up_token_ttl" env-default:"5m"`
+	JWTSecret       string               `yaml:"jwt_secret" env:"JWT_SECRET" env-required:"true"`
+	GRPC            GRPCConfig           `yaml:"grpc"`
+	HTTP            HTTPConfig           `yaml:"http"`
+	OAuth           OAuthConfig          `yaml:"oauth"`
+	Upstream        UpstreamConfig       `yaml:"upstream"`
+	LDAP            LDAPConfig           `yaml:"ldap"`
+	SAML            SAMLConfig           `yaml:"saml"`
+	SCIM            SCIMConfig           `yaml:"scim"`
+	Accounts        AccountsConfig       `yaml:"accounts"`
+	PasswordPolicy  PasswordPolicyConfig `yaml:"password_policy"`
+	Email           EmailConfig          `yaml:"email"`
+	EmailLogin      EmailLoginConfig     `yaml:"email_login"`
+	Mail            MailConfig           `yaml:"mail"`
+	Registration    RegistrationConfig   `yaml:"registration"`
+	TokenClaims     map[string]string    `yaml:"token_claims"`
+	SMS             SMSConfig            `yaml:"sms"`
+	// TrustedProxies are the IPs or CIDR ranges of reverse proxies whose
+	// X-Forwarded-For header tells the client address. The header of any
+	// other peer is ignored.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// APIKeyScopes are the only scopes API keys can be created with.
+	APIKeyScopes []string `yaml:"api_key_scopes"`
 }
 
 type GRPCConfig struct {
@@ -21,6 +44,186 @@ type GRPCConfig struct {
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+type HTTPConfig struct {
+	Host    string        `yaml:"host"`
+	Port    int           `yaml:"port"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+	// PublicURL is the base URL the HTTP endpoints are reachable at from
+	// browsers and clients, e.g. "https://sso.example.com".
+	PublicURL string `yaml:"public_url" env-required:"true"`
+}
+
+type OAuthConfig struct {
+	// CodeTTL is how long authorization codes can be exchanged for tokens.
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"1m"`
+	// DeviceCodeTTL is how long users have to approve a device that
+	// started the device authorization grant.
+	DeviceCodeTTL time.Duration `yaml:"device_code_ttl" env-default:"10m"`
+	// DevicePollInterval is how long devices must wait between two polls
+	// of the token endpoint.
+	DevicePollInterval time.Duration `yaml:"device_poll_interval" env-default:"5s"`
+	// BackchannelLogout configures the delivery of logout tokens to
+	// clients when a user's session ends.
+	BackchannelLogout BackchannelLogoutConfig `yaml:"backchannel_logout"`
+	// RegistrationToken is the initial access token clients must present
+	// to register dynamically. Empty disables dynamic registration.
+	RegistrationToken string `yaml:"registration_token" env:"OAUTH_REGISTRATION_TOKEN"`
+	// SigningKeyPath is the PEM file with the RSA key ID tokens are signed
+	// with. A new key is generated there if the file does not exist.
+	SigningKeyPath string `yaml:"signing_key_path" env:"OIDC_SIGNING_KEY_PATH" env-default:"./storage/oidc_signing_key.pem"`
+}
+
+type BackchannelLogoutConfig struct {
+	// Interval is how often queued logout tokens are delivered.
+	Interval time.Duration `yaml:"interval" env-default:"5s"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"5s"`
+	// RetryInterval is the wait before the first retry of a failed
+	// delivery, doubled with each further attempt.
+	RetryInterval time.Duration `yaml:"retry_interval" env-default:"30s"`
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"5"`
+}
+
+type UpstreamConfig struct {
+	// Timeout bounds each request to an upstream provider.
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+	// LoginTTL is how long users have to log in at a provider.
+	LoginTTL  time.Duration            `yaml:"login_ttl" env-default:"10m"`
+	Providers []UpstreamProviderConfig `yaml:"providers"`
+}
+
+// UpstreamProviderConfig describes an OpenID provider users can sign in
+// with. gia-sso must be registered there as a confidential client with the
+// redirect URI <public_url>/upstream/callback.
+type UpstreamProviderConfig struct {
+	ID           string   `yaml:"id"`
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// SAMLConfig configures the SAML 2.0 identity provider. Service providers
+// are registered over gRPC and sign assertions with the OIDC signing key.
+type SAMLConfig struct {
+	// AssertionTTL is how long service providers accept an assertion after
+	// it was issued.
+	AssertionTTL time.Duration `yaml:"assertion_ttl" env-default:"5m"`
+}
+
+// SCIMConfig configures the SCIM 2.0 provisioning API served under
+// /scim/v2. An empty token disables it.
+type SCIMConfig struct {
+	Token string `yaml:"token" env:"SCIM_TOKEN"`
+	// MaxResults bounds the number of resources returned by one query.
+	MaxResults int `yaml:"max_results" env-default:"100"`
+}
+
+// LDAPConfig connects the LDAP or Active Directory server users can log in
+// to with their directory password. An empty URL disables it.
+type LDAPConfig struct {
+	URL      string `yaml:"url"`
+	StartTLS bool   `yaml:"start_tls"`
+	// CACertPath is a PEM file of CAs trusted for the server certificate in
+	// addition to the system ones.
+	CACertPath string        `yaml:"ca_cert_path"`
+	Timeout    time.Duration `yaml:"timeout" env-default:"5s"`
+	// BindDN and BindPassword are the service account users are searched
+	// with before binding as them. Leave empty to bind as UserDN instead.
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password" env:"LDAP_BIND_PASSWORD"`
+	// UserDN is the name users bind as without a BindDN, with %s replaced
+	// by their login, e.g. "uid=%s,ou=people,dc=example,dc=com".
+	UserDN string `yaml:"user_dn"`
+	BaseDN string `yaml:"base_dn"`
+	// UserFilter finds the entry of a user, with %s replaced by their login.
+	UserFilter     string `yaml:"user_filter" env-default:"(&(objectClass=person)(mail=%s))"`
+	IDAttribute    string `yaml:"id_attribute" env-default:"entryUUID"`
+	EmailAttribute string `yaml:"email_attribute" env-default:"mail"`
+	GroupAttribute string `yaml:"group_attribute" env-default:"memberOf"`
+	// GroupRoles maps group DNs to the role their members get. The only
+	// role is "admin".
+	GroupRoles map[string]string `yaml:"group_roles"`
+}
+
+type AccountsConfig struct {
+	DeletionGracePeriod time.Duration `yaml:"deletion_grace_period" env-default:"720h"`
+	PurgeInterval       time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+type PasswordPolicyConfig struct {
+	MinLength     int  `yaml:"min_length" env-default:"6"`
+	MaxLength     int  `yaml:"max_length" env-default:"72"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	RejectEmail   bool `yaml:"reject_email"`
+	// BreachedListPath points to a file or HIBP range directory of passwords
+	// that must not be used. Empty disables the check.
+	BreachedListPath string        `yaml:"breached_list_path"`
+	HistorySize      int           `yaml:"history_size"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+type EmailConfig struct {
+	// ProviderRules applies mailbox provider specific normalization, such as
+	// ignoring dots and "+tag" suffixes in Gmail addresses. Stored addresses
+	// are brought in line after a change by the migrator's
+	// -canonicalize-emails.
+	ProviderRules bool `yaml:"provider_rules"`
+	// AllowedDomains, when set, are the only domains that may register.
+	AllowedDomains []string `yaml:"allowed_domains"`
+	// DeniedDomains and the domains listed in DeniedDomainsPath, one per
+	// line, may never register, e.g. disposable email providers.
+	DeniedDomains     []string `yaml:"denied_domains"`
+	DeniedDomainsPath string   `yaml:"denied_domains_path"`
+}
+
+// EmailLoginConfig configures passwordless logins with a code or link sent
+// to the user's email address.
+type EmailLoginConfig struct {
+	// Method is "code" for a 6-digit code, "link" for a magic link, or
+	// empty to disable passwordless logins.
+	Method string `yaml:"method"`
+	// LinkURL is the page of the app magic links open, with the token added
+	// as the "token" query parameter.
+	LinkURL string        `yaml:"link_url"`
+	TTL     time.Duration `yaml:"ttl" env-default:"10m"`
+	// MaxAttempts is how many codes can be tried before the login must be
+	// started again.
+	MaxAttempts int `yaml:"max_attempts" env-default:"5"`
+	// ResendInterval is how long to wait before another login can be
+	// requested for the same address, whether or not it has an account.
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+}
+
+// RegistrationConfig decides who may register an account.
+type RegistrationConfig struct {
+	// Mode is "open", "invite_only", "closed" or "domain_restricted".
+	Mode string `yaml:"mode" env-default:"open"`
+	// Domains may register without an invitation in domain_restricted
+	// mode, including their subdomains.
+	Domains       []string      `yaml:"domains"`
+	InvitationTTL time.Duration `yaml:"invitation_ttl" env-default:"168h"`
+	// InvitationURL is the registration page of the app invitation emails
+	// link to, with the code in the "invitation" query parameter. Empty
+	// sends the bare code.
+	InvitationURL string `yaml:"invitation_url"`
+}
+
+// MailConfig configures how emails are sent.
+type MailConfig struct {
+	// Driver is "log" to write emails to the log, or "smtp".
+	Driver   string        `yaml:"driver" env-default:"log"`
+	From     string        `yaml:"from"`
+	Host     string        `yaml:"host"`
+	Port     int           `yaml:"port" env-default:"587"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password" env:"SMTP_PASSWORD"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
 func MustLoad() *Config {
 	path := fetchConfigPath()
 	if path == "" {
@@ -53,3 +256,25 @@ func fetchConfigPath() string {
 
 	return res
 }
+
+// SMSConfig configures how text messages are sent and the one-time codes
+// sent with them.
+type SMSConfig struct {
+	// Driver is "log" to write messages to the log, "file" to append them
+	// to Path, "http" to post them to the gateway at URL, or empty to
+	// disable phone verification and SMS codes.
+	Driver    string        `yaml:"driver"`
+	Path      string        `yaml:"path"`
+	URL       string        `yaml:"url"`
+	AuthToken string        `yaml:"auth_token" env:"SMS_AUTH_TOKEN"`
+	From      string        `yaml:"from"`
+	Timeout   time.Duration `yaml:"timeout" env-default:"10s"`
+	CodeTTL   time.Duration `yaml:"code_ttl" env-default:"5m"`
+	// MaxAttempts is how many codes can be tried before a new one must be
+	// requested.
+	MaxAttempts int `yaml:"max_attempts" env-default:"5"`
+	// ResendInterval and HourlyLimit bound how often codes are sent to the
+	// same number.
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+	HourlyLimit    int           `yaml:"hourly_limit" env-default:"5"`
+}
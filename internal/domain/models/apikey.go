@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// APIKeyPrefix starts every API key, so that keys are recognized by secret
+// scanners and told apart from access tokens.
+const APIKeyPrefix = "gia_pat_"
+
+// APIKey is a long-lived credential scripts and CI jobs use in place of a
+// user's password. Only a hash of the key is stored.
+type APIKey struct {
+	ID     string `json:"id"`
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	// Prefix is the start of the key, shown so that users can tell their
+	// keys apart.
+	Prefix     string    `json:"prefix"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	RevokedAt  time.Time `json:"revoked_at,omitzero"`
+}
+
+// IsActive reports whether the key can still be used to authenticate.
+func (k APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt.IsZero() && (k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt))
+}
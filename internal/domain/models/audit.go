@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+const (
+	AuditUserRegistered        = "user.registered"
+	AuditLogin                 = "session.created"
+	AuditLogout                = "session.ended"
+	AuditSessionRevoked        = "session.revoked"
+	AuditSessionsRevoked       = "sessions.revoked"
+	AuditAccountStatusChanged  = "account.status_changed"
+	AuditAccountDeleted        = "account.deleted"
+	AuditAccountPurged         = "account.purged"
+	AuditDataExported          = "account.data_exported"
+	AuditPasswordChanged       = "account.password_changed"
+	AuditIdentityLinked        = "account.identity_linked"
+	AuditIdentityUnlinked      = "account.identity_unlinked"
+	AuditRolesChanged          = "account.roles_changed"
+	AuditClientAuthorized      = "oauth.client_authorized"
+	AuditCodeReplayed          = "oauth.code_replayed"
+	AuditTokenExchanged        = "oauth.token_exchanged"
+	AuditUserImpersonated      = "oauth.user_impersonated"
+	AuditSAMLLogin             = "saml.login"
+	AuditAPIKeyCreated         = "api_key.created"
+	AuditAPIKeyRevoked         = "api_key.revoked"
+	AuditServiceAccountCreated = "service_account.created"
+	AuditStepUp                = "session.stepped_up"
+	AuditInvitationCreated     = "invitation.created"
+	AuditInvitationRevoked     = "invitation.revoked"
+	AuditOrgCreated            = "org.created"
+	AuditOrgMemberAdded        = "org.member_added"
+	AuditProfileUpdated        = "account.profile_updated"
+	AuditPhoneVerified         = "account.phone_verified"
+)
+
+// AuditEvent records something that happened to a user's account. ActorID is
+// the user who caused it, which is zero when it was the system itself.
+type AuditEvent struct {
+	ID        int64             `json:"id"`
+	UserID    int64             `json:"user_id"`
+	ActorID   int64             `json:"actor_id,omitempty"`
+	Action    string            `json:"action"`
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// AMREmail is the authentication method reference of a login with a code or
+// link sent to the user's email address.
+const AMREmail = "email"
+
+type EmailLoginMethod string
+
+const (
+	// EmailLoginCode sends a 6-digit code the user types into the app.
+	EmailLoginCode EmailLoginMethod = "code"
+	// EmailLoginLink sends a magic link that carries a one-time token.
+	EmailLoginLink EmailLoginMethod = "link"
+)
+
+// EmailLogin is a passwordless login waiting for the user to enter the code
+// or open the link sent to them. Only a hash of the secret is stored.
+type EmailLogin struct {
+	ID       string
+	UserID   int64
+	Method   EmailLoginMethod
+	Attempts int
+	// ExpiresAt is returned to the app so that it can tell the user how
+	// long the code is valid.
+	ExpiresAt time.Time
+	UsedAt    time.Time
+	CreatedAt time.Time
+}
+
+// IsPending reports whether the login can still be completed.
+func (l EmailLogin) IsPending(now time.Time) bool {
+	return l.UsedAt.IsZero() && now.Before(l.ExpiresAt)
+}
+
+// EmailMessage is a plain text email sent to a user.
+type EmailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// UserDataExport is everything gia-sso stores about a user, as handed out by
+// a data export request.
+type UserDataExport struct {
+	ExportedAt time.Time       `json:"exported_at"`
+	Profile    ExportedProfile `json:"profile"`
+	Roles      []string        `json:"roles"`
+	Sessions   []Session       `json:"sessions"`
+	Grants     []OAuthGrant    `json:"grants"`
+	Identities []Identity      `json:"identities"`
+	APIKeys    []APIKey        `json:"api_keys"`
+	// ServiceAccounts are the service accounts the user owns.
+	ServiceAccounts []ServiceAccount `json:"service_accounts"`
+	// Orgs are the organizations the user is a member of.
+	Orgs []OrgMember `json:"orgs"`
+	// Invitation is the invitation the user registered with, if any.
+	Invitation *Invitation `json:"invitation,omitempty"`
+	// Provisioning is what a SCIM client stored about the user, if any.
+	Provisioning *ExportedProvisioning `json:"provisioning,omitempty"`
+	AuditEvents  []AuditEvent          `json:"audit_events"`
+}
+
+type ExportedProfile struct {
+	ID                int64      `json:"id"`
+	Email             string     `json:"email"`
+	Status            UserStatus `json:"status"`
+	StatusReason      string     `json:"status_reason,omitempty"`
+	StatusChangedAt   time.Time  `json:"status_changed_at,omitzero"`
+	DeletedAt         time.Time  `json:"deleted_at,omitzero"`
+	PasswordChangedAt time.Time  `json:"password_changed_at,omitzero"`
+	Attributes        Profile    `json:"attributes"`
+}
+
+type ExportedProvisioning struct {
+	ExternalID  string   `json:"external_id,omitempty"`
+	GivenName   string   `json:"given_name,omitempty"`
+	FamilyName  string   `json:"family_name,omitempty"`
+	DisplayName string   `json:"display_name,omitempty"`
+	Groups      []string `json:"groups"`
+}
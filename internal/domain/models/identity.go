@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// AMRFederated is the authentication method reference of a login at an
+// upstream identity provider.
+const AMRFederated = "fed"
+
+// ProviderLDAP is the provider of the identities of users that log in with
+// their password in the LDAP directory.
+const ProviderLDAP = "ldap"
+
+// Identity links a user to their account at an upstream identity provider.
+type Identity struct {
+	// Provider is the id of the provider in the configuration and Subject
+	// the user's sub claim there.
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"`
+	UserID      int64     `json:"user_id"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// DirectoryUser is a user as authenticated by an LDAP directory.
+type DirectoryUser struct {
+	// Subject identifies the user in the directory and does not change
+	// when they are renamed, e.g. their entryUUID or objectGUID.
+	Subject string
+	Email   string
+	// EmailVerified is set when Email was read from the entry rather than
+	// taken from the login the user typed.
+	EmailVerified bool
+	// Roles are mapped from the groups of the user. They are nil when the
+	// directory does not manage roles.
+	Roles []string
+}
+
+// UpstreamLogin is a login at an upstream identity provider that the user
+// has been sent to and not yet returned from.
+type UpstreamLogin struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	// ReturnTo is the local path the user continues at once logged in.
+	ReturnTo string
+	// LinkUserID is set on logins that link the identity to this user
+	// instead of signing in.
+	LinkUserID int64
+	ExpiresAt  time.Time
+}
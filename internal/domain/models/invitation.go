@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// RegistrationMode decides who may register an account with Register.
+type RegistrationMode string
+
+const (
+	// RegistrationOpen lets anyone register.
+	RegistrationOpen RegistrationMode = "open"
+	// RegistrationInviteOnly requires an invitation.
+	RegistrationInviteOnly RegistrationMode = "invite_only"
+	// RegistrationClosed rejects every registration. Accounts are then
+	// created by provisioning, e.g. over SCIM or from a directory.
+	RegistrationClosed RegistrationMode = "closed"
+	// RegistrationDomainRestricted lets addresses at the configured domains
+	// register and requires an invitation for everyone else.
+	RegistrationDomainRestricted RegistrationMode = "domain_restricted"
+)
+
+// Invitation lets the owner of Email register, with Role granted to the new
+// account and, when OrgID is set, membership of that organization with
+// OrgRole. It can be used once; only a hash of its code is stored.
+type Invitation struct {
+	ID         string    `json:"id"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role,omitempty"`
+	OrgID      int64     `json:"org_id,omitempty"`
+	OrgRole    string    `json:"org_role,omitempty"`
+	InvitedBy  int64     `json:"invited_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	AcceptedAt time.Time `json:"accepted_at,omitzero"`
+	AcceptedBy int64     `json:"accepted_by,omitempty"`
+	RevokedAt  time.Time `json:"revoked_at,omitzero"`
+}
+
+// IsPending reports whether the invitation can still be accepted.
+func (i Invitation) IsPending(now time.Time) bool {
+	return i.AcceptedAt.IsZero() && i.RevokedAt.IsZero() && now.Before(i.ExpiresAt)
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// OAuthClient is an application registered to obtain tokens through the
+// OAuth 2.0 endpoints.
+type OAuthClient struct {
+	ID   string
+	Name string
+	// SecretHash is the SHA-256 hash of the client secret. It is empty for
+	// public clients, such as single page and native apps, which cannot keep
+	// a secret and rely on PKCE alone.
+	SecretHash []byte
+	// RedirectURIs lists the exact redirect URIs the client may use.
+	RedirectURIs []string
+	// TokenEndpointAuthMethod is how the client authenticates at the token
+	// endpoint; see AuthMethod.
+	TokenEndpointAuthMethod string
+	GrantTypes              []string
+	// Scopes and Audience limit the tokens the client can obtain for itself
+	// through the client credentials grant.
+	Scopes   []string
+	Audience []string
+	// ServiceAccountID is the service account that tokens of the client
+	// credentials grant are issued for. Without one the client is the
+	// subject of the tokens.
+	ServiceAccountID int64
+	// JWKS holds the public keys of clients using private_key_jwt.
+	JWKS string
+	// PostLogoutRedirectURIs lists the exact URIs users may be sent back to
+	// after logging out at the end session endpoint.
+	PostLogoutRedirectURIs []string
+	// FrontchannelLogoutURI is loaded in the browser and
+	// BackchannelLogoutURI receives a logout token when a session the
+	// client holds tokens for ends.
+	FrontchannelLogoutURI string
+	BackchannelLogoutURI  string
+	// AccessTokenTTL and RefreshTokenTTL override the lifetimes of the
+	// tokens issued to the client when set.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// RegistrationTokenHash is the SHA-256 hash of the registration access
+	// token of a dynamically registered client (RFC 7592).
+	RegistrationTokenHash []byte
+	// FirstParty clients are operated by the same party as gia-sso; users
+	// are not asked to consent to the scopes they request.
+	FirstParty bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Client authentication methods at the token endpoint (RFC 7591).
+const (
+	AuthMethodSecretBasic   = "client_secret_basic"
+	AuthMethodSecretPost    = "client_secret_post"
+	AuthMethodPrivateKeyJWT = "private_key_jwt"
+	AuthMethodNone          = "none"
+)
+
+// AuthMethod returns the token endpoint authentication method of the
+// client, defaulting to a client secret if it has one.
+func (c OAuthClient) AuthMethod() string {
+	if c.TokenEndpointAuthMethod != "" {
+		return c.TokenEndpointAuthMethod
+	}
+	if len(c.SecretHash) > 0 {
+		return AuthMethodSecretBasic
+	}
+
+	return AuthMethodNone
+}
+
+// IsConfidential reports whether the client has to authenticate at the
+// token endpoint.
+func (c OAuthClient) IsConfidential() bool {
+	return c.AuthMethod() != AuthMethodNone
+}
+
+// AllowsGrantType reports whether the client may use grantType.
+func (c OAuthClient) AllowsGrantType(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsRedirectURI reports whether uri is registered for the client. URIs
+// are compared as exact strings, as required by the OAuth 2.0 security BCP.
+func (c OAuthClient) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AllowsPostLogoutRedirectURI reports whether uri is registered for the
+// client to be redirected to after logout.
+func (c OAuthClient) AllowsPostLogoutRedirectURI(uri string) bool {
+	return slices.Contains(c.PostLogoutRedirectURIs, uri)
+}
+
+// AuthorizationCode is a single-use code handed to a client at the end of
+// the authorization request and exchanged for tokens at the token endpoint.
+type AuthorizationCode struct {
+	ClientID            string
+	UserID              int64
+	SessionID           string
+	RedirectURI         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	AuthTime            time.Time
+	AMR                 []string
+	ExpiresAt           time.Time
+	UsedAt              time.Time
+	IssuedSessionID     string
+}
+
+type DeviceCodeStatus string
+
+const (
+	DeviceCodePending  DeviceCodeStatus = "pending"
+	DeviceCodeApproved DeviceCodeStatus = "approved"
+	DeviceCodeDenied   DeviceCodeStatus = "denied"
+	DeviceCodeUsed     DeviceCodeStatus = "used"
+)
+
+// DeviceCode is a device authorization request (RFC 8628). The device polls
+// the token endpoint with the device code while the user approves the
+// request by entering the user code in a browser.
+type DeviceCode struct {
+	UserCode string
+	ClientID string
+	Scope    string
+	Status   DeviceCodeStatus
+	// UserID, SessionID, AuthTime and AMR are set once the user has decided
+	// on the request.
+	UserID    int64
+	SessionID string
+	AuthTime  time.Time
+	AMR       []string
+	// Interval is the minimum time the device must wait between two polls.
+	Interval     time.Duration
+	LastPolledAt time.Time
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// Actor is the party acting on behalf of the subject of a token, carried in
+// the act claim (RFC 8693 section 4.1). Earlier actors of a delegation chain
+// are nested in Actor.
+type Actor struct {
+	// Subject is the user id of a user or the client id of a client.
+	Subject string `json:"sub"`
+	// ClientID is set when the actor is a client.
+	ClientID string `json:"client_id,omitempty"`
+	Actor    *Actor `json:"act,omitempty"`
+}
+
+// TokenExchange describes the access token issued by a token exchange
+// (RFC 8693).
+type TokenExchange struct {
+	// ClientID is the client that made the exchange.
+	ClientID string
+	Scope    string
+	Audience []string
+	// Actor is who the token lets act on behalf of its subject.
+	Actor Actor
+}
+
+// LogoutNotification is a back-channel logout token waiting to be delivered
+// to a client.
+type LogoutNotification struct {
+	ID       int64
+	ClientID string
+	// LogoutURI is the back-channel logout URI of the client.
+	LogoutURI     string
+	UserID        int64
+	SessionID     string
+	Attempts      int
+	NextAttemptAt time.Time
+}
+
+// OAuthGrant records the scopes a user has consented to give a client.
+// Requests for scopes within the grant are not asked about again.
+type OAuthGrant struct {
+	UserID     int64     `json:"user_id"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scope      string    `json:"scope"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
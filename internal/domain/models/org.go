@@ -0,0 +1,35 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	// OrgRoleOwner is the role of the members who manage an organization
+	// and may invite people to it.
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+)
+
+// OrgRoles lists the roles a member of an organization can have.
+var OrgRoles = []string{OrgRoleOwner, OrgRoleMember}
+
+// ValidOrgRole reports whether role is a role of organization members.
+func ValidOrgRole(role string) bool {
+	return slices.Contains(OrgRoles, role)
+}
+
+// Org is an organization users belong to.
+type Org struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrgMember is the membership of a user in an organization.
+type OrgMember struct {
+	OrgID  int64  `json:"org_id"`
+	UserID int64  `json:"user_id"`
+	Role   string `json:"role"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// AMRSMS is the authentication method reference of a one-time code sent by
+// text message to the user's verified phone number.
+const AMRSMS = "sms"
+
+type PhoneCodePurpose string
+
+const (
+	// PhoneCodeVerification codes prove that a user receives texts at the
+	// number on their profile.
+	PhoneCodeVerification PhoneCodePurpose = "verification"
+	// PhoneCodeOTP codes are a second factor sent to a verified number.
+	PhoneCodeOTP PhoneCodePurpose = "otp"
+)
+
+// PhoneCode is a one-time code sent by text message, waiting for the user
+// to enter it. Only a hash of the code is stored.
+type PhoneCode struct {
+	ID       string
+	UserID   int64
+	Phone    string
+	Purpose  PhoneCodePurpose
+	Attempts int
+	// ExpiresAt is returned to the app so that it can tell the user how
+	// long the code is valid.
+	ExpiresAt time.Time
+	UsedAt    time.Time
+	CreatedAt time.Time
+}
+
+// IsPending reports whether the code can still be entered.
+func (c PhoneCode) IsPending(now time.Time) bool {
+	return c.UsedAt.IsZero() && now.Before(c.ExpiresAt)
+}
+
+// SMSMessage is a text message sent to a phone number in E.164 form.
+type SMSMessage struct {
+	To   string
+	Body string
+}
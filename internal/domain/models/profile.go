@@ -0,0 +1,109 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Names of the profile attributes, as used in update masks and the claim
+// mapping. Keys of the metadata bags are addressed as "metadata.<key>" and
+// "admin_metadata.<key>".
+const (
+	ProfileDisplayName   = "display_name"
+	ProfileGivenName     = "given_name"
+	ProfileFamilyName    = "family_name"
+	ProfileLocale        = "locale"
+	ProfileTimezone      = "timezone"
+	ProfileAvatarURL     = "avatar_url"
+	ProfilePhone         = "phone"
+	ProfileMetadata      = "metadata"
+	ProfileAdminMetadata = "admin_metadata"
+)
+
+// ProfileFields lists the attributes of a profile that can be updated.
+var ProfileFields = []string{
+	ProfileDisplayName,
+	ProfileGivenName,
+	ProfileFamilyName,
+	ProfileLocale,
+	ProfileTimezone,
+	ProfileAvatarURL,
+	ProfilePhone,
+	ProfileMetadata,
+	ProfileAdminMetadata,
+}
+
+// Profile holds what a user tells about themselves beyond their email.
+type Profile struct {
+	DisplayName string `json:"display_name,omitempty"`
+	GivenName   string `json:"given_name,omitempty"`
+	FamilyName  string `json:"family_name,omitempty"`
+	// Locale is a BCP 47 language tag and Timezone an IANA time zone name.
+	Locale    string `json:"locale,omitempty"`
+	Timezone  string `json:"timezone,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	// PhoneVerifiedAt is when the user proved to receive texts at Phone.
+	// It is reset whenever Phone changes.
+	PhoneVerifiedAt time.Time `json:"phone_verified_at,omitzero"`
+	// Metadata is free-form data the user may edit themselves, while
+	// AdminMetadata can only be changed by admins, e.g. a plan or tenant.
+	Metadata      map[string]any `json:"metadata,omitempty"`
+	AdminMetadata map[string]any `json:"admin_metadata,omitempty"`
+	UpdatedAt     time.Time      `json:"updated_at,omitzero"`
+}
+
+// PhoneVerified reports whether Phone is a verified number of the user.
+func (p Profile) PhoneVerified() bool {
+	return p.Phone != "" && !p.PhoneVerifiedAt.IsZero()
+}
+
+// Attribute returns the value of the named attribute, and false if it is
+// not set.
+func (p Profile) Attribute(name string) (any, bool) {
+	if key, ok := strings.CutPrefix(name, ProfileMetadata+"."); ok {
+		value, ok := p.Metadata[key]
+		return value, ok
+	}
+	if key, ok := strings.CutPrefix(name, ProfileAdminMetadata+"."); ok {
+		value, ok := p.AdminMetadata[key]
+		return value, ok
+	}
+
+	var value string
+	switch name {
+	case ProfileDisplayName:
+		value = p.DisplayName
+	case ProfileGivenName:
+		value = p.GivenName
+	case ProfileFamilyName:
+		value = p.FamilyName
+	case ProfileLocale:
+		value = p.Locale
+	case ProfileTimezone:
+		value = p.Timezone
+	case ProfileAvatarURL:
+		value = p.AvatarURL
+	case ProfilePhone:
+		value = p.Phone
+	}
+
+	return value, value != ""
+}
+
+// IsProfileAttribute reports whether name is an attribute Attribute knows.
+func IsProfileAttribute(name string) bool {
+	for _, prefix := range []string{ProfileMetadata + ".", ProfileAdminMetadata + "."} {
+		if key, ok := strings.CutPrefix(name, prefix); ok {
+			return key != ""
+		}
+	}
+
+	switch name {
+	case ProfileDisplayName, ProfileGivenName, ProfileFamilyName, ProfileLocale,
+		ProfileTimezone, ProfileAvatarURL, ProfilePhone:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// SAMLServiceProvider is an application registered to sign users in with
+// SAML 2.0.
+type SAMLServiceProvider struct {
+	// EntityID identifies the service provider, usually the URL of its
+	// metadata.
+	EntityID string
+	Name     string
+	// ACSURLs lists the assertion consumer services responses may be posted
+	// to. The first one is the default; requests pick another by its URL or
+	// index.
+	ACSURLs []string
+	// NameIDFormat is the name identifier format sent unless a request asks
+	// for another one.
+	NameIDFormat string
+	// Attributes maps the names of the SAML attributes sent to the service
+	// provider to the user fields they are filled from.
+	Attributes map[string]string
+	// IdPInitiated allows users to sign in to the service provider from
+	// gia-sso without a request of it.
+	IdPInitiated bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// User fields SAML attributes can be filled from.
+const (
+	UserFieldID    = "id"
+	UserFieldEmail = "email"
+	// UserFieldRoles holds one value per role of the user.
+	UserFieldRoles = "roles"
+)
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// SCIMUser is a user as provisioned by a SCIM client, such as an HR
+// system. Users that were created otherwise have no SCIM attributes until
+// a client updates them.
+type SCIMUser struct {
+	User
+	ExternalID  string
+	GivenName   string
+	FamilyName  string
+	DisplayName string
+	// Groups lists the groups the user is a member of, without their
+	// members.
+	Groups []SCIMGroup
+	// CreatedAt and UpdatedAt are zero for users no SCIM client touched.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SCIMGroup is a group of users maintained by a SCIM client.
+type SCIMGroup struct {
+	ID          string
+	DisplayName string
+	ExternalID  string
+	// Members holds the ids of the users in the group.
+	Members   []int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
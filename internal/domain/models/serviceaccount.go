@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ServiceAccount is a non-human principal, such as a deployment or a
+// scheduled job. It is stored as a user without email or password and
+// authenticates only with API keys or through OAuth clients bound to it.
+type ServiceAccount struct {
+	// ID is the user id of the service account.
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	OwnerID     int64      `json:"owner_id"`
+	Roles       []string   `json:"roles"`
+	Status      UserStatus `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// AMRPassword is the authentication method reference (RFC 8176) of a login
+// with email and password.
+const AMRPassword = "pwd"
+
+// Authentication context classes reported to clients, from the weakest to
+// the strongest.
+const (
+	// ACRPassword is the class of sessions authenticated with a single
+	// factor, such as a password alone.
+	ACRPassword = "urn:gia-sso:acr:password"
+	// ACRMultiFactor is the class of sessions in which the user proved
+	// two independent factors, e.g. a password and a code sent by email.
+	ACRMultiFactor = "urn:gia-sso:acr:mfa"
+)
+
+// ACRValues lists the supported authentication context classes ordered by
+// strength.
+var ACRValues = []string{ACRPassword, ACRMultiFactor}
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	RevokedAt  time.Time `json:"revoked_at,omitzero"`
+	// ClientID is set on sessions opened by an OAuth client on behalf of the
+	// user. ParentID is the browser session the user authorized it from;
+	// revoking the parent revokes the client sessions as well.
+	ClientID string `json:"client_id,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// AuthTime is when the user last actively authenticated in the session
+	// and AMR the methods they used to do so.
+	AuthTime time.Time `json:"auth_time"`
+	AMR      []string  `json:"amr,omitempty"`
+	// Browser is set on sessions of the hosted login pages, which live in a
+	// cookie and cannot be refreshed.
+	Browser bool `json:"browser,omitempty"`
+}
+
+// ACR returns the authentication context class satisfied by having
+// authenticated with the methods in amr.
+func ACR(amr []string) string {
+	// Federated logins are a single factor of unknown kind, so they only
+	// add to a local factor.
+	factors := 0
+	for _, method := range []string{AMRPassword, AMREmail, AMRSMS, AMRFederated} {
+		if slices.Contains(amr, method) {
+			factors++
+		}
+	}
+
+	if factors >= 2 {
+		return ACRMultiFactor
+	}
+
+	return ACRPassword
+}
+
+// ACRLevel returns the strength of an authentication context class, or -1
+// for classes gia-sso does not know.
+func ACRLevel(acr string) int {
+	return slices.Index(ACRValues, acr)
+}
+
+// IsActive reports whether the session can still be used to authenticate.
+func (s Session) IsActive(now time.Time) bool {
+	return s.RevokedAt.IsZero() && now.Before(s.ExpiresAt)
+}
+
+// ClientInfo describes the client a session is opened from.
+type ClientInfo struct {
+	Device    string
+	IP        string
+	UserAgent string
+}
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	SessionID    string
+}
@@ -1,7 +1,62 @@
 package models
 
+import "time"
+
+type UserStatus string
+
+const (
+	UserStatusActive              UserStatus = "active"
+	UserStatusDisabled            UserStatus = "disabled"
+	UserStatusLocked              UserStatus = "locked"
+	UserStatusPendingVerification UserStatus = "pending_verification"
+	UserStatusDeleted             UserStatus = "deleted"
+)
+
+// Valid reports whether s is one of the known account statuses.
+func (s UserStatus) Valid() bool {
+	switch s {
+	case UserStatusActive,
+		UserStatusDisabled,
+		UserStatusLocked,
+		UserStatusPendingVerification,
+		UserStatusDeleted:
+		return true
+	}
+
+	return false
+}
+
+// PrincipalType tells apart the kinds of principals tokens are issued to.
+type PrincipalType string
+
+const (
+	PrincipalUser           PrincipalType = "user"
+	PrincipalServiceAccount PrincipalType = "service_account"
+	// PrincipalClient is an OAuth client acting for itself through the
+	// client credentials grant.
+	PrincipalClient PrincipalType = "client"
+)
+
+// RoleAdmin is the role of the users that manage gia-sso.
+const RoleAdmin = "admin"
+
 type User struct {
-	ID       int64
-	Email    string
-	PassHash []byte
+	ID              int64
+	Email           string
+	PassHash        []byte
+	Status          UserStatus
+	StatusReason    string
+	StatusChangedAt time.Time
+	DeletedAt       time.Time
+	// PasswordChangedAt is when the current password was set.
+	PasswordChangedAt time.Time
+	// PrincipalType is PrincipalUser or PrincipalServiceAccount. Service
+	// accounts have neither an email nor a password.
+	PrincipalType PrincipalType
+	Profile       Profile
+}
+
+// IsServiceAccount reports whether the user is a service account.
+func (u User) IsServiceAccount() bool {
+	return u.PrincipalType == PrincipalServiceAccount
 }
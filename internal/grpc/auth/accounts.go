@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+func (s *serverAPI) SetUserStatus(
+	ctx context.Context,
+	req *ssov1.SetUserStatusRequest,
+) (*ssov1.SetUserStatusResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateSetUserStatusRequest(req); err != nil {
+		return nil, err
+	}
+
+	err = s.auth.SetUserStatus(
+		ctx,
+		caller,
+		req.GetUserId(),
+		models.UserStatus(req.GetStatus()),
+		req.GetReason(),
+	)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.SetUserStatusResponse{
+		Success: true,
+	}, nil
+}
+
+func (s *serverAPI) DeleteUser(
+	ctx context.Context,
+	req *ssov1.DeleteUserRequest,
+) (*ssov1.DeleteUserResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateDeleteUserRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.DeleteUser(ctx, caller, req.GetUserId(), req.GetReason()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.DeleteUserResponse{
+		Success: true,
+	}, nil
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) CreateAPIKey(
+	ctx context.Context,
+	req *ssov1.CreateAPIKeyRequest,
+) (*ssov1.CreateAPIKeyResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateCreateAPIKeyRequest(req); err != nil {
+		return nil, err
+	}
+
+	var expiresAt time.Time
+	if req.GetExpiresAt() != nil {
+		expiresAt = req.GetExpiresAt().AsTime()
+	}
+
+	key, secret, err := s.auth.CreateAPIKey(
+		ctx,
+		caller,
+		req.GetServiceAccountId(),
+		req.GetName(),
+		req.GetScopes(),
+		expiresAt,
+	)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CreateAPIKeyResponse{
+		ApiKey: toAPIKeyProto(key),
+		Key:    secret,
+	}, nil
+}
+
+func (s *serverAPI) ListAPIKeys(
+	ctx context.Context,
+	req *ssov1.ListAPIKeysRequest,
+) (*ssov1.ListAPIKeysResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateListAPIKeysRequest(req); err != nil {
+		return nil, err
+	}
+
+	keys, err := s.auth.APIKeys(ctx, caller, req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListAPIKeysResponse{
+		ApiKeys: make([]*ssov1.APIKey, 0, len(keys)),
+	}
+	for _, key := range keys {
+		resp.ApiKeys = append(resp.ApiKeys, toAPIKeyProto(key))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeAPIKey(
+	ctx context.Context,
+	req *ssov1.RevokeAPIKeyRequest,
+) (*ssov1.RevokeAPIKeyResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateRevokeAPIKeyRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeAPIKey(ctx, caller, req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.RevokeAPIKeyResponse{
+		Success: true,
+	}, nil
+}
+
+func toAPIKeyProto(key models.APIKey) *ssov1.APIKey {
+	resp := &ssov1.APIKey{
+		Id:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: timestamppb.New(key.CreatedAt),
+	}
+	if !key.ExpiresAt.IsZero() {
+		resp.ExpiresAt = timestamppb.New(key.ExpiresAt)
+	}
+	if !key.LastUsedAt.IsZero() {
+		resp.LastUsedAt = timestamppb.New(key.LastUsedAt)
+	}
+
+	return resp
+}
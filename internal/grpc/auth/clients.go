@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+// ClientCredentials is the gRPC equivalent of the client_credentials grant
+// of the token endpoint, for services that do not speak HTTP.
+func (s *serverAPI) ClientCredentials(
+	ctx context.Context,
+	req *ssov1.ClientCredentialsRequest,
+) (*ssov1.ClientCredentialsResponse, error) {
+	if err := validator.ValidateClientCredentialsRequest(req); err != nil {
+		return nil, err
+	}
+
+	client, err := s.authenticateClient(ctx, req.GetClientId(), req.GetClientSecret(), req.GetClientAssertion())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	res, err := s.oauth.ClientCredentialsGrant(ctx, client, req.GetScope(), req.GetAudience())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.ClientCredentialsResponse{
+		AccessToken: res.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(res.ExpiresIn.Seconds()),
+		Scope:       res.Scope,
+	}, nil
+}
+
+// ExchangeToken is the gRPC equivalent of the token exchange grant of the
+// token endpoint.
+func (s *serverAPI) ExchangeToken(
+	ctx context.Context,
+	req *ssov1.TokenExchangeRequest,
+) (*ssov1.TokenExchangeResponse, error) {
+	if err := validator.ValidateTokenExchangeRequest(req); err != nil {
+		return nil, err
+	}
+
+	client, err := s.authenticateClient(ctx, req.GetClientId(), req.GetClientSecret(), req.GetClientAssertion())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	res, err := s.oauth.ExchangeToken(ctx, client, oauthservice.TokenExchangeRequest{
+		SubjectToken:       req.GetSubjectToken(),
+		SubjectTokenType:   req.GetSubjectTokenType(),
+		ActorToken:         req.GetActorToken(),
+		ActorTokenType:     req.GetActorTokenType(),
+		RequestedTokenType: req.GetRequestedTokenType(),
+		Audience:           req.GetAudience(),
+		Scope:              req.GetScope(),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.TokenExchangeResponse{
+		AccessToken:     res.AccessToken,
+		IssuedTokenType: res.IssuedTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(res.ExpiresIn.Seconds()),
+		Scope:           res.Scope,
+	}, nil
+}
+
+// authenticateClient authenticates a client calling over gRPC with either
+// its secret or a client assertion.
+func (s *serverAPI) authenticateClient(
+	ctx context.Context,
+	clientID string,
+	secret string,
+	assertion string,
+) (models.OAuthClient, error) {
+	creds := oauthservice.ClientCredentials{
+		ClientID: clientID,
+		Secret:   secret,
+	}
+	if assertion != "" {
+		creds.AssertionType = jwt.ClientAssertionType
+		creds.Assertion = assertion
+	}
+
+	return s.oauth.AuthenticateClient(ctx, creds)
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/grpc/reqctx"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) StartEmailLogin(
+	ctx context.Context,
+	req *ssov1.StartEmailLoginRequest,
+) (*ssov1.StartEmailLoginResponse, error) {
+	if err := validator.ValidateStartEmailLoginRequest(req); err != nil {
+		return nil, err
+	}
+
+	login, err := s.auth.StartEmailLogin(ctx, req.GetEmail())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.StartEmailLoginResponse{
+		LoginId:   login.ID,
+		Method:    string(login.Method),
+		ExpiresAt: timestamppb.New(login.ExpiresAt),
+	}, nil
+}
+
+func (s *serverAPI) CompleteEmailLogin(
+	ctx context.Context,
+	req *ssov1.CompleteEmailLoginRequest,
+) (*ssov1.CompleteEmailLoginResponse, error) {
+	if err := validator.ValidateCompleteEmailLoginRequest(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.CompleteEmailLogin(
+		ctx,
+		req.GetLoginId(),
+		req.GetCode(),
+		req.GetToken(),
+		reqctx.Client(ctx, s.trustedProxies),
+	)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CompleteEmailLoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) ListGrants(
+	ctx context.Context,
+	req *ssov1.ListGrantsRequest,
+) (*ssov1.ListGrantsResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := s.oauth.Grants(ctx, caller)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListGrantsResponse{
+		Grants: make([]*ssov1.OAuthGrant, 0, len(grants)),
+	}
+	for _, grant := range grants {
+		resp.Grants = append(resp.Grants, toGrantProto(grant))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeGrant(
+	ctx context.Context,
+	req *ssov1.RevokeGrantRequest,
+) (*ssov1.RevokeGrantResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateRevokeGrantRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.oauth.RevokeGrant(ctx, caller, req.GetClientId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.RevokeGrantResponse{
+		Success: true,
+	}, nil
+}
+
+func toGrantProto(grant models.OAuthGrant) *ssov1.OAuthGrant {
+	return &ssov1.OAuthGrant{
+		ClientId:   grant.ClientID,
+		ClientName: grant.ClientName,
+		Scopes:     strings.Fields(grant.Scope),
+		CreatedAt:  timestamppb.New(grant.CreatedAt),
+		UpdatedAt:  timestamppb.New(grant.UpdatedAt),
+	}
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) ListIdentities(
+	ctx context.Context,
+	req *ssov1.ListIdentitiesRequest,
+) (*ssov1.ListIdentitiesResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.auth.Identities(ctx, caller)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListIdentitiesResponse{
+		Identities: make([]*ssov1.Identity, 0, len(identities)),
+	}
+	for _, identity := range identities {
+		resp.Identities = append(resp.Identities, toIdentityProto(identity))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) LinkIdentity(
+	ctx context.Context,
+	req *ssov1.LinkIdentityRequest,
+) (*ssov1.LinkIdentityResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateLinkIdentityRequest(req); err != nil {
+		return nil, err
+	}
+
+	linkURL, err := s.upstream.StartLink(ctx, caller, req.GetProvider())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.LinkIdentityResponse{
+		LinkUrl: linkURL,
+	}, nil
+}
+
+func (s *serverAPI) UnlinkIdentity(
+	ctx context.Context,
+	req *ssov1.UnlinkIdentityRequest,
+) (*ssov1.UnlinkIdentityResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateUnlinkIdentityRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.UnlinkIdentity(ctx, caller, req.GetProvider(), req.GetSubject()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.UnlinkIdentityResponse{
+		Success: true,
+	}, nil
+}
+
+func toIdentityProto(identity models.Identity) *ssov1.Identity {
+	return &ssov1.Identity{
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		CreatedAt:   timestamppb.New(identity.CreatedAt),
+		LastLoginAt: timestamppb.New(identity.LastLoginAt),
+	}
+}
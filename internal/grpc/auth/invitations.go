@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) CreateInvitation(
+	ctx context.Context,
+	req *ssov1.CreateInvitationRequest,
+) (*ssov1.CreateInvitationResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateCreateInvitationRequest(req); err != nil {
+		return nil, err
+	}
+
+	invitation, code, err := s.auth.CreateInvitation(
+		ctx,
+		caller,
+		req.GetEmail(),
+		req.GetRole(),
+		req.GetOrgId(),
+		req.GetOrgRole(),
+	)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CreateInvitationResponse{
+		Invitation: toInvitationProto(invitation),
+		Code:       code,
+	}, nil
+}
+
+func (s *serverAPI) ListInvitations(
+	ctx context.Context,
+	req *ssov1.ListInvitationsRequest,
+) (*ssov1.ListInvitationsResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invitations, err := s.auth.Invitations(ctx, caller)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListInvitationsResponse{
+		Invitations: make([]*ssov1.Invitation, 0, len(invitations)),
+	}
+	for _, invitation := range invitations {
+		resp.Invitations = append(resp.Invitations, toInvitationProto(invitation))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeInvitation(
+	ctx context.Context,
+	req *ssov1.RevokeInvitationRequest,
+) (*ssov1.RevokeInvitationResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateRevokeInvitationRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeInvitation(ctx, caller, req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.RevokeInvitationResponse{
+		Success: true,
+	}, nil
+}
+
+func toInvitationProto(invitation models.Invitation) *ssov1.Invitation {
+	res := &ssov1.Invitation{
+		Id:         invitation.ID,
+		Email:      invitation.Email,
+		Role:       invitation.Role,
+		OrgId:      invitation.OrgID,
+		OrgRole:    invitation.OrgRole,
+		InvitedBy:  invitation.InvitedBy,
+		CreatedAt:  timestamppb.New(invitation.CreatedAt),
+		ExpiresAt:  timestamppb.New(invitation.ExpiresAt),
+		AcceptedBy: invitation.AcceptedBy,
+	}
+	if !invitation.AcceptedAt.IsZero() {
+		res.AcceptedAt = timestamppb.New(invitation.AcceptedAt)
+	}
+
+	return res
+}
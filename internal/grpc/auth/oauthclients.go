@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) CreateClient(
+	ctx context.Context,
+	req *ssov1.CreateClientRequest,
+) (*ssov1.CreateClientResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateCreateClientRequest(req); err != nil {
+		return nil, err
+	}
+
+	reg, err := s.oauth.CreateClient(ctx, caller, fromClientProto(req.GetClient()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CreateClientResponse{
+		Client:       toClientProto(reg.Client),
+		ClientSecret: reg.Secret,
+	}, nil
+}
+
+func (s *serverAPI) GetClient(
+	ctx context.Context,
+	req *ssov1.GetClientRequest,
+) (*ssov1.GetClientResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateGetClientRequest(req); err != nil {
+		return nil, err
+	}
+
+	client, err := s.oauth.Client(ctx, caller, req.GetClientId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.GetClientResponse{
+		Client: toClientProto(client),
+	}, nil
+}
+
+func (s *serverAPI) ListClients(
+	ctx context.Context,
+	req *ssov1.ListClientsRequest,
+) (*ssov1.ListClientsResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clients, err := s.oauth.Clients(ctx, caller)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListClientsResponse{
+		Clients: make([]*ssov1.OAuthClient, 0, len(clients)),
+	}
+	for _, client := range clients {
+		resp.Clients = append(resp.Clients, toClientProto(client))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) UpdateClient(
+	ctx context.Context,
+	req *ssov1.UpdateClientRequest,
+) (*ssov1.UpdateClientResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateUpdateClientRequest(req); err != nil {
+		return nil, err
+	}
+
+	reg, err := s.oauth.UpdateClient(ctx, caller, fromClientProto(req.GetClient()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.UpdateClientResponse{
+		Client:       toClientProto(reg.Client),
+		ClientSecret: reg.Secret,
+	}, nil
+}
+
+func (s *serverAPI) RotateClientSecret(
+	ctx context.Context,
+	req *ssov1.RotateClientSecretRequest,
+) (*ssov1.RotateClientSecretResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateRotateClientSecretRequest(req); err != nil {
+		return nil, err
+	}
+
+	secret, err := s.oauth.RotateClientSecret(ctx, caller, req.GetClientId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.RotateClientSecretResponse{
+		ClientSecret: secret,
+	}, nil
+}
+
+func (s *serverAPI) DeleteClient(
+	ctx context.Context,
+	req *ssov1.DeleteClientRequest,
+) (*ssov1.DeleteClientResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateDeleteClientRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.oauth.DeleteClient(ctx, caller, req.GetClientId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.DeleteClientResponse{
+		Success: true,
+	}, nil
+}
+
+func fromClientProto(client *ssov1.OAuthClient) models.OAuthClient {
+	return models.OAuthClient{
+		ID:                      client.GetClientId(),
+		Name:                    client.GetClientName(),
+		RedirectURIs:            client.GetRedirectUris(),
+		TokenEndpointAuthMethod: client.GetTokenEndpointAuthMethod(),
+		GrantTypes:              client.GetGrantTypes(),
+		Scopes:                  client.GetScopes(),
+		Audience:                client.GetAudience(),
+		JWKS:                    client.GetJwks(),
+		PostLogoutRedirectURIs:  client.GetPostLogoutRedirectUris(),
+		FrontchannelLogoutURI:   client.GetFrontchannelLogoutUri(),
+		BackchannelLogoutURI:    client.GetBackchannelLogoutUri(),
+		AccessTokenTTL:          time.Duration(client.GetAccessTokenTtlSeconds()) * time.Second,
+		RefreshTokenTTL:         time.Duration(client.GetRefreshTokenTtlSeconds()) * time.Second,
+		FirstParty:              client.GetFirstParty(),
+		ServiceAccountID:        client.GetServiceAccountId(),
+	}
+}
+
+func toClientProto(client models.OAuthClient) *ssov1.OAuthClient {
+	return &ssov1.OAuthClient{
+		ClientId:                client.ID,
+		ClientName:              client.Name,
+		RedirectUris:            client.RedirectURIs,
+		GrantTypes:              client.GrantTypes,
+		TokenEndpointAuthMethod: client.AuthMethod(),
+		Scopes:                  client.Scopes,
+		Audience:                client.Audience,
+		Jwks:                    client.JWKS,
+		PostLogoutRedirectUris:  client.PostLogoutRedirectURIs,
+		FrontchannelLogoutUri:   client.FrontchannelLogoutURI,
+		BackchannelLogoutUri:    client.BackchannelLogoutURI,
+		AccessTokenTtlSeconds:   int64(client.AccessTokenTTL.Seconds()),
+		RefreshTokenTtlSeconds:  int64(client.RefreshTokenTTL.Seconds()),
+		FirstParty:              client.FirstParty,
+		CreatedAt:               timestamppb.New(client.CreatedAt),
+		UpdatedAt:               timestamppb.New(client.UpdatedAt),
+		ServiceAccountId:        client.ServiceAccountID,
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) CreateOrg(
+	ctx context.Context,
+	req *ssov1.CreateOrgRequest,
+) (*ssov1.CreateOrgResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateCreateOrgRequest(req); err != nil {
+		return nil, err
+	}
+
+	org, err := s.auth.CreateOrg(ctx, caller, req.GetName(), req.GetOwnerId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CreateOrgResponse{
+		Org: &ssov1.Org{
+			Id:        org.ID,
+			Name:      org.Name,
+			CreatedAt: timestamppb.New(org.CreatedAt),
+		},
+	}, nil
+}
+
+func (s *serverAPI) ListOrgMembers(
+	ctx context.Context,
+	req *ssov1.ListOrgMembersRequest,
+) (*ssov1.ListOrgMembersResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateListOrgMembersRequest(req); err != nil {
+		return nil, err
+	}
+
+	members, err := s.auth.OrgMembers(ctx, caller, req.GetOrgId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListOrgMembersResponse{
+		Members: make([]*ssov1.OrgMember, 0, len(members)),
+	}
+	for _, member := range members {
+		resp.Members = append(resp.Members, &ssov1.OrgMember{
+			OrgId:  member.OrgID,
+			UserId: member.UserID,
+			Role:   member.Role,
+		})
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+func (s *serverAPI) ChangePassword(
+	ctx context.Context,
+	req *ssov1.ChangePasswordRequest,
+) (*ssov1.ChangePasswordResponse, error) {
+	if err := validator.ValidateChangePasswordRequest(req); err != nil {
+		return nil, err
+	}
+
+	err := s.auth.ChangePassword(
+		ctx,
+		req.GetEmail(),
+		req.GetOldPassword(),
+		req.GetNewPassword(),
+	)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.ChangePasswordResponse{
+		Success: true,
+	}, nil
+}
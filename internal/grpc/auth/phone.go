@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) StartPhoneVerification(
+	ctx context.Context,
+	req *ssov1.StartPhoneVerificationRequest,
+) (*ssov1.StartPhoneVerificationResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := s.auth.StartPhoneVerification(ctx, caller)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.StartPhoneVerificationResponse{
+		VerificationId: code.ID,
+		ExpiresAt:      timestamppb.New(code.ExpiresAt),
+	}, nil
+}
+
+func (s *serverAPI) ConfirmPhoneVerification(
+	ctx context.Context,
+	req *ssov1.ConfirmPhoneVerificationRequest,
+) (*ssov1.ConfirmPhoneVerificationResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateConfirmPhoneVerificationRequest(req); err != nil {
+		return nil, err
+	}
+
+	user, err := s.auth.ConfirmPhoneVerification(ctx, caller, req.GetVerificationId(), req.GetCode())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.ConfirmPhoneVerificationResponse{
+		Profile: toProfileProto(user),
+	}, nil
+}
+
+func (s *serverAPI) StartSMSChallenge(
+	ctx context.Context,
+	req *ssov1.StartSMSChallengeRequest,
+) (*ssov1.StartSMSChallengeResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := s.auth.StartSMSChallenge(ctx, caller)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.StartSMSChallengeResponse{
+		ChallengeId: code.ID,
+		ExpiresAt:   timestamppb.New(code.ExpiresAt),
+	}, nil
+}
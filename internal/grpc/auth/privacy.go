@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+const exportContentType = "application/json"
+
+func (s *serverAPI) ExportMyData(
+	ctx context.Context,
+	req *ssov1.ExportMyDataRequest,
+) (*ssov1.ExportMyDataResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.auth.ExportUserData(ctx, caller)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.ExportMyDataResponse{
+		Data:        data,
+		ContentType: exportContentType,
+	}, nil
+}
+
+func (s *serverAPI) DeleteMyAccount(
+	ctx context.Context,
+	req *ssov1.DeleteMyAccountRequest,
+) (*ssov1.DeleteMyAccountResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateDeleteMyAccountRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.DeleteMyAccount(ctx, caller, req.GetPassword()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.DeleteMyAccountResponse{
+		Success: true,
+	}, nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) GetProfile(
+	ctx context.Context,
+	req *ssov1.GetProfileRequest,
+) (*ssov1.GetProfileResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateGetProfileRequest(req); err != nil {
+		return nil, err
+	}
+
+	user, err := s.auth.Profile(ctx, caller, req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.GetProfileResponse{
+		Profile: toProfileProto(user),
+	}, nil
+}
+
+func (s *serverAPI) UpdateProfile(
+	ctx context.Context,
+	req *ssov1.UpdateProfileRequest,
+) (*ssov1.UpdateProfileResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateUpdateProfileRequest(req); err != nil {
+		return nil, err
+	}
+
+	metadata, err := parseMetadata("Metadata", req.GetMetadata())
+	if err != nil {
+		return nil, err
+	}
+
+	adminMetadata, err := parseMetadata("AdminMetadata", req.GetAdminMetadata())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.auth.UpdateProfile(ctx, caller, req.GetUserId(), models.Profile{
+		DisplayName:   req.GetDisplayName(),
+		GivenName:     req.GetGivenName(),
+		FamilyName:    req.GetFamilyName(),
+		Locale:        req.GetLocale(),
+		Timezone:      req.GetTimezone(),
+		AvatarURL:     req.GetAvatarUrl(),
+		Phone:         req.GetPhone(),
+		Metadata:      metadata,
+		AdminMetadata: adminMetadata,
+	}, req.GetUpdateMask())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.UpdateProfileResponse{
+		Profile: toProfileProto(user),
+	}, nil
+}
+
+// parseMetadata decodes a metadata bag sent as a JSON object. An empty value
+// clears the bag.
+func parseMetadata(field string, value string) (map[string]any, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var metadata map[string]any
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		return nil, validator.FieldViolationsError([]validator.FieldViolation{{
+			Field:       field,
+			Description: "must be a JSON object",
+		}})
+	}
+
+	return metadata, nil
+}
+
+func toProfileProto(user models.User) *ssov1.Profile {
+	profile := user.Profile
+
+	res := &ssov1.Profile{
+		UserId:        user.ID,
+		Email:         user.Email,
+		DisplayName:   profile.DisplayName,
+		GivenName:     profile.GivenName,
+		FamilyName:    profile.FamilyName,
+		Locale:        profile.Locale,
+		Timezone:      profile.Timezone,
+		AvatarUrl:     profile.AvatarURL,
+		Phone:         profile.Phone,
+		Metadata:      formatMetadata(profile.Metadata),
+		AdminMetadata: formatMetadata(profile.AdminMetadata),
+		PhoneVerified: profile.PhoneVerified(),
+	}
+	if !profile.UpdatedAt.IsZero() {
+		res.UpdatedAt = timestamppb.New(profile.UpdatedAt)
+	}
+
+	return res
+}
+
+func formatMetadata(metadata map[string]any) string {
+	if len(metadata) == 0 {
+		return "{}"
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(data)
+}
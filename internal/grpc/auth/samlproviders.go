@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) CreateSAMLServiceProvider(
+	ctx context.Context,
+	req *ssov1.CreateSAMLServiceProviderRequest,
+) (*ssov1.CreateSAMLServiceProviderResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateCreateSAMLServiceProviderRequest(req); err != nil {
+		return nil, err
+	}
+
+	sp, err := s.saml.CreateServiceProvider(ctx, caller, fromServiceProviderProto(req.GetServiceProvider()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CreateSAMLServiceProviderResponse{
+		ServiceProvider: toServiceProviderProto(sp),
+	}, nil
+}
+
+func (s *serverAPI) GetSAMLServiceProvider(
+	ctx context.Context,
+	req *ssov1.GetSAMLServiceProviderRequest,
+) (*ssov1.GetSAMLServiceProviderResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateGetSAMLServiceProviderRequest(req); err != nil {
+		return nil, err
+	}
+
+	sp, err := s.saml.ServiceProvider(ctx, caller, req.GetEntityId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.GetSAMLServiceProviderResponse{
+		ServiceProvider: toServiceProviderProto(sp),
+	}, nil
+}
+
+func (s *serverAPI) ListSAMLServiceProviders(
+	ctx context.Context,
+	req *ssov1.ListSAMLServiceProvidersRequest,
+) (*ssov1.ListSAMLServiceProvidersResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	providers, err := s.saml.ServiceProviders(ctx, caller)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListSAMLServiceProvidersResponse{
+		ServiceProviders: make([]*ssov1.SAMLServiceProvider, 0, len(providers)),
+	}
+	for _, sp := range providers {
+		resp.ServiceProviders = append(resp.ServiceProviders, toServiceProviderProto(sp))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) UpdateSAMLServiceProvider(
+	ctx context.Context,
+	req *ssov1.UpdateSAMLServiceProviderRequest,
+) (*ssov1.UpdateSAMLServiceProviderResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateUpdateSAMLServiceProviderRequest(req); err != nil {
+		return nil, err
+	}
+
+	sp, err := s.saml.UpdateServiceProvider(ctx, caller, fromServiceProviderProto(req.GetServiceProvider()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.UpdateSAMLServiceProviderResponse{
+		ServiceProvider: toServiceProviderProto(sp),
+	}, nil
+}
+
+func (s *serverAPI) DeleteSAMLServiceProvider(
+	ctx context.Context,
+	req *ssov1.DeleteSAMLServiceProviderRequest,
+) (*ssov1.DeleteSAMLServiceProviderResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateDeleteSAMLServiceProviderRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.saml.DeleteServiceProvider(ctx, caller, req.GetEntityId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.DeleteSAMLServiceProviderResponse{
+		Success: true,
+	}, nil
+}
+
+func fromServiceProviderProto(sp *ssov1.SAMLServiceProvider) models.SAMLServiceProvider {
+	return models.SAMLServiceProvider{
+		EntityID:     sp.GetEntityId(),
+		Name:         sp.GetName(),
+		ACSURLs:      sp.GetAcsUrls(),
+		NameIDFormat: sp.GetNameIdFormat(),
+		Attributes:   sp.GetAttributes(),
+		IdPInitiated: sp.GetIdpInitiated(),
+	}
+}
+
+func toServiceProviderProto(sp models.SAMLServiceProvider) *ssov1.SAMLServiceProvider {
+	return &ssov1.SAMLServiceProvider{
+		EntityId:     sp.EntityID,
+		Name:         sp.Name,
+		AcsUrls:      sp.ACSURLs,
+		NameIdFormat: sp.NameIDFormat,
+		Attributes:   sp.Attributes,
+		IdpInitiated: sp.IdPInitiated,
+		CreatedAt:    timestamppb.New(sp.CreatedAt),
+		UpdatedAt:    timestamppb.New(sp.UpdatedAt),
+	}
+}
@@ -2,14 +2,25 @@ package auth
 
 import (
 	"context"
-	"fmt"
-	"os"
+	"errors"
+	"strings"
+	"time"
 
 	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/grpc/reqctx"
+	authservice "github.com/VariableSan/gia-sso/internal/services/auth"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+	samlservice "github.com/VariableSan/gia-sso/internal/services/saml"
+	"github.com/VariableSan/gia-sso/internal/services/upstream"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/clientip"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
 	"github.com/VariableSan/gia-sso/pkg/validator"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Auth interface {
@@ -17,28 +28,334 @@ type Auth interface {
 		ctx context.Context,
 		email string,
 		password string,
-		jwtSecret string,
-	) (token string, err error)
+		client models.ClientInfo,
+	) (tokens models.TokenPair, err error)
 	RegisterNewUser(
 		ctx context.Context,
 		email string,
 		password string,
+		invitationCode string,
 	) (userID int64, err error)
 	IsAdmin(
 		ctx context.Context,
 		userID int64,
 	) (bool, error)
+	Refresh(
+		ctx context.Context,
+		refreshToken string,
+	) (models.TokenPair, error)
+	VerifyToken(
+		ctx context.Context,
+		token string,
+	) (jwt.Claims, error)
+	VerifySessionToken(
+		ctx context.Context,
+		token string,
+	) (jwt.Claims, error)
+	Logout(
+		ctx context.Context,
+		token string,
+	) error
+	ListSessions(
+		ctx context.Context,
+		caller jwt.Claims,
+		userID int64,
+	) ([]models.Session, error)
+	RevokeSession(
+		ctx context.Context,
+		caller jwt.Claims,
+		sessionID string,
+	) error
+	RevokeAllOtherSessions(
+		ctx context.Context,
+		caller jwt.Claims,
+		userID int64,
+	) (int64, error)
+	SetUserStatus(
+		ctx context.Context,
+		caller jwt.Claims,
+		userID int64,
+		status models.UserStatus,
+		reason string,
+	) error
+	DeleteUser(
+		ctx context.Context,
+		caller jwt.Claims,
+		userID int64,
+		reason string,
+	) error
+	ExportUserData(
+		ctx context.Context,
+		caller jwt.Claims,
+	) ([]byte, error)
+	DeleteMyAccount(
+		ctx context.Context,
+		caller jwt.Claims,
+		password string,
+	) error
+	ChangePassword(
+		ctx context.Context,
+		email string,
+		oldPassword string,
+		newPassword string,
+	) error
+	Identities(
+		ctx context.Context,
+		caller jwt.Claims,
+	) ([]models.Identity, error)
+	UnlinkIdentity(
+		ctx context.Context,
+		caller jwt.Claims,
+		provider string,
+		subject string,
+	) error
+	CreateAPIKey(
+		ctx context.Context,
+		caller jwt.Claims,
+		userID int64,
+		name string,
+		scopes []string,
+		expiresAt time.Time,
+	) (models.APIKey, string, error)
+	APIKeys(
+		ctx context.Context,
+		caller jwt.Claims,
+		userID int64,
+	) ([]models.APIKey, error)
+	RevokeAPIKey(
+		ctx context.Context,
+		caller jwt.Claims,
+		keyID string,
+	) error
+	VerifyAPIKey(
+		ctx context.Context,
+		key string,
+	) (jwt.Claims, error)
+	CreateServiceAccount(
+		ctx context.Context,
+		caller jwt.Claims,
+		name string,
+		description string,
+		ownerID int64,
+	) (models.ServiceAccount, error)
+	ServiceAccount(
+		ctx context.Context,
+		caller jwt.Claims,
+		accountID int64,
+	) (models.ServiceAccount, error)
+	ServiceAccounts(
+		ctx context.Context,
+		caller jwt.Claims,
+		ownerID int64,
+	) ([]models.ServiceAccount, error)
+	DeleteServiceAccount(
+		ctx context.Context,
+		caller jwt.Claims,
+		accountID int64,
+	) error
+	SetServiceAccountRoles(
+		ctx context.Context,
+		caller jwt.Claims,
+		accountID int64,
+		roles []string,
+	) (models.ServiceAccount, error)
+	StartEmailLogin(
+		ctx context.Context,
+		email string,
+	) (models.EmailLogin, error)
+	CompleteEmailLogin(
+		ctx context.Context,
+		loginID string,
+		code string,
+		token string,
+		client models.ClientInfo,
+	) (models.TokenPair, error)
+	StepUp(
+		ctx context.Context,
+		caller jwt.Claims,
+		challenge authservice.StepUpChallenge,
+		acr string,
+	) (string, jwt.Claims, error)
+	CheckAuthentication(
+		claims jwt.Claims,
+		minACR string,
+		maxAge time.Duration,
+	) error
+	CreateInvitation(
+		ctx context.Context,
+		caller jwt.Claims,
+		email string,
+		role string,
+		orgID int64,
+		orgRole string,
+	) (models.Invitation, string, error)
+	Invitations(
+		ctx context.Context,
+		caller jwt.Claims,
+	) ([]models.Invitation, error)
+	RevokeInvitation(
+		ctx context.Context,
+		caller jwt.Claims,
+		invitationID string,
+	) error
+	CreateOrg(
+		ctx context.Context,
+		caller jwt.Claims,
+		name string,
+		ownerID int64,
+	) (models.Org, error)
+	OrgMembers(
+		ctx context.Context,
+		caller jwt.Claims,
+		orgID int64,
+	) ([]models.OrgMember, error)
+	Profile(
+		ctx context.Context,
+		caller jwt.Claims,
+		userID int64,
+	) (models.User, error)
+	UpdateProfile(
+		ctx context.Context,
+		caller jwt.Claims,
+		userID int64,
+		update models.Profile,
+		fields []string,
+	) (models.User, error)
+	StartPhoneVerification(ctx context.Context, caller jwt.Claims) (models.PhoneCode, error)
+	ConfirmPhoneVerification(
+		ctx context.Context,
+		caller jwt.Claims,
+		codeID string,
+		code string,
+	) (models.User, error)
+	StartSMSChallenge(ctx context.Context, caller jwt.Claims) (models.PhoneCode, error)
+}
+
+// OAuth is the part of the OAuth service exposed over gRPC.
+type OAuth interface {
+	AuthenticateClient(
+		ctx context.Context,
+		creds oauthservice.ClientCredentials,
+	) (models.OAuthClient, error)
+	ClientCredentialsGrant(
+		ctx context.Context,
+		client models.OAuthClient,
+		scope string,
+		audience string,
+	) (oauthservice.TokenResponse, error)
+	VerifyClientToken(
+		ctx context.Context,
+		token string,
+	) (jwt.Claims, error)
+	ExchangeToken(
+		ctx context.Context,
+		client models.OAuthClient,
+		req oauthservice.TokenExchangeRequest,
+	) (oauthservice.TokenResponse, error)
+	CreateClient(
+		ctx context.Context,
+		caller jwt.Claims,
+		metadata models.OAuthClient,
+	) (oauthservice.ClientRegistration, error)
+	Client(
+		ctx context.Context,
+		caller jwt.Claims,
+		clientID string,
+	) (models.OAuthClient, error)
+	Clients(
+		ctx context.Context,
+		caller jwt.Claims,
+	) ([]models.OAuthClient, error)
+	UpdateClient(
+		ctx context.Context,
+		caller jwt.Claims,
+		metadata models.OAuthClient,
+	) (oauthservice.ClientRegistration, error)
+	RotateClientSecret(
+		ctx context.Context,
+		caller jwt.Claims,
+		clientID string,
+	) (string, error)
+	DeleteClient(
+		ctx context.Context,
+		caller jwt.Claims,
+		clientID string,
+	) error
+	Grants(
+		ctx context.Context,
+		caller jwt.Claims,
+	) ([]models.OAuthGrant, error)
+	RevokeGrant(
+		ctx context.Context,
+		caller jwt.Claims,
+		clientID string,
+	) error
+}
+
+// Upstream is the part of the upstream login service exposed over gRPC.
+type Upstream interface {
+	StartLink(
+		ctx context.Context,
+		caller jwt.Claims,
+		providerID string,
+	) (string, error)
+}
+
+// SAML is the part of the SAML service exposed over gRPC.
+type SAML interface {
+	CreateServiceProvider(
+		ctx context.Context,
+		caller jwt.Claims,
+		sp models.SAMLServiceProvider,
+	) (models.SAMLServiceProvider, error)
+	ServiceProvider(
+		ctx context.Context,
+		caller jwt.Claims,
+		entityID string,
+	) (models.SAMLServiceProvider, error)
+	ServiceProviders(
+		ctx context.Context,
+		caller jwt.Claims,
+	) ([]models.SAMLServiceProvider, error)
+	UpdateServiceProvider(
+		ctx context.Context,
+		caller jwt.Claims,
+		sp models.SAMLServiceProvider,
+	) (models.SAMLServiceProvider, error)
+	DeleteServiceProvider(
+		ctx context.Context,
+		caller jwt.Claims,
+		entityID string,
+	) error
 }
 
 type serverAPI struct {
 	ssov1.UnimplementedAuthServer
-	auth Auth
+	auth     Auth
+	oauth    OAuth
+	upstream Upstream
+	saml     SAML
+	// trustedProxies are the proxies whose x-forwarded-for is believed.
+	trustedProxies *clientip.Proxies
 }
 
-func Register(gRPC *grpc.Server, auth Auth) {
+func Register(
+	gRPC *grpc.Server,
+	auth Auth,
+	oauth OAuth,
+	upstream Upstream,
+	saml SAML,
+	trustedProxies *clientip.Proxies,
+) {
 	ssov1.RegisterAuthServer(
 		gRPC,
-		&serverAPI{auth: auth},
+		&serverAPI{
+			auth:           auth,
+			oauth:          oauth,
+			upstream:       upstream,
+			saml:           saml,
+			trustedProxies: trustedProxies,
+		},
 	)
 }
 
@@ -50,19 +367,14 @@ func (s *serverAPI) Login(
 		return nil, err
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return nil, status.Error(codes.InvalidArgument, "JWT_SECRET environment variable is not set")
-	}
-
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), jwtSecret)
+	tokens, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), reqctx.Client(ctx, s.trustedProxies))
 	if err != nil {
-		fmt.Println(err)
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, toStatus(err)
 	}
 
 	return &ssov1.LoginResponse{
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
@@ -74,9 +386,14 @@ func (s *serverAPI) Register(
 		return nil, err
 	}
 
-	userID, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword())
+	userID, err := s.auth.RegisterNewUser(
+		ctx,
+		req.GetEmail(),
+		req.GetPassword(),
+		req.GetInvitationCode(),
+	)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, toStatus(err)
 	}
 
 	return &ssov1.RegisterResponse{
@@ -110,9 +427,249 @@ func (s *serverAPI) Logout(
 		return nil, err
 	}
 
-	// TODO: implement logout logic
+	if err := s.auth.Logout(ctx, req.GetToken()); err != nil {
+		return nil, toStatus(err)
+	}
 
 	return &ssov1.LogoutResponse{
 		Success: true,
 	}, nil
 }
+
+func (s *serverAPI) RefreshToken(
+	ctx context.Context,
+	req *ssov1.RefreshTokenRequest,
+) (*ssov1.RefreshTokenResponse, error) {
+	if err := validator.ValidateRefreshTokenRequest(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.Refresh(ctx, req.GetRefreshToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.RefreshTokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+func (s *serverAPI) ValidateToken(
+	ctx context.Context,
+	req *ssov1.ValidateTokenRequest,
+) (*ssov1.ValidateTokenResponse, error) {
+	if err := validator.ValidateValidateTokenRequest(req); err != nil {
+		return nil, err
+	}
+
+	var (
+		claims jwt.Claims
+		err    error
+	)
+	if strings.HasPrefix(req.GetToken(), models.APIKeyPrefix) {
+		// API keys stand in for tokens of their user with the scopes of
+		// the key, so that services check both the same way.
+		claims, err = s.auth.VerifyAPIKey(ctx, req.GetToken())
+	} else {
+		claims, err = s.auth.VerifyToken(ctx, req.GetToken())
+		if err != nil {
+			// Tokens services obtained for themselves have no user or session.
+			clientClaims, clientErr := s.oauth.VerifyClientToken(ctx, req.GetToken())
+			if clientErr == nil {
+				claims, err = clientClaims, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	// Services demand recent or stronger authentication for sensitive
+	// actions; the caller then has to step up.
+	if err := s.auth.CheckAuthentication(
+		claims,
+		req.GetMinAcr(),
+		time.Duration(req.GetMaxAge())*time.Second,
+	); err != nil {
+		return nil, toStatus(err)
+	}
+
+	res := &ssov1.ValidateTokenResponse{
+		UserId:    claims.UserID,
+		Email:     claims.Email,
+		SessionId: claims.SessionID,
+		ClientId:  claims.ClientID,
+		Scope:     claims.Scope,
+		Audience:  claims.Audience,
+		ApiKeyId:  claims.APIKeyID,
+		// Services tell people from automation by the principal type
+		// rather than by the absence of an email.
+		PrincipalType: string(claims.PrincipalType),
+	}
+	if claims.Actor != nil {
+		res.ActorSubject = claims.Actor.Subject
+	}
+	if !claims.AuthTime.IsZero() {
+		res.Acr = claims.ACR
+		res.Amr = claims.AMR
+		res.AuthTime = timestamppb.New(claims.AuthTime)
+	}
+
+	return res, nil
+}
+
+// authenticate verifies the bearer token of an incoming call and returns the
+// claims of its caller. Only first-party session tokens are accepted: API
+// keys are not, so that a leaked key cannot be used to create more keys or
+// change the account, and neither are tokens issued to OAuth clients or by
+// token exchanges.
+func (s *serverAPI) authenticate(ctx context.Context) (jwt.Claims, error) {
+	token, err := reqctx.BearerToken(ctx)
+	if err != nil {
+		return jwt.Claims{}, err
+	}
+
+	claims, err := s.auth.VerifySessionToken(ctx, token)
+	if err != nil {
+		return jwt.Claims{}, toStatus(err)
+	}
+
+	return claims, nil
+}
+
+// toStatus maps service and storage errors onto gRPC status errors.
+func toStatus(err error) error {
+	var policyErr *authservice.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return validator.FieldViolationsError(policyErr.Violations)
+	}
+
+	var oauthErr *oauthservice.Error
+	if errors.As(err, &oauthErr) {
+		return oauthStatus(oauthErr)
+	}
+
+	var spErr *samlservice.InvalidServiceProviderError
+	if errors.As(err, &spErr) {
+		return status.Error(codes.InvalidArgument, spErr.Error())
+	}
+
+	switch {
+	case errors.Is(err, authservice.ErrInvalidToken),
+		errors.Is(err, oauthservice.ErrInvalidClientToken):
+		return status.Error(codes.Unauthenticated, "invalid or expired token")
+	case errors.Is(err, authservice.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "permission denied")
+	case errors.Is(err, authservice.ErrAccountDisabled):
+		return status.Error(codes.PermissionDenied, "account is disabled")
+	case errors.Is(err, authservice.ErrAccountLocked):
+		return status.Error(codes.PermissionDenied, "account is locked")
+	case errors.Is(err, authservice.ErrAccountNotVerified):
+		return status.Error(codes.FailedPrecondition, "account is pending verification")
+	case errors.Is(err, authservice.ErrAccountDeleted):
+		return status.Error(codes.PermissionDenied, "account is deleted")
+	case errors.Is(err, authservice.ErrInvalidStatus):
+		return status.Error(codes.InvalidArgument, "invalid account status")
+	case errors.Is(err, authservice.ErrPasswordExpired):
+		return status.Error(codes.FailedPrecondition, "password expired, it must be changed")
+	case errors.Is(err, storage.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "invalid email or password")
+	case errors.Is(err, validator.ErrInvalidEmail):
+		return status.Error(codes.InvalidArgument, "invalid email address")
+	case errors.Is(err, storage.ErrUserExists):
+		return status.Error(codes.AlreadyExists, "user already exists")
+	case errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, storage.ErrSessionNotFound):
+		return status.Error(codes.NotFound, "session not found")
+	case errors.Is(err, storage.ErrClientNotFound):
+		return status.Error(codes.NotFound, "client not found")
+	case errors.Is(err, storage.ErrClientExists):
+		return status.Error(codes.AlreadyExists, "client already exists")
+	case errors.Is(err, storage.ErrGrantNotFound):
+		return status.Error(codes.NotFound, "grant not found")
+	case errors.Is(err, storage.ErrIdentityNotFound):
+		return status.Error(codes.NotFound, "identity not found")
+	case errors.Is(err, storage.ErrIdentityExists):
+		return status.Error(codes.AlreadyExists, "identity is linked to another account")
+	case errors.Is(err, authservice.ErrEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, "email not verified by identity provider")
+	case errors.Is(err, authservice.ErrLastLoginMethod):
+		return status.Error(codes.FailedPrecondition, "cannot remove the last login method")
+	case errors.Is(err, upstream.ErrUnknownProvider):
+		return status.Error(codes.NotFound, "identity provider not found")
+	case errors.Is(err, storage.ErrServiceProviderNotFound):
+		return status.Error(codes.NotFound, "service provider not found")
+	case errors.Is(err, storage.ErrServiceProviderExists):
+		return status.Error(codes.AlreadyExists, "service provider already exists")
+	case errors.Is(err, storage.ErrAPIKeyNotFound):
+		return status.Error(codes.NotFound, "api key not found")
+	case errors.Is(err, authservice.ErrInvalidExpiry):
+		return status.Error(codes.InvalidArgument, "expiry must be in the future")
+	case errors.Is(err, authservice.ErrScopeNotAllowed):
+		return status.Error(codes.InvalidArgument, "scope not allowed")
+	case errors.Is(err, storage.ErrServiceAccountNotFound):
+		return status.Error(codes.NotFound, "service account not found")
+	case errors.Is(err, authservice.ErrInvalidOwner):
+		return status.Error(codes.InvalidArgument, "service accounts must be owned by a user")
+	case errors.Is(err, authservice.ErrUnknownRole):
+		return status.Error(codes.InvalidArgument, "unknown role")
+	case errors.Is(err, validator.ErrInvalidPhone):
+		return status.Error(codes.InvalidArgument, "invalid phone number")
+	case errors.Is(err, authservice.ErrSMSDisabled):
+		return status.Error(codes.FailedPrecondition, "sms is not configured")
+	case errors.Is(err, authservice.ErrPhoneMissing):
+		return status.Error(codes.FailedPrecondition, "no phone number on profile")
+	case errors.Is(err, authservice.ErrPhoneNotVerified):
+		return status.Error(codes.FailedPrecondition, "phone number is not verified")
+	case errors.Is(err, authservice.ErrPhoneAlreadyVerified):
+		return status.Error(codes.FailedPrecondition, "phone number is already verified")
+	case errors.Is(err, authservice.ErrInvalidPhoneCode):
+		return status.Error(codes.Unauthenticated, "invalid or expired phone code")
+	case errors.Is(err, authservice.ErrPhoneCodeThrottled):
+		return status.Error(codes.ResourceExhausted, "too many codes sent to this phone number, try again later")
+	case errors.Is(err, storage.ErrPhoneTaken):
+		return status.Error(codes.AlreadyExists, "phone number is verified by another account")
+	case errors.Is(err, authservice.ErrUnknownProfileField):
+		return status.Error(codes.InvalidArgument, "unknown profile field in update mask")
+	case errors.Is(err, authservice.ErrEmailLoginDisabled):
+		return status.Error(codes.FailedPrecondition, "email login is disabled")
+	case errors.Is(err, authservice.ErrInvalidEmailLogin):
+		return status.Error(codes.Unauthenticated, "invalid or expired login code")
+	case errors.Is(err, authservice.ErrEmailLoginThrottled):
+		return status.Error(codes.ResourceExhausted, "email login requested too often, try again later")
+	case errors.Is(err, authservice.ErrStepUpRequired):
+		return status.Error(codes.PermissionDenied, "step-up authentication required")
+	case errors.Is(err, authservice.ErrUnknownACR):
+		return status.Error(codes.InvalidArgument, "unknown authentication context class")
+	case errors.Is(err, authservice.ErrRegistrationClosed):
+		return status.Error(codes.FailedPrecondition, "registration is closed")
+	case errors.Is(err, authservice.ErrInvitationRequired):
+		return status.Error(codes.PermissionDenied, "an invitation is required to register")
+	case errors.Is(err, authservice.ErrInvalidInvitation):
+		return status.Error(codes.PermissionDenied, "invalid or expired invitation")
+	case errors.Is(err, storage.ErrInvitationNotFound):
+		return status.Error(codes.NotFound, "invitation not found")
+	case errors.Is(err, storage.ErrOrgNotFound):
+		return status.Error(codes.NotFound, "organization not found")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// oauthStatus maps OAuth error responses onto gRPC status errors.
+func oauthStatus(err *oauthservice.Error) error {
+	message := err.Error()
+
+	switch err.Code {
+	case oauthservice.InvalidClient, oauthservice.InvalidToken:
+		return status.Error(codes.Unauthenticated, message)
+	case oauthservice.UnauthorizedClient, oauthservice.AccessDenied, oauthservice.InsufficientScope:
+		return status.Error(codes.PermissionDenied, message)
+	case oauthservice.ServerError:
+		return status.Error(codes.Internal, "internal error")
+	default:
+		return status.Error(codes.InvalidArgument, message)
+	}
+}
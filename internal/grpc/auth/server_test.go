@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	authservice "github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{authservice.ErrEmailNotVerified, codes.FailedPrecondition},
+		{fmt.Errorf("auth.Login: %w", authservice.ErrEmailNotVerified), codes.FailedPrecondition},
+		{storage.ErrInvalidCredentials, codes.Unauthenticated},
+		{authservice.ErrPermissionDenied, codes.PermissionDenied},
+		{storage.ErrUserNotFound, codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := status.Code(toStatus(tt.err)); got != tt.want {
+				t.Errorf("code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) CreateServiceAccount(
+	ctx context.Context,
+	req *ssov1.CreateServiceAccountRequest,
+) (*ssov1.CreateServiceAccountResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateCreateServiceAccountRequest(req); err != nil {
+		return nil, err
+	}
+
+	account, err := s.auth.CreateServiceAccount(
+		ctx,
+		caller,
+		req.GetName(),
+		req.GetDescription(),
+		req.GetOwnerId(),
+	)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CreateServiceAccountResponse{
+		ServiceAccount: toServiceAccountProto(account),
+	}, nil
+}
+
+func (s *serverAPI) GetServiceAccount(
+	ctx context.Context,
+	req *ssov1.GetServiceAccountRequest,
+) (*ssov1.GetServiceAccountResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateGetServiceAccountRequest(req); err != nil {
+		return nil, err
+	}
+
+	account, err := s.auth.ServiceAccount(ctx, caller, req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.GetServiceAccountResponse{
+		ServiceAccount: toServiceAccountProto(account),
+	}, nil
+}
+
+func (s *serverAPI) ListServiceAccounts(
+	ctx context.Context,
+	req *ssov1.ListServiceAccountsRequest,
+) (*ssov1.ListServiceAccountsResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateListServiceAccountsRequest(req); err != nil {
+		return nil, err
+	}
+
+	accounts, err := s.auth.ServiceAccounts(ctx, caller, req.GetOwnerId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListServiceAccountsResponse{
+		ServiceAccounts: make([]*ssov1.ServiceAccount, 0, len(accounts)),
+	}
+	for _, account := range accounts {
+		resp.ServiceAccounts = append(resp.ServiceAccounts, toServiceAccountProto(account))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) DeleteServiceAccount(
+	ctx context.Context,
+	req *ssov1.DeleteServiceAccountRequest,
+) (*ssov1.DeleteServiceAccountResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateDeleteServiceAccountRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.DeleteServiceAccount(ctx, caller, req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.DeleteServiceAccountResponse{
+		Success: true,
+	}, nil
+}
+
+func (s *serverAPI) SetServiceAccountRoles(
+	ctx context.Context,
+	req *ssov1.SetServiceAccountRolesRequest,
+) (*ssov1.SetServiceAccountRolesResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateSetServiceAccountRolesRequest(req); err != nil {
+		return nil, err
+	}
+
+	account, err := s.auth.SetServiceAccountRoles(ctx, caller, req.GetId(), req.GetRoles())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.SetServiceAccountRolesResponse{
+		ServiceAccount: toServiceAccountProto(account),
+	}, nil
+}
+
+func toServiceAccountProto(account models.ServiceAccount) *ssov1.ServiceAccount {
+	return &ssov1.ServiceAccount{
+		Id:            account.ID,
+		Name:          account.Name,
+		Description:   account.Description,
+		OwnerId:       account.OwnerID,
+		Roles:         account.Roles,
+		Status:        string(account.Status),
+		PrincipalType: string(models.PrincipalServiceAccount),
+		CreatedAt:     timestamppb.New(account.CreatedAt),
+	}
+}
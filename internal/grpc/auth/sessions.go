@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) ListSessions(
+	ctx context.Context,
+	req *ssov1.ListSessionsRequest,
+) (*ssov1.ListSessionsResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateListSessionsRequest(req); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.auth.ListSessions(ctx, caller, req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListSessionsResponse{
+		Sessions: make([]*ssov1.Session, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, toSessionProto(session, caller.SessionID))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeSession(
+	ctx context.Context,
+	req *ssov1.RevokeSessionRequest,
+) (*ssov1.RevokeSessionResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateRevokeSessionRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeSession(ctx, caller, req.GetSessionId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.RevokeSessionResponse{
+		Success: true,
+	}, nil
+}
+
+func (s *serverAPI) RevokeAllOtherSessions(
+	ctx context.Context,
+	req *ssov1.RevokeAllOtherSessionsRequest,
+) (*ssov1.RevokeAllOtherSessionsResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateRevokeAllOtherSessionsRequest(req); err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.auth.RevokeAllOtherSessions(ctx, caller, req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.RevokeAllOtherSessionsResponse{
+		RevokedCount: revoked,
+	}, nil
+}
+
+func toSessionProto(session models.Session, currentSessionID string) *ssov1.Session {
+	return &ssov1.Session{
+		Id:         session.ID,
+		Device:     session.Device,
+		Ip:         session.IP,
+		UserAgent:  session.UserAgent,
+		CreatedAt:  timestamppb.New(session.CreatedAt),
+		LastSeenAt: timestamppb.New(session.LastSeenAt),
+		Current:    session.ID == currentSessionID,
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+
+	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
+	authservice "github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) StepUp(
+	ctx context.Context,
+	req *ssov1.StepUpRequest,
+) (*ssov1.StepUpResponse, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.ValidateStepUpRequest(req); err != nil {
+		return nil, err
+	}
+
+	token, claims, err := s.auth.StepUp(ctx, caller, authservice.StepUpChallenge{
+		Password:     req.GetPassword(),
+		EmailLoginID: req.GetEmailLoginId(),
+		EmailCode:    req.GetEmailCode(),
+		SMSCodeID:    req.GetSmsChallengeId(),
+		SMSCode:      req.GetSmsCode(),
+	}, req.GetAcr())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.StepUpResponse{
+		Token:     token,
+		ExpiresAt: timestamppb.New(claims.ExpiresAt),
+		Acr:       claims.ACR,
+		Amr:       claims.AMR,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package reqctx
+
+import (
+	"context"
+	"strings"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/clientip"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationHeader = "authorization"
+	deviceHeader        = "x-device-name"
+	userAgentHeader     = "user-agent"
+	forwardedForHeader  = "x-forwarded-for"
+)
+
+// BearerToken extracts the token from the "authorization: Bearer <token>"
+// metadata of an incoming call.
+func BearerToken(ctx context.Context) (string, error) {
+	value := first(ctx, authorizationHeader)
+
+	scheme, token, ok := strings.Cut(value, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	return token, nil
+}
+
+// Client describes the client behind an incoming call from its metadata and
+// peer address. The x-forwarded-for metadata is only believed when the peer
+// is one of the trusted proxies.
+func Client(ctx context.Context, trustedProxies *clientip.Proxies) models.ClientInfo {
+	client := models.ClientInfo{
+		Device:    first(ctx, deviceHeader),
+		UserAgent: first(ctx, userAgentHeader),
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		var forwarded []string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			forwarded = md.Get(forwardedForHeader)
+		}
+		client.IP = trustedProxies.ClientIP(p.Addr.String(), forwarded)
+	}
+
+	return client
+}
+
+func first(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
@@ -0,0 +1,362 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	authservice "github.com/VariableSan/gia-sso/internal/services/auth"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+type loginPage struct {
+	ClientName string
+	// Action is where the form is posted to, with the hidden fields of
+	// either Request or SAML.
+	Action    string
+	Request   oauthservice.AuthorizeRequest
+	SAML      *samlLoginForm
+	Email     string
+	Error     string
+	CSRFToken string
+	Upstreams []upstreamLink
+}
+
+// Authorize handles GET /authorize. Users with a browser session are sent
+// straight back to the client with a code, unless the client asked for a
+// fresh login through prompt or max_age or needs their consent. Everyone
+// else gets the login page.
+func (s *serverAPI) Authorize(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequest(r.URL.Query())
+
+	client, ok := s.checkAuthorizeRequest(w, r, req)
+	if !ok {
+		return
+	}
+
+	var current *models.Session
+	if session, ok := s.browserSession(r); ok {
+		current = &session
+	}
+
+	reuse, err := s.oauth.ReuseSession(req, current)
+	if err != nil {
+		s.redirectError(w, r, req, err)
+		return
+	}
+
+	if reuse {
+		s.authorize(w, r, client, req, *current)
+		return
+	}
+
+	s.renderLogin(w, http.StatusOK, client, req, "", "")
+}
+
+// Login handles the login form posted from the page rendered by Authorize.
+func (s *serverAPI) Login(w http.ResponseWriter, r *http.Request) {
+	const operation = "http.oauth.Login"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+	)
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request could not be read.")
+		return
+	}
+
+	req := authorizeRequest(r.PostForm)
+
+	client, ok := s.checkAuthorizeRequest(w, r, req)
+	if !ok {
+		return
+	}
+
+	email := r.PostForm.Get("email")
+
+	if !s.validCSRFToken(r) {
+		log.Warn("invalid csrf token")
+		s.renderLogin(w, http.StatusForbidden, client, req, email, "Your session has expired, please try again.")
+		return
+	}
+
+	session, err := s.signIn(w, r, email, r.PostForm.Get("password"))
+	if err != nil {
+		message, status := loginErrorMessage(err)
+		if status == http.StatusInternalServerError {
+			log.Error("failed to login", slog.String("error", err.Error()))
+			s.renderError(w, status, message)
+			return
+		}
+
+		s.renderLogin(w, status, client, req, email, message)
+		return
+	}
+
+	s.authorize(w, r, client, req, session)
+}
+
+// signIn logs a user in and keeps the new browser session in a cookie.
+func (s *serverAPI) signIn(
+	w http.ResponseWriter,
+	r *http.Request,
+	email string,
+	password string,
+) (models.Session, error) {
+	tokens, err := s.auth.Login(r.Context(), email, password, s.clientInfo(r))
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	return s.setSessionCookie(w, r, tokens)
+}
+
+// setSessionCookie turns the session tokens were issued for into a browser
+// session and keeps it in a cookie. The tokens themselves are dropped.
+func (s *serverAPI) setSessionCookie(
+	w http.ResponseWriter,
+	r *http.Request,
+	tokens models.TokenPair,
+) (models.Session, error) {
+	cookie, session, err := s.auth.StartBrowserSession(r.Context(), tokens)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    cookie,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		Secure:   s.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return session, nil
+}
+
+func authorizeRequest(values url.Values) oauthservice.AuthorizeRequest {
+	return oauthservice.AuthorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Nonce:               values.Get("nonce"),
+		Prompt:              values.Get("prompt"),
+		MaxAge:              values.Get("max_age"),
+	}
+}
+
+// authorizeParams turns req back into the parameters of an authorization
+// request, leaving out empty ones.
+func authorizeParams(req oauthservice.AuthorizeRequest) url.Values {
+	params := url.Values{}
+	for key, value := range map[string]string{
+		"response_type":         req.ResponseType,
+		"client_id":             req.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+		"nonce":                 req.Nonce,
+		"prompt":                req.Prompt,
+		"max_age":               req.MaxAge,
+	} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+
+	return params
+}
+
+// checkAuthorizeRequest validates req and answers it with an error when it
+// is invalid. Errors are only redirected back to the client once its
+// redirect URI has been verified.
+func (s *serverAPI) checkAuthorizeRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	req oauthservice.AuthorizeRequest,
+) (models.OAuthClient, bool) {
+	client, err := s.oauth.CheckAuthorizeRequest(r.Context(), req)
+	if err == nil {
+		return client, true
+	}
+
+	var oauthErr *oauthservice.Error
+	switch {
+	case errors.As(err, &oauthErr):
+		s.redirectError(w, r, req, oauthErr)
+	case errors.Is(err, oauthservice.ErrUnknownClient):
+		s.renderError(w, http.StatusBadRequest, "The application that sent you here is not registered.")
+	case errors.Is(err, oauthservice.ErrInvalidRedirectURI):
+		s.renderError(w, http.StatusBadRequest, "The application that sent you here used an unregistered redirect address.")
+	default:
+		s.log.Error("failed to check authorization request", slog.String("error", err.Error()))
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+	}
+
+	return models.OAuthClient{}, false
+}
+
+// redirectError sends an OAuth error back to the verified redirect URI of
+// req.
+func (s *serverAPI) redirectError(
+	w http.ResponseWriter,
+	r *http.Request,
+	req oauthservice.AuthorizeRequest,
+	err error,
+) {
+	var oauthErr *oauthservice.Error
+	if !errors.As(err, &oauthErr) {
+		s.log.Error("authorization request failed", slog.String("error", err.Error()))
+		oauthErr = &oauthservice.Error{Code: oauthservice.ServerError}
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+		"state":             {req.State},
+	})
+}
+
+func (s *serverAPI) issueCode(
+	w http.ResponseWriter,
+	r *http.Request,
+	req oauthservice.AuthorizeRequest,
+	session models.Session,
+) {
+	code, err := s.oauth.IssueCode(r.Context(), req, session)
+	if err != nil {
+		s.redirectError(w, r, req, err)
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	})
+}
+
+// browserSession returns the session of the signed in user, if any.
+func (s *serverAPI) browserSession(r *http.Request) (models.Session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return models.Session{}, false
+	}
+
+	session, err := s.auth.BrowserSession(r.Context(), cookie.Value)
+	if err != nil {
+		return models.Session{}, false
+	}
+
+	return session, true
+}
+
+func (s *serverAPI) renderLogin(
+	w http.ResponseWriter,
+	status int,
+	client models.OAuthClient,
+	req oauthservice.AuthorizeRequest,
+	email string,
+	message string,
+) {
+	csrfToken, err := s.newCSRFToken(w, "/authorize")
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	s.render(w, status, "login.html", loginPage{
+		ClientName: client.Name,
+		Action:     "/authorize",
+		Request:    req,
+		Email:      email,
+		Error:      message,
+		CSRFToken:  csrfToken,
+		Upstreams:  s.upstreamLinks(authorizeParams(req)),
+	})
+}
+
+// newCSRFToken sets a CSRF cookie for the forms posted to path and returns
+// the token the forms must repeat.
+func (s *serverAPI) newCSRFToken(w http.ResponseWriter, path string) (string, error) {
+	csrfToken, err := random.Token(32)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     path,
+		MaxAge:   int(time.Hour.Seconds()),
+		Secure:   s.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return csrfToken, nil
+}
+
+// validCSRFToken checks the double-submitted CSRF token of a form.
+func (s *serverAPI) validCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostForm.Get("csrf_token"))) == 1
+}
+
+func loginErrorMessage(err error) (string, int) {
+	switch {
+	case errors.Is(err, storage.ErrInvalidCredentials):
+		return "Invalid email or password.", http.StatusUnauthorized
+	case errors.Is(err, authservice.ErrPasswordExpired):
+		return "Your password has expired. Change it and sign in again.", http.StatusForbidden
+	case errors.Is(err, authservice.ErrAccountNotVerified):
+		return "Your account has not been verified yet.", http.StatusForbidden
+	case errors.Is(err, authservice.ErrAccountDisabled),
+		errors.Is(err, authservice.ErrAccountLocked),
+		errors.Is(err, authservice.ErrAccountDeleted),
+		errors.Is(err, authservice.ErrInvalidStatus):
+		return "This account cannot sign in.", http.StatusForbidden
+	default:
+		return "Something went wrong, please try again.", http.StatusInternalServerError
+	}
+}
+
+// redirect sends the browser to uri with params added to its query. Empty
+// params are left out.
+func redirect(w http.ResponseWriter, r *http.Request, uri string, params url.Values) {
+	target, err := url.Parse(uri)
+	if err != nil {
+		http.Error(w, "invalid redirect uri", http.StatusBadRequest)
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		for _, value := range values {
+			if value != "" {
+				query.Add(key, value)
+			}
+		}
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
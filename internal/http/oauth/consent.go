@@ -0,0 +1,97 @@
+package oauth
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+)
+
+type consentPage struct {
+	ClientName string
+	Request    oauthservice.AuthorizeRequest
+	Scopes     []string
+	CSRFToken  string
+}
+
+// Consent handles POST /authorize/consent, the user's answer to the consent
+// page rendered by authorize.
+func (s *serverAPI) Consent(w http.ResponseWriter, r *http.Request) {
+	const operation = "http.oauth.Consent"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+	)
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request could not be read.")
+		return
+	}
+
+	req := authorizeRequest(r.PostForm)
+
+	client, ok := s.checkAuthorizeRequest(w, r, req)
+	if !ok {
+		return
+	}
+
+	session, signedIn := s.browserSession(r)
+	if !signedIn || !s.validCSRFToken(r) {
+		log.Warn("consent without session or csrf token")
+		s.renderLogin(w, http.StatusForbidden, client, req, "", "Your session has expired, please try again.")
+		return
+	}
+
+	if r.PostForm.Get("decision") != "approve" {
+		log.Info("consent denied", slog.String("client_id", client.ID), slog.Int64("user_id", session.UserID))
+		s.redirectError(w, r, req, &oauthservice.Error{
+			Code:        oauthservice.AccessDenied,
+			Description: "the user denied the request",
+		})
+		return
+	}
+
+	if err := s.oauth.GrantConsent(r.Context(), req, session); err != nil {
+		s.redirectError(w, r, req, err)
+		return
+	}
+
+	s.issueCode(w, r, req, session)
+}
+
+// authorize answers an authorization request the user of session has
+// authenticated for, asking for their consent first if the client needs
+// it.
+func (s *serverAPI) authorize(
+	w http.ResponseWriter,
+	r *http.Request,
+	client models.OAuthClient,
+	req oauthservice.AuthorizeRequest,
+	session models.Session,
+) {
+	needsConsent, err := s.oauth.NeedsConsent(r.Context(), client, req, session)
+	if err != nil {
+		s.redirectError(w, r, req, err)
+		return
+	}
+
+	if !needsConsent {
+		s.issueCode(w, r, req, session)
+		return
+	}
+
+	csrfToken, err := s.newCSRFToken(w, "/authorize")
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	s.render(w, http.StatusOK, "consent.html", consentPage{
+		ClientName: client.Name,
+		Request:    req,
+		Scopes:     strings.Fields(req.Scope),
+		CSRFToken:  csrfToken,
+	})
+}
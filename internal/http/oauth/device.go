@@ -0,0 +1,224 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+)
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+type devicePage struct {
+	UserCode  string
+	SignedIn  bool
+	Email     string
+	Error     string
+	CSRFToken string
+}
+
+type deviceConfirmPage struct {
+	ClientName string
+	UserCode   string
+	Scopes     []string
+	CSRFToken  string
+}
+
+type deviceDonePage struct {
+	ClientName string
+	Approved   bool
+}
+
+// DeviceAuthorization handles POST /device_authorization, where devices
+// without a browser start the device authorization grant.
+func (s *serverAPI) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.writeTokenError(w, r, &oauthservice.Error{
+			Code:        oauthservice.InvalidRequest,
+			Description: "malformed request body",
+		})
+		return
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		s.writeTokenError(w, r, err)
+		return
+	}
+
+	res, err := s.oauth.AuthorizeDevice(r.Context(), client, r.PostForm.Get("scope"))
+	if err != nil {
+		s.writeTokenError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deviceAuthorizationResponse{
+		DeviceCode:              res.DeviceCode,
+		UserCode:                res.UserCode,
+		VerificationURI:         res.VerificationURI,
+		VerificationURIComplete: res.VerificationURIComplete,
+		ExpiresIn:               int64(res.ExpiresIn.Seconds()),
+		Interval:                int64(res.Interval.Seconds()),
+	})
+}
+
+// Device handles GET /device, the verification page users enter the code
+// shown by their device on.
+func (s *serverAPI) Device(w http.ResponseWriter, r *http.Request) {
+	_, signedIn := s.browserSession(r)
+
+	s.renderDevice(w, http.StatusOK, devicePage{
+		UserCode: r.URL.Query().Get("user_code"),
+		SignedIn: signedIn,
+	})
+}
+
+// VerifyDevice handles the form of the verification page. Users that are
+// not signed in yet log in with the same form. The request of the device is
+// then shown for the user to approve.
+func (s *serverAPI) VerifyDevice(w http.ResponseWriter, r *http.Request) {
+	const operation = "http.oauth.VerifyDevice"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+	)
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request could not be read.")
+		return
+	}
+
+	_, signedIn := s.browserSession(r)
+	page := devicePage{
+		UserCode: r.PostForm.Get("user_code"),
+		SignedIn: signedIn,
+		Email:    r.PostForm.Get("email"),
+	}
+
+	if !s.validCSRFToken(r) {
+		log.Warn("invalid csrf token")
+		page.Error = "Your session has expired, please try again."
+		s.renderDevice(w, http.StatusForbidden, page)
+		return
+	}
+
+	code, client, err := s.oauth.DeviceRequest(r.Context(), page.UserCode)
+	if err != nil {
+		if errors.Is(err, oauthservice.ErrInvalidUserCode) {
+			page.Error = "This code is invalid or has expired. Check the code on your device and try again."
+			s.renderDevice(w, http.StatusBadRequest, page)
+			return
+		}
+
+		log.Error("failed to get device request", slog.String("error", err.Error()))
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	if !signedIn {
+		if _, err := s.signIn(w, r, page.Email, r.PostForm.Get("password")); err != nil {
+			message, status := loginErrorMessage(err)
+			if status == http.StatusInternalServerError {
+				log.Error("failed to login", slog.String("error", err.Error()))
+				s.renderError(w, status, message)
+				return
+			}
+
+			page.Error = message
+			s.renderDevice(w, status, page)
+			return
+		}
+	}
+
+	s.renderDeviceConfirm(w, client, code)
+}
+
+// ConfirmDevice handles the approval or denial of a device request.
+func (s *serverAPI) ConfirmDevice(w http.ResponseWriter, r *http.Request) {
+	const operation = "http.oauth.ConfirmDevice"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+	)
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request could not be read.")
+		return
+	}
+
+	session, signedIn := s.browserSession(r)
+	if !signedIn || !s.validCSRFToken(r) {
+		log.Warn("device confirmation without session or csrf token")
+		s.renderDevice(w, http.StatusForbidden, devicePage{
+			UserCode: r.PostForm.Get("user_code"),
+			SignedIn: signedIn,
+			Error:    "Your session has expired, please try again.",
+		})
+		return
+	}
+
+	userCode := r.PostForm.Get("user_code")
+
+	approved := r.PostForm.Get("decision") == "approve"
+
+	_, client, err := s.oauth.DeviceRequest(r.Context(), userCode)
+	if err == nil {
+		err = s.oauth.DecideDeviceRequest(r.Context(), userCode, session, approved)
+	}
+
+	switch {
+	case err == nil:
+		s.render(w, http.StatusOK, "device_done.html", deviceDonePage{
+			ClientName: client.Name,
+			Approved:   approved,
+		})
+	case errors.Is(err, oauthservice.ErrInvalidUserCode):
+		s.renderDevice(w, http.StatusBadRequest, devicePage{
+			SignedIn: true,
+			Error:    "This code is invalid or has expired. Check the code on your device and try again.",
+		})
+	default:
+		log.Error("failed to decide device request", slog.String("error", err.Error()))
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+	}
+}
+
+func (s *serverAPI) renderDevice(w http.ResponseWriter, status int, page devicePage) {
+	csrfToken, err := s.newCSRFToken(w, "/device")
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	page.CSRFToken = csrfToken
+	s.render(w, status, "device.html", page)
+}
+
+func (s *serverAPI) renderDeviceConfirm(
+	w http.ResponseWriter,
+	client models.OAuthClient,
+	code models.DeviceCode,
+) {
+	csrfToken, err := s.newCSRFToken(w, "/device")
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	s.render(w, http.StatusOK, "device_confirm.html", deviceConfirmPage{
+		ClientName: client.Name,
+		UserCode:   code.UserCode,
+		Scopes:     strings.Fields(code.Scope),
+		CSRFToken:  csrfToken,
+	})
+}
@@ -0,0 +1,216 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+)
+
+type logoutPage struct {
+	ClientName            string
+	IDTokenHint           string
+	ClientID              string
+	PostLogoutRedirectURI string
+	State                 string
+	CSRFToken             string
+}
+
+type loggedOutPage struct {
+	// FrontchannelURIs are loaded in hidden frames to log the user out of
+	// the clients that registered a front-channel logout URI.
+	FrontchannelURIs []string
+	RedirectURI      string
+}
+
+// EndSession handles GET and POST /logout, the end session endpoint of
+// OpenID Connect RP-Initiated Logout.
+func (s *serverAPI) EndSession(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request could not be read.")
+		return
+	}
+
+	req := endSessionRequest(r.Form)
+
+	end, ok := s.checkEndSessionRequest(w, r, req)
+	if !ok {
+		return
+	}
+
+	session, signedIn := s.browserSession(r)
+	if !signedIn {
+		s.finishLogout(w, r, end, nil)
+		return
+	}
+
+	// A request carrying an ID token of this very session comes from one
+	// of its clients. Any site could send the user here otherwise, so the
+	// user is asked first.
+	if end.SessionID != "" && end.SessionID == session.ID {
+		s.logout(w, r, session, end)
+		return
+	}
+
+	csrfToken, err := s.newCSRFToken(w, "/logout")
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	s.render(w, http.StatusOK, "logout.html", logoutPage{
+		ClientName:            end.Client.Name,
+		IDTokenHint:           req.IDTokenHint,
+		ClientID:              req.ClientID,
+		PostLogoutRedirectURI: req.PostLogoutRedirectURI,
+		State:                 req.State,
+		CSRFToken:             csrfToken,
+	})
+}
+
+// ConfirmLogout handles the form of the logout confirmation page.
+func (s *serverAPI) ConfirmLogout(w http.ResponseWriter, r *http.Request) {
+	const operation = "http.oauth.ConfirmLogout"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+	)
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request could not be read.")
+		return
+	}
+
+	if !s.validCSRFToken(r) {
+		log.Warn("invalid csrf token")
+		s.renderError(w, http.StatusForbidden, "Your session has expired, please try again.")
+		return
+	}
+
+	end, ok := s.checkEndSessionRequest(w, r, endSessionRequest(r.PostForm))
+	if !ok {
+		return
+	}
+
+	session, signedIn := s.browserSession(r)
+	if !signedIn {
+		s.finishLogout(w, r, end, nil)
+		return
+	}
+
+	s.logout(w, r, session, end)
+}
+
+func endSessionRequest(values url.Values) oauthservice.EndSessionRequest {
+	return oauthservice.EndSessionRequest{
+		IDTokenHint:           values.Get("id_token_hint"),
+		ClientID:              values.Get("client_id"),
+		PostLogoutRedirectURI: values.Get("post_logout_redirect_uri"),
+		State:                 values.Get("state"),
+	}
+}
+
+// checkEndSessionRequest validates a logout request and renders an error
+// page if it is invalid.
+func (s *serverAPI) checkEndSessionRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	req oauthservice.EndSessionRequest,
+) (oauthservice.EndSession, bool) {
+	end, err := s.oauth.CheckEndSessionRequest(r.Context(), req)
+	switch {
+	case err == nil:
+		return end, true
+	case errors.Is(err, oauthservice.ErrInvalidIDTokenHint):
+		s.renderError(w, http.StatusBadRequest, "The logout request of the application is invalid.")
+	case errors.Is(err, oauthservice.ErrUnknownClient):
+		s.renderError(w, http.StatusBadRequest, "The application that sent you here is not registered.")
+	case errors.Is(err, oauthservice.ErrInvalidPostLogoutRedirectURI):
+		s.renderError(w, http.StatusBadRequest, "The application asked to send you to an address it did not register.")
+	default:
+		s.log.Error(
+			"failed to check end session request",
+			slog.String("operation", "http.oauth.checkEndSessionRequest"),
+			slog.String("error", err.Error()),
+		)
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+	}
+
+	return oauthservice.EndSession{}, false
+}
+
+// logout ends the browser session and clears its cookie.
+func (s *serverAPI) logout(
+	w http.ResponseWriter,
+	r *http.Request,
+	session models.Session,
+	end oauthservice.EndSession,
+) {
+	uris, err := s.oauth.Logout(r.Context(), session)
+	if err != nil {
+		s.log.Error(
+			"failed to log out",
+			slog.String("operation", "http.oauth.logout"),
+			slog.String("error", err.Error()),
+		)
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   s.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	s.finishLogout(w, r, end, uris)
+}
+
+// finishLogout sends the user back to the client, unless clients are to be
+// logged out in the browser first.
+func (s *serverAPI) finishLogout(
+	w http.ResponseWriter,
+	r *http.Request,
+	end oauthservice.EndSession,
+	frontchannelURIs []string,
+) {
+	if len(frontchannelURIs) == 0 && end.RedirectURI != "" {
+		http.Redirect(w, r, end.RedirectURI, http.StatusFound)
+		return
+	}
+
+	var origins []string
+	for _, uri := range frontchannelURIs {
+		if origin := originOf(uri); origin != "" && !slices.Contains(origins, origin) {
+			origins = append(origins, origin)
+		}
+	}
+
+	policy := contentSecurityPolicy
+	if len(origins) > 0 {
+		policy += "; frame-src " + strings.Join(origins, " ")
+	}
+
+	s.renderWithPolicy(w, http.StatusOK, "logged_out.html", loggedOutPage{
+		FrontchannelURIs: frontchannelURIs,
+		RedirectURI:      end.RedirectURI,
+	}, policy)
+}
+
+func originOf(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host
+}
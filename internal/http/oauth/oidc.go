@@ -0,0 +1,155 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RegistrationEndpoint              string   `json:"registration_endpoint"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgs      []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	PromptValuesSupported             []string `json:"prompt_values_supported"`
+	ACRValuesSupported                []string `json:"acr_values_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	FrontchannelLogoutSupported       bool     `json:"frontchannel_logout_supported"`
+	FrontchannelLogoutSession         bool     `json:"frontchannel_logout_session_supported"`
+	BackchannelLogoutSupported        bool     `json:"backchannel_logout_supported"`
+	BackchannelLogoutSession          bool     `json:"backchannel_logout_session_supported"`
+}
+
+// Discovery handles GET /.well-known/openid-configuration.
+func (s *serverAPI) Discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := strings.TrimSuffix(s.oauth.Issuer(), "/")
+
+	writeJSON(w, http.StatusOK, discoveryDocument{
+		Issuer:                      s.oauth.Issuer(),
+		AuthorizationEndpoint:       issuer + "/authorize",
+		TokenEndpoint:               issuer + "/token",
+		DeviceAuthorizationEndpoint: issuer + "/device_authorization",
+		UserInfoEndpoint:            issuer + "/userinfo",
+		JWKSURI:                     issuer + "/jwks",
+		RegistrationEndpoint:        issuer + "/register",
+		EndSessionEndpoint:          issuer + "/logout",
+		ScopesSupported: []string{
+			oauthservice.ScopeOpenID,
+			oauthservice.ScopeEmail,
+			oauthservice.ScopeProfile,
+			oauthservice.ScopePhone,
+		},
+		ResponseTypesSupported: []string{oauthservice.ResponseTypeCode},
+		ResponseModesSupported: []string{"query"},
+		GrantTypesSupported: []string{
+			oauthservice.GrantTypeAuthorizationCode,
+			oauthservice.GrantTypeRefreshToken,
+			oauthservice.GrantTypeClientCredentials,
+			oauthservice.GrantTypeDeviceCode,
+			oauthservice.GrantTypeTokenExchange,
+		},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{
+			models.AuthMethodSecretBasic,
+			models.AuthMethodSecretPost,
+			models.AuthMethodPrivateKeyJWT,
+			models.AuthMethodNone,
+		},
+		TokenEndpointAuthSigningAlgs:  jwt.AssertionAlgorithms,
+		CodeChallengeMethodsSupported: []string{oauthservice.CodeChallengeMethodS256},
+		PromptValuesSupported: []string{
+			oauthservice.PromptNone,
+			oauthservice.PromptLogin,
+			oauthservice.PromptConsent,
+			oauthservice.PromptSelectAccount,
+		},
+		ACRValuesSupported: models.ACRValues,
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "acr", "amr", "sid",
+			"email", "email_verified", "preferred_username", "name", "given_name", "family_name",
+			"locale", "zoneinfo", "picture", "updated_at", "phone_number", "phone_number_verified",
+		},
+		FrontchannelLogoutSupported: true,
+		FrontchannelLogoutSession:   true,
+		BackchannelLogoutSupported:  true,
+		BackchannelLogoutSession:    true,
+	})
+}
+
+// JWKS handles GET /jwks.
+func (s *serverAPI) JWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.oauth.JWKS())
+}
+
+// UserInfo handles the OpenID Connect UserInfo endpoint. The access token is
+// accepted from the Authorization header only.
+func (s *serverAPI) UserInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: oauthservice.InvalidRequest})
+		return
+	}
+
+	claims, err := s.auth.VerifyToken(r.Context(), token)
+	if err != nil {
+		writeBearerError(w, &oauthservice.Error{Code: oauthservice.InvalidToken})
+		return
+	}
+
+	info, err := s.oauth.UserInfo(r.Context(), claims)
+	if err != nil {
+		writeBearerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+// writeBearerError answers a request with an invalid or insufficient access
+// token as described in RFC 6750 section 3.
+func writeBearerError(w http.ResponseWriter, err error) {
+	var oauthErr *oauthservice.Error
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &oauthservice.Error{Code: oauthservice.InvalidToken}
+	}
+
+	status := http.StatusUnauthorized
+	if oauthErr.Code == oauthservice.InsufficientScope {
+		status = http.StatusForbidden
+	}
+
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="userinfo", error=%q`, oauthErr.Code))
+	writeJSON(w, status, errorResponse{
+		Error:            oauthErr.Code,
+		ErrorDescription: oauthErr.Description,
+	})
+}
@@ -0,0 +1,374 @@
+package oauth_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	oauthhttp "github.com/VariableSan/gia-sso/internal/http/oauth"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+	samlservice "github.com/VariableSan/gia-sso/internal/services/saml"
+	"github.com/VariableSan/gia-sso/internal/services/upstream"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite/sqlitetest"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+const (
+	testClientID    = "test-app"
+	testRedirectURI = "http://app.test/callback"
+	testEmail       = "user@example.com"
+	testPassword    = "correct horse battery"
+)
+
+var csrfField = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// oidcEnv is gia-sso served over HTTP, with a user and a public first-party
+// client registered.
+type oidcEnv struct {
+	srv      *httptest.Server
+	provider *oidc.Provider
+	config   oauth2.Config
+	// browser keeps the session cookie between authorization requests and
+	// does not follow redirects, so that they can be inspected.
+	browser *http.Client
+}
+
+func newOIDCEnv(t *testing.T) oidcEnv {
+	t.Helper()
+
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	storage, err := sqlite.New(sqlitetest.Path(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingKey, err := jwt.LoadOrCreateSigningKey(filepath.Join(t.TempDir(), "signing.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	authService := auth.New(log, storage, auth.Config{
+		JWTSecret:       "secret",
+		TokenTTL:        time.Hour,
+		RefreshTokenTTL: time.Hour,
+		PasswordPolicy: auth.PasswordPolicy{
+			PasswordPolicy: validator.PasswordPolicy{MinLength: 8},
+		},
+	})
+	oauthService := oauthservice.New(log, storage, authService, oauthservice.Config{
+		Issuer:     srv.URL,
+		SigningKey: signingKey,
+		JWTSecret:  "secret",
+		TokenTTL:   time.Hour,
+		CodeTTL:    time.Minute,
+	})
+	upstreamService := upstream.New(log, storage, authService, upstream.Config{
+		CallbackURL: srv.URL + "/upstream/callback",
+		LinkURL:     srv.URL + "/upstream/link",
+		Timeout:     time.Second,
+		LoginTTL:    time.Minute,
+	})
+	samlService, err := samlservice.New(log, storage, samlservice.Config{
+		EntityID:     srv.URL + "/saml/metadata",
+		SSOURL:       srv.URL + "/saml/sso",
+		SigningKey:   signingKey,
+		AssertionTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oauthhttp.Register(mux, log, oauthService, authService, upstreamService, samlService, oauthhttp.Config{
+		PublicURL: srv.URL,
+	})
+
+	if err := storage.SaveOAuthClient(ctx, models.OAuthClient{
+		ID:                      testClientID,
+		Name:                    "Test App",
+		RedirectURIs:            []string{testRedirectURI},
+		TokenEndpointAuthMethod: models.AuthMethodNone,
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		FirstParty:              true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := authService.RegisterNewUser(ctx, testEmail, testPassword, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := oidc.NewProvider(ctx, srv.URL)
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+
+	endpoint := provider.Endpoint()
+	endpoint.AuthStyle = oauth2.AuthStyleInParams
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return oidcEnv{
+		srv:      srv,
+		provider: provider,
+		config: oauth2.Config{
+			ClientID:    testClientID,
+			Endpoint:    endpoint,
+			RedirectURL: testRedirectURI,
+			Scopes:      []string{oidc.ScopeOpenID, "email"},
+		},
+		browser: &http.Client{
+			Jar: jar,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// authorize sends the browser to the authorization endpoint and signs in
+// when the login page is shown. It returns the redirect back to the client
+// and whether the user had to sign in.
+func (e oidcEnv) authorize(t *testing.T, authURL string) (*url.URL, bool) {
+	t.Helper()
+
+	res, err := e.browser.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusFound {
+		return location(t, res), false
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("authorize: status %d: %s", res.StatusCode, body)
+	}
+
+	match := csrfField.FindSubmatch(body)
+	if match == nil {
+		t.Fatalf("authorize: no login form: %s", body)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := parsed.Query()
+	form.Set("csrf_token", string(match[1]))
+	form.Set("email", testEmail)
+	form.Set("password", testPassword)
+
+	res, err = e.browser.PostForm(e.srv.URL+"/authorize", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("login: status %d: %s", res.StatusCode, body)
+	}
+
+	return location(t, res), true
+}
+
+// login runs the authorization code flow and returns the verified ID token.
+func (e oidcEnv) login(t *testing.T, opts ...oauth2.AuthCodeOption) (*oidc.IDToken, bool) {
+	t.Helper()
+
+	ctx := context.Background()
+	verifier := oauth2.GenerateVerifier()
+
+	callback, signedIn := e.authorize(t, e.config.AuthCodeURL(
+		"state",
+		append(opts, oauth2.S256ChallengeOption(verifier))...,
+	))
+	if errCode := callback.Query().Get("error"); errCode != "" {
+		t.Fatalf("authorization failed: %s: %s", errCode, callback.Query().Get("error_description"))
+	}
+
+	token, err := e.config.Exchange(ctx, callback.Query().Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		t.Fatalf("code exchange failed: %v", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		t.Fatal("no id_token in token response")
+	}
+
+	idToken, err := e.provider.Verifier(&oidc.Config{ClientID: testClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		t.Fatalf("id token verification failed: %v", err)
+	}
+
+	userInfo, err := e.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+	if err != nil {
+		t.Fatalf("userinfo failed: %v", err)
+	}
+	if userInfo.Subject != idToken.Subject || userInfo.Email != testEmail {
+		t.Errorf("userinfo = %s %s, want %s %s", userInfo.Subject, userInfo.Email, idToken.Subject, testEmail)
+	}
+
+	return idToken, signedIn
+}
+
+func location(t *testing.T, res *http.Response) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	e := newOIDCEnv(t)
+
+	var metadata struct {
+		Issuer                        string   `json:"issuer"`
+		JWKSURI                       string   `json:"jwks_uri"`
+		ScopesSupported               []string `json:"scopes_supported"`
+		CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+	}
+	if err := e.provider.Claims(&metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata.Issuer != e.srv.URL {
+		t.Errorf("issuer = %q, want %q", metadata.Issuer, e.srv.URL)
+	}
+	if !strings.HasPrefix(metadata.JWKSURI, e.srv.URL) {
+		t.Errorf("jwks_uri = %q, want it served by the issuer", metadata.JWKSURI)
+	}
+	if !slices.Contains(metadata.ScopesSupported, oidc.ScopeOpenID) {
+		t.Errorf("scopes_supported = %v, want openid", metadata.ScopesSupported)
+	}
+	if !slices.Contains(metadata.CodeChallengeMethodsSupported, "S256") {
+		t.Errorf("code_challenge_methods_supported = %v, want S256", metadata.CodeChallengeMethodsSupported)
+	}
+}
+
+func TestOIDCNonce(t *testing.T) {
+	e := newOIDCEnv(t)
+
+	idToken, _ := e.login(t, oidc.Nonce("first-nonce"))
+	if idToken.Nonce != "first-nonce" {
+		t.Errorf("nonce = %q, want first-nonce", idToken.Nonce)
+	}
+
+	// The browser session is reused, but every ID token carries the nonce
+	// of its own request.
+	idToken, signedIn := e.login(t, oidc.Nonce("second-nonce"))
+	if signedIn {
+		t.Error("signed in again, want the browser session reused")
+	}
+	if idToken.Nonce != "second-nonce" {
+		t.Errorf("nonce = %q, want second-nonce", idToken.Nonce)
+	}
+
+	idToken, _ = e.login(t)
+	if idToken.Nonce != "" {
+		t.Errorf("nonce = %q, want none without a nonce in the request", idToken.Nonce)
+	}
+}
+
+func TestOIDCPromptAndMaxAge(t *testing.T) {
+	e := newOIDCEnv(t)
+
+	// Without a browser session prompt=none fails instead of showing the
+	// login page.
+	callback, signedIn := e.authorize(t, e.config.AuthCodeURL(
+		"state",
+		oauth2.SetAuthURLParam("prompt", "none"),
+		oauth2.S256ChallengeOption(oauth2.GenerateVerifier()),
+	))
+	if signedIn || callback.Query().Get("error") != oauthservice.LoginRequired {
+		t.Fatalf("prompt=none without a session: redirected to %s", callback)
+	}
+
+	first, signedIn := e.login(t)
+	if !signedIn {
+		t.Fatal("not asked to sign in without a session")
+	}
+
+	tests := []struct {
+		name       string
+		opts       []oauth2.AuthCodeOption
+		wantSignIn bool
+	}{
+		{
+			name: "session reused",
+		},
+		{
+			name: "prompt none",
+			opts: []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("prompt", "none")},
+		},
+		{
+			name:       "prompt login",
+			opts:       []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("prompt", "login")},
+			wantSignIn: true,
+		},
+		{
+			name: "max_age not reached",
+			opts: []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("max_age", "3600")},
+		},
+		{
+			name:       "max_age exceeded",
+			opts:       []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("max_age", "0")},
+			wantSignIn: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idToken, signedIn := e.login(t, tt.opts...)
+			if signedIn != tt.wantSignIn {
+				t.Fatalf("signed in = %v, want %v", signedIn, tt.wantSignIn)
+			}
+
+			var claims struct {
+				AuthTime int64 `json:"auth_time"`
+			}
+			if err := idToken.Claims(&claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims.AuthTime == 0 {
+				t.Fatal("no auth_time in the id token")
+			}
+			if !tt.wantSignIn && idToken.Subject != first.Subject {
+				t.Errorf("subject = %q, want %q", idToken.Subject, first.Subject)
+			}
+		})
+	}
+}
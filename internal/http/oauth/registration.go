@@ -0,0 +1,208 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+)
+
+// maxRegistrationBody bounds the size of client metadata documents.
+const maxRegistrationBody = 64 << 10
+
+// clientMetadata is the client metadata of RFC 7591 section 2 and the
+// logout extensions of OpenID Connect that gia-sso supports.
+type clientMetadata struct {
+	ClientID                string          `json:"client_id,omitempty"`
+	ClientName              string          `json:"client_name,omitempty"`
+	RedirectURIs            []string        `json:"redirect_uris,omitempty"`
+	GrantTypes              []string        `json:"grant_types,omitempty"`
+	ResponseTypes           []string        `json:"response_types,omitempty"`
+	TokenEndpointAuthMethod string          `json:"token_endpoint_auth_method,omitempty"`
+	Scope                   string          `json:"scope,omitempty"`
+	Audience                []string        `json:"audience,omitempty"`
+	JWKS                    json.RawMessage `json:"jwks,omitempty"`
+	PostLogoutRedirectURIs  []string        `json:"post_logout_redirect_uris,omitempty"`
+	FrontchannelLogoutURI   string          `json:"frontchannel_logout_uri,omitempty"`
+	BackchannelLogoutURI    string          `json:"backchannel_logout_uri,omitempty"`
+}
+
+type registrationResponse struct {
+	clientMetadata
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+// RegisterClient handles POST /register, the client registration endpoint
+// of RFC 7591.
+func (s *serverAPI) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+
+	metadata, err := readClientMetadata(w, r)
+	if err != nil {
+		s.writeRegistrationError(w, err)
+		return
+	}
+
+	reg, err := s.oauth.RegisterClient(r.Context(), token, metadata)
+	if err != nil {
+		s.writeRegistrationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, registrationResponseOf(reg))
+}
+
+// RegisteredClient handles GET /register/{client_id}, the client
+// configuration endpoint of RFC 7592.
+func (s *serverAPI) RegisteredClient(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+
+	reg, err := s.oauth.RegisteredClient(r.Context(), r.PathValue("client_id"), token)
+	if err != nil {
+		s.writeRegistrationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, registrationResponseOf(reg))
+}
+
+// UpdateRegisteredClient handles PUT /register/{client_id}. The request
+// replaces all metadata of the client.
+func (s *serverAPI) UpdateRegisteredClient(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+
+	metadata, err := readClientMetadata(w, r)
+	if err != nil {
+		s.writeRegistrationError(w, err)
+		return
+	}
+
+	reg, err := s.oauth.UpdateRegisteredClient(r.Context(), r.PathValue("client_id"), token, metadata)
+	if err != nil {
+		s.writeRegistrationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, registrationResponseOf(reg))
+}
+
+// DeleteRegisteredClient handles DELETE /register/{client_id}.
+func (s *serverAPI) DeleteRegisteredClient(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+
+	if err := s.oauth.DeleteRegisteredClient(r.Context(), r.PathValue("client_id"), token); err != nil {
+		s.writeRegistrationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readClientMetadata(w http.ResponseWriter, r *http.Request) (models.OAuthClient, error) {
+	var metadata clientMetadata
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRegistrationBody))
+	if err := decoder.Decode(&metadata); err != nil {
+		return models.OAuthClient{}, &oauthservice.Error{
+			Code:        oauthservice.InvalidClientMetadata,
+			Description: "the request body must be a JSON object",
+		}
+	}
+
+	for _, responseType := range metadata.ResponseTypes {
+		if responseType != oauthservice.ResponseTypeCode {
+			return models.OAuthClient{}, &oauthservice.Error{
+				Code:        oauthservice.InvalidClientMetadata,
+				Description: fmt.Sprintf("unsupported response type %q", responseType),
+			}
+		}
+	}
+
+	client := models.OAuthClient{
+		ID:                      metadata.ClientID,
+		Name:                    metadata.ClientName,
+		RedirectURIs:            metadata.RedirectURIs,
+		TokenEndpointAuthMethod: metadata.TokenEndpointAuthMethod,
+		GrantTypes:              metadata.GrantTypes,
+		Scopes:                  strings.Fields(metadata.Scope),
+		Audience:                metadata.Audience,
+		PostLogoutRedirectURIs:  metadata.PostLogoutRedirectURIs,
+		FrontchannelLogoutURI:   metadata.FrontchannelLogoutURI,
+		BackchannelLogoutURI:    metadata.BackchannelLogoutURI,
+	}
+	if len(metadata.JWKS) > 0 {
+		client.JWKS = string(metadata.JWKS)
+	}
+
+	return client, nil
+}
+
+func registrationResponseOf(reg oauthservice.ClientRegistration) registrationResponse {
+	client := reg.Client
+
+	res := registrationResponse{
+		clientMetadata: clientMetadata{
+			ClientID:                client.ID,
+			ClientName:              client.Name,
+			RedirectURIs:            client.RedirectURIs,
+			GrantTypes:              client.GrantTypes,
+			TokenEndpointAuthMethod: client.AuthMethod(),
+			Scope:                   strings.Join(client.Scopes, " "),
+			Audience:                client.Audience,
+			PostLogoutRedirectURIs:  client.PostLogoutRedirectURIs,
+			FrontchannelLogoutURI:   client.FrontchannelLogoutURI,
+			BackchannelLogoutURI:    client.BackchannelLogoutURI,
+		},
+		ClientSecret:            reg.Secret,
+		ClientIDIssuedAt:        client.CreatedAt.Unix(),
+		RegistrationAccessToken: reg.RegistrationAccessToken,
+		RegistrationClientURI:   reg.RegistrationClientURI,
+	}
+
+	if client.JWKS != "" {
+		res.JWKS = json.RawMessage(client.JWKS)
+	}
+	if slices.Contains(client.GrantTypes, oauthservice.GrantTypeAuthorizationCode) {
+		res.ResponseTypes = []string{oauthservice.ResponseTypeCode}
+	}
+	if reg.Secret != "" {
+		// Secrets do not expire.
+		var expiresAt int64
+		res.ClientSecretExpiresAt = &expiresAt
+	}
+
+	return res
+}
+
+// writeRegistrationError answers a registration request with the error
+// response of RFC 7591 section 3.2.2, or of RFC 6750 for a missing or
+// invalid access token.
+func (s *serverAPI) writeRegistrationError(w http.ResponseWriter, err error) {
+	var oauthErr *oauthservice.Error
+	if !errors.As(err, &oauthErr) {
+		s.log.Error("client registration request failed", slog.String("error", err.Error()))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: oauthservice.ServerError})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == oauthservice.InvalidToken {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="register", error=%q`, oauthErr.Code))
+	}
+
+	writeJSON(w, status, errorResponse{
+		Error:            oauthErr.Code,
+		ErrorDescription: oauthErr.Description,
+	})
+}
@@ -0,0 +1,346 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	samlservice "github.com/VariableSan/gia-sso/internal/services/saml"
+	"github.com/VariableSan/gia-sso/pkg/random"
+	samlproto "github.com/VariableSan/gia-sso/pkg/saml"
+)
+
+// samlLoginForm carries a SAML login through the login page: the request
+// of a service provider, or the entity ID of the one an IdP-initiated login
+// goes to.
+type samlLoginForm struct {
+	SAMLRequest string
+	EntityID    string
+	RelayState  string
+}
+
+type samlPostPage struct {
+	ServiceProviderName string
+	ACSURL              string
+	SAMLResponse        string
+	RelayState          string
+	Nonce               string
+}
+
+// SAMLMetadata handles GET /saml/metadata, whose URL is also the entity ID
+// of gia-sso.
+func (s *serverAPI) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.saml.Metadata())
+}
+
+// SAMLRedirect handles requests of service providers sent with the
+// HTTP-Redirect binding to GET /saml/sso.
+func (s *serverAPI) SAMLRedirect(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	data, err := samlproto.DecodeRedirect(query.Get("SAMLRequest"))
+	if err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request of the application that sent you here could not be read.")
+		return
+	}
+
+	form := samlLoginForm{
+		SAMLRequest: samlproto.EncodePost(data),
+		RelayState:  query.Get("RelayState"),
+	}
+
+	req, ok := s.checkSAMLRequest(w, r, data, form.RelayState)
+	if !ok {
+		return
+	}
+
+	s.answerSAML(w, r, req, form)
+}
+
+// SAMLPost handles requests of service providers sent with the HTTP-POST
+// binding to POST /saml/sso. The browser session cookie is not sent along
+// with cross-site posts, so the request is turned into one of the
+// HTTP-Redirect binding, whose navigation carries it.
+func (s *serverAPI) SAMLPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request could not be read.")
+		return
+	}
+
+	data, err := samlproto.DecodePost(r.PostForm.Get("SAMLRequest"))
+	if err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request of the application that sent you here could not be read.")
+		return
+	}
+
+	encoded, err := samlproto.EncodeRedirect(data)
+	if err != nil {
+		s.log.Error("failed to encode saml request", slog.String("error", err.Error()))
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	params := url.Values{"SAMLRequest": {encoded}}
+	if relayState := r.PostForm.Get("RelayState"); relayState != "" {
+		params.Set("RelayState", relayState)
+	}
+
+	http.Redirect(w, r, "/saml/sso?"+params.Encode(), http.StatusSeeOther)
+}
+
+// SAMLStartLogin handles GET /saml/idp, which signs the user in to the
+// service provider entity_id without a request of it. RelayState is passed
+// on to the service provider, which may use it as the page to land on.
+func (s *serverAPI) SAMLStartLogin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	form := samlLoginForm{
+		EntityID:   query.Get("entity_id"),
+		RelayState: query.Get("RelayState"),
+	}
+
+	req, ok := s.startSAMLLogin(w, r, form.EntityID)
+	if !ok {
+		return
+	}
+
+	s.answerSAML(w, r, req, form)
+}
+
+// SAMLLogin handles the login form posted from the page rendered for SAML
+// logins.
+func (s *serverAPI) SAMLLogin(w http.ResponseWriter, r *http.Request) {
+	const operation = "http.oauth.SAMLLogin"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+	)
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "The request could not be read.")
+		return
+	}
+
+	form := samlLoginForm{
+		SAMLRequest: r.PostForm.Get("SAMLRequest"),
+		EntityID:    r.PostForm.Get("entity_id"),
+		RelayState:  r.PostForm.Get("RelayState"),
+	}
+
+	var (
+		req samlservice.Request
+		ok  bool
+	)
+	if form.SAMLRequest != "" {
+		data, err := samlproto.DecodePost(form.SAMLRequest)
+		if err != nil {
+			s.renderError(w, http.StatusBadRequest, "The request of the application that sent you here could not be read.")
+			return
+		}
+		req, ok = s.checkSAMLRequest(w, r, data, form.RelayState)
+	} else {
+		req, ok = s.startSAMLLogin(w, r, form.EntityID)
+	}
+	if !ok {
+		return
+	}
+
+	email := r.PostForm.Get("email")
+
+	if !s.validCSRFToken(r) {
+		log.Warn("invalid csrf token")
+		s.renderSAMLLogin(w, http.StatusForbidden, req, form, email, "Your session has expired, please try again.")
+		return
+	}
+
+	session, err := s.signIn(w, r, email, r.PostForm.Get("password"))
+	if err != nil {
+		message, status := loginErrorMessage(err)
+		if status == http.StatusInternalServerError {
+			log.Error("failed to login", slog.String("error", err.Error()))
+			s.renderError(w, status, message)
+			return
+		}
+
+		s.renderSAMLLogin(w, status, req, form, email, message)
+		return
+	}
+
+	s.respondSAML(w, r, req, form.RelayState, session)
+}
+
+// answerSAML answers a checked SAML login right away for users with a
+// browser session, unless the service provider asked for a fresh login.
+// Everyone else gets the login page.
+func (s *serverAPI) answerSAML(
+	w http.ResponseWriter,
+	r *http.Request,
+	req samlservice.Request,
+	form samlLoginForm,
+) {
+	if !req.ForceAuthn {
+		if session, ok := s.browserSession(r); ok {
+			s.respondSAML(w, r, req, form.RelayState, session)
+			return
+		}
+	}
+
+	if req.IsPassive {
+		s.failSAML(w, req, form.RelayState, &samlservice.Error{
+			Status:    samlproto.StatusResponder,
+			SubStatus: samlproto.StatusNoPassive,
+		})
+		return
+	}
+
+	s.renderSAMLLogin(w, http.StatusOK, req, form, "", "")
+}
+
+// checkSAMLRequest checks an AuthnRequest and answers it with an error when
+// it is invalid. Errors are only posted back to the service provider once
+// its assertion consumer service has been verified.
+func (s *serverAPI) checkSAMLRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	data []byte,
+	relayState string,
+) (samlservice.Request, bool) {
+	req, err := s.saml.CheckRequest(r.Context(), data)
+	if err == nil {
+		return req, true
+	}
+
+	var samlErr *samlservice.Error
+	if errors.As(err, &samlErr) {
+		s.failSAML(w, req, relayState, samlErr)
+		return samlservice.Request{}, false
+	}
+
+	s.renderSAMLError(w, err)
+	return samlservice.Request{}, false
+}
+
+func (s *serverAPI) startSAMLLogin(
+	w http.ResponseWriter,
+	r *http.Request,
+	entityID string,
+) (samlservice.Request, bool) {
+	req, err := s.saml.StartLogin(r.Context(), entityID)
+	if err != nil {
+		s.renderSAMLError(w, err)
+		return samlservice.Request{}, false
+	}
+
+	return req, true
+}
+
+// respondSAML sends the user to the service provider with an assertion
+// about them.
+func (s *serverAPI) respondSAML(
+	w http.ResponseWriter,
+	r *http.Request,
+	req samlservice.Request,
+	relayState string,
+	session models.Session,
+) {
+	resp, err := s.saml.Respond(r.Context(), req, session)
+	if err != nil {
+		var samlErr *samlservice.Error
+		if errors.As(err, &samlErr) {
+			s.failSAML(w, req, relayState, samlErr)
+			return
+		}
+
+		s.log.Error("failed to answer saml request", slog.String("error", err.Error()))
+		s.failSAML(w, req, relayState, &samlservice.Error{Status: samlproto.StatusResponder})
+		return
+	}
+
+	s.postSAMLResponse(w, req, resp, relayState)
+}
+
+// failSAML sends the user back to the service provider with a failure.
+func (s *serverAPI) failSAML(
+	w http.ResponseWriter,
+	req samlservice.Request,
+	relayState string,
+	samlErr *samlservice.Error,
+) {
+	resp, err := s.saml.Fail(req, samlErr)
+	if err != nil {
+		s.log.Error("failed to answer saml request", slog.String("error", err.Error()))
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	s.postSAMLResponse(w, req, resp, relayState)
+}
+
+// postSAMLResponse renders the page that posts a response to the assertion
+// consumer service of the service provider.
+func (s *serverAPI) postSAMLResponse(
+	w http.ResponseWriter,
+	req samlservice.Request,
+	resp samlservice.Response,
+	relayState string,
+) {
+	nonce, err := random.Token(16)
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	policy := contentSecurityPolicy + "; script-src 'nonce-" + nonce + "'"
+
+	s.renderWithPolicy(w, http.StatusOK, "saml_post.html", samlPostPage{
+		ServiceProviderName: req.ServiceProvider.Name,
+		ACSURL:              resp.ACSURL,
+		SAMLResponse:        resp.SAMLResponse,
+		RelayState:          relayState,
+		Nonce:               nonce,
+	}, policy)
+}
+
+func (s *serverAPI) renderSAMLLogin(
+	w http.ResponseWriter,
+	status int,
+	req samlservice.Request,
+	form samlLoginForm,
+	email string,
+	message string,
+) {
+	csrfToken, err := s.newCSRFToken(w, "/saml/login")
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	s.render(w, status, "login.html", loginPage{
+		ClientName: req.ServiceProvider.Name,
+		Action:     "/saml/login",
+		SAML:       &form,
+		Email:      email,
+		Error:      message,
+		CSRFToken:  csrfToken,
+	})
+}
+
+func (s *serverAPI) renderSAMLError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, samlservice.ErrInvalidRequest):
+		s.renderError(w, http.StatusBadRequest, "The request of the application that sent you here could not be read.")
+	case errors.Is(err, samlservice.ErrUnknownServiceProvider):
+		s.renderError(w, http.StatusBadRequest, "The application that sent you here is not registered.")
+	case errors.Is(err, samlservice.ErrInvalidACSURL):
+		s.renderError(w, http.StatusBadRequest, "The application that sent you here used an unregistered address.")
+	case errors.Is(err, samlservice.ErrIdPInitiatedDisabled):
+		s.renderError(w, http.StatusForbidden, "Sign in to this application from its own page.")
+	default:
+		s.log.Error("failed to check saml request", slog.String("error", err.Error()))
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+	}
+}
@@ -0,0 +1,315 @@
+package oauth
+
+import (
+	"context"
+	"embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+	samlservice "github.com/VariableSan/gia-sso/internal/services/saml"
+	"github.com/VariableSan/gia-sso/internal/services/upstream"
+	"github.com/VariableSan/gia-sso/pkg/clientip"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+const (
+	// sessionCookie holds the browser session shared by all clients, which
+	// is what makes the login single sign-on.
+	sessionCookie = "gia_sso_session"
+	csrfCookie    = "gia_sso_csrf"
+
+	contentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+type OAuth interface {
+	CheckAuthorizeRequest(
+		ctx context.Context,
+		req oauthservice.AuthorizeRequest,
+	) (models.OAuthClient, error)
+	IssueCode(
+		ctx context.Context,
+		req oauthservice.AuthorizeRequest,
+		session models.Session,
+	) (string, error)
+	NeedsConsent(
+		ctx context.Context,
+		client models.OAuthClient,
+		req oauthservice.AuthorizeRequest,
+		session models.Session,
+	) (bool, error)
+	GrantConsent(
+		ctx context.Context,
+		req oauthservice.AuthorizeRequest,
+		session models.Session,
+	) error
+	AuthenticateClient(
+		ctx context.Context,
+		creds oauthservice.ClientCredentials,
+	) (models.OAuthClient, error)
+	ClientCredentialsGrant(
+		ctx context.Context,
+		client models.OAuthClient,
+		scope string,
+		audience string,
+	) (oauthservice.TokenResponse, error)
+	AuthorizeDevice(
+		ctx context.Context,
+		client models.OAuthClient,
+		scope string,
+	) (oauthservice.DeviceAuthorization, error)
+	DeviceRequest(
+		ctx context.Context,
+		userCode string,
+	) (models.DeviceCode, models.OAuthClient, error)
+	DecideDeviceRequest(
+		ctx context.Context,
+		userCode string,
+		session models.Session,
+		approved bool,
+	) error
+	DeviceToken(
+		ctx context.Context,
+		client models.OAuthClient,
+		deviceCode string,
+	) (oauthservice.TokenResponse, error)
+	ExchangeToken(
+		ctx context.Context,
+		client models.OAuthClient,
+		req oauthservice.TokenExchangeRequest,
+	) (oauthservice.TokenResponse, error)
+	ExchangeCode(
+		ctx context.Context,
+		client models.OAuthClient,
+		code string,
+		redirectURI string,
+		codeVerifier string,
+	) (oauthservice.TokenResponse, error)
+	Refresh(
+		ctx context.Context,
+		client models.OAuthClient,
+		refreshToken string,
+	) (oauthservice.TokenResponse, error)
+	CheckEndSessionRequest(
+		ctx context.Context,
+		req oauthservice.EndSessionRequest,
+	) (oauthservice.EndSession, error)
+	Logout(
+		ctx context.Context,
+		session models.Session,
+	) ([]string, error)
+	RegisterClient(
+		ctx context.Context,
+		initialAccessToken string,
+		metadata models.OAuthClient,
+	) (oauthservice.ClientRegistration, error)
+	RegisteredClient(
+		ctx context.Context,
+		clientID string,
+		registrationToken string,
+	) (oauthservice.ClientRegistration, error)
+	UpdateRegisteredClient(
+		ctx context.Context,
+		clientID string,
+		registrationToken string,
+		metadata models.OAuthClient,
+	) (oauthservice.ClientRegistration, error)
+	DeleteRegisteredClient(
+		ctx context.Context,
+		clientID string,
+		registrationToken string,
+	) error
+	ReuseSession(
+		req oauthservice.AuthorizeRequest,
+		session *models.Session,
+	) (bool, error)
+	UserInfo(
+		ctx context.Context,
+		claims jwt.Claims,
+	) (map[string]any, error)
+	Issuer() string
+	JWKS() jwt.JSONWebKeySet
+}
+
+type Auth interface {
+	Login(
+		ctx context.Context,
+		email string,
+		password string,
+		client models.ClientInfo,
+	) (models.TokenPair, error)
+	StartBrowserSession(
+		ctx context.Context,
+		tokens models.TokenPair,
+	) (string, models.Session, error)
+	BrowserSession(
+		ctx context.Context,
+		token string,
+	) (models.Session, error)
+	VerifyToken(
+		ctx context.Context,
+		token string,
+	) (jwt.Claims, error)
+}
+
+// Config holds the settings of the OAuth endpoints.
+type Config struct {
+	// PublicURL is the external base URL of the HTTP server. Cookies are
+	// marked secure when it uses https.
+	PublicURL string
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header
+	// tells the client address. Nil ignores the header.
+	TrustedProxies *clientip.Proxies
+}
+
+// Upstream signs users in at upstream identity providers.
+type Upstream interface {
+	Providers() []upstream.Provider
+	StartLogin(
+		ctx context.Context,
+		providerID string,
+		returnTo string,
+	) (string, string, error)
+	ResumeLink(
+		ctx context.Context,
+		state string,
+	) (string, error)
+	FinishLogin(
+		ctx context.Context,
+		state string,
+		code string,
+		client models.ClientInfo,
+	) (upstream.Result, error)
+}
+
+// SAML signs users in to SAML service providers.
+type SAML interface {
+	Metadata() []byte
+	CheckRequest(
+		ctx context.Context,
+		data []byte,
+	) (samlservice.Request, error)
+	StartLogin(
+		ctx context.Context,
+		entityID string,
+	) (samlservice.Request, error)
+	Respond(
+		ctx context.Context,
+		req samlservice.Request,
+		session models.Session,
+	) (samlservice.Response, error)
+	Fail(
+		req samlservice.Request,
+		samlErr *samlservice.Error,
+	) (samlservice.Response, error)
+}
+
+type serverAPI struct {
+	log           *slog.Logger
+	oauth         OAuth
+	auth          Auth
+	upstream      Upstream
+	saml          SAML
+	secureCookies bool
+	// trustedProxies are the proxies whose X-Forwarded-For is believed.
+	trustedProxies *clientip.Proxies
+}
+
+func Register(
+	mux *http.ServeMux,
+	log *slog.Logger,
+	oauth OAuth,
+	auth Auth,
+	upstream Upstream,
+	saml SAML,
+	cfg Config,
+) {
+	api := &serverAPI{
+		log:            log,
+		oauth:          oauth,
+		auth:           auth,
+		upstream:       upstream,
+		saml:           saml,
+		secureCookies:  strings.HasPrefix(cfg.PublicURL, "https://"),
+		trustedProxies: cfg.TrustedProxies,
+	}
+
+	mux.HandleFunc("GET /authorize", api.Authorize)
+	mux.HandleFunc("POST /authorize", api.Login)
+	mux.HandleFunc("POST /authorize/consent", api.Consent)
+	mux.HandleFunc("GET /upstream/{provider}/login", api.UpstreamLogin)
+	mux.HandleFunc("GET /upstream/link", api.UpstreamLink)
+	mux.HandleFunc("GET /upstream/callback", api.UpstreamCallback)
+	mux.HandleFunc("GET /saml/metadata", api.SAMLMetadata)
+	mux.HandleFunc("GET /saml/sso", api.SAMLRedirect)
+	mux.HandleFunc("POST /saml/sso", api.SAMLPost)
+	mux.HandleFunc("GET /saml/idp", api.SAMLStartLogin)
+	mux.HandleFunc("POST /saml/login", api.SAMLLogin)
+	mux.HandleFunc("POST /token", api.Token)
+	mux.HandleFunc("POST /device_authorization", api.DeviceAuthorization)
+	mux.HandleFunc("GET /device", api.Device)
+	mux.HandleFunc("POST /device", api.VerifyDevice)
+	mux.HandleFunc("POST /device/confirm", api.ConfirmDevice)
+	mux.HandleFunc("GET /logout", api.EndSession)
+	mux.HandleFunc("POST /logout", api.EndSession)
+	mux.HandleFunc("POST /logout/confirm", api.ConfirmLogout)
+	mux.HandleFunc("POST /register", api.RegisterClient)
+	mux.HandleFunc("GET /register/{client_id}", api.RegisteredClient)
+	mux.HandleFunc("PUT /register/{client_id}", api.UpdateRegisteredClient)
+	mux.HandleFunc("DELETE /register/{client_id}", api.DeleteRegisteredClient)
+	mux.HandleFunc("GET /userinfo", api.UserInfo)
+	mux.HandleFunc("POST /userinfo", api.UserInfo)
+	mux.HandleFunc("GET /jwks", api.JWKS)
+	mux.HandleFunc("GET /.well-known/openid-configuration", api.Discovery)
+}
+
+// clientInfo describes the browser or client behind a request.
+func (s *serverAPI) clientInfo(r *http.Request) models.ClientInfo {
+	return models.ClientInfo{
+		IP:        s.trustedProxies.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For")),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+func (s *serverAPI) render(w http.ResponseWriter, status int, name string, data any) {
+	s.renderWithPolicy(w, status, name, data, contentSecurityPolicy)
+}
+
+// renderWithPolicy renders a page with its own content security policy.
+func (s *serverAPI) renderWithPolicy(
+	w http.ResponseWriter,
+	status int,
+	name string,
+	data any,
+	policy string,
+) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", policy)
+	w.WriteHeader(status)
+
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		s.log.Error("failed to render page", slog.String("template", name), slog.String("error", err.Error()))
+	}
+}
+
+type errorPage struct {
+	Title   string
+	Message string
+}
+
+func (s *serverAPI) renderError(w http.ResponseWriter, status int, message string) {
+	s.render(w, status, "error.html", errorPage{
+		Title:   http.StatusText(status),
+		Message: message,
+	})
+}
@@ -0,0 +1,154 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	oauthservice "github.com/VariableSan/gia-sso/internal/services/oauth"
+)
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// IssuedTokenType is required in token exchange responses.
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Token handles POST /token.
+func (s *serverAPI) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.writeTokenError(w, r, &oauthservice.Error{
+			Code:        oauthservice.InvalidRequest,
+			Description: "malformed request body",
+		})
+		return
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		s.writeTokenError(w, r, err)
+		return
+	}
+
+	var res oauthservice.TokenResponse
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case oauthservice.GrantTypeAuthorizationCode:
+		res, err = s.oauth.ExchangeCode(
+			r.Context(),
+			client,
+			r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"),
+		)
+	case oauthservice.GrantTypeRefreshToken:
+		res, err = s.oauth.Refresh(r.Context(), client, r.PostForm.Get("refresh_token"))
+	case oauthservice.GrantTypeClientCredentials:
+		res, err = s.oauth.ClientCredentialsGrant(
+			r.Context(),
+			client,
+			r.PostForm.Get("scope"),
+			r.PostForm.Get("audience"),
+		)
+	case oauthservice.GrantTypeDeviceCode:
+		res, err = s.oauth.DeviceToken(r.Context(), client, r.PostForm.Get("device_code"))
+	case oauthservice.GrantTypeTokenExchange:
+		res, err = s.oauth.ExchangeToken(r.Context(), client, oauthservice.TokenExchangeRequest{
+			SubjectToken:       r.PostForm.Get("subject_token"),
+			SubjectTokenType:   r.PostForm.Get("subject_token_type"),
+			ActorToken:         r.PostForm.Get("actor_token"),
+			ActorTokenType:     r.PostForm.Get("actor_token_type"),
+			RequestedTokenType: r.PostForm.Get("requested_token_type"),
+			Audience:           r.PostForm["audience"],
+			Scope:              r.PostForm.Get("scope"),
+		})
+	case "":
+		err = &oauthservice.Error{Code: oauthservice.InvalidRequest, Description: "grant_type is required"}
+	default:
+		err = &oauthservice.Error{Code: oauthservice.UnsupportedGrantType}
+	}
+	if err != nil {
+		s.writeTokenError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:     res.AccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(res.ExpiresIn.Seconds()),
+		RefreshToken:    res.RefreshToken,
+		IDToken:         res.IDToken,
+		IssuedTokenType: res.IssuedTokenType,
+		Scope:           res.Scope,
+	})
+}
+
+// authenticateClient reads client credentials from HTTP Basic auth
+// (client_secret_basic) or from the form (client_secret_post,
+// private_key_jwt, or client_id alone for public clients).
+func (s *serverAPI) authenticateClient(r *http.Request) (models.OAuthClient, error) {
+	creds := oauthservice.ClientCredentials{
+		ClientID:      r.PostForm.Get("client_id"),
+		Secret:        r.PostForm.Get("client_secret"),
+		AssertionType: r.PostForm.Get("client_assertion_type"),
+		Assertion:     r.PostForm.Get("client_assertion"),
+	}
+
+	if clientID, secret, ok := r.BasicAuth(); ok {
+		// RFC 6749 section 2.3.1: credentials are form-encoded before
+		// being put into the header.
+		var err error
+		if creds.ClientID, err = url.QueryUnescape(clientID); err != nil {
+			return models.OAuthClient{}, &oauthservice.Error{Code: oauthservice.InvalidClient}
+		}
+		if creds.Secret, err = url.QueryUnescape(secret); err != nil {
+			return models.OAuthClient{}, &oauthservice.Error{Code: oauthservice.InvalidClient}
+		}
+	}
+
+	return s.oauth.AuthenticateClient(r.Context(), creds)
+}
+
+func (s *serverAPI) writeTokenError(w http.ResponseWriter, r *http.Request, err error) {
+	var oauthErr *oauthservice.Error
+	if !errors.As(err, &oauthErr) {
+		s.log.Error("token request failed", slog.String("error", err.Error()))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: oauthservice.ServerError})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == oauthservice.InvalidClient {
+		status = http.StatusUnauthorized
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+	}
+
+	writeJSON(w, status, errorResponse{
+		Error:            oauthErr.Code,
+		ErrorDescription: oauthErr.Description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,193 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	authservice "github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/services/upstream"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// upstreamCookie binds a login at an upstream provider to the browser that
+// started it, so that callbacks cannot be replayed into another browser.
+const upstreamCookie = "gia_sso_upstream"
+
+// upstreamCookieMaxAge bounds how long a login at an upstream provider may
+// take in the browser.
+const upstreamCookieMaxAge = time.Hour
+
+// upstreamLink is a button of the login page.
+type upstreamLink struct {
+	Name string
+	URL  string
+}
+
+type upstreamLinkedPage struct {
+	ProviderName string
+}
+
+// UpstreamLogin handles GET /upstream/{provider}/login, which sends the
+// user to log in at an upstream provider. The query holds the authorization
+// request to continue with afterwards.
+func (s *serverAPI) UpstreamLogin(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequest(r.URL.Query())
+
+	if _, ok := s.checkAuthorizeRequest(w, r, req); !ok {
+		return
+	}
+
+	authURL, state, err := s.upstream.StartLogin(
+		r.Context(),
+		r.PathValue("provider"),
+		"/authorize?"+r.URL.RawQuery,
+	)
+	if err != nil {
+		if errors.Is(err, upstream.ErrUnknownProvider) {
+			s.renderError(w, http.StatusNotFound, "This sign in option is not available.")
+			return
+		}
+		s.log.Error("failed to start upstream login", slog.String("error", err.Error()))
+		s.renderError(w, http.StatusBadGateway, "The identity provider is not reachable, please try again later.")
+		return
+	}
+
+	s.redirectUpstream(w, r, authURL, state)
+}
+
+// UpstreamLink handles GET /upstream/link, the page users open to log in at
+// the provider whose identity they link to their account. The link is
+// started over gRPC, which hands out this page with its state.
+func (s *serverAPI) UpstreamLink(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+
+	authURL, err := s.upstream.ResumeLink(r.Context(), state)
+	if err != nil {
+		message, status := upstreamErrorMessage(err)
+		if status == http.StatusInternalServerError {
+			s.log.Error("failed to resume identity link", slog.String("error", err.Error()))
+		}
+		s.renderError(w, status, message)
+		return
+	}
+
+	s.redirectUpstream(w, r, authURL, state)
+}
+
+// UpstreamCallback handles GET /upstream/callback, where providers send
+// users back to after logging in.
+func (s *serverAPI) UpstreamCallback(w http.ResponseWriter, r *http.Request) {
+	const operation = "http.oauth.UpstreamCallback"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+	)
+
+	query := r.URL.Query()
+	state := query.Get("state")
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     upstreamCookie,
+		Path:     "/upstream",
+		MaxAge:   -1,
+		Secure:   s.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	cookie, err := r.Cookie(upstreamCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		log.Warn("upstream callback without matching state")
+		s.renderError(w, http.StatusBadRequest, "Your sign in has expired, please try again.")
+		return
+	}
+
+	if query.Get("error") != "" {
+		log.Info("upstream login failed", slog.String("error", query.Get("error")))
+		s.renderError(w, http.StatusForbidden, "The identity provider did not sign you in.")
+		return
+	}
+
+	result, err := s.upstream.FinishLogin(r.Context(), state, query.Get("code"), s.clientInfo(r))
+	if err != nil {
+		message, status := upstreamErrorMessage(err)
+		if status == http.StatusInternalServerError {
+			log.Error("failed to finish upstream login", slog.String("error", err.Error()))
+		}
+		s.renderError(w, status, message)
+		return
+	}
+
+	if result.Linked {
+		s.render(w, http.StatusOK, "upstream_linked.html", upstreamLinkedPage{
+			ProviderName: result.Provider.Name,
+		})
+		return
+	}
+
+	if _, err := s.setSessionCookie(w, r, result.Tokens); err != nil {
+		log.Error("failed to get new browser session", slog.String("error", err.Error()))
+		s.renderError(w, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	http.Redirect(w, r, result.ReturnTo, http.StatusFound)
+}
+
+// redirectUpstream sends the user to log in at a provider, binding the
+// login with the given state to the browser.
+func (s *serverAPI) redirectUpstream(w http.ResponseWriter, r *http.Request, authURL string, state string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     upstreamCookie,
+		Value:    state,
+		Path:     "/upstream",
+		MaxAge:   int(upstreamCookieMaxAge.Seconds()),
+		Secure:   s.secureCookies,
+		HttpOnly: true,
+		// The callback is a cross-site navigation from the provider.
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// upstreamLinks returns the upstream login buttons for an authorization
+// request.
+func (s *serverAPI) upstreamLinks(params url.Values) []upstreamLink {
+	providers := s.upstream.Providers()
+
+	links := make([]upstreamLink, 0, len(providers))
+	for _, provider := range providers {
+		links = append(links, upstreamLink{
+			Name: provider.Name,
+			URL:  "/upstream/" + url.PathEscape(provider.ID) + "/login?" + params.Encode(),
+		})
+	}
+
+	return links
+}
+
+func upstreamErrorMessage(err error) (string, int) {
+	switch {
+	case errors.Is(err, upstream.ErrInvalidState):
+		return "Your sign in has expired, please try again.", http.StatusBadRequest
+	case errors.Is(err, upstream.ErrUnknownProvider):
+		return "This sign in option is not available.", http.StatusNotFound
+	case errors.Is(err, upstream.ErrProvider):
+		return "The identity provider could not sign you in.", http.StatusBadGateway
+	case errors.Is(err, authservice.ErrEmailNotVerified):
+		return "Your identity provider did not confirm your email address.", http.StatusForbidden
+	case errors.Is(err, authservice.ErrRegistrationClosed):
+		return "New accounts cannot be created.", http.StatusForbidden
+	case errors.Is(err, authservice.ErrInvitationRequired):
+		return "You need an invitation to create an account.", http.StatusForbidden
+	case errors.Is(err, storage.ErrIdentityExists):
+		return "This account at the identity provider is already linked to another user.", http.StatusConflict
+	default:
+		return loginErrorMessage(err)
+	}
+}
@@ -0,0 +1,81 @@
+package scim
+
+import (
+	"net/http"
+
+	scimproto "github.com/VariableSan/gia-sso/pkg/scim"
+)
+
+type supported struct {
+	Supported bool `json:"supported"`
+}
+
+type filterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type bulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type authenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+type serviceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 supported              `json:"patch"`
+	Bulk                  bulkSupport            `json:"bulk"`
+	Filter                filterSupport          `json:"filter"`
+	ChangePassword        supported              `json:"changePassword"`
+	Sort                  supported              `json:"sort"`
+	ETag                  supported              `json:"etag"`
+	AuthenticationSchemes []authenticationScheme `json:"authenticationSchemes"`
+}
+
+// ServiceProviderConfig handles GET /scim/v2/ServiceProviderConfig, which
+// tells clients the features of RFC 7644 that are supported.
+func (s *serverAPI) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, serviceProviderConfig{
+		Schemas: []string{scimproto.SchemaServiceProviderConfig},
+		Patch:   supported{Supported: true},
+		Filter: filterSupport{
+			Supported:  true,
+			MaxResults: s.maxResults,
+		},
+		AuthenticationSchemes: []authenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer token",
+			Description: "The token configured for SCIM clients, sent in the Authorization header.",
+			Primary:     true,
+		}},
+	})
+}
+
+// ResourceTypes handles GET /scim/v2/ResourceTypes.
+func (s *serverAPI) ResourceTypes(w http.ResponseWriter, r *http.Request) {
+	resourceTypes := []map[string]any{
+		{
+			"schemas":  []string{scimproto.SchemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   scimproto.SchemaUser,
+		},
+		{
+			"schemas":  []string{scimproto.SchemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   scimproto.SchemaGroup,
+		},
+	}
+
+	writeJSON(w, http.StatusOK, scimproto.NewListResponse(resourceTypes, 1, len(resourceTypes)))
+}
@@ -0,0 +1,327 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	scimservice "github.com/VariableSan/gia-sso/internal/services/scim"
+	scimproto "github.com/VariableSan/gia-sso/pkg/scim"
+)
+
+const (
+	// prefix is the path the SCIM endpoints are served under.
+	prefix = "/scim/v2"
+
+	contentType = "application/scim+json"
+
+	// maxBody bounds the size of resources and PATCH requests.
+	maxBody = 256 << 10
+)
+
+type SCIM interface {
+	Authenticate(token string) error
+	Users(
+		ctx context.Context,
+		query scimservice.Query,
+	) (scimproto.ListResponse, error)
+	User(
+		ctx context.Context,
+		id string,
+		projection scimservice.Projection,
+	) (map[string]any, error)
+	CreateUser(
+		ctx context.Context,
+		resource map[string]any,
+	) (map[string]any, error)
+	ReplaceUser(
+		ctx context.Context,
+		id string,
+		resource map[string]any,
+	) (map[string]any, error)
+	PatchUser(
+		ctx context.Context,
+		id string,
+		operations []scimproto.PatchOperation,
+	) (map[string]any, error)
+	DeleteUser(
+		ctx context.Context,
+		id string,
+	) error
+	Groups(
+		ctx context.Context,
+		query scimservice.Query,
+	) (scimproto.ListResponse, error)
+	Group(
+		ctx context.Context,
+		id string,
+		projection scimservice.Projection,
+	) (map[string]any, error)
+	CreateGroup(
+		ctx context.Context,
+		resource map[string]any,
+	) (map[string]any, error)
+	ReplaceGroup(
+		ctx context.Context,
+		id string,
+		resource map[string]any,
+	) (map[string]any, error)
+	PatchGroup(
+		ctx context.Context,
+		id string,
+		operations []scimproto.PatchOperation,
+	) (map[string]any, error)
+	DeleteGroup(
+		ctx context.Context,
+		id string,
+	) error
+}
+
+// Config holds the settings of the SCIM endpoints.
+type Config struct {
+	// MaxResults is the most resources returned by one query, which is
+	// advertised to clients.
+	MaxResults int
+}
+
+type serverAPI struct {
+	log        *slog.Logger
+	scim       SCIM
+	maxResults int
+}
+
+// resourceType holds the handlers of one type of resource.
+type resourceType struct {
+	list    func(ctx context.Context, query scimservice.Query) (scimproto.ListResponse, error)
+	get     func(ctx context.Context, id string, projection scimservice.Projection) (map[string]any, error)
+	create  func(ctx context.Context, resource map[string]any) (map[string]any, error)
+	replace func(ctx context.Context, id string, resource map[string]any) (map[string]any, error)
+	patch   func(ctx context.Context, id string, operations []scimproto.PatchOperation) (map[string]any, error)
+	delete  func(ctx context.Context, id string) error
+}
+
+// Register serves the SCIM 2.0 endpoints of RFC 7644 under /scim/v2. All
+// of them require the bearer token of the SCIM client.
+func Register(mux *http.ServeMux, log *slog.Logger, scim SCIM, cfg Config) {
+	api := &serverAPI{
+		log:        log,
+		scim:       scim,
+		maxResults: cfg.MaxResults,
+	}
+
+	api.handleResources(mux, "Users", resourceType{
+		list:    scim.Users,
+		get:     scim.User,
+		create:  scim.CreateUser,
+		replace: scim.ReplaceUser,
+		patch:   scim.PatchUser,
+		delete:  scim.DeleteUser,
+	})
+	api.handleResources(mux, "Groups", resourceType{
+		list:    scim.Groups,
+		get:     scim.Group,
+		create:  scim.CreateGroup,
+		replace: scim.ReplaceGroup,
+		patch:   scim.PatchGroup,
+		delete:  scim.DeleteGroup,
+	})
+
+	mux.Handle("GET "+prefix+"/ServiceProviderConfig", api.authenticated(api.ServiceProviderConfig))
+	mux.Handle("GET "+prefix+"/ResourceTypes", api.authenticated(api.ResourceTypes))
+}
+
+func (s *serverAPI) handleResources(mux *http.ServeMux, name string, resources resourceType) {
+	path := prefix + "/" + name
+
+	mux.Handle("GET "+path, s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		query, err := readQuery(r)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		res, err := resources.list(r.Context(), query)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, res)
+	}))
+
+	mux.Handle("POST "+path, s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		var resource map[string]any
+		if err := readJSON(w, r, &resource); err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		created, err := resources.create(r.Context(), resource)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		if meta, ok := created["meta"].(map[string]any); ok {
+			if location, ok := meta["location"].(string); ok {
+				w.Header().Set("Location", location)
+			}
+		}
+		writeJSON(w, http.StatusCreated, created)
+	}))
+
+	mux.Handle("GET "+path+"/{id}", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		resource, err := resources.get(r.Context(), r.PathValue("id"), readProjection(r))
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, resource)
+	}))
+
+	mux.Handle("PUT "+path+"/{id}", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		var resource map[string]any
+		if err := readJSON(w, r, &resource); err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		updated, err := resources.replace(r.Context(), r.PathValue("id"), resource)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, updated)
+	}))
+
+	mux.Handle("PATCH "+path+"/{id}", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		var req scimproto.PatchRequest
+		if err := readJSON(w, r, &req); err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		updated, err := resources.patch(r.Context(), r.PathValue("id"), req.Operations)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, updated)
+	}))
+
+	mux.Handle("DELETE "+path+"/{id}", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		if err := resources.delete(r.Context(), r.PathValue("id")); err != nil {
+			s.writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// authenticated rejects requests without the bearer token of the SCIM
+// client.
+func (s *serverAPI) authenticated(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "bearer") || s.scim.Authenticate(token) != nil {
+			s.log.Warn(
+				"scim request with invalid token",
+				slog.String("path", r.URL.Path),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			writeJSON(w, http.StatusUnauthorized, (&scimproto.Error{
+				Status: http.StatusUnauthorized,
+				Detail: "invalid or missing bearer token",
+			}).Response())
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// readQuery reads the query parameters of RFC 7644 section 3.4.2.
+func readQuery(r *http.Request) (scimservice.Query, error) {
+	params := r.URL.Query()
+
+	query := scimservice.Query{
+		Filter:     params.Get("filter"),
+		StartIndex: 1,
+		Projection: readProjection(r),
+	}
+
+	if value := params.Get("startIndex"); value != "" {
+		startIndex, err := strconv.Atoi(value)
+		if err != nil {
+			return scimservice.Query{}, scimproto.BadRequest(scimproto.ErrorInvalidValue, "startIndex must be an integer")
+		}
+		query.StartIndex = startIndex
+	}
+
+	if value := params.Get("count"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return scimservice.Query{}, scimproto.BadRequest(scimproto.ErrorInvalidValue, "count must be an integer")
+		}
+		query.Count = &count
+	}
+
+	return query, nil
+}
+
+func readProjection(r *http.Request) scimservice.Projection {
+	params := r.URL.Query()
+
+	return scimservice.Projection{
+		Attributes:         splitList(params.Get("attributes")),
+		ExcludedAttributes: splitList(params.Get("excludedAttributes")),
+	}
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, ",")
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, dest any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+	if err := decoder.Decode(dest); err != nil {
+		return scimproto.BadRequest(scimproto.ErrorInvalidSyntax, "the request body must be a JSON object")
+	}
+
+	return nil
+}
+
+func (s *serverAPI) writeError(w http.ResponseWriter, err error) {
+	var scimErr *scimproto.Error
+	if !errors.As(err, &scimErr) {
+		s.log.Error("scim request failed", slog.String("error", err.Error()))
+		scimErr = &scimproto.Error{
+			Status: http.StatusInternalServerError,
+			Detail: "internal error",
+		}
+	}
+
+	writeJSON(w, scimErr.Status, scimErr.Response())
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
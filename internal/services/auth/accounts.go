@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+var (
+	ErrAccountDisabled    = errors.New("account is disabled")
+	ErrAccountLocked      = errors.New("account is locked")
+	ErrAccountNotVerified = errors.New("account is pending verification")
+	ErrAccountDeleted     = errors.New("account is deleted")
+	ErrInvalidStatus      = errors.New("invalid account status")
+)
+
+type AccountManager interface {
+	SetUserStatus(
+		ctx context.Context,
+		userID int64,
+		status models.UserStatus,
+		reason string,
+		changedAt time.Time,
+	) error
+	SetUserAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	PurgeUsers(ctx context.Context, deletedBefore time.Time, purgedAt time.Time) ([]int64, error)
+}
+
+// checkStatus returns an error describing why user may not authenticate, or
+// nil if the account is active.
+func checkStatus(user models.User) error {
+	switch user.Status {
+	case models.UserStatusActive:
+		return nil
+	case models.UserStatusDisabled:
+		return ErrAccountDisabled
+	case models.UserStatusLocked:
+		return ErrAccountLocked
+	case models.UserStatusPendingVerification:
+		return ErrAccountNotVerified
+	case models.UserStatusDeleted:
+		return ErrAccountDeleted
+	default:
+		return ErrInvalidStatus
+	}
+}
+
+// SetUserStatus changes the status of an account on behalf of an admin.
+// Any status other than active also revokes the user's sessions.
+func (auth *Auth) SetUserStatus(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+	status models.UserStatus,
+	reason string,
+) error {
+	const operation = "auth.SetUserStatus"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("user_id", userID),
+		slog.String("status", string(status)),
+	)
+
+	if !status.Valid() {
+		return fmt.Errorf("%s: %w", operation, ErrInvalidStatus)
+	}
+
+	if err := auth.changeStatus(ctx, caller, userID, status, reason); err != nil {
+		log.Error("failed to change account status")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log.Info("account status changed", slog.Int64("changed_by", caller.UserID))
+
+	return nil
+}
+
+// DeleteUser soft-deletes an account on behalf of an admin. The account can
+// be restored by setting it back to active until the deletion grace period
+// runs out and it is purged.
+func (auth *Auth) DeleteUser(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+	reason string,
+) error {
+	const operation = "auth.DeleteUser"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("user_id", userID),
+	)
+
+	if err := auth.changeStatus(ctx, caller, userID, models.UserStatusDeleted, reason); err != nil {
+		log.Error("failed to delete account")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log.Info(
+		"account deleted",
+		slog.Int64("deleted_by", caller.UserID),
+		slog.Time("purge_after", time.Now().Add(auth.deletionGracePeriod)),
+	)
+
+	return nil
+}
+
+func (auth *Auth) changeStatus(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+	status models.UserStatus,
+	reason string,
+) error {
+	if userID == caller.UserID {
+		// Admins locking themselves out is never what they meant to do.
+		return ErrPermissionDenied
+	}
+
+	if _, err := auth.resolveTargetUser(ctx, caller, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := auth.accountManager.SetUserStatus(ctx, userID, status, reason, now); err != nil {
+		return err
+	}
+
+	if status != models.UserStatusActive {
+		if _, err := auth.sessionProvider.RevokeUserSessions(ctx, userID, "", now); err != nil {
+			return err
+		}
+	}
+
+	action := models.AuditAccountStatusChanged
+	if status == models.UserStatusDeleted {
+		action = models.AuditAccountDeleted
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  userID,
+		ActorID: caller.UserID,
+		Action:  action,
+		Details: map[string]string{"status": string(status), "reason": reason},
+	})
+
+	return nil
+}
+
+// PurgeDeletedUsers erases the accounts whose deletion grace period is over.
+func (auth *Auth) PurgeDeletedUsers(ctx context.Context) (int64, error) {
+	const operation = "auth.PurgeDeletedUsers"
+
+	now := time.Now()
+
+	userIDs, err := auth.accountManager.PurgeUsers(ctx, now.Add(-auth.deletionGracePeriod), now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	for _, userID := range userIDs {
+		auth.audit(ctx, models.AuditEvent{
+			UserID: userID,
+			Action: models.AuditAccountPurged,
+		})
+	}
+
+	if len(userIDs) > 0 {
+		auth.log.Info(
+			"purged deleted accounts",
+			slog.String("operation", operation),
+			slog.Int("count", len(userIDs)),
+		)
+	}
+
+	return int64(len(userIDs)), nil
+}
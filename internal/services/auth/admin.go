@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+// AdminChecker tells whether a user is an admin.
+type AdminChecker interface {
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+}
+
+// RequireAdmin fails with ErrPermissionDenied unless caller is an admin
+// acting as themselves. The services admins manage gia-sso through share
+// it, so that they all draw the line in the same place.
+func RequireAdmin(ctx context.Context, users AdminChecker, caller jwt.Claims) error {
+	if caller.Actor != nil {
+		return ErrPermissionDenied
+	}
+
+	isAdmin, err := users.IsAdmin(ctx, caller.UserID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
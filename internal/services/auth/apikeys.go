@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+var (
+	// ErrInvalidExpiry is returned for API keys that would expire in the
+	// past.
+	ErrInvalidExpiry = errors.New("expiry must be in the future")
+	// ErrScopeNotAllowed is returned for API key scopes that are not
+	// configured or that the caller was not granted, and for keys without
+	// any scope.
+	ErrScopeNotAllowed = errors.New("scope not allowed")
+)
+
+// apiKeyPrefixLength is how many characters of the secret part of a key are
+// kept as its visible prefix.
+const apiKeyPrefixLength = 8
+
+type APIKeyStorage interface {
+	SaveAPIKey(ctx context.Context, key models.APIKey, keyHash []byte) error
+	APIKey(ctx context.Context, keyID string) (models.APIKey, error)
+	APIKeyByHash(ctx context.Context, keyHash []byte) (models.APIKey, error)
+	APIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID string, usedAt time.Time) error
+	RevokeAPIKey(ctx context.Context, keyID string, revokedAt time.Time) error
+}
+
+// CreateAPIKey creates an API key that grants scopes until expiresAt, or
+// until it is revoked when expiresAt is zero. The key belongs to userID,
+// which is the caller when zero or else a service account they manage. The
+// key is returned only here; afterwards only its prefix is known. Keys can
+// only be created with the user's own tokens, not delegated or client ones,
+// and only with configured scopes the caller's token covers.
+func (auth *Auth) CreateAPIKey(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+	name string,
+	scopes []string,
+	expiresAt time.Time,
+) (models.APIKey, string, error) {
+	const operation = "auth.CreateAPIKey"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	if caller.Actor != nil || caller.ClientID != "" {
+		return models.APIKey{}, "", fmt.Errorf("%s: %w", operation, ErrPermissionDenied)
+	}
+
+	if userID == 0 {
+		userID = caller.UserID
+	}
+	if userID != caller.UserID {
+		// Admins may create keys for any service account, but never for
+		// another person.
+		if _, err := auth.managedServiceAccount(ctx, caller, userID); err != nil {
+			return models.APIKey{}, "", fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	keyScopes, err := auth.apiKeyScopesFor(caller, scopes)
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		return models.APIKey{}, "", fmt.Errorf("%s: %w", operation, ErrInvalidExpiry)
+	}
+
+	keyID, err := random.Token(9)
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	secret, err := random.Token(32)
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+	secret = models.APIKeyPrefix + secret
+
+	key := models.APIKey{
+		ID:        keyID,
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:len(models.APIKeyPrefix)+apiKeyPrefixLength],
+		Scopes:    keyScopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := auth.apiKeyStorage.SaveAPIKey(ctx, key, random.Hash(secret)); err != nil {
+		log.Error("failed to save api key")
+		return models.APIKey{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  userID,
+		ActorID: caller.UserID,
+		Action:  models.AuditAPIKeyCreated,
+		Details: map[string]string{"api_key_id": key.ID, "name": key.Name},
+	})
+
+	log.Info("api key created", slog.String("api_key_id", key.ID), slog.Int64("user_id", userID))
+
+	return key, secret, nil
+}
+
+// APIKeys returns the API keys of userID that are not revoked. A zero
+// userID means the caller's own keys; listing anyone else's requires owning
+// the service account userID or admin rights.
+func (auth *Auth) APIKeys(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+) ([]models.APIKey, error) {
+	const operation = "auth.APIKeys"
+
+	userID, err := auth.apiKeyOwner(ctx, caller, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	keys, err := auth.apiKeyStorage.APIKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key. Users may revoke their own keys and
+// those of the service accounts they own, admins may revoke anyone's.
+func (auth *Auth) RevokeAPIKey(
+	ctx context.Context,
+	caller jwt.Claims,
+	keyID string,
+) error {
+	const operation = "auth.RevokeAPIKey"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("api_key_id", keyID),
+	)
+
+	key, err := auth.apiKeyStorage.APIKey(ctx, keyID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, err := auth.apiKeyOwner(ctx, caller, key.UserID); err != nil {
+		// Do not disclose that the key exists to someone who cannot see it.
+		if errors.Is(err, ErrPermissionDenied) {
+			return fmt.Errorf("%s: %w", operation, storage.ErrAPIKeyNotFound)
+		}
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.apiKeyStorage.RevokeAPIKey(ctx, keyID, time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  key.UserID,
+		ActorID: caller.UserID,
+		Action:  models.AuditAPIKeyRevoked,
+		Details: map[string]string{"api_key_id": key.ID, "name": key.Name},
+	})
+
+	log.Info("api key revoked", slog.Int64("revoked_by", caller.UserID))
+
+	return nil
+}
+
+// VerifyAPIKey checks that an API key is neither revoked nor expired and
+// that its account is still active. The principal is returned as the
+// claims of an access token with the scopes of the key and no session.
+func (auth *Auth) VerifyAPIKey(
+	ctx context.Context,
+	secret string,
+) (jwt.Claims, error) {
+	const operation = "auth.VerifyAPIKey"
+
+	if !strings.HasPrefix(secret, models.APIKeyPrefix) {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+	}
+
+	key, err := auth.apiKeyStorage.APIKeyByHash(ctx, random.Hash(secret))
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+		}
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Keys created without scopes before they were required are not
+	// honoured, as they would grant everything.
+	now := time.Now()
+	if !key.IsActive(now) || len(key.Scopes) == 0 {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, key.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+		}
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if now.Sub(key.LastUsedAt) > touchInterval {
+		if err := auth.apiKeyStorage.TouchAPIKey(ctx, key.ID, now); err != nil {
+			auth.log.Warn(
+				"failed to update api key last used time",
+				slog.String("operation", operation),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	return jwt.Claims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		Scope:         strings.Join(key.Scopes, " "),
+		APIKeyID:      key.ID,
+		PrincipalType: user.PrincipalType,
+		ExpiresAt:     key.ExpiresAt,
+	}, nil
+}
+
+// apiKeyOwner resolves whose API keys the caller asks for: their own for a
+// zero userID, those of a service account they own, or, for admins, anyone's.
+func (auth *Auth) apiKeyOwner(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+) (int64, error) {
+	if userID == 0 || userID == caller.UserID {
+		return caller.UserID, nil
+	}
+
+	account, err := auth.serviceAccounts.ServiceAccount(ctx, userID)
+	switch {
+	case err == nil && account.OwnerID == caller.UserID:
+		return account.ID, nil
+	case err != nil && !errors.Is(err, storage.ErrServiceAccountNotFound):
+		return 0, err
+	}
+
+	return auth.resolveTargetUser(ctx, caller, userID)
+}
+
+// apiKeyScopesFor returns the distinct scopes of a key. Scopes are separated
+// by spaces like OAuth scopes, so a scope with spaces is split up. Every
+// scope must be configured for API keys and, when the caller's token is
+// scoped, granted to the caller, and at least one is required.
+func (auth *Auth) apiKeyScopesFor(caller jwt.Claims, scopes []string) ([]string, error) {
+	unique := []string{}
+	for _, scope := range strings.Fields(strings.Join(scopes, " ")) {
+		if slices.Contains(unique, scope) {
+			continue
+		}
+
+		if !slices.Contains(auth.apiKeyScopes, scope) {
+			return nil, fmt.Errorf("%w: %s", ErrScopeNotAllowed, scope)
+		}
+		if caller.Scope != "" && !slices.Contains(strings.Fields(caller.Scope), scope) {
+			return nil, fmt.Errorf("%w: %s", ErrScopeNotAllowed, scope)
+		}
+
+		unique = append(unique, scope)
+	}
+
+	// A key without scopes would verify as an unscoped token, which is
+	// trusted with everything.
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("%w: no scopes", ErrScopeNotAllowed)
+	}
+
+	return unique, nil
+}
@@ -0,0 +1,148 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+func TestCreateAPIKeyScopes(t *testing.T) {
+	e := newEnv(t, auth.Config{APIKeyScopes: []string{"read", "write"}})
+	ctx := context.Background()
+
+	userID := e.register(t, "user@example.com")
+	otherID := e.register(t, "other@example.com")
+	caller := jwt.Claims{UserID: userID}
+
+	tests := []struct {
+		name    string
+		caller  jwt.Claims
+		userID  int64
+		scopes  []string
+		want    []string
+		wantErr error
+	}{
+		{name: "split and deduplicated", caller: caller, scopes: []string{"read write", "read"}, want: []string{"read", "write"}},
+		{name: "no scopes", caller: caller, wantErr: auth.ErrScopeNotAllowed},
+		{name: "blank scopes", caller: caller, scopes: []string{" "}, wantErr: auth.ErrScopeNotAllowed},
+		{name: "scope not configured", caller: caller, scopes: []string{"read", "admin"}, wantErr: auth.ErrScopeNotAllowed},
+		{
+			name:    "scope beyond the caller's token",
+			caller:  jwt.Claims{UserID: userID, Scope: "read"},
+			scopes:  []string{"write"},
+			wantErr: auth.ErrScopeNotAllowed,
+		},
+		{name: "scope within the caller's token", caller: jwt.Claims{UserID: userID, Scope: "read"}, scopes: []string{"read"}, want: []string{"read"}},
+		{
+			name:    "token issued to a client",
+			caller:  jwt.Claims{UserID: userID, ClientID: "app"},
+			scopes:  []string{"read"},
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name:    "delegated token",
+			caller:  jwt.Claims{UserID: userID, Actor: &models.Actor{Subject: "2"}},
+			scopes:  []string{"read"},
+			wantErr: auth.ErrPermissionDenied,
+		},
+		// Keys for others are only made for service accounts.
+		{name: "another person", caller: caller, userID: otherID, scopes: []string{"read"}, wantErr: storage.ErrServiceAccountNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, secret, err := e.auth.CreateAPIKey(ctx, tt.caller, tt.userID, tt.name, tt.scopes, time.Time{})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Join(key.Scopes, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("scopes = %v, want %v", key.Scopes, tt.want)
+			}
+
+			claims, err := e.auth.VerifyAPIKey(ctx, secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != userID || claims.APIKeyID != key.ID || claims.Scope != strings.Join(tt.want, " ") {
+				t.Errorf("claims = %+v, want user %d with scope %q", claims, userID, strings.Join(tt.want, " "))
+			}
+		})
+	}
+}
+
+func TestVerifyAPIKey(t *testing.T) {
+	e := newEnv(t, auth.Config{APIKeyScopes: []string{"read"}})
+	ctx := context.Background()
+
+	userID := e.register(t, "user@example.com")
+	caller := jwt.Claims{UserID: userID}
+
+	newKey := func(t *testing.T, name string) (models.APIKey, string) {
+		t.Helper()
+
+		key, secret, err := e.auth.CreateAPIKey(ctx, caller, 0, name, []string{"read"}, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(secret, key.Prefix) {
+			t.Fatalf("secret does not start with the prefix %q", key.Prefix)
+		}
+
+		return key, secret
+	}
+
+	if _, _, err := e.auth.CreateAPIKey(ctx, caller, 0, "past", []string{"read"}, time.Now().Add(-time.Minute)); !errors.Is(err, auth.ErrInvalidExpiry) {
+		t.Fatalf("expiry in the past: err = %v, want ErrInvalidExpiry", err)
+	}
+
+	_, secret := newKey(t, "valid")
+	for name, bad := range map[string]string{
+		"tampered":  secret + "x",
+		"no prefix": strings.TrimPrefix(secret, models.APIKeyPrefix),
+		"empty":     "",
+	} {
+		if _, err := e.auth.VerifyAPIKey(ctx, bad); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("%s key: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+
+	expired, expiredSecret := newKey(t, "expired")
+	e.exec(t, "UPDATE api_keys SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Minute).UTC(), expired.ID)
+	if _, err := e.auth.VerifyAPIKey(ctx, expiredSecret); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("expired key: err = %v, want ErrInvalidToken", err)
+	}
+
+	revoked, revokedSecret := newKey(t, "revoked")
+	if err := e.auth.RevokeAPIKey(ctx, caller, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.auth.VerifyAPIKey(ctx, revokedSecret); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("revoked key: err = %v, want ErrInvalidToken", err)
+	}
+
+	// Keys stored without scopes must not pass for unscoped tokens.
+	unscoped, unscopedSecret := newKey(t, "unscoped")
+	e.exec(t, "UPDATE api_keys SET scopes = '' WHERE id = ?", unscoped.ID)
+	if _, err := e.auth.VerifyAPIKey(ctx, unscopedSecret); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("key without scopes: err = %v, want ErrInvalidToken", err)
+	}
+
+	e.exec(t, "UPDATE users SET status = ? WHERE id = ?", string(models.UserStatusDisabled), userID)
+	if _, err := e.auth.VerifyAPIKey(ctx, secret); !errors.Is(err, auth.ErrAccountDisabled) {
+		t.Errorf("key of a disabled account: err = %v, want ErrAccountDisabled", err)
+	}
+}
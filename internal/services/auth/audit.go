@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+)
+
+type AuditLogger interface {
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+	AuditEvents(ctx context.Context, userID int64) ([]models.AuditEvent, error)
+}
+
+// audit records an audit event. Failing to record one is logged but does not
+// fail the operation being audited.
+func (auth *Auth) audit(ctx context.Context, event models.AuditEvent) {
+	event.CreatedAt = time.Now()
+
+	if err := auth.auditLogger.SaveAuditEvent(ctx, event); err != nil {
+		auth.log.Error(
+			"failed to save audit event",
+			slog.String("action", event.Action),
+			slog.Int64("user_id", event.UserID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -10,38 +10,157 @@ import (
 	"github.com/VariableSan/gia-sso/internal/domain/models"
 	"github.com/VariableSan/gia-sso/internal/storage"
 	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/validator"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
 type Auth struct {
-	log          *slog.Logger
-	userProvider UserProvider
-	tokenTTL     time.Duration
+	log                 *slog.Logger
+	userProvider        UserProvider
+	sessionProvider     SessionProvider
+	accountManager      AccountManager
+	auditLogger         AuditLogger
+	passwordManager     PasswordManager
+	grantProvider       GrantProvider
+	identityStorage     IdentityStorage
+	provisioning        ProvisioningProvider
+	apiKeyStorage       APIKeyStorage
+	serviceAccounts     ServiceAccountStorage
+	emailLoginStorage   EmailLoginStorage
+	invitationStorage   InvitationStorage
+	orgStorage          OrgStorage
+	profileStorage      ProfileStorage
+	phoneCodeStorage    PhoneCodeStorage
+	directory           Directory
+	jwtSecret           string
+	tokenTTL            time.Duration
+	refreshTokenTTL     time.Duration
+	stepUpTokenTTL      time.Duration
+	deletionGracePeriod time.Duration
+	passwordPolicy      PasswordPolicy
+	emailNormalizer     validator.EmailNormalizer
+	emailLogin          EmailLoginConfig
+	mailer              Mailer
+	registration        RegistrationConfig
+	claimMapping        jwt.ClaimMapping
+	phone               PhoneConfig
+	smsSender           SMSSender
+	apiKeyScopes        []string
+}
+
+// Config holds the settings of the auth service.
+type Config struct {
+	JWTSecret       string
+	TokenTTL        time.Duration
+	RefreshTokenTTL time.Duration
+	// StepUpTokenTTL is how long the elevated tokens issued by StepUp are
+	// valid.
+	StepUpTokenTTL time.Duration
+	// DeletionGracePeriod is how long soft-deleted accounts are kept before
+	// their personal data is purged.
+	DeletionGracePeriod time.Duration
+	PasswordPolicy      PasswordPolicy
+	EmailNormalizer     validator.EmailNormalizer
+	// Directory, when set, is where passwords are checked first. Users it
+	// does not know log in with their local password.
+	Directory Directory
+	// EmailLogin configures logins with a code or link sent by Mailer.
+	EmailLogin EmailLoginConfig
+	Mailer     Mailer
+	// Registration decides who may register and how invitations work.
+	Registration RegistrationConfig
+	// ClaimMapping selects the profile attributes added to access tokens.
+	ClaimMapping jwt.ClaimMapping
+	// Phone configures the codes sent by SMSSender. A nil SMSSender
+	// disables phone verification and SMS codes.
+	Phone     PhoneConfig
+	SMSSender SMSSender
+	// APIKeyScopes are the only scopes API keys can be created with.
+	APIKeyScopes []string
 }
 
 type UserProvider interface {
-	User(ctx context.Context, email string) (models models.User, err error)
+	User(ctx context.Context, emailNormalized string) (models models.User, err error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
 	IsAdmin(ctx context.Context, userID int64) (bool, error)
 	SaveUser(
 		ctx context.Context,
 		email string,
+		emailNormalized string,
 		passHash []byte,
 	) (int64, error)
 }
 
+// ProvisioningProvider reads what SCIM clients stored about a user.
+type ProvisioningProvider interface {
+	SCIMUser(ctx context.Context, userID int64) (models.SCIMUser, error)
+}
+
+// GrantProvider lists the consent a user has given OAuth clients.
+type GrantProvider interface {
+	OAuthGrants(ctx context.Context, userID int64) ([]models.OAuthGrant, error)
+}
+
 type Provider interface {
 	UserProvider
+	SessionProvider
+	AccountManager
+	AuditLogger
+	PasswordManager
+	GrantProvider
+	IdentityStorage
+	ProvisioningProvider
+	APIKeyStorage
+	ServiceAccountStorage
+	EmailLoginStorage
+	InvitationStorage
+	OrgStorage
+	ProfileStorage
+	PhoneCodeStorage
 }
 
 func New(
 	log *slog.Logger,
 	provider Provider,
-	tokenTTL time.Duration,
+	cfg Config,
 ) *Auth {
 	return &Auth{
-		log:          log,
-		userProvider: provider,
-		tokenTTL:     tokenTTL,
+		log:                 log,
+		userProvider:        provider,
+		sessionProvider:     provider,
+		accountManager:      provider,
+		auditLogger:         provider,
+		passwordManager:     provider,
+		grantProvider:       provider,
+		identityStorage:     provider,
+		provisioning:        provider,
+		apiKeyStorage:       provider,
+		serviceAccounts:     provider,
+		emailLoginStorage:   provider,
+		invitationStorage:   provider,
+		orgStorage:          provider,
+		profileStorage:      provider,
+		phoneCodeStorage:    provider,
+		directory:           cfg.Directory,
+		jwtSecret:           cfg.JWTSecret,
+		tokenTTL:            cfg.TokenTTL,
+		refreshTokenTTL:     cfg.RefreshTokenTTL,
+		stepUpTokenTTL:      cfg.StepUpTokenTTL,
+		deletionGracePeriod: cfg.DeletionGracePeriod,
+		passwordPolicy:      cfg.PasswordPolicy,
+		emailNormalizer:     cfg.EmailNormalizer,
+		emailLogin:          cfg.EmailLogin,
+		mailer:              cfg.Mailer,
+		registration:        cfg.Registration,
+		claimMapping:        cfg.ClaimMapping,
+		phone:               cfg.Phone,
+		smsSender:           cfg.SMSSender,
+		apiKeyScopes:        cfg.APIKeyScopes,
 	}
 }
 
@@ -49,8 +168,8 @@ func (auth *Auth) Login(
 	ctx context.Context,
 	email string,
 	password string,
-	jwtSecret string,
-) (string, error) {
+	client models.ClientInfo,
+) (models.TokenPair, error) {
 	const operation = "auth.Login"
 
 	log := auth.log.With(
@@ -59,36 +178,69 @@ func (auth *Auth) Login(
 
 	log.Info("attempting to login user")
 
-	user, err := auth.userProvider.User(ctx, email)
+	if auth.directory != nil {
+		tokens, err := auth.directoryLogin(ctx, email, password, client)
+		if !errors.Is(err, errNotInDirectory) {
+			if err != nil {
+				return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+			}
+			return tokens, nil
+		}
+	}
+
+	user, err := auth.userByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			auth.log.Warn("user not found")
-			return "", fmt.Errorf("%s: %w", operation, storage.ErrInvalidCredentials)
+			return models.TokenPair{}, fmt.Errorf("%s: %w", operation, storage.ErrInvalidCredentials)
 		}
 		auth.log.Error("failed to get user")
-		return "", fmt.Errorf("%s: %w", operation, err)
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
 	}
 
 	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
 		auth.log.Error("invalid credentials")
-		return "", fmt.Errorf("%s: %w", operation, storage.ErrInvalidCredentials)
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, storage.ErrInvalidCredentials)
 	}
 
-	token, err := jwt.NewToken(user, jwtSecret, auth.tokenTTL)
+	if err := checkStatus(user); err != nil {
+		log.Warn("login to inactive account", slog.String("status", string(user.Status)))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if auth.passwordExpired(user, time.Now()) {
+		log.Warn("password expired")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, ErrPasswordExpired)
+	}
+
+	tokens, err := auth.startSession(ctx, user, client)
 	if err != nil {
-		auth.log.Error("failed to generate token")
-		return "", fmt.Errorf("%s: %w", operation, err)
+		log.Error("failed to start session")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
 	}
 
+	auth.audit(ctx, models.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   user.ID,
+		Action:    models.AuditLogin,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   map[string]string{"session_id": tokens.SessionID},
+	})
+
 	log.Info("user logged in successfully")
 
-	return token, nil
+	return tokens, nil
 }
 
+// RegisterNewUser creates an account with a password. Depending on the
+// registration mode an invitation for email is required; when one is given,
+// it is used up and its role granted to the new account.
 func (auth *Auth) RegisterNewUser(
 	ctx context.Context,
 	email string,
 	password string,
+	invitationCode string,
 ) (userID int64, err error) {
 	const operation = "auth.RegisterNewUser"
 
@@ -98,23 +250,55 @@ func (auth *Auth) RegisterNewUser(
 
 	log.Info("registering user")
 
+	emailNormalized, err := auth.emailNormalizer.Normalize(email)
+	if err != nil {
+		log.Warn("invalid email")
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	invitation, err := auth.registrationInvitation(ctx, email, emailNormalized, invitationCode)
+	if err != nil {
+		log.Warn("registration not permitted", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.checkNewPassword(ctx, 0, email, password); err != nil {
+		log.Warn("password rejected by policy")
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
 	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Error("failed to generate password hash")
 		return 0, fmt.Errorf("%s: %w", operation, err)
 	}
 
-	id, err := auth.userProvider.SaveUser(ctx, email, passHash)
+	id, err := auth.saveNewUser(ctx, email, emailNormalized, passHash, invitation)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserExists) {
+		switch {
+		case errors.Is(err, storage.ErrUserExists):
 			log.Warn("user already exists")
 			return 0, fmt.Errorf("%s: %w", operation, storage.ErrUserExists)
+		case errors.Is(err, ErrInvalidInvitation):
+			log.Warn("invitation used concurrently")
+			return 0, fmt.Errorf("%s: %w", operation, err)
 		}
 
 		log.Error("failed to save user")
 		return 0, fmt.Errorf("%s: %w", operation, err)
 	}
 
+	event := models.AuditEvent{
+		UserID:  id,
+		ActorID: id,
+		Action:  models.AuditUserRegistered,
+	}
+	if invitation.ID != "" {
+		event.Details = map[string]string{"invitation_id": invitation.ID}
+	}
+
+	auth.audit(ctx, event)
+
 	log.Info("user registered")
 
 	return id, nil
@@ -141,3 +325,13 @@ func (auth *Auth) IsAdmin(
 
 	return isAdmin, nil
 }
+
+// userByEmail looks a user up by any spelling of their email address.
+func (auth *Auth) userByEmail(ctx context.Context, email string) (models.User, error) {
+	emailNormalized, err := auth.emailNormalizer.Normalize(email)
+	if err != nil {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return auth.userProvider.User(ctx, emailNormalized)
+}
@@ -0,0 +1,111 @@
+package auth_test
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite/sqlitetest"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+const testPassword = "correct horse battery"
+
+// env is an auth service over a fresh database.
+type env struct {
+	storage *sqlite.Storage
+	auth    *auth.Auth
+	// db is a second handle on the database, to arrange states the service
+	// cannot be asked for, such as expired records.
+	db *sql.DB
+}
+
+// newEnv returns an auth service configured by cfg, with the token and
+// password settings every test needs filled in where cfg leaves them out.
+func newEnv(t *testing.T, cfg auth.Config) env {
+	t.Helper()
+
+	path := sqlitetest.Path(t)
+
+	storage, err := sqlite.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if cfg.JWTSecret == "" {
+		cfg.JWTSecret = "secret"
+	}
+	if cfg.TokenTTL == 0 {
+		cfg.TokenTTL = time.Hour
+	}
+	if cfg.RefreshTokenTTL == 0 {
+		cfg.RefreshTokenTTL = time.Hour
+	}
+	if cfg.StepUpTokenTTL == 0 {
+		cfg.StepUpTokenTTL = 5 * time.Minute
+	}
+	if cfg.PasswordPolicy.MinLength == 0 {
+		cfg.PasswordPolicy.PasswordPolicy = validator.PasswordPolicy{MinLength: 8}
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return env{
+		storage: storage,
+		auth:    auth.New(log, storage, cfg),
+		db:      db,
+	}
+}
+
+// register creates a user with email and testPassword.
+func (e env) register(t *testing.T, email string) int64 {
+	t.Helper()
+
+	userID, err := e.auth.RegisterNewUser(context.Background(), email, testPassword, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return userID
+}
+
+// login logs in with email and testPassword and returns the claims of the
+// access token.
+func (e env) login(t *testing.T, email string) (models.TokenPair, jwt.Claims) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	tokens, err := e.auth.Login(ctx, email, testPassword, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := e.auth.VerifyToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokens, claims
+}
+
+func (e env) exec(t *testing.T, query string, args ...any) {
+	t.Helper()
+
+	if _, err := e.db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+// StartBrowserSession turns the session tokens were issued for by Login
+// into a browser session of the hosted login pages and returns the token
+// for its cookie. The refresh token of tokens stops working: browser
+// sessions cannot be refreshed, so the cookie is useless to RefreshToken.
+func (auth *Auth) StartBrowserSession(
+	ctx context.Context,
+	tokens models.TokenPair,
+) (string, models.Session, error) {
+	const operation = "auth.StartBrowserSession"
+
+	session, err := auth.sessionByRefreshToken(ctx, tokens.RefreshToken)
+	if err != nil {
+		return "", models.Session{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	cookie, err := random.Token(32)
+	if err != nil {
+		return "", models.Session{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.sessionProvider.StartBrowserSession(ctx, session.ID, random.Hash(cookie)); err != nil {
+		return "", models.Session{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	session.Browser = true
+
+	return cookie, session, nil
+}
+
+// BrowserSession returns the browser session whose cookie holds token.
+func (auth *Auth) BrowserSession(
+	ctx context.Context,
+	token string,
+) (models.Session, error) {
+	const operation = "auth.BrowserSession"
+
+	session, err := auth.sessionByRefreshToken(ctx, token)
+	if err != nil {
+		return models.Session{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !session.Browser {
+		return models.Session{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+	}
+
+	return session, nil
+}
+
+// sessionByRefreshToken returns the active session of an active user that
+// Login opened with refreshToken, or the browser session with that cookie.
+func (auth *Auth) sessionByRefreshToken(
+	ctx context.Context,
+	refreshToken string,
+) (models.Session, error) {
+	session, err := auth.sessionProvider.SessionByRefreshHash(ctx, random.Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return models.Session{}, ErrInvalidToken
+		}
+		return models.Session{}, err
+	}
+
+	if session.ClientID != "" || !session.IsActive(time.Now()) {
+		return models.Session{}, ErrInvalidToken
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, session.UserID)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	if err := checkStatus(user); err != nil {
+		return models.Session{}, err
+	}
+
+	return session, nil
+}
+
+// StartClientSession opens a session for an OAuth client on behalf of the
+// user of the browser session parentID. The client session lives on its own
+// refresh token but is revoked together with its parent.
+func (auth *Auth) StartClientSession(
+	ctx context.Context,
+	parentID string,
+	client models.OAuthClient,
+	scope string,
+) (models.TokenPair, error) {
+	const operation = "auth.StartClientSession"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("client_id", client.ID),
+	)
+
+	parent, err := auth.sessionProvider.Session(ctx, parentID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !parent.IsActive(time.Now()) {
+		log.Warn("parent session is no longer active", slog.String("session_id", parentID))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, parent.UserID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	accessTTL, refreshTTL := auth.tokenLifetimes(client)
+
+	tokens, err := auth.openSession(ctx, user, models.Session{
+		Device:    parent.Device,
+		IP:        parent.IP,
+		UserAgent: parent.UserAgent,
+		ClientID:  client.ID,
+		ParentID:  parent.ID,
+		Scope:     scope,
+		AuthTime:  parent.AuthTime,
+		AMR:       parent.AMR,
+		ExpiresAt: time.Now().Add(refreshTTL),
+	}, accessTTL)
+	if err != nil {
+		log.Error("failed to start session")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   user.ID,
+		Action:    models.AuditClientAuthorized,
+		IP:        parent.IP,
+		UserAgent: parent.UserAgent,
+		Details: map[string]string{
+			"client_id":  client.ID,
+			"scope":      scope,
+			"session_id": tokens.SessionID,
+		},
+	})
+
+	log.Info("client session started", slog.String("session_id", tokens.SessionID))
+
+	return tokens, nil
+}
+
+// RefreshClientSession is Refresh for sessions opened by StartClientSession.
+// The refresh token is only accepted from the client it was issued to.
+func (auth *Auth) RefreshClientSession(
+	ctx context.Context,
+	client models.OAuthClient,
+	refreshToken string,
+) (models.TokenPair, error) {
+	const operation = "auth.RefreshClientSession"
+
+	tokens, err := auth.refresh(ctx, operation, client, refreshToken)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return tokens, nil
+}
+
+// RevokeClientSession revokes a client session without a caller, e.g. when
+// the authorization code it was created from is replayed.
+func (auth *Auth) RevokeClientSession(
+	ctx context.Context,
+	sessionID string,
+) error {
+	const operation = "auth.RevokeClientSession"
+
+	session, err := auth.sessionProvider.Session(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if session.ClientID == "" {
+		return fmt.Errorf("%s: %w", operation, storage.ErrSessionNotFound)
+	}
+
+	if err := auth.sessionProvider.RevokeSession(ctx, sessionID, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			// Already revoked.
+			return nil
+		}
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  session.UserID,
+		Action:  models.AuditSessionRevoked,
+		Details: map[string]string{"session_id": sessionID, "client_id": session.ClientID},
+	})
+
+	auth.log.Info(
+		"client session revoked",
+		slog.String("operation", operation),
+		slog.String("session_id", sessionID),
+	)
+
+	return nil
+}
+
+// EndBrowserSession ends a browser session of the hosted login pages along
+// with the client sessions opened from it, which it returns.
+func (auth *Auth) EndBrowserSession(
+	ctx context.Context,
+	session models.Session,
+) ([]models.Session, error) {
+	const operation = "auth.EndBrowserSession"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("session_id", session.ID),
+	)
+
+	sessions, err := auth.sessionProvider.Sessions(ctx, session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var children []models.Session
+	for _, child := range sessions {
+		if child.ParentID == session.ID {
+			children = append(children, child)
+		}
+	}
+
+	if err := auth.sessionProvider.RevokeSession(ctx, session.ID, time.Now()); err != nil {
+		log.Error("failed to revoke session")
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:    session.UserID,
+		ActorID:   session.UserID,
+		Action:    models.AuditLogout,
+		IP:        session.IP,
+		UserAgent: session.UserAgent,
+		Details:   map[string]string{"session_id": session.ID},
+	})
+
+	log.Info("browser session ended", slog.Int("client_sessions", len(children)))
+
+	return children, nil
+}
@@ -0,0 +1,53 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+)
+
+func TestBrowserSession(t *testing.T) {
+	e := newEnv(t, auth.Config{})
+	ctx := context.Background()
+
+	e.register(t, "user@example.com")
+	tokens, _ := e.login(t, "user@example.com")
+
+	cookie, session, err := e.auth.StartBrowserSession(ctx, tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := e.auth.BrowserSession(ctx, cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != session.ID || !got.Browser {
+		t.Errorf("session = %+v, want browser session %s", got, session.ID)
+	}
+
+	t.Run("cookie is not a refresh token", func(t *testing.T) {
+		if _, err := e.auth.Refresh(ctx, cookie); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Fatalf("err = %v, want %v", err, auth.ErrInvalidToken)
+		}
+	})
+
+	t.Run("login refresh token stops working", func(t *testing.T) {
+		if _, err := e.auth.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Fatalf("err = %v, want %v", err, auth.ErrInvalidToken)
+		}
+	})
+
+	t.Run("refresh token is not a cookie", func(t *testing.T) {
+		other, _ := e.login(t, "user@example.com")
+
+		if _, err := e.auth.BrowserSession(ctx, other.RefreshToken); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Fatalf("err = %v, want %v", err, auth.ErrInvalidToken)
+		}
+		if _, err := e.auth.Refresh(ctx, other.RefreshToken); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// Directory checks passwords in an external directory, such as LDAP or
+// Active Directory.
+type Directory interface {
+	// Authenticate returns storage.ErrUserNotFound for logins the directory
+	// does not know, and storage.ErrInvalidCredentials for wrong passwords.
+	Authenticate(ctx context.Context, login string, password string) (models.DirectoryUser, error)
+}
+
+// errNotInDirectory is returned by directoryLogin for users that log in
+// with their local password instead.
+var errNotInDirectory = errors.New("user not in directory")
+
+// directoryLogin logs in a user with their password in the directory. The
+// local user is provisioned on their first login, or linked by email when
+// the entry has one, and gets the roles the directory assigns.
+func (auth *Auth) directoryLogin(
+	ctx context.Context,
+	login string,
+	password string,
+	client models.ClientInfo,
+) (models.TokenPair, error) {
+	log := auth.log.With(
+		slog.String("operation", "auth.directoryLogin"),
+	)
+
+	directoryUser, err := auth.directory.Authenticate(ctx, login, password)
+	switch {
+	case errors.Is(err, storage.ErrInvalidCredentials):
+		log.Warn("invalid directory credentials")
+		return models.TokenPair{}, storage.ErrInvalidCredentials
+	case errors.Is(err, storage.ErrUserNotFound):
+		return models.TokenPair{}, errNotInDirectory
+	case err != nil:
+		// Local accounts keep working while the directory is down.
+		log.Error("directory unavailable", slog.String("error", err.Error()))
+		return models.TokenPair{}, errNotInDirectory
+	}
+
+	now := time.Now()
+
+	user, err := auth.identityUser(ctx, FederatedIdentity{
+		Provider:      models.ProviderLDAP,
+		Subject:       directoryUser.Subject,
+		Email:         directoryUser.Email,
+		EmailVerified: directoryUser.EmailVerified,
+	}, now)
+	if err != nil {
+		log.Error("failed to find user of directory entry", slog.String("error", err.Error()))
+		return models.TokenPair{}, err
+	}
+
+	if err := checkStatus(user); err != nil {
+		log.Warn("login to inactive account", slog.String("status", string(user.Status)))
+		return models.TokenPair{}, err
+	}
+
+	if directoryUser.Roles != nil {
+		if err := auth.syncRoles(ctx, user.ID, directoryUser.Roles); err != nil {
+			log.Error("failed to update roles", slog.String("error", err.Error()))
+			return models.TokenPair{}, err
+		}
+	}
+
+	tokens, err := auth.startSession(ctx, user, client)
+	if err != nil {
+		log.Error("failed to start session")
+		return models.TokenPair{}, err
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   user.ID,
+		Action:    models.AuditLogin,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details: map[string]string{
+			"session_id": tokens.SessionID,
+			"provider":   models.ProviderLDAP,
+		},
+	})
+
+	log.Info("user logged in through directory", slog.Int64("user_id", user.ID))
+
+	return tokens, nil
+}
+
+// syncRoles grants or revokes the admin role of a user to match the roles
+// the directory assigns them.
+func (auth *Auth) syncRoles(ctx context.Context, userID int64, roles []string) error {
+	isAdmin, err := auth.userProvider.IsAdmin(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	wantAdmin := slices.Contains(roles, models.RoleAdmin)
+	if isAdmin == wantAdmin {
+		return nil
+	}
+
+	if err := auth.accountManager.SetUserAdmin(ctx, userID, wantAdmin); err != nil {
+		return err
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  userID,
+		ActorID: userID,
+		Action:  models.AuditRolesChanged,
+		Details: map[string]string{
+			"admin":    strconv.FormatBool(wantAdmin),
+			"provider": models.ProviderLDAP,
+		},
+	})
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// directory is an auth.Directory with fixed entries, keyed by login.
+type directory map[string]models.DirectoryUser
+
+func (d directory) Authenticate(
+	_ context.Context,
+	login string,
+	password string,
+) (models.DirectoryUser, error) {
+	user, ok := d[login]
+	if !ok {
+		return models.DirectoryUser{}, storage.ErrUserNotFound
+	}
+	if password != testPassword {
+		return models.DirectoryUser{}, storage.ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+func TestDirectoryLogin(t *testing.T) {
+	e := newEnv(t, auth.Config{Directory: directory{
+		"alice": {
+			Subject:       "alice-uuid",
+			Email:         "alice@example.com",
+			EmailVerified: true,
+			Roles:         []string{models.RoleAdmin},
+		},
+		// An entry without a mail attribute: the login stands in for the
+		// email, unverified.
+		"bob": {Subject: "bob-uuid", Email: "bob"},
+	}})
+	e.register(t, "carol@example.com")
+
+	ctx := context.Background()
+
+	t.Run("provisions the user", func(t *testing.T) {
+		tokens, err := e.auth.Login(ctx, "alice", testPassword, models.ClientInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := e.auth.VerifyToken(ctx, tokens.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		isAdmin, err := e.storage.IsAdmin(ctx, claims.UserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isAdmin {
+			t.Error("directory role admin was not granted")
+		}
+	})
+
+	t.Run("entry without email", func(t *testing.T) {
+		_, err := e.auth.Login(ctx, "bob", testPassword, models.ClientInfo{})
+		if !errors.Is(err, auth.ErrEmailNotVerified) {
+			t.Fatalf("err = %v, want %v", err, auth.ErrEmailNotVerified)
+		}
+	})
+
+	t.Run("wrong directory password", func(t *testing.T) {
+		_, err := e.auth.Login(ctx, "alice", "wrong password", models.ClientInfo{})
+		if !errors.Is(err, storage.ErrInvalidCredentials) {
+			t.Fatalf("err = %v, want %v", err, storage.ErrInvalidCredentials)
+		}
+	})
+
+	t.Run("local user not in directory", func(t *testing.T) {
+		e.login(t, "carol@example.com")
+	})
+}
@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+var (
+	ErrEmailLoginDisabled  = errors.New("email login is disabled")
+	ErrInvalidEmailLogin   = errors.New("invalid or expired email login")
+	ErrEmailLoginThrottled = errors.New("email login requested too often")
+)
+
+// emailCodeLength is the number of digits of the codes sent by email.
+const emailCodeLength = 6
+
+// Mailer sends emails to users.
+type Mailer interface {
+	Send(ctx context.Context, msg models.EmailMessage) error
+}
+
+type EmailLoginStorage interface {
+	SaveEmailLogin(ctx context.Context, login models.EmailLogin, secretHash []byte) error
+	EmailLogin(ctx context.Context, loginID string) (models.EmailLogin, []byte, error)
+	EmailLoginByHash(ctx context.Context, secretHash []byte) (models.EmailLogin, error)
+	ThrottleEmailLogin(ctx context.Context, emailNormalized string, requestedAt time.Time, notBefore time.Time) error
+	AddEmailLoginAttempt(ctx context.Context, loginID string) (int, error)
+	UseEmailLogin(ctx context.Context, loginID string, usedAt time.Time) error
+}
+
+// EmailLoginConfig holds the settings of passwordless logins. An empty
+// Method disables them.
+type EmailLoginConfig struct {
+	Method models.EmailLoginMethod
+	// LinkURL is the page of the app magic links point to. The token is
+	// added as the "token" query parameter.
+	LinkURL        string
+	TTL            time.Duration
+	MaxAttempts    int
+	ResendInterval time.Duration
+}
+
+// StartEmailLogin sends a login code or magic link to email. To not
+// disclose which addresses have accounts, a login is returned for unknown
+// and inactive accounts as well; it just cannot be completed. Requests are
+// rate limited per address whether or not it has an account.
+func (auth *Auth) StartEmailLogin(ctx context.Context, email string) (models.EmailLogin, error) {
+	const operation = "auth.StartEmailLogin"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+	)
+
+	cfg := auth.emailLogin
+	if cfg.Method == "" {
+		return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, ErrEmailLoginDisabled)
+	}
+
+	loginID, err := random.Token(16)
+	if err != nil {
+		return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+	login := models.EmailLogin{
+		ID:        loginID,
+		Method:    cfg.Method,
+		ExpiresAt: now.Add(cfg.TTL),
+		CreatedAt: now,
+	}
+
+	emailNormalized, err := auth.emailNormalizer.Normalize(email)
+	if err != nil {
+		log.Warn("email login for invalid address")
+		return login, nil
+	}
+
+	// Addresses without an active account are throttled too, so that the
+	// answer does not tell whether the account exists.
+	err = auth.emailLoginStorage.ThrottleEmailLogin(ctx, emailNormalized, now, now.Add(-cfg.ResendInterval))
+	if err != nil {
+		if errors.Is(err, storage.ErrEmailLoginThrottled) {
+			log.Warn("email login requested too often")
+			return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, ErrEmailLoginThrottled)
+		}
+		return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	user, err := auth.userProvider.User(ctx, emailNormalized)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("email login for unknown user")
+			return login, nil
+		}
+		return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+
+	if err := checkStatus(user); err != nil || user.IsServiceAccount() {
+		log.Warn("email login for inactive account", slog.String("status", string(user.Status)))
+		return login, nil
+	}
+
+	login.UserID = user.ID
+
+	msg, secretHash, err := auth.emailLoginMessage(user, login)
+	if err != nil {
+		return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.emailLoginStorage.SaveEmailLogin(ctx, login, secretHash); err != nil {
+		log.Error("failed to save email login")
+		return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.mailer.Send(ctx, msg); err != nil {
+		log.Error("failed to send email login", slog.String("error", err.Error()))
+		return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log.Info("email login started", slog.String("method", string(login.Method)))
+
+	return login, nil
+}
+
+// CompleteEmailLogin logs a user in with the code sent for the login
+// loginID or with the token of a magic link. Each login can be completed
+// once, and a code login is given up after too many wrong codes.
+func (auth *Auth) CompleteEmailLogin(
+	ctx context.Context,
+	loginID string,
+	code string,
+	token string,
+	client models.ClientInfo,
+) (models.TokenPair, error) {
+	const operation = "auth.CompleteEmailLogin"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+	)
+
+	if auth.emailLogin.Method == "" {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, ErrEmailLoginDisabled)
+	}
+
+	var (
+		login models.EmailLogin
+		err   error
+	)
+	if token != "" {
+		login, err = auth.linkLogin(ctx, token)
+	} else {
+		login, err = auth.codeLogin(ctx, loginID, code)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrEmailLoginNotFound) {
+			log.Warn("invalid email login")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", operation, ErrInvalidEmailLogin)
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log = log.With(slog.Int64("user_id", login.UserID))
+
+	now := time.Now()
+	if !login.IsPending(now) {
+		log.Warn("email login expired or used")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, ErrInvalidEmailLogin)
+	}
+
+	if err := auth.emailLoginStorage.UseEmailLogin(ctx, login.ID, now); err != nil {
+		if errors.Is(err, storage.ErrEmailLoginNotFound) {
+			log.Warn("email login used concurrently")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", operation, ErrInvalidEmailLogin)
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, login.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", operation, ErrInvalidEmailLogin)
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		log.Warn("login to inactive account", slog.String("status", string(user.Status)))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	tokens, err := auth.openSession(ctx, user, models.Session{
+		Device:    client.Device,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		AMR:       []string{models.AMREmail},
+	}, auth.tokenTTL)
+	if err != nil {
+		log.Error("failed to start session")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   user.ID,
+		Action:    models.AuditLogin,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details: map[string]string{
+			"session_id": tokens.SessionID,
+			"method":     models.AMREmail,
+		},
+	})
+
+	log.Info("user logged in by email", slog.String("method", string(login.Method)))
+
+	return tokens, nil
+}
+
+// codeLogin returns the code login loginID if code is its code. Every try
+// counts, so that the short codes cannot be guessed.
+func (auth *Auth) codeLogin(ctx context.Context, loginID string, code string) (models.EmailLogin, error) {
+	login, secretHash, err := auth.emailLoginStorage.EmailLogin(ctx, loginID)
+	if err != nil {
+		return models.EmailLogin{}, err
+	}
+	if login.Method != models.EmailLoginCode {
+		return models.EmailLogin{}, storage.ErrEmailLoginNotFound
+	}
+
+	attempts, err := auth.emailLoginStorage.AddEmailLoginAttempt(ctx, login.ID)
+	if err != nil {
+		return models.EmailLogin{}, err
+	}
+	if attempts > auth.emailLogin.MaxAttempts {
+		return models.EmailLogin{}, storage.ErrEmailLoginNotFound
+	}
+
+	if !hmac.Equal(secretHash, auth.codeHash(login.ID, code)) {
+		return models.EmailLogin{}, storage.ErrEmailLoginNotFound
+	}
+
+	return login, nil
+}
+
+// linkLogin returns the magic link login of token.
+func (auth *Auth) linkLogin(ctx context.Context, token string) (models.EmailLogin, error) {
+	login, err := auth.emailLoginStorage.EmailLoginByHash(ctx, random.Hash(token))
+	if err != nil {
+		return models.EmailLogin{}, err
+	}
+	if login.Method != models.EmailLoginLink {
+		return models.EmailLogin{}, storage.ErrEmailLoginNotFound
+	}
+
+	return login, nil
+}
+
+// emailLoginMessage creates the secret of login and the email that carries
+// it to user. It returns the hash of the secret to be stored.
+func (auth *Auth) emailLoginMessage(
+	user models.User,
+	login models.EmailLogin,
+) (models.EmailMessage, []byte, error) {
+	validFor := login.ExpiresAt.Sub(login.CreatedAt).Round(time.Minute)
+
+	if login.Method == models.EmailLoginLink {
+		token, err := random.Token(32)
+		if err != nil {
+			return models.EmailMessage{}, nil, err
+		}
+
+		link, err := url.Parse(auth.emailLogin.LinkURL)
+		if err != nil {
+			return models.EmailMessage{}, nil, err
+		}
+		query := link.Query()
+		query.Set("token", token)
+		link.RawQuery = query.Encode()
+
+		return models.EmailMessage{
+			To:      user.Email,
+			Subject: "Your login link",
+			Body: fmt.Sprintf(
+				"Open this link to log in:\n\n%s\n\nThe link is valid for %s and can be used once. "+
+					"If you did not try to log in, you can ignore this email.\n",
+				link,
+				validFor,
+			),
+		}, random.Hash(token), nil
+	}
+
+	code, err := random.Code(emailCodeLength, "0123456789")
+	if err != nil {
+		return models.EmailMessage{}, nil, err
+	}
+
+	return models.EmailMessage{
+		To:      user.Email,
+		Subject: "Your login code",
+		Body: fmt.Sprintf(
+			"Your login code is %s.\n\nThe code is valid for %s. "+
+				"If you did not try to log in, you can ignore this email.\n",
+			code,
+			validFor,
+		),
+	}, auth.codeHash(login.ID, code), nil
+}
+
+// codeHash keys the hash of a short code with the id of the login or phone
+// code it was sent for, as different ones can share the same code.
+func (auth *Auth) codeHash(id string, code string) []byte {
+	mac := hmac.New(sha256.New, []byte(auth.jwtSecret))
+	mac.Write([]byte(id))
+	mac.Write([]byte{0})
+	mac.Write([]byte(code))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,333 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+)
+
+// mailer keeps the emails sent instead of sending them.
+type mailer struct {
+	messages []models.EmailMessage
+}
+
+func (m *mailer) Send(_ context.Context, msg models.EmailMessage) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// last returns the last email sent.
+func (m *mailer) last(t *testing.T) models.EmailMessage {
+	t.Helper()
+
+	if len(m.messages) == 0 {
+		t.Fatal("no email sent")
+	}
+
+	return m.messages[len(m.messages)-1]
+}
+
+var (
+	codePattern = regexp.MustCompile(`\b\d{6}\b`)
+	linkPattern = regexp.MustCompile(`https://\S+`)
+)
+
+// emailLoginEnv returns an auth service sending logins of method through m,
+// with a registered user@example.com.
+func emailLoginEnv(t *testing.T, method models.EmailLoginMethod, m *mailer) env {
+	t.Helper()
+
+	e := newEnv(t, auth.Config{
+		EmailLogin: auth.EmailLoginConfig{
+			Method:         method,
+			LinkURL:        "https://app.example.com/login?source=email",
+			TTL:            10 * time.Minute,
+			MaxAttempts:    3,
+			ResendInterval: time.Minute,
+		},
+		Mailer: m,
+	})
+	e.register(t, "user@example.com")
+
+	return e
+}
+
+// linkToken returns the token of the magic link in msg.
+func linkToken(t *testing.T, msg models.EmailMessage) string {
+	t.Helper()
+
+	link, err := url.Parse(linkPattern.FindString(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Query().Get("source") != "email" {
+		t.Errorf("link %s lost the query of the login page", link)
+	}
+
+	token := link.Query().Get("token")
+	if token == "" {
+		t.Fatalf("no token in %q", msg.Body)
+	}
+
+	return token
+}
+
+func TestEmailLoginCode(t *testing.T) {
+	tests := []struct {
+		name string
+		// arrange changes the state of the login before it is completed
+		// with its code.
+		arrange func(t *testing.T, e env, a *auth.Auth, loginID string)
+		wantErr error
+	}{
+		{name: "code"},
+		{
+			name: "replayed code",
+			arrange: func(t *testing.T, e env, a *auth.Auth, loginID string) {
+				e.exec(t, "UPDATE email_logins SET used_at = ? WHERE id = ?", time.Now(), loginID)
+			},
+			wantErr: auth.ErrInvalidEmailLogin,
+		},
+		{
+			name: "expired code",
+			arrange: func(t *testing.T, e env, a *auth.Auth, loginID string) {
+				e.exec(t, "UPDATE email_logins SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Second), loginID)
+			},
+			wantErr: auth.ErrInvalidEmailLogin,
+		},
+		{
+			name: "too many wrong codes",
+			arrange: func(t *testing.T, e env, a *auth.Auth, loginID string) {
+				for range 3 {
+					_, err := a.CompleteEmailLogin(context.Background(), loginID, "wrong", "", models.ClientInfo{})
+					if !errors.Is(err, auth.ErrInvalidEmailLogin) {
+						t.Fatalf("wrong code: got %v, want %v", err, auth.ErrInvalidEmailLogin)
+					}
+				}
+			},
+			wantErr: auth.ErrInvalidEmailLogin,
+		},
+		{
+			name: "account disabled since",
+			arrange: func(t *testing.T, e env, a *auth.Auth, loginID string) {
+				e.exec(t, "UPDATE users SET status = ?", models.UserStatusDisabled)
+			},
+			wantErr: auth.ErrAccountDisabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mailer{}
+			e := emailLoginEnv(t, models.EmailLoginCode, m)
+			ctx := context.Background()
+
+			login, err := e.auth.StartEmailLogin(ctx, "User@Example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := m.last(t)
+			if msg.To != "user@example.com" {
+				t.Errorf("sent to %q", msg.To)
+			}
+			code := codePattern.FindString(msg.Body)
+			if code == "" {
+				t.Fatalf("no code in %q", msg.Body)
+			}
+
+			if tt.arrange != nil {
+				tt.arrange(t, e, e.auth, login.ID)
+			}
+
+			tokens, err := e.auth.CompleteEmailLogin(ctx, login.ID, code, "", models.ClientInfo{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			claims, err := e.auth.VerifyToken(ctx, tokens.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(claims.AMR) != 1 || claims.AMR[0] != models.AMREmail {
+				t.Errorf("amr %v, want [%s]", claims.AMR, models.AMREmail)
+			}
+
+			_, err = e.auth.CompleteEmailLogin(ctx, login.ID, code, "", models.ClientInfo{})
+			if !errors.Is(err, auth.ErrInvalidEmailLogin) {
+				t.Errorf("replay: got %v, want %v", err, auth.ErrInvalidEmailLogin)
+			}
+		})
+	}
+}
+
+func TestEmailLoginWrongCode(t *testing.T) {
+	m := &mailer{}
+	e := emailLoginEnv(t, models.EmailLoginCode, m)
+	ctx := context.Background()
+
+	login, err := e.auth.StartEmailLogin(ctx, "user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := codePattern.FindString(m.last(t).Body)
+
+	tests := []struct {
+		name    string
+		loginID string
+		code    string
+	}{
+		{name: "wrong code", loginID: login.ID, code: "not the code"},
+		{name: "unknown login", loginID: "unknown", code: code},
+		{name: "code as a link token", loginID: "", code: code},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := e.auth.CompleteEmailLogin(ctx, tt.loginID, tt.code, "", models.ClientInfo{})
+			if !errors.Is(err, auth.ErrInvalidEmailLogin) {
+				t.Errorf("got %v, want %v", err, auth.ErrInvalidEmailLogin)
+			}
+		})
+	}
+
+	// Wrong codes below the limit leave the login usable.
+	if _, err := e.auth.CompleteEmailLogin(ctx, login.ID, code, "", models.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmailLoginLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		arrange func(t *testing.T, e env, loginID string)
+		wantErr error
+	}{
+		{name: "link"},
+		{
+			name: "expired link",
+			arrange: func(t *testing.T, e env, loginID string) {
+				e.exec(t, "UPDATE email_logins SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Second), loginID)
+			},
+			wantErr: auth.ErrInvalidEmailLogin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mailer{}
+			e := emailLoginEnv(t, models.EmailLoginLink, m)
+			ctx := context.Background()
+
+			login, err := e.auth.StartEmailLogin(ctx, "user@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			token := linkToken(t, m.last(t))
+
+			if tt.arrange != nil {
+				tt.arrange(t, e, login.ID)
+			}
+
+			_, err = e.auth.CompleteEmailLogin(ctx, "", "", token, models.ClientInfo{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			_, err = e.auth.CompleteEmailLogin(ctx, "", "", token, models.ClientInfo{})
+			if !errors.Is(err, auth.ErrInvalidEmailLogin) {
+				t.Errorf("replay: got %v, want %v", err, auth.ErrInvalidEmailLogin)
+			}
+
+			// The login id alone does not complete a link login.
+			_, err = e.auth.CompleteEmailLogin(ctx, login.ID, "", "", models.ClientInfo{})
+			if !errors.Is(err, auth.ErrInvalidEmailLogin) {
+				t.Errorf("login id: got %v, want %v", err, auth.ErrInvalidEmailLogin)
+			}
+		})
+	}
+}
+
+func TestEmailLoginThrottle(t *testing.T) {
+	m := &mailer{}
+	e := emailLoginEnv(t, models.EmailLoginCode, m)
+	e.register(t, "other@example.com")
+	ctx := context.Background()
+
+	for _, email := range []string{"user@example.com", "nobody@example.com"} {
+		if _, err := e.auth.StartEmailLogin(ctx, email); err != nil {
+			t.Fatalf("%s: %v", email, err)
+		}
+	}
+	if len(m.messages) != 1 {
+		t.Fatalf("sent %d emails, want 1 to the registered address", len(m.messages))
+	}
+
+	// Unknown addresses are throttled alike, so that the answer does not
+	// tell which ones have accounts.
+	for _, email := range []string{"user@example.com", "USER@example.com", "nobody@example.com"} {
+		_, err := e.auth.StartEmailLogin(ctx, email)
+		if !errors.Is(err, auth.ErrEmailLoginThrottled) {
+			t.Errorf("%s: got %v, want %v", email, err, auth.ErrEmailLoginThrottled)
+		}
+	}
+	if len(m.messages) != 1 {
+		t.Errorf("throttled requests sent %d emails", len(m.messages)-1)
+	}
+
+	if _, err := e.auth.StartEmailLogin(ctx, "other@example.com"); err != nil {
+		t.Errorf("other address: %v", err)
+	}
+
+	// Once the interval has passed, the address may ask again.
+	e.exec(t, "UPDATE email_login_requests SET requested_at = ?", time.Now().Add(-2*time.Minute))
+	if _, err := e.auth.StartEmailLogin(ctx, "user@example.com"); err != nil {
+		t.Errorf("after interval: %v", err)
+	}
+}
+
+func TestEmailLoginUnknownAccount(t *testing.T) {
+	m := &mailer{}
+	e := emailLoginEnv(t, models.EmailLoginCode, m)
+	ctx := context.Background()
+
+	login, err := e.auth.StartEmailLogin(ctx, "nobody@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.ID == "" {
+		t.Error("no login returned for an unknown address")
+	}
+	if len(m.messages) != 0 {
+		t.Fatalf("sent %d emails to an unknown address", len(m.messages))
+	}
+
+	_, err = e.auth.CompleteEmailLogin(ctx, login.ID, "000000", "", models.ClientInfo{})
+	if !errors.Is(err, auth.ErrInvalidEmailLogin) {
+		t.Errorf("got %v, want %v", err, auth.ErrInvalidEmailLogin)
+	}
+}
+
+func TestEmailLoginDisabled(t *testing.T) {
+	e := newEnv(t, auth.Config{})
+	ctx := context.Background()
+
+	if _, err := e.auth.StartEmailLogin(ctx, "user@example.com"); !errors.Is(err, auth.ErrEmailLoginDisabled) {
+		t.Errorf("start: got %v, want %v", err, auth.ErrEmailLoginDisabled)
+	}
+	if _, err := e.auth.CompleteEmailLogin(ctx, "id", "000000", "", models.ClientInfo{}); !errors.Is(err, auth.ErrEmailLoginDisabled) {
+		t.Errorf("complete: got %v, want %v", err, auth.ErrEmailLoginDisabled)
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+// DelegateToken issues a token for the subject of an access token, so that
+// exchange.Actor can call another service on the subject's behalf. The new
+// token lives on the session of the subject token.
+func (auth *Auth) DelegateToken(
+	ctx context.Context,
+	subject jwt.Claims,
+	exchange models.TokenExchange,
+) (string, error) {
+	const operation = "auth.DelegateToken"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("client_id", exchange.ClientID),
+		slog.Int64("user_id", subject.UserID),
+	)
+
+	user, err := auth.userProvider.UserByID(ctx, subject.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+		}
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	token, err := jwt.NewToken(
+		user,
+		subject.SessionID,
+		auth.jwtSecret,
+		auth.tokenTTL,
+		append([]jwt.Option{jwt.WithProfileClaims(auth.claimMapping, user.Profile)}, exchangeOptions(exchange)...)...,
+	)
+	if err != nil {
+		log.Error("failed to generate token")
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  user.ID,
+		ActorID: actorUserID(exchange.Actor),
+		Action:  models.AuditTokenExchanged,
+		Details: exchangeDetails(exchange, subject.SessionID),
+	})
+
+	log.Info("token delegated", slog.String("actor", exchange.Actor.Subject))
+
+	return token, nil
+}
+
+// ImpersonateUser lets an admin act as another user, e.g. to debug what a
+// customer sees. The token lives on a new session of the user that is a
+// child of the admin's session, so that it ends with it, and cannot be
+// refreshed.
+func (auth *Auth) ImpersonateUser(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+	exchange models.TokenExchange,
+) (string, error) {
+	const operation = "auth.ImpersonateUser"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("client_id", exchange.ClientID),
+		slog.Int64("user_id", userID),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	// Impersonation does not chain: an impersonated admin is still not the
+	// one asking.
+	if caller.Actor != nil || userID == caller.UserID {
+		return "", fmt.Errorf("%s: %w", operation, ErrPermissionDenied)
+	}
+
+	isAdmin, err := auth.userProvider.IsAdmin(ctx, caller.UserID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+	if !isAdmin {
+		log.Warn("impersonation attempted by non-admin")
+		return "", fmt.Errorf("%s: %w", operation, ErrPermissionDenied)
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Service accounts never have sessions.
+	if user.IsServiceAccount() {
+		return "", fmt.Errorf("%s: %w", operation, ErrPermissionDenied)
+	}
+
+	if err := checkStatus(user); err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	parent, err := auth.sessionProvider.Session(ctx, caller.SessionID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	tokens, err := auth.openSession(ctx, user, models.Session{
+		Device:    "Impersonation by user " + strconv.FormatInt(caller.UserID, 10),
+		IP:        parent.IP,
+		UserAgent: parent.UserAgent,
+		ClientID:  exchange.ClientID,
+		ParentID:  parent.ID,
+		Scope:     exchange.Scope,
+		AuthTime:  parent.AuthTime,
+		AMR:       parent.AMR,
+		ExpiresAt: time.Now().Add(auth.tokenTTL),
+	}, auth.tokenTTL, exchangeOptions(exchange)...)
+	if err != nil {
+		log.Error("failed to open session")
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   caller.UserID,
+		Action:    models.AuditUserImpersonated,
+		IP:        parent.IP,
+		UserAgent: parent.UserAgent,
+		Details:   exchangeDetails(exchange, tokens.SessionID),
+	})
+
+	log.Warn("user impersonated", slog.String("session_id", tokens.SessionID))
+
+	return tokens.AccessToken, nil
+}
+
+func exchangeOptions(exchange models.TokenExchange) []jwt.Option {
+	return []jwt.Option{
+		jwt.WithClient(exchange.ClientID, exchange.Scope),
+		jwt.WithAudience(exchange.Audience),
+		jwt.WithActor(exchange.Actor),
+	}
+}
+
+func exchangeDetails(exchange models.TokenExchange, sessionID string) map[string]string {
+	details := map[string]string{
+		"client_id":  exchange.ClientID,
+		"actor":      exchange.Actor.Subject,
+		"audience":   strings.Join(exchange.Audience, " "),
+		"scope":      exchange.Scope,
+		"session_id": sessionID,
+	}
+	if exchange.Actor.ClientID != "" {
+		details["actor_client_id"] = exchange.Actor.ClientID
+	}
+
+	return details
+}
+
+// actorUserID returns the user id of actor, or zero if it is a client.
+func actorUserID(actor models.Actor) int64 {
+	if actor.ClientID != "" {
+		return 0
+	}
+
+	userID, _ := strconv.ParseInt(actor.Subject, 10, 64)
+	return userID
+}
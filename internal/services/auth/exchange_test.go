@@ -0,0 +1,192 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+// impersonationEnv is an auth service with a signed in admin and a user.
+type impersonationEnv struct {
+	env
+	adminTokens models.TokenPair
+	admin       jwt.Claims
+	userID      int64
+}
+
+func newImpersonationEnv(t *testing.T) impersonationEnv {
+	t.Helper()
+
+	e := newEnv(t, auth.Config{})
+
+	adminID := e.register(t, "admin@example.com")
+	if err := e.storage.SetUserAdmin(context.Background(), adminID, true); err != nil {
+		t.Fatal(err)
+	}
+	adminTokens, admin := e.login(t, "admin@example.com")
+
+	return impersonationEnv{
+		env:         e,
+		adminTokens: adminTokens,
+		admin:       admin,
+		userID:      e.register(t, "user@example.com"),
+	}
+}
+
+// impersonate lets caller impersonate userID as a token exchange without a
+// client would.
+func (e impersonationEnv) impersonate(caller jwt.Claims, userID int64) (string, error) {
+	return e.auth.ImpersonateUser(context.Background(), caller, userID, models.TokenExchange{
+		Scope: "read",
+		Actor: models.Actor{Subject: strconv.FormatInt(caller.UserID, 10), Actor: caller.Actor},
+	})
+}
+
+func TestImpersonateUser(t *testing.T) {
+	e := newImpersonationEnv(t)
+	ctx := context.Background()
+
+	token, err := e.impersonate(e.admin, e.userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := e.auth.VerifyToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != e.userID {
+		t.Errorf("subject = %d, want %d", claims.UserID, e.userID)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != strconv.FormatInt(e.admin.UserID, 10) {
+		t.Errorf("actor = %+v, want admin %d", claims.Actor, e.admin.UserID)
+	}
+
+	// The impersonation ends with the admin's session.
+	if err := e.auth.Logout(ctx, e.adminTokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.auth.VerifyToken(ctx, token); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("err = %v, want %v after the admin logged out", err, auth.ErrInvalidToken)
+	}
+}
+
+func TestImpersonateUserRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		// arrange returns the caller and the user they try to impersonate.
+		arrange func(t *testing.T, e impersonationEnv) (jwt.Claims, int64)
+		wantErr error
+	}{
+		{
+			name: "non-admin",
+			arrange: func(t *testing.T, e impersonationEnv) (jwt.Claims, int64) {
+				_, user := e.login(t, "user@example.com")
+				return user, e.admin.UserID
+			},
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name: "themselves",
+			arrange: func(t *testing.T, e impersonationEnv) (jwt.Claims, int64) {
+				return e.admin, e.admin.UserID
+			},
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			// An admin impersonating another admin is still not the one
+			// asking.
+			name: "chained",
+			arrange: func(t *testing.T, e impersonationEnv) (jwt.Claims, int64) {
+				otherID := e.register(t, "other-admin@example.com")
+				if err := e.storage.SetUserAdmin(context.Background(), otherID, true); err != nil {
+					t.Fatal(err)
+				}
+
+				token, err := e.impersonate(e.admin, otherID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				other, err := e.auth.VerifyToken(context.Background(), token)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return other, e.userID
+			},
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name: "service account",
+			arrange: func(t *testing.T, e impersonationEnv) (jwt.Claims, int64) {
+				account, err := e.auth.CreateServiceAccount(context.Background(), e.admin, "ci", "", e.admin.UserID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return e.admin, account.ID
+			},
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name: "disabled user",
+			arrange: func(t *testing.T, e impersonationEnv) (jwt.Claims, int64) {
+				e.exec(t, "UPDATE users SET status = ? WHERE id = ?", models.UserStatusDisabled, e.userID)
+				return e.admin, e.userID
+			},
+			wantErr: auth.ErrAccountDisabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newImpersonationEnv(t)
+			caller, userID := tt.arrange(t, e)
+
+			if _, err := e.impersonate(caller, userID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDelegateToken(t *testing.T) {
+	e := newEnv(t, auth.Config{})
+	ctx := context.Background()
+
+	userID := e.register(t, "user@example.com")
+	_, subject := e.login(t, "user@example.com")
+
+	token, err := e.auth.DelegateToken(ctx, subject, models.TokenExchange{
+		Scope:    "read",
+		Audience: []string{"billing"},
+		Actor:    models.Actor{Subject: "gateway", ClientID: "gateway"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := e.auth.VerifyToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != userID || claims.SessionID != subject.SessionID {
+		t.Errorf("token of user %d in session %s, want %d in %s", claims.UserID, claims.SessionID, userID, subject.SessionID)
+	}
+	if claims.Actor == nil || claims.Actor.ClientID != "gateway" {
+		t.Errorf("actor = %+v, want client gateway", claims.Actor)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "billing" {
+		t.Errorf("audience = %v, want billing", claims.Audience)
+	}
+
+	// A subject whose account is gone cannot be acted for.
+	e.exec(t, "DELETE FROM users WHERE id = ?", userID)
+	if _, err := e.auth.DelegateToken(ctx, subject, models.TokenExchange{}); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("err = %v, want %v for a deleted subject", err, auth.ErrInvalidToken)
+	}
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// ErrEmailNotVerified is returned when an upstream provider does not vouch
+// for the email of a user that has to be matched or provisioned by email.
+var ErrEmailNotVerified = errors.New("email not verified by identity provider")
+
+type IdentityStorage interface {
+	Identity(ctx context.Context, provider string, subject string) (models.Identity, error)
+	Identities(ctx context.Context, userID int64) ([]models.Identity, error)
+	SaveIdentity(ctx context.Context, identity models.Identity) error
+	TouchIdentity(
+		ctx context.Context,
+		provider string,
+		subject string,
+		email string,
+		loggedInAt time.Time,
+	) error
+	DeleteIdentity(ctx context.Context, userID int64, provider string, subject string) error
+}
+
+// FederatedIdentity is a user as authenticated by an upstream identity
+// provider.
+type FederatedIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// FederatedLogin opens a browser session for a user authenticated by an
+// upstream identity provider. A known identity logs in its user. Otherwise
+// the identity is linked to the account with the same email, or a new
+// account is provisioned for it, provided the provider verified the email.
+func (auth *Auth) FederatedLogin(
+	ctx context.Context,
+	identity FederatedIdentity,
+	client models.ClientInfo,
+) (models.TokenPair, error) {
+	const operation = "auth.FederatedLogin"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("provider", identity.Provider),
+	)
+
+	now := time.Now()
+
+	user, err := auth.identityUser(ctx, identity, now)
+	if err != nil {
+		log.Warn("failed to find user of identity", slog.String("error", err.Error()))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		log.Warn("login to inactive account", slog.String("status", string(user.Status)))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	tokens, err := auth.openSession(ctx, user, models.Session{
+		Device:    client.Device,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		AMR:       []string{models.AMRFederated},
+	}, auth.tokenTTL)
+	if err != nil {
+		log.Error("failed to start session")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   user.ID,
+		Action:    models.AuditLogin,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details: map[string]string{
+			"session_id": tokens.SessionID,
+			"provider":   identity.Provider,
+		},
+	})
+
+	log.Info("user logged in through identity provider", slog.Int64("user_id", user.ID))
+
+	return tokens, nil
+}
+
+// identityUser returns the user identity belongs to, linking or
+// provisioning one on its first login.
+func (auth *Auth) identityUser(
+	ctx context.Context,
+	identity FederatedIdentity,
+	now time.Time,
+) (models.User, error) {
+	linked, err := auth.identityStorage.Identity(ctx, identity.Provider, identity.Subject)
+	switch {
+	case err == nil:
+		if err := auth.identityStorage.TouchIdentity(
+			ctx,
+			identity.Provider,
+			identity.Subject,
+			identity.Email,
+			now,
+		); err != nil {
+			return models.User{}, err
+		}
+
+		return auth.userProvider.UserByID(ctx, linked.UserID)
+	case !errors.Is(err, storage.ErrIdentityNotFound):
+		return models.User{}, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return models.User{}, ErrEmailNotVerified
+	}
+
+	user, err := auth.userByEmail(ctx, identity.Email)
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		user, err = auth.provisionUser(ctx, identity)
+		if err != nil {
+			return models.User{}, err
+		}
+	case err != nil:
+		return models.User{}, err
+	}
+
+	err = auth.identityStorage.SaveIdentity(ctx, models.Identity{
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		UserID:      user.ID,
+		Email:       identity.Email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  user.ID,
+		ActorID: user.ID,
+		Action:  models.AuditIdentityLinked,
+		Details: map[string]string{"provider": identity.Provider},
+	})
+
+	return user, nil
+}
+
+// provisionUser creates an account without a password for an identity
+// that logs in for the first time, if the registration mode lets its
+// address register.
+func (auth *Auth) provisionUser(ctx context.Context, identity FederatedIdentity) (models.User, error) {
+	log := auth.log.With(
+		slog.String("operation", "auth.provisionUser"),
+		slog.String("provider", identity.Provider),
+	)
+
+	emailNormalized, err := auth.emailNormalizer.Normalize(identity.Email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	invitation, err := auth.provisioningInvitation(ctx, identity.Email, emailNormalized)
+	if err != nil {
+		log.Warn("provisioning not permitted", slog.String("error", err.Error()))
+		return models.User{}, err
+	}
+
+	id, err := auth.saveNewUser(ctx, identity.Email, emailNormalized, []byte{}, invitation)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	details := map[string]string{"provider": identity.Provider}
+	if invitation.ID != "" {
+		details["invitation_id"] = invitation.ID
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  id,
+		ActorID: id,
+		Action:  models.AuditUserRegistered,
+		Details: details,
+	})
+
+	log.Info("user provisioned from identity provider", slog.Int64("user_id", id))
+
+	return auth.userProvider.UserByID(ctx, id)
+}
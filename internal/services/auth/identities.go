@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+// ErrLastLoginMethod is returned when unlinking an identity would leave a
+// user without any way to log in.
+var ErrLastLoginMethod = errors.New("cannot remove the last login method")
+
+// LinkIdentity links an identity authenticated by an upstream provider to
+// the account of userID, so that the user can log in with it. An identity
+// that is already linked to another account is refused with
+// storage.ErrIdentityExists.
+func (auth *Auth) LinkIdentity(
+	ctx context.Context,
+	userID int64,
+	identity FederatedIdentity,
+) error {
+	const operation = "auth.LinkIdentity"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("provider", identity.Provider),
+		slog.Int64("user_id", userID),
+	)
+
+	user, err := auth.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+
+	linked, err := auth.identityStorage.Identity(ctx, identity.Provider, identity.Subject)
+	switch {
+	case err == nil && linked.UserID == user.ID:
+		if err := auth.identityStorage.TouchIdentity(
+			ctx,
+			identity.Provider,
+			identity.Subject,
+			identity.Email,
+			now,
+		); err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+
+		return nil
+	case err == nil:
+		log.Warn("identity is linked to another account", slog.Int64("owner_id", linked.UserID))
+		return fmt.Errorf("%s: %w", operation, storage.ErrIdentityExists)
+	case !errors.Is(err, storage.ErrIdentityNotFound):
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	err = auth.identityStorage.SaveIdentity(ctx, models.Identity{
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		UserID:      user.ID,
+		Email:       identity.Email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrIdentityExists) {
+			log.Warn("identity was linked to another account meanwhile")
+		}
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  user.ID,
+		ActorID: user.ID,
+		Action:  models.AuditIdentityLinked,
+		Details: map[string]string{"provider": identity.Provider},
+	})
+
+	log.Info("identity linked")
+
+	return nil
+}
+
+// Identities returns the upstream identities linked to the caller's
+// account.
+func (auth *Auth) Identities(
+	ctx context.Context,
+	caller jwt.Claims,
+) ([]models.Identity, error) {
+	const operation = "auth.Identities"
+
+	identities, err := auth.identityStorage.Identities(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return identities, nil
+}
+
+// UnlinkIdentity removes an identity from the caller's account. The last
+// identity of an account without a password cannot be removed, as the
+// user could not log in anymore.
+func (auth *Auth) UnlinkIdentity(
+	ctx context.Context,
+	caller jwt.Claims,
+	provider string,
+	subject string,
+) error {
+	const operation = "auth.UnlinkIdentity"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("provider", provider),
+		slog.Int64("user_id", caller.UserID),
+	)
+
+	if caller.Actor != nil {
+		return fmt.Errorf("%s: %w", operation, ErrPermissionDenied)
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, caller.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	identities, err := auth.identityStorage.Identities(ctx, caller.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !slices.ContainsFunc(identities, func(identity models.Identity) bool {
+		return identity.Provider == provider && identity.Subject == subject
+	}) {
+		return fmt.Errorf("%s: %w", operation, storage.ErrIdentityNotFound)
+	}
+
+	if len(user.PassHash) == 0 && len(identities) == 1 {
+		log.Warn("refused to unlink last login method")
+		return fmt.Errorf("%s: %w", operation, ErrLastLoginMethod)
+	}
+
+	if err := auth.identityStorage.DeleteIdentity(ctx, caller.UserID, provider, subject); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  caller.UserID,
+		ActorID: caller.UserID,
+		Action:  models.AuditIdentityUnlinked,
+		Details: map[string]string{"provider": provider},
+	})
+
+	log.Info("identity unlinked")
+
+	return nil
+}
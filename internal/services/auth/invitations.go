@@ -0,0 +1,396 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrInvitationRequired = errors.New("an invitation is required to register")
+	ErrInvalidInvitation  = errors.New("invalid or expired invitation")
+)
+
+type InvitationStorage interface {
+	SaveInvitation(
+		ctx context.Context,
+		invitation models.Invitation,
+		emailNormalized string,
+		codeHash []byte,
+	) error
+	Invitation(ctx context.Context, invitationID string) (models.Invitation, error)
+	InvitationByHash(ctx context.Context, codeHash []byte) (models.Invitation, string, error)
+	AcceptedInvitation(ctx context.Context, userID int64) (models.Invitation, error)
+	PendingInvitation(ctx context.Context, emailNormalized string, now time.Time) (models.Invitation, error)
+	Invitations(ctx context.Context) ([]models.Invitation, error)
+	SaveInvitedUser(
+		ctx context.Context,
+		email string,
+		emailNormalized string,
+		passHash []byte,
+		invitation models.Invitation,
+		acceptedAt time.Time,
+	) (int64, error)
+	RevokeInvitation(ctx context.Context, invitationID string, revokedAt time.Time) error
+}
+
+// RegistrationConfig decides who may register with RegisterNewUser.
+type RegistrationConfig struct {
+	Mode models.RegistrationMode
+	// Domains are the domains whose addresses may register without an
+	// invitation in RegistrationDomainRestricted mode.
+	Domains *validator.EmailDomainPolicy
+	// InvitationTTL is how long invitations can be accepted.
+	InvitationTTL time.Duration
+	// InvitationURL, when set, is the registration page of the app that
+	// invitation emails link to, with the code in the "invitation" query
+	// parameter. Otherwise the email carries the bare code.
+	InvitationURL string
+}
+
+// CreateInvitation invites email to register. The new account gets role,
+// which is empty or "admin", and when orgID is set joins that organization
+// with orgRole, "member" unless given. Admins may invite to any organization
+// or none, and owners of an organization to their own; only admins may
+// grant the admin role. The code is returned only here and sent to email.
+func (auth *Auth) CreateInvitation(
+	ctx context.Context,
+	caller jwt.Claims,
+	email string,
+	role string,
+	orgID int64,
+	orgRole string,
+) (models.Invitation, string, error) {
+	const operation = "auth.CreateInvitation"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	if role != "" && role != models.RoleAdmin {
+		return models.Invitation{}, "", fmt.Errorf("%s: %w: %s", operation, ErrUnknownRole, role)
+	}
+
+	if orgID != 0 && orgRole == "" {
+		orgRole = models.OrgRoleMember
+	}
+	if orgID == 0 && orgRole != "" {
+		return models.Invitation{}, "", fmt.Errorf("%s: %w: %s without an organization", operation, ErrUnknownRole, orgRole)
+	}
+	if orgID != 0 && !models.ValidOrgRole(orgRole) {
+		return models.Invitation{}, "", fmt.Errorf("%s: %w: %s", operation, ErrUnknownRole, orgRole)
+	}
+
+	if err := auth.requireInviter(ctx, caller, orgID); err != nil {
+		return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+	if role != "" {
+		if err := RequireAdmin(ctx, auth.userProvider, caller); err != nil {
+			return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	var org models.Org
+	if orgID != 0 {
+		var err error
+		if org, err = auth.orgStorage.Org(ctx, orgID); err != nil {
+			return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	emailNormalized, err := auth.emailNormalizer.Normalize(email)
+	if err != nil {
+		return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	invitationID, err := random.Token(9)
+	if err != nil {
+		return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	code, err := random.Token(24)
+	if err != nil {
+		return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+	invitation := models.Invitation{
+		ID:        invitationID,
+		Email:     strings.TrimSpace(email),
+		Role:      role,
+		OrgID:     org.ID,
+		OrgRole:   orgRole,
+		InvitedBy: caller.UserID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(auth.registration.InvitationTTL),
+	}
+
+	if err := auth.invitationStorage.SaveInvitation(
+		ctx,
+		invitation,
+		emailNormalized,
+		random.Hash(code),
+	); err != nil {
+		// An address that has an account already is the caller's mistake.
+		if errors.Is(err, storage.ErrUserExists) {
+			return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+		}
+		log.Error("failed to save invitation")
+		return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	msg, err := auth.invitationMessage(invitation, org, code)
+	if err != nil {
+		return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// The admin still gets the code to pass on if the email is lost.
+	if err := auth.mailer.Send(ctx, msg); err != nil {
+		log.Error("failed to send invitation", slog.String("error", err.Error()))
+	}
+
+	details := map[string]string{"invitation_id": invitation.ID, "role": role}
+	if invitation.OrgID != 0 {
+		details["org_id"] = fmt.Sprint(invitation.OrgID)
+		details["org_role"] = invitation.OrgRole
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  caller.UserID,
+		ActorID: caller.UserID,
+		Action:  models.AuditInvitationCreated,
+		Details: details,
+	})
+
+	log.Info("invitation created", slog.String("invitation_id", invitation.ID))
+
+	return invitation, code, nil
+}
+
+// Invitations returns all invitations that are not revoked to an admin.
+func (auth *Auth) Invitations(ctx context.Context, caller jwt.Claims) ([]models.Invitation, error) {
+	const operation = "auth.Invitations"
+
+	if err := RequireAdmin(ctx, auth.userProvider, caller); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	invitations, err := auth.invitationStorage.Invitations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return invitations, nil
+}
+
+// RevokeInvitation revokes an invitation that was not accepted yet on
+// behalf of an admin or an owner of the organization it invites to.
+func (auth *Auth) RevokeInvitation(ctx context.Context, caller jwt.Claims, invitationID string) error {
+	const operation = "auth.RevokeInvitation"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("invitation_id", invitationID),
+	)
+
+	invitation, err := auth.invitationStorage.Invitation(ctx, invitationID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.requireInviter(ctx, caller, invitation.OrgID); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.invitationStorage.RevokeInvitation(ctx, invitationID, time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  caller.UserID,
+		ActorID: caller.UserID,
+		Action:  models.AuditInvitationRevoked,
+		Details: map[string]string{"invitation_id": invitationID},
+	})
+
+	log.Info("invitation revoked", slog.Int64("revoked_by", caller.UserID))
+
+	return nil
+}
+
+// registrationInvitation checks that emailNormalized may register under the
+// registration mode. It returns the invitation that permits it, or the
+// zero invitation when none is needed and none was given.
+func (auth *Auth) registrationInvitation(
+	ctx context.Context,
+	email string,
+	emailNormalized string,
+	code string,
+) (models.Invitation, error) {
+	switch auth.registration.Mode {
+	case models.RegistrationClosed:
+		return models.Invitation{}, ErrRegistrationClosed
+	case models.RegistrationInviteOnly:
+		if code == "" {
+			return models.Invitation{}, ErrInvitationRequired
+		}
+	case models.RegistrationDomainRestricted:
+		if code == "" && (auth.registration.Domains == nil || !auth.registration.Domains.Permits(email)) {
+			return models.Invitation{}, ErrInvitationRequired
+		}
+	}
+
+	if code == "" {
+		return models.Invitation{}, nil
+	}
+
+	invitation, invitedEmail, err := auth.invitationStorage.InvitationByHash(ctx, random.Hash(code))
+	if err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return models.Invitation{}, ErrInvalidInvitation
+		}
+		return models.Invitation{}, err
+	}
+
+	// Invitations are bound to the address they were sent to.
+	if !invitation.IsPending(time.Now()) || invitedEmail != emailNormalized {
+		return models.Invitation{}, ErrInvalidInvitation
+	}
+
+	return invitation, nil
+}
+
+// provisioningInvitation checks that emailNormalized may get an account on
+// its first login through an identity provider, under the same registration
+// mode as RegisterNewUser. Such logins carry no invitation code, so where an
+// invitation is needed it is the pending one sent to the address, which is
+// returned to be accepted.
+func (auth *Auth) provisioningInvitation(
+	ctx context.Context,
+	email string,
+	emailNormalized string,
+) (models.Invitation, error) {
+	switch auth.registration.Mode {
+	case models.RegistrationClosed:
+		return models.Invitation{}, ErrRegistrationClosed
+	case models.RegistrationInviteOnly:
+	case models.RegistrationDomainRestricted:
+		if auth.registration.Domains != nil && auth.registration.Domains.Permits(email) {
+			return models.Invitation{}, nil
+		}
+	default:
+		return models.Invitation{}, nil
+	}
+
+	invitation, err := auth.invitationStorage.PendingInvitation(ctx, emailNormalized, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return models.Invitation{}, ErrInvitationRequired
+		}
+		return models.Invitation{}, err
+	}
+
+	return invitation, nil
+}
+
+// saveNewUser creates a user who registers with invitation, or without one
+// when it is the zero invitation. The invitation is used up, its role
+// granted and its organization joined together with creating the account,
+// so that a registration whose invitation was used concurrently leaves no
+// account behind.
+func (auth *Auth) saveNewUser(
+	ctx context.Context,
+	email string,
+	emailNormalized string,
+	passHash []byte,
+	invitation models.Invitation,
+) (int64, error) {
+	email = strings.TrimSpace(email)
+
+	if invitation.ID == "" {
+		return auth.userProvider.SaveUser(ctx, email, emailNormalized, passHash)
+	}
+
+	id, err := auth.invitationStorage.SaveInvitedUser(ctx, email, emailNormalized, passHash, invitation, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return 0, ErrInvalidInvitation
+		}
+		return 0, err
+	}
+
+	if invitation.Role != "" {
+		auth.audit(ctx, models.AuditEvent{
+			UserID:  id,
+			ActorID: invitation.InvitedBy,
+			Action:  models.AuditRolesChanged,
+			Details: map[string]string{"roles": invitation.Role, "invitation_id": invitation.ID},
+		})
+	}
+
+	if invitation.OrgID != 0 {
+		auth.audit(ctx, models.AuditEvent{
+			UserID:  id,
+			ActorID: invitation.InvitedBy,
+			Action:  models.AuditOrgMemberAdded,
+			Details: map[string]string{
+				"org_id":        fmt.Sprint(invitation.OrgID),
+				"role":          invitation.OrgRole,
+				"invitation_id": invitation.ID,
+			},
+		})
+	}
+
+	return id, nil
+}
+
+// invitationMessage creates the email that carries the code of invitation
+// to org, which is the zero organization for invitations to none.
+func (auth *Auth) invitationMessage(
+	invitation models.Invitation,
+	org models.Org,
+	code string,
+) (models.EmailMessage, error) {
+	validFor := invitation.ExpiresAt.Sub(invitation.CreatedAt).Round(time.Hour)
+
+	action := "Register with this invitation code:\n\n" + code
+	if auth.registration.InvitationURL != "" {
+		link, err := url.Parse(auth.registration.InvitationURL)
+		if err != nil {
+			return models.EmailMessage{}, err
+		}
+		query := link.Query()
+		query.Set("invitation", code)
+		link.RawQuery = query.Encode()
+
+		action = "Open this link to create your account:\n\n" + link.String()
+	}
+
+	invited := "You have been invited to create an account."
+	if org.ID != 0 {
+		invited = fmt.Sprintf("You have been invited to join %s.", org.Name)
+	}
+
+	return models.EmailMessage{
+		To:      invitation.Email,
+		Subject: "You are invited",
+		Body: fmt.Sprintf(
+			"%s\n\n%s\n\nThe invitation is valid for %s and can be used once.\n",
+			invited,
+			action,
+			validFor,
+		),
+	}, nil
+}
@@ -0,0 +1,305 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+// orgEnv is an auth service with an admin, an organization owned by owner
+// with member in it, and a second organization of someone else.
+type orgEnv struct {
+	env
+	mailer *mailer
+	admin  jwt.Claims
+	owner  jwt.Claims
+	member jwt.Claims
+	org    models.Org
+	other  models.Org
+}
+
+func newOrgEnv(t *testing.T) orgEnv {
+	t.Helper()
+
+	ctx := context.Background()
+	m := &mailer{}
+	e := newEnv(t, auth.Config{
+		Registration: auth.RegistrationConfig{InvitationTTL: time.Hour},
+		Mailer:       m,
+	})
+
+	adminID := e.register(t, "admin@example.com")
+	e.exec(t, "UPDATE users SET is_admin = TRUE WHERE id = ?", adminID)
+	ownerID := e.register(t, "owner@example.com")
+	memberID := e.register(t, "member@example.com")
+
+	_, admin := e.login(t, "admin@example.com")
+	_, owner := e.login(t, "owner@example.com")
+	_, member := e.login(t, "member@example.com")
+
+	org, err := e.auth.CreateOrg(ctx, admin, " Example ", ownerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.exec(t, "INSERT INTO org_members(org_id, user_id, role) VALUES(?, ?, ?)", org.ID, memberID, models.OrgRoleMember)
+
+	other, err := e.auth.CreateOrg(ctx, admin, "Other", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return orgEnv{env: e, mailer: m, admin: admin, owner: owner, member: member, org: org, other: other}
+}
+
+func TestCreateOrg(t *testing.T) {
+	e := newOrgEnv(t)
+	ctx := context.Background()
+
+	if e.org.Name != "Example" {
+		t.Errorf("name %q, want it trimmed", e.org.Name)
+	}
+
+	members, err := e.auth.OrgMembers(ctx, e.member, e.org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.OrgMember{
+		{OrgID: e.org.ID, UserID: e.owner.UserID, Role: models.OrgRoleOwner},
+		{OrgID: e.org.ID, UserID: e.member.UserID, Role: models.OrgRoleMember},
+	}
+	if len(members) != len(want) || members[0] != want[0] || members[1] != want[1] {
+		t.Errorf("members %v, want %v", members, want)
+	}
+
+	if _, err := e.auth.CreateOrg(ctx, e.owner, "Mine", 0); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("create by a user: got %v, want %v", err, auth.ErrPermissionDenied)
+	}
+	if _, err := e.auth.OrgMembers(ctx, e.owner, e.other.ID); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("members of another organization: got %v, want %v", err, auth.ErrPermissionDenied)
+	}
+	if _, err := e.auth.OrgMembers(ctx, e.admin, 999); !errors.Is(err, storage.ErrOrgNotFound) {
+		t.Errorf("unknown organization: got %v, want %v", err, storage.ErrOrgNotFound)
+	}
+}
+
+func TestCreateInvitation(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  func(orgEnv) jwt.Claims
+		email   string
+		role    string
+		org     func(orgEnv) int64
+		orgRole string
+		wantErr error
+	}{
+		{name: "admin without organization", caller: adminOf, email: "new@example.com"},
+		{name: "admin granting admin", caller: adminOf, email: "new@example.com", role: models.RoleAdmin},
+		{name: "admin to any organization", caller: adminOf, email: "new@example.com", org: otherOf},
+		{name: "owner to their organization", caller: ownerOf, email: "new@example.com", org: orgOf},
+		{
+			name:    "owner inviting an owner",
+			caller:  ownerOf,
+			email:   "new@example.com",
+			org:     orgOf,
+			orgRole: models.OrgRoleOwner,
+		},
+		{
+			name:    "owner to another organization",
+			caller:  ownerOf,
+			email:   "new@example.com",
+			org:     otherOf,
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name:    "owner without organization",
+			caller:  ownerOf,
+			email:   "new@example.com",
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name:    "owner granting admin",
+			caller:  ownerOf,
+			email:   "new@example.com",
+			role:    models.RoleAdmin,
+			org:     orgOf,
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name:    "member",
+			caller:  memberOf,
+			email:   "new@example.com",
+			org:     orgOf,
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name: "owner on behalf of someone",
+			caller: func(e orgEnv) jwt.Claims {
+				c := e.owner
+				c.Actor = &models.Actor{Subject: "support"}
+				return c
+			},
+			email:   "new@example.com",
+			org:     orgOf,
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name:    "unknown organization role",
+			caller:  adminOf,
+			email:   "new@example.com",
+			org:     orgOf,
+			orgRole: "guest",
+			wantErr: auth.ErrUnknownRole,
+		},
+		{
+			name:    "organization role without organization",
+			caller:  adminOf,
+			email:   "new@example.com",
+			orgRole: models.OrgRoleMember,
+			wantErr: auth.ErrUnknownRole,
+		},
+		{
+			name:    "unknown organization",
+			caller:  adminOf,
+			email:   "new@example.com",
+			org:     func(orgEnv) int64 { return 999 },
+			wantErr: storage.ErrOrgNotFound,
+		},
+		{
+			name:    "existing account",
+			caller:  ownerOf,
+			email:   "Member@example.com",
+			org:     orgOf,
+			wantErr: storage.ErrUserExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newOrgEnv(t)
+			ctx := context.Background()
+
+			var orgID int64
+			if tt.org != nil {
+				orgID = tt.org(e)
+			}
+
+			invitation, code, err := e.auth.CreateInvitation(ctx, tt.caller(e), tt.email, tt.role, orgID, tt.orgRole)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(e.mailer.messages) != 0 {
+					t.Errorf("sent %d emails for a refused invitation", len(e.mailer.messages))
+				}
+				return
+			}
+
+			wantOrgRole := tt.orgRole
+			if orgID != 0 && wantOrgRole == "" {
+				wantOrgRole = models.OrgRoleMember
+			}
+			if invitation.OrgID != orgID || invitation.OrgRole != wantOrgRole {
+				t.Errorf("invitation to %d as %q, want %d as %q", invitation.OrgID, invitation.OrgRole, orgID, wantOrgRole)
+			}
+			if !strings.Contains(e.mailer.last(t).Body, code) {
+				t.Error("code not sent")
+			}
+		})
+	}
+}
+
+func TestRegisterWithOrgInvitation(t *testing.T) {
+	e := newOrgEnv(t)
+	ctx := context.Background()
+
+	invitation, code, err := e.auth.CreateInvitation(ctx, e.owner, "new@example.com", "", e.org.ID, models.OrgRoleOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := e.mailer.last(t).Body; !strings.Contains(body, "join Example") {
+		t.Errorf("email does not name the organization: %q", body)
+	}
+
+	userID, err := e.auth.RegisterNewUser(ctx, "new@example.com", testPassword, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	members, err := e.auth.OrgMembers(ctx, e.owner, e.org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := models.OrgMember{OrgID: e.org.ID, UserID: userID, Role: models.OrgRoleOwner}
+	if len(members) != 3 || members[2] != joined {
+		t.Errorf("members %v, want %v added", members, joined)
+	}
+
+	// The new owner may invite in turn, but not revoke a used invitation.
+	_, newOwner := e.login(t, "new@example.com")
+	if _, _, err := e.auth.CreateInvitation(ctx, newOwner, "next@example.com", "", e.org.ID, ""); err != nil {
+		t.Errorf("invitation by the new owner: %v", err)
+	}
+	if err := e.auth.RevokeInvitation(ctx, newOwner, invitation.ID); !errors.Is(err, storage.ErrInvitationNotFound) {
+		t.Errorf("revoke used invitation: got %v, want %v", err, storage.ErrInvitationNotFound)
+	}
+}
+
+func TestRevokeOrgInvitation(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  func(orgEnv) jwt.Claims
+		wantErr error
+	}{
+		{name: "owner", caller: ownerOf},
+		{name: "admin", caller: adminOf},
+		{name: "member", caller: memberOf, wantErr: auth.ErrPermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newOrgEnv(t)
+			ctx := context.Background()
+
+			invitation, code, err := e.auth.CreateInvitation(ctx, e.owner, "new@example.com", "", e.org.ID, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = e.auth.RevokeInvitation(ctx, tt.caller(e), invitation.ID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			_, err = e.auth.RegisterNewUser(ctx, "new@example.com", testPassword, code)
+			if !errors.Is(err, auth.ErrInvalidInvitation) {
+				t.Errorf("register with revoked invitation: got %v, want %v", err, auth.ErrInvalidInvitation)
+			}
+		})
+	}
+
+	// Owners manage the invitations of their own organization only.
+	e := newOrgEnv(t)
+	invitation, _, err := e.auth.CreateInvitation(context.Background(), e.admin, "new@example.com", "", e.other.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.auth.RevokeInvitation(context.Background(), e.owner, invitation.ID); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("revoke for another organization: got %v, want %v", err, auth.ErrPermissionDenied)
+	}
+}
+
+func adminOf(e orgEnv) jwt.Claims  { return e.admin }
+func ownerOf(e orgEnv) jwt.Claims  { return e.owner }
+func memberOf(e orgEnv) jwt.Claims { return e.member }
+func orgOf(e orgEnv) int64         { return e.org.ID }
+func otherOf(e orgEnv) int64       { return e.other.ID }
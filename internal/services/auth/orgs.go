@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+type OrgStorage interface {
+	SaveOrg(ctx context.Context, org models.Org, ownerID int64) (int64, error)
+	Org(ctx context.Context, orgID int64) (models.Org, error)
+	OrgRole(ctx context.Context, orgID int64, userID int64) (string, error)
+	OrgMembers(ctx context.Context, orgID int64) ([]models.OrgMember, error)
+	UserOrgs(ctx context.Context, userID int64) ([]models.OrgMember, error)
+}
+
+// CreateOrg creates an organization on behalf of an admin, owned by ownerID
+// or by the admin when ownerID is zero. Its owners may invite people to it.
+func (auth *Auth) CreateOrg(
+	ctx context.Context,
+	caller jwt.Claims,
+	name string,
+	ownerID int64,
+) (models.Org, error) {
+	const operation = "auth.CreateOrg"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	if err := RequireAdmin(ctx, auth.userProvider, caller); err != nil {
+		return models.Org{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if ownerID == 0 {
+		ownerID = caller.UserID
+	}
+
+	owner, err := auth.userProvider.UserByID(ctx, ownerID)
+	if err != nil {
+		return models.Org{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	if owner.IsServiceAccount() {
+		return models.Org{}, fmt.Errorf("%s: %w", operation, ErrInvalidOwner)
+	}
+	if err := checkStatus(owner); err != nil {
+		return models.Org{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	org := models.Org{
+		Name:      strings.TrimSpace(name),
+		CreatedAt: time.Now(),
+	}
+
+	org.ID, err = auth.orgStorage.SaveOrg(ctx, org, owner.ID)
+	if err != nil {
+		log.Error("failed to save organization")
+		return models.Org{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  owner.ID,
+		ActorID: caller.UserID,
+		Action:  models.AuditOrgCreated,
+		Details: map[string]string{"org_id": fmt.Sprint(org.ID), "name": org.Name},
+	})
+
+	log.Info("organization created", slog.Int64("org_id", org.ID), slog.Int64("owner_id", owner.ID))
+
+	return org, nil
+}
+
+// OrgMembers returns the members of an organization to its members and to
+// admins.
+func (auth *Auth) OrgMembers(ctx context.Context, caller jwt.Claims, orgID int64) ([]models.OrgMember, error) {
+	const operation = "auth.OrgMembers"
+
+	if _, err := auth.orgStorage.Org(ctx, orgID); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := RequireAdmin(ctx, auth.userProvider, caller); err != nil {
+		if !errors.Is(err, ErrPermissionDenied) {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		if _, err := auth.orgStorage.OrgRole(ctx, orgID, caller.UserID); err != nil {
+			if errors.Is(err, storage.ErrOrgMemberNotFound) {
+				return nil, fmt.Errorf("%s: %w", operation, ErrPermissionDenied)
+			}
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	members, err := auth.orgStorage.OrgMembers(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return members, nil
+}
+
+// requireInviter fails with ErrPermissionDenied unless caller may manage
+// invitations to the organization orgID: admins may for any and owners of
+// an organization for their own. A zero orgID is for admins only.
+func (auth *Auth) requireInviter(ctx context.Context, caller jwt.Claims, orgID int64) error {
+	err := RequireAdmin(ctx, auth.userProvider, caller)
+	if err == nil || orgID == 0 || !errors.Is(err, ErrPermissionDenied) || caller.Actor != nil {
+		return err
+	}
+
+	role, err := auth.orgStorage.OrgRole(ctx, orgID, caller.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrgMemberNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+	if role != models.OrgRoleOwner {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
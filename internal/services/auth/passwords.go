@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordExpired = errors.New("password expired")
+
+type PasswordManager interface {
+	UpdatePassword(
+		ctx context.Context,
+		userID int64,
+		passHash []byte,
+		changedAt time.Time,
+	) error
+	PasswordHistory(ctx context.Context, userID int64, limit int) ([][]byte, error)
+}
+
+// PasswordPolicy extends the stateless rules of validator.PasswordPolicy with
+// the ones that depend on what is stored about the user.
+type PasswordPolicy struct {
+	validator.PasswordPolicy
+	// HistorySize is how many previous passwords, including the current one,
+	// a new password must differ from. Zero disables the check.
+	HistorySize int
+	// MaxAge forces users to change passwords older than this before they can
+	// log in again. Zero disables expiry.
+	MaxAge time.Duration
+}
+
+// PasswordPolicyError lists the policy rules a rejected password breaks.
+type PasswordPolicyError struct {
+	Violations []validator.FieldViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	descriptions := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		descriptions = append(descriptions, violation.Field+" "+violation.Description)
+	}
+
+	return "password policy violated: " + strings.Join(descriptions, "; ")
+}
+
+// ChangePassword replaces the password of a user after checking the current
+// one. It does not require an access token so that users whose password has
+// expired can still change it. All sessions of the user are revoked.
+func (auth *Auth) ChangePassword(
+	ctx context.Context,
+	email string,
+	oldPassword string,
+	newPassword string,
+) error {
+	const operation = "auth.ChangePassword"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+	)
+
+	user, err := auth.userByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return fmt.Errorf("%s: %w", operation, storage.ErrInvalidCredentials)
+		}
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(oldPassword)); err != nil {
+		log.Warn("invalid credentials")
+		return fmt.Errorf("%s: %w", operation, storage.ErrInvalidCredentials)
+	}
+
+	if err := checkStatus(user); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.checkNewPassword(ctx, user.ID, user.Email, newPassword); err != nil {
+		log.Warn("password rejected by policy")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("failed to generate password hash")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+	if err := auth.passwordManager.UpdatePassword(ctx, user.ID, passHash, now); err != nil {
+		log.Error("failed to update password")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, err := auth.sessionProvider.RevokeUserSessions(ctx, user.ID, "", now); err != nil {
+		log.Error("failed to revoke sessions")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  user.ID,
+		ActorID: user.ID,
+		Action:  models.AuditPasswordChanged,
+	})
+
+	log.Info("password changed", slog.Int64("user_id", user.ID))
+
+	return nil
+}
+
+// checkNewPassword checks password against the password policy. userID is
+// zero for users that do not exist yet and therefore have no history.
+func (auth *Auth) checkNewPassword(
+	ctx context.Context,
+	userID int64,
+	email string,
+	password string,
+) error {
+	violations := auth.passwordPolicy.CheckPassword("password", password, email)
+
+	if userID != 0 && auth.passwordPolicy.HistorySize > 0 {
+		history, err := auth.passwordManager.PasswordHistory(ctx, userID, auth.passwordPolicy.HistorySize)
+		if err != nil {
+			return err
+		}
+
+		for _, passHash := range history {
+			if bcrypt.CompareHashAndPassword(passHash, []byte(password)) == nil {
+				violations = append(violations, validator.FieldViolation{
+					Field: "password",
+					Description: fmt.Sprintf(
+						"must not match any of your last %d passwords",
+						auth.passwordPolicy.HistorySize,
+					),
+				})
+				break
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+func (auth *Auth) passwordExpired(user models.User, now time.Time) bool {
+	if auth.passwordPolicy.MaxAge <= 0 || user.PasswordChangedAt.IsZero() {
+		return false
+	}
+
+	return now.After(user.PasswordChangedAt.Add(auth.passwordPolicy.MaxAge))
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+var (
+	ErrSMSDisabled          = errors.New("sms is not configured")
+	ErrPhoneMissing         = errors.New("no phone number on profile")
+	ErrPhoneNotVerified     = errors.New("phone number is not verified")
+	ErrPhoneAlreadyVerified = errors.New("phone number is already verified")
+	ErrInvalidPhoneCode     = errors.New("invalid or expired phone code")
+	ErrPhoneCodeThrottled   = errors.New("too many codes sent to this phone number")
+)
+
+// phoneCodeLength is the number of digits of the codes sent by text
+// message.
+const phoneCodeLength = 6
+
+// phoneRateWindow is the period PhoneConfig.HourlyLimit applies to.
+const phoneRateWindow = time.Hour
+
+// SMSSender sends text messages to users.
+type SMSSender interface {
+	Send(ctx context.Context, msg models.SMSMessage) error
+}
+
+type PhoneCodeStorage interface {
+	SavePhoneCode(
+		ctx context.Context,
+		code models.PhoneCode,
+		codeHash []byte,
+		lastBefore time.Time,
+		since time.Time,
+		limit int,
+	) error
+	PhoneCode(ctx context.Context, codeID string) (models.PhoneCode, []byte, error)
+	AddPhoneCodeAttempt(ctx context.Context, codeID string) (int, error)
+	UsePhoneCode(ctx context.Context, codeID string, usedAt time.Time) error
+	SetPhoneVerified(ctx context.Context, userID int64, phone string, verifiedAt time.Time) error
+}
+
+// PhoneConfig holds the settings of codes sent by text message. Sends are
+// limited per number rather than per user, as texts cost money and a
+// number can be put on any number of profiles.
+type PhoneConfig struct {
+	TTL         time.Duration
+	MaxAttempts int
+	// ResendInterval is how long to wait before another code is sent to a
+	// number, and HourlyLimit how many codes a number gets per hour.
+	ResendInterval time.Duration
+	HourlyLimit    int
+}
+
+// StartPhoneVerification texts a code to the phone number on the caller's
+// profile. Entering it with ConfirmPhoneVerification verifies the number.
+func (auth *Auth) StartPhoneVerification(ctx context.Context, caller jwt.Claims) (models.PhoneCode, error) {
+	const operation = "auth.StartPhoneVerification"
+
+	user, err := auth.phoneUser(ctx, caller)
+	if err != nil {
+		return models.PhoneCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if user.Profile.Phone == "" {
+		return models.PhoneCode{}, fmt.Errorf("%s: %w", operation, ErrPhoneMissing)
+	}
+	if user.Profile.PhoneVerified() {
+		return models.PhoneCode{}, fmt.Errorf("%s: %w", operation, ErrPhoneAlreadyVerified)
+	}
+
+	code, err := auth.sendPhoneCode(ctx, user, models.PhoneCodeVerification)
+	if err != nil {
+		return models.PhoneCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return code, nil
+}
+
+// ConfirmPhoneVerification verifies the phone number of the caller with a
+// code sent by StartPhoneVerification. A number can be verified by one user
+// only.
+func (auth *Auth) ConfirmPhoneVerification(
+	ctx context.Context,
+	caller jwt.Claims,
+	codeID string,
+	code string,
+) (models.User, error) {
+	const operation = "auth.ConfirmPhoneVerification"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("user_id", caller.UserID),
+	)
+
+	user, err := auth.phoneUser(ctx, caller)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	phoneCode, err := auth.usePhoneCode(ctx, user, models.PhoneCodeVerification, codeID, code)
+	if err != nil {
+		log.Warn("phone verification failed", slog.String("error", err.Error()))
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+	if err := auth.phoneCodeStorage.SetPhoneVerified(ctx, user.ID, phoneCode.Phone, now); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			// The number changed since the code was sent.
+			return models.User{}, fmt.Errorf("%s: %w", operation, ErrInvalidPhoneCode)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	user.Profile.PhoneVerifiedAt = now
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  user.ID,
+		ActorID: user.ID,
+		Action:  models.AuditPhoneVerified,
+	})
+
+	log.Info("phone number verified")
+
+	return user, nil
+}
+
+// StartSMSChallenge texts a one-time code to the verified phone number of
+// the caller, to be passed to StepUp as a second factor.
+func (auth *Auth) StartSMSChallenge(ctx context.Context, caller jwt.Claims) (models.PhoneCode, error) {
+	const operation = "auth.StartSMSChallenge"
+
+	if caller.SessionID == "" {
+		return models.PhoneCode{}, fmt.Errorf("%s: %w", operation, ErrPermissionDenied)
+	}
+
+	user, err := auth.phoneUser(ctx, caller)
+	if err != nil {
+		return models.PhoneCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !user.Profile.PhoneVerified() {
+		return models.PhoneCode{}, fmt.Errorf("%s: %w", operation, ErrPhoneNotVerified)
+	}
+
+	code, err := auth.sendPhoneCode(ctx, user, models.PhoneCodeOTP)
+	if err != nil {
+		return models.PhoneCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return code, nil
+}
+
+// phoneUser returns the active user of caller. Codes go to the user's own
+// phone, so someone acting on their behalf cannot request or enter them.
+func (auth *Auth) phoneUser(ctx context.Context, caller jwt.Claims) (models.User, error) {
+	if auth.smsSender == nil {
+		return models.User{}, ErrSMSDisabled
+	}
+
+	if caller.Actor != nil {
+		return models.User{}, ErrPermissionDenied
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, caller.UserID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := checkStatus(user); err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// sendPhoneCode texts a new code for purpose to the phone number of user,
+// unless the number got too many codes lately.
+func (auth *Auth) sendPhoneCode(
+	ctx context.Context,
+	user models.User,
+	purpose models.PhoneCodePurpose,
+) (models.PhoneCode, error) {
+	log := auth.log.With(
+		slog.Int64("user_id", user.ID),
+		slog.String("purpose", string(purpose)),
+	)
+
+	cfg := auth.phone
+	phone := user.Profile.Phone
+	now := time.Now()
+
+	codeID, err := random.Token(16)
+	if err != nil {
+		return models.PhoneCode{}, err
+	}
+
+	secret, err := random.Code(phoneCodeLength, "0123456789")
+	if err != nil {
+		return models.PhoneCode{}, err
+	}
+
+	code := models.PhoneCode{
+		ID:        codeID,
+		UserID:    user.ID,
+		Phone:     phone,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(cfg.TTL),
+		CreatedAt: now,
+	}
+
+	if err := auth.phoneCodeStorage.SavePhoneCode(
+		ctx,
+		code,
+		auth.codeHash(code.ID, secret),
+		now.Add(-cfg.ResendInterval),
+		now.Add(-phoneRateWindow),
+		cfg.HourlyLimit,
+	); err != nil {
+		if errors.Is(err, storage.ErrPhoneCodeThrottled) {
+			log.Warn("phone code requested too often")
+			return models.PhoneCode{}, ErrPhoneCodeThrottled
+		}
+		log.Error("failed to save phone code")
+		return models.PhoneCode{}, err
+	}
+
+	if err := auth.smsSender.Send(ctx, models.SMSMessage{
+		To: phone,
+		Body: fmt.Sprintf(
+			"%s is your verification code. It is valid for %s. Do not share it with anyone.",
+			secret,
+			cfg.TTL.Round(time.Minute),
+		),
+	}); err != nil {
+		log.Error("failed to send phone code", slog.String("error", err.Error()))
+		return models.PhoneCode{}, err
+	}
+
+	log.Info("phone code sent")
+
+	return code, nil
+}
+
+// usePhoneCode checks code against the phone code codeID sent to user for
+// purpose and uses it up. Every try counts, so that the short codes cannot
+// be guessed, and a code is only good for the number it was sent to.
+func (auth *Auth) usePhoneCode(
+	ctx context.Context,
+	user models.User,
+	purpose models.PhoneCodePurpose,
+	codeID string,
+	code string,
+) (models.PhoneCode, error) {
+	phoneCode, codeHash, err := auth.phoneCodeStorage.PhoneCode(ctx, codeID)
+	if err != nil {
+		if errors.Is(err, storage.ErrPhoneCodeNotFound) {
+			return models.PhoneCode{}, ErrInvalidPhoneCode
+		}
+		return models.PhoneCode{}, err
+	}
+
+	if phoneCode.UserID != user.ID || phoneCode.Purpose != purpose || phoneCode.Phone != user.Profile.Phone {
+		return models.PhoneCode{}, ErrInvalidPhoneCode
+	}
+
+	attempts, err := auth.phoneCodeStorage.AddPhoneCodeAttempt(ctx, phoneCode.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrPhoneCodeNotFound) {
+			return models.PhoneCode{}, ErrInvalidPhoneCode
+		}
+		return models.PhoneCode{}, err
+	}
+	if attempts > auth.phone.MaxAttempts {
+		return models.PhoneCode{}, ErrInvalidPhoneCode
+	}
+
+	if !hmac.Equal(codeHash, auth.codeHash(phoneCode.ID, code)) {
+		return models.PhoneCode{}, ErrInvalidPhoneCode
+	}
+
+	now := time.Now()
+	if !phoneCode.IsPending(now) {
+		return models.PhoneCode{}, ErrInvalidPhoneCode
+	}
+
+	if err := auth.phoneCodeStorage.UsePhoneCode(ctx, phoneCode.ID, now); err != nil {
+		if errors.Is(err, storage.ErrPhoneCodeNotFound) {
+			return models.PhoneCode{}, ErrInvalidPhoneCode
+		}
+		return models.PhoneCode{}, err
+	}
+
+	return phoneCode, nil
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ExportUserData returns everything stored about the caller as a JSON
+// document.
+func (auth *Auth) ExportUserData(
+	ctx context.Context,
+	caller jwt.Claims,
+) ([]byte, error) {
+	const operation = "auth.ExportUserData"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("user_id", caller.UserID),
+	)
+
+	user, err := auth.userProvider.UserByID(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	isAdmin, err := auth.userProvider.IsAdmin(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	sessions, err := auth.sessionProvider.AllSessions(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	grants, err := auth.grantProvider.OAuthGrants(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	identities, err := auth.identityStorage.Identities(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	apiKeys, err := auth.apiKeyStorage.APIKeys(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	serviceAccounts, err := auth.serviceAccounts.ServiceAccounts(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	orgs, err := auth.orgStorage.UserOrgs(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	invitation, err := auth.invitationStorage.AcceptedInvitation(ctx, caller.UserID)
+	if err != nil && !errors.Is(err, storage.ErrInvitationNotFound) {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	provisioned, err := auth.provisioning.SCIMUser(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	events, err := auth.auditLogger.AuditEvents(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	export := models.UserDataExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: models.ExportedProfile{
+			ID:                user.ID,
+			Email:             user.Email,
+			Status:            user.Status,
+			StatusReason:      user.StatusReason,
+			StatusChangedAt:   user.StatusChangedAt,
+			DeletedAt:         user.DeletedAt,
+			PasswordChangedAt: user.PasswordChangedAt,
+			Attributes:        user.Profile,
+		},
+		Roles:           []string{},
+		Sessions:        sessions,
+		Grants:          grants,
+		Identities:      identities,
+		APIKeys:         apiKeys,
+		ServiceAccounts: serviceAccounts,
+		Orgs:            orgs,
+		AuditEvents:     events,
+	}
+	if invitation.ID != "" {
+		export.Invitation = &invitation
+	}
+	if isAdmin {
+		export.Roles = append(export.Roles, models.RoleAdmin)
+	}
+	if provisioned.ExternalID != "" || provisioned.GivenName != "" || provisioned.FamilyName != "" ||
+		provisioned.DisplayName != "" || len(provisioned.Groups) > 0 {
+		export.Provisioning = &models.ExportedProvisioning{
+			ExternalID:  provisioned.ExternalID,
+			GivenName:   provisioned.GivenName,
+			FamilyName:  provisioned.FamilyName,
+			DisplayName: provisioned.DisplayName,
+			Groups:      []string{},
+		}
+		for _, group := range provisioned.Groups {
+			export.Provisioning.Groups = append(export.Provisioning.Groups, group.DisplayName)
+		}
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  caller.UserID,
+		ActorID: caller.UserID,
+		Action:  models.AuditDataExported,
+	})
+
+	log.Info("user data exported")
+
+	return data, nil
+}
+
+// DeleteMyAccount soft-deletes the caller's account after re-checking their
+// password. Users without a local password, who log in through an identity
+// provider, the directory or email codes, need a token from a login or
+// step-up at most StepUpTokenTTL old instead. Personal data is erased once
+// the deletion grace period is over.
+func (auth *Auth) DeleteMyAccount(
+	ctx context.Context,
+	caller jwt.Claims,
+	password string,
+) error {
+	const operation = "auth.DeleteMyAccount"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("user_id", caller.UserID),
+	)
+
+	user, err := auth.userProvider.UserByID(ctx, caller.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if len(user.PassHash) == 0 {
+		// Someone acting on behalf of the user cannot prove to be them.
+		if caller.Actor != nil {
+			return fmt.Errorf("%s: %w", operation, ErrPermissionDenied)
+		}
+		if err := auth.CheckAuthentication(caller, "", auth.stepUpTokenTTL); err != nil {
+			log.Warn("authentication too old to delete account")
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+	} else if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
+		log.Warn("invalid credentials")
+		return fmt.Errorf("%s: %w", operation, storage.ErrInvalidCredentials)
+	}
+
+	now := time.Now()
+	err = auth.accountManager.SetUserStatus(
+		ctx,
+		caller.UserID,
+		models.UserStatusDeleted,
+		"deleted by user",
+		now,
+	)
+	if err != nil {
+		log.Error("failed to delete account")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, err := auth.sessionProvider.RevokeUserSessions(ctx, caller.UserID, "", now); err != nil {
+		log.Error("failed to revoke sessions")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  caller.UserID,
+		ActorID: caller.UserID,
+		Action:  models.AuditAccountDeleted,
+		Details: map[string]string{"status": string(models.UserStatusDeleted)},
+	})
+
+	log.Info("account deleted by user", slog.Time("purge_after", now.Add(auth.deletionGracePeriod)))
+
+	return nil
+}
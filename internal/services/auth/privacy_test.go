@@ -0,0 +1,79 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+func TestDeleteMyAccount(t *testing.T) {
+	tests := []struct {
+		name string
+		// passwordless users log in through an identity provider, the
+		// directory or email codes.
+		passwordless bool
+		password     string
+		claims       func(jwt.Claims) jwt.Claims
+		wantErr      error
+	}{
+		{name: "password", password: testPassword},
+		{name: "wrong password", password: "wrong password", wantErr: storage.ErrInvalidCredentials},
+		{name: "password required", password: "", wantErr: storage.ErrInvalidCredentials},
+		{name: "passwordless with fresh login", passwordless: true},
+		{
+			name:         "passwordless with old login",
+			passwordless: true,
+			claims: func(c jwt.Claims) jwt.Claims {
+				c.AuthTime = time.Now().Add(-time.Hour)
+				return c
+			},
+			wantErr: auth.ErrStepUpRequired,
+		},
+		{
+			name:         "passwordless on behalf of the user",
+			passwordless: true,
+			claims: func(c jwt.Claims) jwt.Claims {
+				c.Actor = &models.Actor{Subject: "support"}
+				return c
+			},
+			wantErr: auth.ErrPermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEnv(t, auth.Config{})
+			ctx := context.Background()
+
+			userID := e.register(t, "user@example.com")
+			_, claims := e.login(t, "user@example.com")
+			if tt.passwordless {
+				e.exec(t, "UPDATE users SET pass_hash = X'' WHERE id = ?", userID)
+			}
+			if tt.claims != nil {
+				claims = tt.claims(claims)
+			}
+
+			err := e.auth.DeleteMyAccount(ctx, claims, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			user, err := e.storage.UserByID(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			deleted := user.Status == models.UserStatusDeleted
+			if deleted != (tt.wantErr == nil) {
+				t.Errorf("status = %q", user.Status)
+			}
+		})
+	}
+}
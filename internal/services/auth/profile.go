@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+var ErrUnknownProfileField = errors.New("unknown profile field")
+
+type ProfileStorage interface {
+	UpdateProfile(ctx context.Context, userID int64, profile models.Profile) error
+}
+
+// Profile returns the profile of userID on behalf of caller. Users may read
+// their own profile, admins anyone's.
+func (auth *Auth) Profile(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+) (models.User, error) {
+	const operation = "auth.Profile"
+
+	targetID, err := auth.resolveTargetUser(ctx, caller, userID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, targetID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return user, nil
+}
+
+// UpdateProfile sets the fields of the profile of userID named by fields to
+// their values in update, leaving the others as they are. Only admins may
+// change admin metadata, also on their own profile.
+func (auth *Auth) UpdateProfile(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+	update models.Profile,
+	fields []string,
+) (models.User, error) {
+	const operation = "auth.UpdateProfile"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	for _, field := range fields {
+		if !slices.Contains(models.ProfileFields, field) {
+			return models.User{}, fmt.Errorf("%s: %w: %s", operation, ErrUnknownProfileField, field)
+		}
+	}
+
+	if slices.Contains(fields, models.ProfilePhone) && update.Phone != "" {
+		phone, err := validator.NormalizePhone(update.Phone)
+		if err != nil {
+			return models.User{}, fmt.Errorf("%s: %w", operation, err)
+		}
+		update.Phone = phone
+	}
+
+	targetID, err := auth.resolveTargetUser(ctx, caller, userID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if slices.Contains(fields, models.ProfileAdminMetadata) {
+		if err := RequireAdmin(ctx, auth.userProvider, caller); err != nil {
+			return models.User{}, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, targetID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	profile := mergeProfile(user.Profile, update, fields)
+	profile.UpdatedAt = time.Now()
+
+	if err := auth.profileStorage.UpdateProfile(ctx, targetID, profile); err != nil {
+		log.Error("failed to update profile", slog.String("error", err.Error()))
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	user.Profile = profile
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  targetID,
+		ActorID: caller.UserID,
+		Action:  models.AuditProfileUpdated,
+		Details: map[string]string{"fields": strings.Join(fields, ",")},
+	})
+
+	log.Info("profile updated", slog.Int64("user_id", targetID))
+
+	return user, nil
+}
+
+// mergeProfile returns profile with the fields named by fields taken from
+// update.
+func mergeProfile(profile models.Profile, update models.Profile, fields []string) models.Profile {
+	for _, field := range fields {
+		switch field {
+		case models.ProfileDisplayName:
+			profile.DisplayName = update.DisplayName
+		case models.ProfileGivenName:
+			profile.GivenName = update.GivenName
+		case models.ProfileFamilyName:
+			profile.FamilyName = update.FamilyName
+		case models.ProfileLocale:
+			profile.Locale = update.Locale
+		case models.ProfileTimezone:
+			profile.Timezone = update.Timezone
+		case models.ProfileAvatarURL:
+			profile.AvatarURL = update.AvatarURL
+		case models.ProfilePhone:
+			if profile.Phone != update.Phone {
+				profile.PhoneVerifiedAt = time.Time{}
+			}
+			profile.Phone = update.Phone
+		case models.ProfileMetadata:
+			profile.Metadata = update.Metadata
+		case models.ProfileAdminMetadata:
+			profile.AdminMetadata = update.AdminMetadata
+		}
+	}
+
+	return profile
+}
@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+var (
+	// ErrInvalidOwner is returned when a service account would be owned by
+	// another service account.
+	ErrInvalidOwner = errors.New("service accounts must be owned by a user")
+	ErrUnknownRole  = errors.New("unknown role")
+)
+
+type ServiceAccountStorage interface {
+	SaveServiceAccount(ctx context.Context, account models.ServiceAccount) (int64, error)
+	ServiceAccount(ctx context.Context, accountID int64) (models.ServiceAccount, error)
+	ServiceAccounts(ctx context.Context, ownerID int64) ([]models.ServiceAccount, error)
+}
+
+// CreateServiceAccount creates a service account owned by ownerID, or by
+// the caller when ownerID is zero. Only admins may create service accounts
+// for someone else. The account has no password; it authenticates with API
+// keys its owner creates for it or through an OAuth client bound to it.
+func (auth *Auth) CreateServiceAccount(
+	ctx context.Context,
+	caller jwt.Claims,
+	name string,
+	description string,
+	ownerID int64,
+) (models.ServiceAccount, error) {
+	const operation = "auth.CreateServiceAccount"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	ownerID, err := auth.resolveTargetUser(ctx, caller, ownerID)
+	if err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	owner, err := auth.userProvider.UserByID(ctx, ownerID)
+	if err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	if owner.IsServiceAccount() {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, ErrInvalidOwner)
+	}
+
+	account := models.ServiceAccount{
+		Name:        strings.TrimSpace(name),
+		Description: description,
+		OwnerID:     owner.ID,
+		Roles:       []string{},
+		Status:      models.UserStatusActive,
+		CreatedAt:   time.Now(),
+	}
+
+	account.ID, err = auth.serviceAccounts.SaveServiceAccount(ctx, account)
+	if err != nil {
+		log.Error("failed to save service account")
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  account.ID,
+		ActorID: caller.UserID,
+		Action:  models.AuditServiceAccountCreated,
+		Details: map[string]string{"name": account.Name, "owner_id": fmt.Sprint(account.OwnerID)},
+	})
+
+	log.Info(
+		"service account created",
+		slog.Int64("service_account_id", account.ID),
+		slog.Int64("owner_id", account.OwnerID),
+	)
+
+	return account, nil
+}
+
+// ServiceAccount returns a service account to its owner or an admin.
+func (auth *Auth) ServiceAccount(
+	ctx context.Context,
+	caller jwt.Claims,
+	accountID int64,
+) (models.ServiceAccount, error) {
+	const operation = "auth.ServiceAccount"
+
+	account, err := auth.managedServiceAccount(ctx, caller, accountID)
+	if err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return account, nil
+}
+
+// ServiceAccounts returns the service accounts owned by ownerID. A zero
+// ownerID means all service accounts for admins and the caller's own for
+// everyone else; listing anyone else's requires admin rights.
+func (auth *Auth) ServiceAccounts(
+	ctx context.Context,
+	caller jwt.Claims,
+	ownerID int64,
+) ([]models.ServiceAccount, error) {
+	const operation = "auth.ServiceAccounts"
+
+	if ownerID == 0 {
+		isAdmin, err := auth.userProvider.IsAdmin(ctx, caller.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		if !isAdmin {
+			ownerID = caller.UserID
+		}
+	} else {
+		var err error
+		if ownerID, err = auth.resolveTargetUser(ctx, caller, ownerID); err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	accounts, err := auth.serviceAccounts.ServiceAccounts(ctx, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return accounts, nil
+}
+
+// DeleteServiceAccount soft-deletes a service account on behalf of its
+// owner or an admin. Its API keys and client tokens stop working at once,
+// and it is purged with the other deleted accounts after the grace period.
+func (auth *Auth) DeleteServiceAccount(
+	ctx context.Context,
+	caller jwt.Claims,
+	accountID int64,
+) error {
+	const operation = "auth.DeleteServiceAccount"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("service_account_id", accountID),
+	)
+
+	account, err := auth.managedServiceAccount(ctx, caller, accountID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.accountManager.SetUserStatus(
+		ctx,
+		account.ID,
+		models.UserStatusDeleted,
+		"",
+		time.Now(),
+	); err != nil {
+		log.Error("failed to delete service account")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  account.ID,
+		ActorID: caller.UserID,
+		Action:  models.AuditAccountDeleted,
+		Details: map[string]string{"status": string(models.UserStatusDeleted)},
+	})
+
+	log.Info("service account deleted", slog.Int64("deleted_by", caller.UserID))
+
+	return nil
+}
+
+// SetServiceAccountRoles replaces the roles of a service account on behalf
+// of an admin. Owners cannot grant roles, as that would let them give
+// themselves admin rights through the account.
+func (auth *Auth) SetServiceAccountRoles(
+	ctx context.Context,
+	caller jwt.Claims,
+	accountID int64,
+	roles []string,
+) (models.ServiceAccount, error) {
+	const operation = "auth.SetServiceAccountRoles"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("service_account_id", accountID),
+	)
+
+	for _, role := range roles {
+		if role != models.RoleAdmin {
+			return models.ServiceAccount{}, fmt.Errorf("%s: %w: %s", operation, ErrUnknownRole, role)
+		}
+	}
+
+	if err := RequireAdmin(ctx, auth.userProvider, caller); err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	account, err := auth.serviceAccounts.ServiceAccount(ctx, accountID)
+	if err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	wantAdmin := slices.Contains(roles, models.RoleAdmin)
+	if err := auth.accountManager.SetUserAdmin(ctx, account.ID, wantAdmin); err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	account.Roles = []string{}
+	if wantAdmin {
+		account.Roles = append(account.Roles, models.RoleAdmin)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  account.ID,
+		ActorID: caller.UserID,
+		Action:  models.AuditRolesChanged,
+		Details: map[string]string{"roles": strings.Join(account.Roles, " ")},
+	})
+
+	log.Info("service account roles changed", slog.Any("roles", account.Roles))
+
+	return account, nil
+}
+
+// managedServiceAccount returns a service account the caller owns or, for
+// admins, any service account. Accounts the caller cannot manage are
+// reported as not found.
+func (auth *Auth) managedServiceAccount(
+	ctx context.Context,
+	caller jwt.Claims,
+	accountID int64,
+) (models.ServiceAccount, error) {
+	account, err := auth.serviceAccounts.ServiceAccount(ctx, accountID)
+	if err != nil {
+		return models.ServiceAccount{}, err
+	}
+
+	if account.OwnerID == caller.UserID {
+		return account, nil
+	}
+
+	isAdmin, err := auth.userProvider.IsAdmin(ctx, caller.UserID)
+	if err != nil {
+		return models.ServiceAccount{}, err
+	}
+	if !isAdmin {
+		return models.ServiceAccount{}, storage.ErrServiceAccountNotFound
+	}
+
+	return account, nil
+}
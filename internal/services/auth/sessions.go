@@ -0,0 +1,490 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+// touchInterval limits how often token verification writes last-seen
+// timestamps back to storage.
+const touchInterval = time.Minute
+
+type SessionProvider interface {
+	SaveSession(ctx context.Context, session models.Session, refreshHash []byte) error
+	Session(ctx context.Context, sessionID string) (models.Session, error)
+	SessionByRefreshHash(ctx context.Context, refreshHash []byte) (models.Session, error)
+	Sessions(ctx context.Context, userID int64) ([]models.Session, error)
+	AllSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	RotateSession(
+		ctx context.Context,
+		sessionID string,
+		refreshHash []byte,
+		lastSeenAt time.Time,
+		expiresAt time.Time,
+	) error
+	StartBrowserSession(ctx context.Context, sessionID string, cookieHash []byte) error
+	TouchSession(ctx context.Context, sessionID string, lastSeenAt time.Time) error
+	RevokeSession(ctx context.Context, sessionID string, revokedAt time.Time) error
+	RevokeUserSessions(
+		ctx context.Context,
+		userID int64,
+		exceptID string,
+		revokedAt time.Time,
+	) (int64, error)
+}
+
+func (auth *Auth) startSession(
+	ctx context.Context,
+	user models.User,
+	client models.ClientInfo,
+) (models.TokenPair, error) {
+	return auth.openSession(ctx, user, models.Session{
+		Device:    client.Device,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		AMR:       []string{models.AMRPassword},
+	}, auth.tokenTTL)
+}
+
+// openSession saves a new session for user built from the given template
+// and issues its first token pair. opts add claims to the access token.
+func (auth *Auth) openSession(
+	ctx context.Context,
+	user models.User,
+	session models.Session,
+	tokenTTL time.Duration,
+	opts ...jwt.Option,
+) (models.TokenPair, error) {
+	sessionID, err := random.Token(16)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	refreshToken, err := random.Token(32)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	now := time.Now()
+	session.ID = sessionID
+	session.UserID = user.ID
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	if session.ExpiresAt.IsZero() {
+		session.ExpiresAt = now.Add(auth.refreshTokenTTL)
+	}
+	if session.AuthTime.IsZero() {
+		session.AuthTime = now
+	}
+
+	if err := auth.sessionProvider.SaveSession(ctx, session, random.Hash(refreshToken)); err != nil {
+		return models.TokenPair{}, err
+	}
+
+	accessToken, err := auth.accessToken(user, session, tokenTTL, opts...)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		SessionID:    sessionID,
+	}, nil
+}
+
+func (auth *Auth) accessToken(
+	user models.User,
+	session models.Session,
+	tokenTTL time.Duration,
+	opts ...jwt.Option,
+) (string, error) {
+	// Options of the caller come last, so that they can override how the
+	// user authenticated, as step-up tokens do.
+	opts = append([]jwt.Option{
+		jwt.WithProfileClaims(auth.claimMapping, user.Profile),
+		jwt.WithAuthentication(session.AuthTime, session.AMR),
+	}, opts...)
+	if session.ClientID != "" {
+		opts = append(opts, jwt.WithClient(session.ClientID, session.Scope))
+	}
+
+	return jwt.NewToken(user, session.ID, auth.jwtSecret, tokenTTL, opts...)
+}
+
+// tokenLifetimes returns how long the access and refresh tokens issued to
+// client are valid. Clients may override the defaults; the zero client
+// stands for first-party logins.
+func (auth *Auth) tokenLifetimes(client models.OAuthClient) (time.Duration, time.Duration) {
+	accessTTL, refreshTTL := auth.tokenTTL, auth.refreshTokenTTL
+	if client.AccessTokenTTL > 0 {
+		accessTTL = client.AccessTokenTTL
+	}
+	if client.RefreshTokenTTL > 0 {
+		refreshTTL = client.RefreshTokenTTL
+	}
+
+	return accessTTL, refreshTTL
+}
+
+// Refresh exchanges a refresh token for a new token pair. The refresh token
+// is rotated, so each one can only be used once.
+func (auth *Auth) Refresh(
+	ctx context.Context,
+	refreshToken string,
+) (models.TokenPair, error) {
+	const operation = "auth.Refresh"
+
+	tokens, err := auth.refresh(ctx, operation, models.OAuthClient{}, refreshToken)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return tokens, nil
+}
+
+// refresh rotates the refresh token of a session that belongs to clientID,
+// which is empty for sessions opened through Login.
+func (auth *Auth) refresh(
+	ctx context.Context,
+	operation string,
+	client models.OAuthClient,
+	refreshToken string,
+) (models.TokenPair, error) {
+	log := auth.log.With(
+		slog.String("operation", operation),
+	)
+
+	session, err := auth.sessionProvider.SessionByRefreshHash(ctx, random.Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			log.Warn("unknown refresh token")
+			return models.TokenPair{}, ErrInvalidToken
+		}
+		log.Error("failed to get session")
+		return models.TokenPair{}, err
+	}
+
+	if session.ClientID != client.ID {
+		log.Warn("refresh token used by another client", slog.String("session_id", session.ID))
+		return models.TokenPair{}, ErrInvalidToken
+	}
+
+	if session.Browser {
+		log.Warn("browser session cookie used as refresh token", slog.String("session_id", session.ID))
+		return models.TokenPair{}, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if !session.IsActive(now) {
+		log.Warn("session is no longer active", slog.String("session_id", session.ID))
+		return models.TokenPair{}, ErrInvalidToken
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, session.UserID)
+	if err != nil {
+		log.Error("failed to get user")
+		return models.TokenPair{}, err
+	}
+
+	if err := checkStatus(user); err != nil {
+		log.Warn("refresh for inactive account", slog.String("status", string(user.Status)))
+		return models.TokenPair{}, err
+	}
+
+	accessTTL, refreshTTL := auth.tokenLifetimes(client)
+
+	newRefreshToken, err := random.Token(32)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	err = auth.sessionProvider.RotateSession(
+		ctx,
+		session.ID,
+		random.Hash(newRefreshToken),
+		now,
+		now.Add(refreshTTL),
+	)
+	if err != nil {
+		log.Error("failed to rotate session")
+		return models.TokenPair{}, err
+	}
+
+	accessToken, err := auth.accessToken(user, session, accessTTL)
+	if err != nil {
+		log.Error("failed to generate token")
+		return models.TokenPair{}, err
+	}
+
+	log.Info("session refreshed", slog.String("session_id", session.ID))
+
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		SessionID:    session.ID,
+	}, nil
+}
+
+// VerifyToken checks the signature and expiry of an access token, that the
+// session it was issued for has not been revoked and that its account is
+// still active.
+func (auth *Auth) VerifyToken(
+	ctx context.Context,
+	token string,
+) (jwt.Claims, error) {
+	const operation = "auth.VerifyToken"
+
+	claims, err := jwt.ParseToken(token, auth.jwtSecret)
+	if err != nil || claims.IsClient() {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+	}
+
+	session, err := auth.sessionProvider.Session(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+		}
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+	if session.UserID != claims.UserID || !session.IsActive(now) {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+		}
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if now.Sub(session.LastSeenAt) > touchInterval {
+		if err := auth.sessionProvider.TouchSession(ctx, session.ID, now); err != nil {
+			auth.log.Warn(
+				"failed to update session last seen time",
+				slog.String("operation", operation),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	return claims, nil
+}
+
+// VerifySessionToken verifies an access token like VerifyToken and also
+// requires it to be a first-party session token, issued by logging in to
+// gia-sso itself. Tokens of OAuth clients, token exchanges and those
+// restricted to an audience are rejected, so that a token handed to some
+// service cannot be replayed to manage the account.
+func (auth *Auth) VerifySessionToken(
+	ctx context.Context,
+	token string,
+) (jwt.Claims, error) {
+	const operation = "auth.VerifySessionToken"
+
+	claims, err := auth.VerifyToken(ctx, token)
+	if err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if claims.ClientID != "" || claims.Actor != nil || len(claims.Audience) > 0 {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// Logout revokes the session the given access token belongs to.
+func (auth *Auth) Logout(
+	ctx context.Context,
+	token string,
+) error {
+	const operation = "auth.Logout"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+	)
+
+	claims, err := auth.VerifyToken(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	session, err := auth.sessionProvider.Session(ctx, claims.SessionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// Logging out of an app ends the SSO session it was opened from, and
+	// with it the sessions of all other apps.
+	sessionID := session.ID
+	if session.ParentID != "" {
+		sessionID = session.ParentID
+	}
+
+	if err := auth.sessionProvider.RevokeSession(ctx, sessionID, time.Now()); err != nil {
+		log.Error("failed to revoke session")
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  claims.UserID,
+		ActorID: claims.UserID,
+		Action:  models.AuditLogout,
+		Details: map[string]string{"session_id": sessionID},
+	})
+
+	log.Info("user logged out", slog.String("session_id", sessionID))
+
+	return nil
+}
+
+// ListSessions returns the active sessions of userID. A zero userID means the
+// caller's own sessions; listing anyone else's requires admin rights.
+func (auth *Auth) ListSessions(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+) ([]models.Session, error) {
+	const operation = "auth.ListSessions"
+
+	userID, err := auth.resolveTargetUser(ctx, caller, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	sessions, err := auth.sessionProvider.Sessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes a single session. Users may revoke their own
+// sessions, admins may revoke anyone's.
+func (auth *Auth) RevokeSession(
+	ctx context.Context,
+	caller jwt.Claims,
+	sessionID string,
+) error {
+	const operation = "auth.RevokeSession"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.String("session_id", sessionID),
+	)
+
+	session, err := auth.sessionProvider.Session(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, err := auth.resolveTargetUser(ctx, caller, session.UserID); err != nil {
+		// Do not disclose that the session exists to someone who cannot see it.
+		if errors.Is(err, ErrPermissionDenied) {
+			return fmt.Errorf("%s: %w", operation, storage.ErrSessionNotFound)
+		}
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := auth.sessionProvider.RevokeSession(ctx, sessionID, time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  session.UserID,
+		ActorID: caller.UserID,
+		Action:  models.AuditSessionRevoked,
+		Details: map[string]string{"session_id": sessionID},
+	})
+
+	log.Info("session revoked", slog.Int64("revoked_by", caller.UserID))
+
+	return nil
+}
+
+// RevokeAllOtherSessions revokes every session of userID except the one the
+// caller is using. When an admin targets another user, all of that user's
+// sessions are revoked.
+func (auth *Auth) RevokeAllOtherSessions(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+) (int64, error) {
+	const operation = "auth.RevokeAllOtherSessions"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+	)
+
+	userID, err := auth.resolveTargetUser(ctx, caller, userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	exceptID := ""
+	if userID == caller.UserID {
+		exceptID = caller.SessionID
+	}
+
+	revoked, err := auth.sessionProvider.RevokeUserSessions(ctx, userID, exceptID, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  userID,
+		ActorID: caller.UserID,
+		Action:  models.AuditSessionsRevoked,
+		Details: map[string]string{"count": strconv.FormatInt(revoked, 10)},
+	})
+
+	log.Info(
+		"sessions revoked",
+		slog.Int64("user_id", userID),
+		slog.Int64("revoked_by", caller.UserID),
+		slog.Int64("count", revoked),
+	)
+
+	return revoked, nil
+}
+
+// resolveTargetUser returns the user an operation applies to, defaulting to
+// the caller and requiring admin rights for anyone else.
+func (auth *Auth) resolveTargetUser(
+	ctx context.Context,
+	caller jwt.Claims,
+	userID int64,
+) (int64, error) {
+	if userID == 0 || userID == caller.UserID {
+		return caller.UserID, nil
+	}
+
+	isAdmin, err := auth.userProvider.IsAdmin(ctx, caller.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !isAdmin {
+		return 0, ErrPermissionDenied
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrStepUpRequired is returned when a token does not satisfy the
+	// authentication level or age a caller demands.
+	ErrStepUpRequired = errors.New("step-up authentication required")
+	ErrUnknownACR     = errors.New("unknown authentication context class")
+)
+
+// StepUpChallenge is how a user proves themselves again: with their
+// password, with a code of an email login they started for their own
+// address, or with a code StartSMSChallenge texted to their verified phone.
+type StepUpChallenge struct {
+	Password     string
+	EmailLoginID string
+	EmailCode    string
+	SMSCodeID    string
+	SMSCode      string
+}
+
+// StepUp re-authenticates the user of the caller's session and returns a
+// short-lived access token with a fresh auth_time. The methods of the
+// challenge add to those the session was opened with, so a password session
+// that passes an email or SMS code reaches ACRMultiFactor. acr, when set, is the
+// class the new token must satisfy. The session itself is not elevated.
+func (auth *Auth) StepUp(
+	ctx context.Context,
+	caller jwt.Claims,
+	challenge StepUpChallenge,
+	acr string,
+) (string, jwt.Claims, error) {
+	const operation = "auth.StepUp"
+
+	log := auth.log.With(
+		slog.String("operation", operation),
+		slog.Int64("user_id", caller.UserID),
+	)
+
+	if acr != "" && models.ACRLevel(acr) < 0 {
+		return "", jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrUnknownACR)
+	}
+
+	// Someone acting on behalf of the user cannot prove to be them.
+	if caller.SessionID == "" || caller.Actor != nil {
+		return "", jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrPermissionDenied)
+	}
+
+	session, err := auth.sessionProvider.Session(ctx, caller.SessionID)
+	if err != nil {
+		return "", jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, session.UserID)
+	if err != nil {
+		return "", jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		return "", jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	method, err := auth.verifyChallenge(ctx, user, challenge)
+	if err != nil {
+		log.Warn("step-up challenge failed", slog.String("error", err.Error()))
+		return "", jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	amr := slices.Clone(session.AMR)
+	if !slices.Contains(amr, method) {
+		amr = append(amr, method)
+	}
+
+	if acr != "" && models.ACRLevel(models.ACR(amr)) < models.ACRLevel(acr) {
+		log.Warn("step-up does not reach requested level", slog.String("acr", acr))
+		return "", jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrStepUpRequired)
+	}
+
+	now := time.Now()
+
+	token, err := auth.accessToken(user, session, auth.stepUpTokenTTL, jwt.WithAuthentication(now, amr))
+	if err != nil {
+		log.Error("failed to generate token")
+		return "", jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	claims, err := jwt.ParseToken(token, auth.jwtSecret)
+	if err != nil {
+		return "", jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	auth.audit(ctx, models.AuditEvent{
+		UserID:  user.ID,
+		ActorID: user.ID,
+		Action:  models.AuditStepUp,
+		Details: map[string]string{
+			"session_id": session.ID,
+			"method":     method,
+			"acr":        claims.ACR,
+		},
+	})
+
+	log.Info("user stepped up", slog.String("acr", claims.ACR))
+
+	return token, claims, nil
+}
+
+// CheckAuthentication reports ErrStepUpRequired unless the user of claims
+// authenticated at least at class minACR and no longer than maxAge ago.
+// Empty minACR and zero maxAge impose no requirement.
+func (auth *Auth) CheckAuthentication(claims jwt.Claims, minACR string, maxAge time.Duration) error {
+	const operation = "auth.CheckAuthentication"
+
+	if minACR != "" {
+		level := models.ACRLevel(minACR)
+		if level < 0 {
+			return fmt.Errorf("%s: %w", operation, ErrUnknownACR)
+		}
+		if models.ACRLevel(claims.ACR) < level {
+			return fmt.Errorf("%s: %w", operation, ErrStepUpRequired)
+		}
+	}
+
+	if maxAge > 0 && (claims.AuthTime.IsZero() || time.Since(claims.AuthTime) > maxAge) {
+		return fmt.Errorf("%s: %w", operation, ErrStepUpRequired)
+	}
+
+	return nil
+}
+
+// verifyChallenge checks the proof of a step-up and returns the
+// authentication method it stands for.
+func (auth *Auth) verifyChallenge(
+	ctx context.Context,
+	user models.User,
+	challenge StepUpChallenge,
+) (string, error) {
+	if challenge.SMSCodeID != "" {
+		if auth.smsSender == nil {
+			return "", ErrSMSDisabled
+		}
+		if !user.Profile.PhoneVerified() {
+			return "", ErrPhoneNotVerified
+		}
+
+		if _, err := auth.usePhoneCode(ctx, user, models.PhoneCodeOTP, challenge.SMSCodeID, challenge.SMSCode); err != nil {
+			return "", err
+		}
+
+		return models.AMRSMS, nil
+	}
+
+	if challenge.EmailLoginID != "" {
+		if auth.emailLogin.Method != models.EmailLoginCode {
+			return "", ErrEmailLoginDisabled
+		}
+
+		login, err := auth.codeLogin(ctx, challenge.EmailLoginID, challenge.EmailCode)
+		if err != nil {
+			if errors.Is(err, storage.ErrEmailLoginNotFound) {
+				return "", ErrInvalidEmailLogin
+			}
+			return "", err
+		}
+
+		now := time.Now()
+		if login.UserID != user.ID || !login.IsPending(now) {
+			return "", ErrInvalidEmailLogin
+		}
+
+		if err := auth.emailLoginStorage.UseEmailLogin(ctx, login.ID, now); err != nil {
+			if errors.Is(err, storage.ErrEmailLoginNotFound) {
+				return "", ErrInvalidEmailLogin
+			}
+			return "", err
+		}
+
+		return models.AMREmail, nil
+	}
+
+	if bcrypt.CompareHashAndPassword(user.PassHash, []byte(challenge.Password)) == nil {
+		return models.AMRPassword, nil
+	}
+
+	// Directory users prove themselves with their directory password.
+	if auth.directory != nil {
+		directoryUser, err := auth.directory.Authenticate(ctx, user.Email, challenge.Password)
+		if err == nil {
+			identity, err := auth.identityStorage.Identity(ctx, models.ProviderLDAP, directoryUser.Subject)
+			if err == nil && identity.UserID == user.ID {
+				return models.AMRPassword, nil
+			}
+		}
+	}
+
+	return "", storage.ErrInvalidCredentials
+}
@@ -0,0 +1,255 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+func TestStepUp(t *testing.T) {
+	tests := []struct {
+		name string
+		// challenge returns the proof, given the login code sent to the
+		// user and the one sent to someone else.
+		challenge func(own, other models.EmailLogin, ownCode, otherCode string) auth.StepUpChallenge
+		claims    func(jwt.Claims) jwt.Claims
+		acr       string
+		wantACR   string
+		wantAMR   []string
+		wantErr   error
+	}{
+		{
+			name: "password",
+			challenge: func(_, _ models.EmailLogin, _, _ string) auth.StepUpChallenge {
+				return auth.StepUpChallenge{Password: testPassword}
+			},
+			wantACR: models.ACRPassword,
+			wantAMR: []string{models.AMRPassword},
+		},
+		{
+			name: "password for multi-factor",
+			challenge: func(_, _ models.EmailLogin, _, _ string) auth.StepUpChallenge {
+				return auth.StepUpChallenge{Password: testPassword}
+			},
+			acr:     models.ACRMultiFactor,
+			wantErr: auth.ErrStepUpRequired,
+		},
+		{
+			name: "email code for multi-factor",
+			challenge: func(own, _ models.EmailLogin, ownCode, _ string) auth.StepUpChallenge {
+				return auth.StepUpChallenge{EmailLoginID: own.ID, EmailCode: ownCode}
+			},
+			acr:     models.ACRMultiFactor,
+			wantACR: models.ACRMultiFactor,
+			wantAMR: []string{models.AMRPassword, models.AMREmail},
+		},
+		{
+			name: "wrong password",
+			challenge: func(_, _ models.EmailLogin, _, _ string) auth.StepUpChallenge {
+				return auth.StepUpChallenge{Password: "wrong password"}
+			},
+			wantErr: storage.ErrInvalidCredentials,
+		},
+		{
+			name: "wrong email code",
+			challenge: func(own, _ models.EmailLogin, _, _ string) auth.StepUpChallenge {
+				return auth.StepUpChallenge{EmailLoginID: own.ID, EmailCode: "wrong"}
+			},
+			wantErr: auth.ErrInvalidEmailLogin,
+		},
+		{
+			name: "email code of someone else",
+			challenge: func(_, other models.EmailLogin, _, otherCode string) auth.StepUpChallenge {
+				return auth.StepUpChallenge{EmailLoginID: other.ID, EmailCode: otherCode}
+			},
+			wantErr: auth.ErrInvalidEmailLogin,
+		},
+		{
+			name: "unknown acr",
+			challenge: func(_, _ models.EmailLogin, _, _ string) auth.StepUpChallenge {
+				return auth.StepUpChallenge{Password: testPassword}
+			},
+			acr:     "urn:example:acr:unknown",
+			wantErr: auth.ErrUnknownACR,
+		},
+		{
+			name: "on behalf of the user",
+			challenge: func(_, _ models.EmailLogin, _, _ string) auth.StepUpChallenge {
+				return auth.StepUpChallenge{Password: testPassword}
+			},
+			claims: func(c jwt.Claims) jwt.Claims {
+				c.Actor = &models.Actor{Subject: "support"}
+				return c
+			},
+			wantErr: auth.ErrPermissionDenied,
+		},
+		{
+			name: "without a session",
+			challenge: func(_, _ models.EmailLogin, _, _ string) auth.StepUpChallenge {
+				return auth.StepUpChallenge{Password: testPassword}
+			},
+			claims: func(c jwt.Claims) jwt.Claims {
+				c.SessionID = ""
+				return c
+			},
+			wantErr: auth.ErrPermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mailer{}
+			e := emailLoginEnv(t, models.EmailLoginCode, m)
+			e.register(t, "other@example.com")
+			ctx := context.Background()
+
+			_, claims := e.login(t, "user@example.com")
+			if tt.claims != nil {
+				claims = tt.claims(claims)
+			}
+
+			own, err := e.auth.StartEmailLogin(ctx, "user@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ownCode := codePattern.FindString(m.last(t).Body)
+
+			other, err := e.auth.StartEmailLogin(ctx, "other@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherCode := codePattern.FindString(m.last(t).Body)
+
+			challenge := tt.challenge(own, other, ownCode, otherCode)
+
+			token, stepped, err := e.auth.StepUp(ctx, claims, challenge, tt.acr)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if stepped.ACR != tt.wantACR {
+				t.Errorf("acr %q, want %q", stepped.ACR, tt.wantACR)
+			}
+			if !slices.Equal(stepped.AMR, tt.wantAMR) {
+				t.Errorf("amr %v, want %v", stepped.AMR, tt.wantAMR)
+			}
+			if stepped.AuthTime.Before(claims.AuthTime) {
+				t.Errorf("auth_time %v is older than the login at %v", stepped.AuthTime, claims.AuthTime)
+			}
+			if stepped.SessionID != claims.SessionID {
+				t.Errorf("session %q, want %q", stepped.SessionID, claims.SessionID)
+			}
+
+			verified, err := e.auth.VerifyToken(ctx, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := e.auth.CheckAuthentication(verified, tt.wantACR, time.Minute); err != nil {
+				t.Errorf("stepped up token: %v", err)
+			}
+
+			// The session itself is not elevated.
+			_, again := e.login(t, "user@example.com")
+			if again.ACR != models.ACRPassword {
+				t.Errorf("new login acr %q, want %q", again.ACR, models.ACRPassword)
+			}
+
+			// An email code is used up by the step-up.
+			if challenge.EmailLoginID != "" {
+				_, _, err := e.auth.StepUp(ctx, claims, challenge, tt.acr)
+				if !errors.Is(err, auth.ErrInvalidEmailLogin) {
+					t.Errorf("replay: got %v, want %v", err, auth.ErrInvalidEmailLogin)
+				}
+			}
+		})
+	}
+}
+
+func TestStepUpEmailCodeDisabled(t *testing.T) {
+	e := newEnv(t, auth.Config{})
+	e.register(t, "user@example.com")
+	_, claims := e.login(t, "user@example.com")
+
+	challenge := auth.StepUpChallenge{EmailLoginID: "id", EmailCode: "000000"}
+
+	_, _, err := e.auth.StepUp(context.Background(), claims, challenge, "")
+	if !errors.Is(err, auth.ErrEmailLoginDisabled) {
+		t.Errorf("got %v, want %v", err, auth.ErrEmailLoginDisabled)
+	}
+}
+
+func TestCheckAuthentication(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		claims  jwt.Claims
+		minACR  string
+		maxAge  time.Duration
+		wantErr error
+	}{
+		{name: "no requirement", claims: jwt.Claims{}},
+		{
+			name:   "recent password",
+			claims: jwt.Claims{ACR: models.ACRPassword, AuthTime: now.Add(-time.Minute)},
+			minACR: models.ACRPassword,
+			maxAge: 5 * time.Minute,
+		},
+		{
+			name:   "multi-factor for password",
+			claims: jwt.Claims{ACR: models.ACRMultiFactor, AuthTime: now},
+			minACR: models.ACRPassword,
+		},
+		{
+			name:    "password for multi-factor",
+			claims:  jwt.Claims{ACR: models.ACRPassword, AuthTime: now},
+			minACR:  models.ACRMultiFactor,
+			wantErr: auth.ErrStepUpRequired,
+		},
+		{
+			name:    "no acr",
+			claims:  jwt.Claims{AuthTime: now},
+			minACR:  models.ACRPassword,
+			wantErr: auth.ErrStepUpRequired,
+		},
+		{
+			name:    "unknown acr required",
+			claims:  jwt.Claims{ACR: models.ACRMultiFactor, AuthTime: now},
+			minACR:  "urn:example:acr:unknown",
+			wantErr: auth.ErrUnknownACR,
+		},
+		{
+			name:    "too old",
+			claims:  jwt.Claims{ACR: models.ACRMultiFactor, AuthTime: now.Add(-10 * time.Minute)},
+			maxAge:  5 * time.Minute,
+			wantErr: auth.ErrStepUpRequired,
+		},
+		{
+			name:    "no auth time",
+			claims:  jwt.Claims{ACR: models.ACRMultiFactor},
+			maxAge:  5 * time.Minute,
+			wantErr: auth.ErrStepUpRequired,
+		},
+	}
+
+	e := newEnv(t, auth.Config{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := e.auth.CheckAuthentication(tt.claims, tt.minACR, tt.maxAge)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+// Package directory authenticates users with their password in an LDAP
+// directory, such as Active Directory.
+package directory
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type Directory struct {
+	log        *slog.Logger
+	cfg        Config
+	tlsConfig  *tls.Config
+	groupRoles map[string]string
+}
+
+// Config holds the settings of the directory connection.
+type Config struct {
+	// URL is the directory server, e.g. "ldaps://dc.example.com".
+	URL string
+	// StartTLS upgrades ldap:// connections to TLS before binding.
+	StartTLS bool
+	// TLS is used for ldaps:// and StartTLS connections.
+	TLS *tls.Config
+	// Timeout bounds connecting and each request to the server.
+	Timeout time.Duration
+	// BindDN and BindPassword are the account users are searched with
+	// before binding as them. Without one, users bind as UserDN right away
+	// and are searched as themselves.
+	BindDN       string
+	BindPassword string
+	// UserDN is the name users bind as when there is no BindDN, with each
+	// %s replaced by their login, e.g. "uid=%s,ou=people,dc=example,dc=com",
+	// or "%s" for user principal names in Active Directory.
+	UserDN string
+	// BaseDN and UserFilter find the entry of a user, with each %s in the
+	// filter replaced by their login, e.g. "(&(objectClass=person)(mail=%s))".
+	BaseDN     string
+	UserFilter string
+	Attributes Attributes
+	// GroupRoles maps the DNs of groups to the role their members get.
+	// Empty leaves the roles of users alone.
+	GroupRoles map[string]string
+}
+
+// Attributes names the attributes of user entries gia-sso reads.
+type Attributes struct {
+	// ID identifies users across renames, e.g. "entryUUID" or
+	// "objectGUID". Empty uses the DN of their entry.
+	ID string
+	// Email defaults to the login of the user when the entry has none.
+	// Such emails are not trusted to link or provision accounts.
+	Email  string
+	Groups string
+}
+
+func New(log *slog.Logger, cfg Config) (*Directory, error) {
+	serverURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid directory url: %w", err)
+	}
+
+	switch serverURL.Scheme {
+	case "ldaps":
+	case "ldap":
+		if !cfg.StartTLS {
+			log.Warn("passwords are sent to the directory unencrypted, use ldaps or start_tls")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported directory url scheme %q", serverURL.Scheme)
+	}
+
+	if cfg.BaseDN == "" || cfg.UserFilter == "" {
+		return nil, errors.New("directory needs a base dn and user filter")
+	}
+	if cfg.BindDN == "" && cfg.UserDN == "" {
+		return nil, errors.New("directory needs a bind dn or user dn")
+	}
+
+	tlsConfig := &tls.Config{}
+	if cfg.TLS != nil {
+		tlsConfig = cfg.TLS.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = serverURL.Hostname()
+	}
+
+	// Distinguished names compare case-insensitively.
+	groupRoles := make(map[string]string, len(cfg.GroupRoles))
+	for group, role := range cfg.GroupRoles {
+		groupRoles[strings.ToLower(group)] = role
+	}
+
+	return &Directory{
+		log:        log,
+		cfg:        cfg,
+		tlsConfig:  tlsConfig,
+		groupRoles: groupRoles,
+	}, nil
+}
+
+// Authenticate checks the password of the user with the given login in the
+// directory. It returns storage.ErrUserNotFound for logins the directory
+// does not know, and storage.ErrInvalidCredentials for wrong passwords.
+// Without a BindDN both look the same to the directory and are reported as
+// storage.ErrUserNotFound.
+func (d *Directory) Authenticate(
+	ctx context.Context,
+	login string,
+	password string,
+) (models.DirectoryUser, error) {
+	const operation = "directory.Authenticate"
+
+	// An empty password makes an unauthenticated bind, which servers accept
+	// for any name.
+	if login == "" || password == "" {
+		return models.DirectoryUser{}, fmt.Errorf("%s: %w", operation, storage.ErrInvalidCredentials)
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return models.DirectoryUser{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var entry *ldap.Entry
+
+	if d.cfg.BindDN != "" {
+		if err := conn.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			return models.DirectoryUser{}, fmt.Errorf("%s: service account bind: %w", operation, err)
+		}
+
+		entry, err = d.findUser(conn, login)
+		if err != nil {
+			return models.DirectoryUser{}, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		if err := conn.Bind(entry.DN, password); err != nil {
+			if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+				return models.DirectoryUser{}, fmt.Errorf("%s: %w", operation, storage.ErrInvalidCredentials)
+			}
+			return models.DirectoryUser{}, fmt.Errorf("%s: %w", operation, err)
+		}
+	} else {
+		if err := conn.Bind(strings.ReplaceAll(d.cfg.UserDN, "%s", ldap.EscapeDN(login)), password); err != nil {
+			if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+				return models.DirectoryUser{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+			}
+			return models.DirectoryUser{}, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		entry, err = d.findUser(conn, login)
+		if err != nil {
+			return models.DirectoryUser{}, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	user, err := d.directoryUser(entry, login)
+	if err != nil {
+		return models.DirectoryUser{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return user, nil
+}
+
+func (d *Directory) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(
+		d.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: d.cfg.Timeout}),
+		ldap.DialWithTLSConfig(d.tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetTimeout(d.cfg.Timeout)
+
+	if d.cfg.StartTLS {
+		if err := conn.StartTLS(d.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// findUser returns the only entry matching the user filter for login.
+func (d *Directory) findUser(conn *ldap.Conn, login string) (*ldap.Entry, error) {
+	attributes := make([]string, 0, 3)
+	for _, attribute := range []string{d.cfg.Attributes.ID, d.cfg.Attributes.Email, d.cfg.Attributes.Groups} {
+		if attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		d.cfg.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(d.cfg.Timeout.Seconds()),
+		false,
+		strings.ReplaceAll(d.cfg.UserFilter, "%s", ldap.EscapeFilter(login)),
+		attributes,
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+
+	if res == nil || len(res.Entries) != 1 {
+		if res != nil && len(res.Entries) > 1 {
+			d.log.Warn("login matches several directory entries", slog.String("operation", "directory.findUser"))
+		}
+		return nil, storage.ErrUserNotFound
+	}
+
+	return res.Entries[0], nil
+}
+
+func (d *Directory) directoryUser(entry *ldap.Entry, login string) (models.DirectoryUser, error) {
+	user := models.DirectoryUser{
+		Subject: entry.DN,
+		Email:   login,
+	}
+
+	if d.cfg.Attributes.ID != "" {
+		id := entry.GetEqualFoldRawAttributeValue(d.cfg.Attributes.ID)
+		if len(id) == 0 {
+			return models.DirectoryUser{}, fmt.Errorf("entry %q has no %s", entry.DN, d.cfg.Attributes.ID)
+		}
+
+		// Binary identifiers such as objectGUID are stored hex encoded.
+		if utf8.Valid(id) {
+			user.Subject = string(id)
+		} else {
+			user.Subject = hex.EncodeToString(id)
+		}
+	}
+
+	if d.cfg.Attributes.Email != "" {
+		if email := entry.GetEqualFoldAttributeValue(d.cfg.Attributes.Email); email != "" {
+			user.Email = email
+			user.EmailVerified = true
+		}
+	}
+
+	if len(d.groupRoles) > 0 {
+		user.Roles = []string{}
+		for _, group := range entry.GetEqualFoldAttributeValues(d.cfg.Attributes.Groups) {
+			role, ok := d.groupRoles[strings.ToLower(group)]
+			if ok && !slices.Contains(user.Roles, role) {
+				user.Roles = append(user.Roles, role)
+			}
+		}
+	}
+
+	return user, nil
+}
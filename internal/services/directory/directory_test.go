@@ -0,0 +1,393 @@
+package directory_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/directory"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// LDAP protocol operations and result codes the test server speaks.
+const (
+	opBindRequest      ber.Tag = 0
+	opBindResponse     ber.Tag = 1
+	opUnbindRequest    ber.Tag = 2
+	opSearchRequest    ber.Tag = 3
+	opSearchEntry      ber.Tag = 4
+	opSearchDone       ber.Tag = 5
+	opExtendedResponse ber.Tag = 24
+
+	resultSuccess            = 0
+	resultProtocolError      = 2
+	resultInvalidCredentials = 49
+	resultInsufficientAccess = 50
+
+	// filterEqualityMatch is the context tag of an attribute=value filter.
+	filterEqualityMatch ber.Tag = 3
+)
+
+type entry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// server is an in-process LDAP server that knows simple binds and searches
+// whose filters are conjunctions of equality matches.
+type server struct {
+	addr string
+
+	mu      sync.Mutex
+	entries []entry
+}
+
+func newServer(t *testing.T, entries ...entry) *server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &server{addr: listener.Addr().String(), entries: entries}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *server) url() string {
+	return "ldap://" + s.addr
+}
+
+func (s *server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case opBindRequest:
+			bound = s.bind(op.Children[1].Data.String(), op.Children[2].Data.String())
+			code := int64(resultSuccess)
+			if !bound {
+				code = resultInvalidCredentials
+			}
+			conn.Write(result(id, opBindResponse, code).Bytes())
+		case opUnbindRequest:
+			return
+		case opSearchRequest:
+			if !bound {
+				conn.Write(result(id, opSearchDone, resultInsufficientAccess).Bytes())
+				continue
+			}
+			for _, e := range s.search(op.Children[6]) {
+				conn.Write(searchEntry(id, e).Bytes())
+			}
+			conn.Write(result(id, opSearchDone, resultSuccess).Bytes())
+		default:
+			conn.Write(result(id, opExtendedResponse, resultProtocolError).Bytes())
+		}
+	}
+}
+
+func (s *server) bind(dn string, password string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) && e.password != "" && e.password == password {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *server) search(filter *ber.Packet) []entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches := map[string]string{}
+	equalityMatches(filter, matches)
+
+	var found []entry
+	for _, e := range s.entries {
+		ok := true
+		for attr, value := range matches {
+			if attr == "objectclass" {
+				continue
+			}
+			ok = ok && slices.ContainsFunc(e.attrs[attr], func(v string) bool {
+				return strings.EqualFold(v, value)
+			})
+		}
+		if ok {
+			found = append(found, e)
+		}
+	}
+
+	return found
+}
+
+// setAttr replaces the values of attr of the entry dn.
+func (s *server) setAttr(dn string, attr string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if e.dn == dn {
+			e.attrs[attr] = values
+		}
+	}
+}
+
+func equalityMatches(filter *ber.Packet, out map[string]string) {
+	if filter.ClassType == ber.ClassContext && filter.Tag == filterEqualityMatch {
+		out[strings.ToLower(filter.Children[0].Data.String())] = filter.Children[1].Data.String()
+		return
+	}
+
+	for _, child := range filter.Children {
+		equalityMatches(child, out)
+	}
+}
+
+func message(id int64, op *ber.Packet) *ber.Packet {
+	msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	msg.AppendChild(op)
+
+	return msg
+}
+
+func result(id int64, tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+
+	return message(id, op)
+}
+
+func searchEntry(id int64, e entry) *ber.Packet {
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+		}
+		attr.AppendChild(set)
+
+		attrs.AppendChild(attr)
+	}
+
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+	op.AppendChild(attrs)
+
+	return message(id, op)
+}
+
+const (
+	serviceDN = "cn=gia-sso,dc=example,dc=com"
+	aliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+	bobDN     = "uid=bob,ou=people,dc=example,dc=com"
+	adminsDN  = "cn=Admins,ou=groups,dc=example,dc=com"
+)
+
+func newDirectoryServer(t *testing.T) *server {
+	t.Helper()
+
+	return newServer(t,
+		entry{dn: serviceDN, password: "service secret"},
+		entry{dn: aliceDN, password: "alice secret", attrs: map[string][]string{
+			"uid":       {"alice"},
+			"mail":      {"alice@example.com"},
+			"entryUUID": {"alice-uuid"},
+			"memberOf":  {adminsDN},
+		}},
+		// Bob has no mail attribute.
+		entry{dn: bobDN, password: "bob secret", attrs: map[string][]string{
+			"uid":       {"bob"},
+			"entryUUID": {"bob-uuid"},
+		}},
+	)
+}
+
+func newDirectory(t *testing.T, cfg directory.Config) *directory.Directory {
+	t.Helper()
+
+	cfg.Timeout = 2 * time.Second
+	cfg.BaseDN = "dc=example,dc=com"
+	cfg.Attributes = directory.Attributes{ID: "entryUUID", Email: "mail", Groups: "memberOf"}
+
+	d, err := directory.New(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestAuthenticate(t *testing.T) {
+	srv := newDirectoryServer(t)
+
+	searchThenBind := newDirectory(t, directory.Config{
+		URL:          srv.url(),
+		BindDN:       serviceDN,
+		BindPassword: "service secret",
+		UserFilter:   "(&(objectClass=person)(uid=%s))",
+		GroupRoles:   map[string]string{strings.ToLower(adminsDN): models.RoleAdmin},
+	})
+	bindAsUser := newDirectory(t, directory.Config{
+		URL:        srv.url(),
+		UserDN:     "uid=%s,ou=people,dc=example,dc=com",
+		UserFilter: "(uid=%s)",
+	})
+
+	tests := []struct {
+		name      string
+		directory *directory.Directory
+		login     string
+		password  string
+		want      models.DirectoryUser
+		wantErr   error
+	}{
+		{
+			name:      "search then bind",
+			directory: searchThenBind,
+			login:     "alice",
+			password:  "alice secret",
+			want: models.DirectoryUser{
+				Subject:       "alice-uuid",
+				Email:         "alice@example.com",
+				EmailVerified: true,
+				Roles:         []string{models.RoleAdmin},
+			},
+		},
+		{
+			name:      "bind as user",
+			directory: bindAsUser,
+			login:     "alice",
+			password:  "alice secret",
+			want: models.DirectoryUser{
+				Subject:       "alice-uuid",
+				Email:         "alice@example.com",
+				EmailVerified: true,
+			},
+		},
+		{
+			// Without a mail attribute the login stands in for the
+			// email, but it is not trusted.
+			name:      "entry without mail",
+			directory: searchThenBind,
+			login:     "bob",
+			password:  "bob secret",
+			want: models.DirectoryUser{
+				Subject: "bob-uuid",
+				Email:   "bob",
+				Roles:   []string{},
+			},
+		},
+		{name: "wrong password", directory: searchThenBind, login: "alice", password: "wrong", wantErr: storage.ErrInvalidCredentials},
+		{name: "empty password", directory: searchThenBind, login: "alice", password: "", wantErr: storage.ErrInvalidCredentials},
+		{name: "unknown login", directory: searchThenBind, login: "carol", password: "alice secret", wantErr: storage.ErrUserNotFound},
+		{name: "filter injection", directory: searchThenBind, login: "*", password: "alice secret", wantErr: storage.ErrUserNotFound},
+		{name: "bind as user with wrong password", directory: bindAsUser, login: "alice", password: "wrong", wantErr: storage.ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.directory.Authenticate(context.Background(), tt.login, tt.password)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Subject != tt.want.Subject || got.Email != tt.want.Email ||
+				got.EmailVerified != tt.want.EmailVerified || !slices.Equal(got.Roles, tt.want.Roles) ||
+				(got.Roles == nil) != (tt.want.Roles == nil) {
+				t.Errorf("user = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateGroupRemoved(t *testing.T) {
+	srv := newDirectoryServer(t)
+	d := newDirectory(t, directory.Config{
+		URL:          srv.url(),
+		BindDN:       serviceDN,
+		BindPassword: "service secret",
+		UserFilter:   "(uid=%s)",
+		GroupRoles:   map[string]string{adminsDN: models.RoleAdmin},
+	})
+
+	srv.setAttr(aliceDN, "memberOf")
+
+	got, err := d.Authenticate(context.Background(), "alice", "alice secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty list, not nil, so that the admin role is taken away.
+	if got.Roles == nil || len(got.Roles) != 0 {
+		t.Errorf("roles = %#v, want none", got.Roles)
+	}
+}
+
+func TestAuthenticateServerDown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	d := newDirectory(t, directory.Config{
+		URL:        "ldap://" + addr,
+		BindDN:     serviceDN,
+		UserFilter: "(uid=%s)",
+	})
+
+	_, err = d.Authenticate(context.Background(), "alice", "alice secret")
+	if err == nil || errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want a connection error", err)
+	}
+}
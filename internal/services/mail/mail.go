@@ -0,0 +1,128 @@
+// Package mail sends the emails of gia-sso, such as login codes and magic
+// links.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+)
+
+// ErrInvalidHeader is returned for messages whose recipient or subject
+// would inject further headers.
+var ErrInvalidHeader = errors.New("invalid mail header")
+
+// LogSender writes messages to the log instead of sending them. It is meant
+// for local development, where codes and links are read from the log.
+type LogSender struct {
+	log *slog.Logger
+}
+
+func NewLogSender(log *slog.Logger) *LogSender {
+	return &LogSender{log: log}
+}
+
+func (s *LogSender) Send(_ context.Context, msg models.EmailMessage) error {
+	s.log.Info(
+		"email",
+		slog.String("operation", "mail.LogSender.Send"),
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+
+	return nil
+}
+
+// SMTPSender sends messages through an SMTP relay.
+type SMTPSender struct {
+	cfg SMTPConfig
+}
+
+// SMTPConfig holds the settings of the SMTP relay.
+type SMTPConfig struct {
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN auth, which net/smtp
+	// only allows over TLS or to localhost. Empty sends without auth.
+	Username string
+	Password string
+	// From is the sender address of all messages.
+	From    string
+	Timeout time.Duration
+}
+
+func NewSMTPSender(cfg SMTPConfig) *SMTPSender {
+	return &SMTPSender{cfg: cfg}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg models.EmailMessage) error {
+	const operation = "mail.SMTPSender.Send"
+
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("%s: %w", operation, ErrInvalidHeader)
+	}
+
+	// The envelope sender is the bare address, the header keeps the name.
+	from, err := netmail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+
+	// net/smtp has no context support, so the timeout of the relay is
+	// bounded by running the send in the background.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(
+			net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port)),
+			auth,
+			from.Address,
+			[]string{msg.To},
+			s.message(msg),
+		)
+	}()
+
+	timeout := time.NewTimer(s.cfg.Timeout)
+	defer timeout.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("%s: timed out after %s", operation, s.cfg.Timeout)
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", operation, ctx.Err())
+	}
+}
+
+func (s *SMTPSender) message(msg models.EmailMessage) []byte {
+	var b strings.Builder
+
+	b.WriteString("From: " + s.cfg.From + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
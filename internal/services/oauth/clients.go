@@ -0,0 +1,239 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+var ErrInvalidClientToken = errors.New("invalid client token")
+
+// ClientCredentials are the credentials a client presents at the token
+// endpoint. Which of them are required depends on the client's
+// authentication method.
+type ClientCredentials struct {
+	ClientID      string
+	Secret        string
+	AssertionType string
+	Assertion     string
+}
+
+// AuthenticateClient identifies the client calling the token endpoint.
+// Public clients only present their id, confidential ones must also present
+// their secret or a client assertion signed with one of their keys.
+func (o *OAuth) AuthenticateClient(
+	ctx context.Context,
+	creds ClientCredentials,
+) (models.OAuthClient, error) {
+	const operation = "oauth.AuthenticateClient"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+	)
+
+	clientID := creds.ClientID
+	if creds.Assertion != "" {
+		if creds.AssertionType != jwt.ClientAssertionType {
+			return models.OAuthClient{}, newError(InvalidClient, "unsupported client_assertion_type")
+		}
+
+		issuer, err := jwt.AssertionIssuer(creds.Assertion)
+		if err != nil {
+			return models.OAuthClient{}, newError(InvalidClient, "malformed client assertion")
+		}
+		if clientID != "" && clientID != issuer {
+			return models.OAuthClient{}, newError(InvalidClient, "client assertion was issued by another client")
+		}
+		clientID = issuer
+	}
+
+	if clientID == "" {
+		return models.OAuthClient{}, newError(InvalidClient, "client authentication required")
+	}
+
+	client, err := o.clientProvider.OAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotFound) {
+			return models.OAuthClient{}, newError(InvalidClient, "unknown client")
+		}
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log = log.With(slog.String("client_id", clientID))
+
+	switch client.AuthMethod() {
+	case models.AuthMethodNone:
+		return client, nil
+	case models.AuthMethodPrivateKeyJWT:
+		if creds.Assertion == "" {
+			return models.OAuthClient{}, newError(InvalidClient, "client assertion required")
+		}
+
+		assertion, err := jwt.ParseClientAssertion(
+			creds.Assertion,
+			client.JWKS,
+			client.ID,
+			o.assertionAudiences(),
+		)
+		if err != nil {
+			log.Warn("invalid client assertion", slog.String("error", err.Error()))
+			return models.OAuthClient{}, newError(InvalidClient, "client authentication failed")
+		}
+
+		if err := o.assertions.SaveClientAssertion(ctx, client.ID, assertion.ID, assertion.ExpiresAt); err != nil {
+			if errors.Is(err, storage.ErrAssertionReplayed) {
+				log.Warn("client assertion replayed")
+				return models.OAuthClient{}, newError(InvalidClient, "client assertion already used")
+			}
+			return models.OAuthClient{}, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		return client, nil
+	default:
+		if creds.Secret == "" || subtle.ConstantTimeCompare(random.Hash(creds.Secret), client.SecretHash) != 1 {
+			log.Warn("client authentication failed")
+			return models.OAuthClient{}, newError(InvalidClient, "client authentication failed")
+		}
+
+		return client, nil
+	}
+}
+
+// assertionAudiences are the values client assertions may be addressed to:
+// the issuer or the token endpoint.
+func (o *OAuth) assertionAudiences() []string {
+	issuer := strings.TrimSuffix(o.issuer, "/")
+	return []string{o.issuer, issuer, issuer + "/token"}
+}
+
+// ClientCredentialsGrant issues a token to an authenticated client for
+// itself. scope and audience narrow down what the client is registered for;
+// when empty, the token covers all of it.
+func (o *OAuth) ClientCredentialsGrant(
+	ctx context.Context,
+	client models.OAuthClient,
+	scope string,
+	audience string,
+) (TokenResponse, error) {
+	const operation = "oauth.ClientCredentialsGrant"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+		slog.String("client_id", client.ID),
+	)
+
+	if !client.IsConfidential() || !client.AllowsGrantType(GrantTypeClientCredentials) {
+		return TokenResponse{}, newError(UnauthorizedClient, "the client may not use the client credentials grant")
+	}
+
+	scopes := strings.Fields(normalizeScope(scope))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, s := range scopes {
+		if !slices.Contains(client.Scopes, s) {
+			return TokenResponse{}, newError(InvalidScope, "scope "+s+" is not allowed for the client")
+		}
+	}
+
+	audiences := client.Audience
+	if audience != "" {
+		if !slices.Contains(client.Audience, audience) {
+			return TokenResponse{}, newError(InvalidRequest, "audience "+audience+" is not allowed for the client")
+		}
+		audiences = []string{audience}
+	}
+
+	granted := strings.Join(scopes, " ")
+
+	var opts []jwt.Option
+	if client.ServiceAccountID != 0 {
+		if err := o.checkServiceAccountActive(ctx, client.ServiceAccountID); err != nil {
+			log.Warn(
+				"token requested for inactive service account",
+				slog.Int64("service_account_id", client.ServiceAccountID),
+			)
+			return TokenResponse{}, err
+		}
+		opts = append(opts, jwt.WithServiceAccount(client.ServiceAccountID))
+	}
+
+	token, err := jwt.NewClientToken(client.ID, granted, audiences, o.jwtSecret, o.accessTokenTTL(client), opts...)
+	if err != nil {
+		log.Error("failed to generate token")
+		return TokenResponse{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log.Info("client token issued", slog.String("scope", granted))
+
+	return TokenResponse{
+		AccessToken: token,
+		Scope:       granted,
+		ExpiresIn:   o.accessTokenTTL(client),
+	}, nil
+}
+
+// VerifyClientToken checks a token issued by ClientCredentialsGrant and
+// that its client is still registered. Tokens issued for a service account
+// also require the client to still be bound to it and the account to be
+// active.
+func (o *OAuth) VerifyClientToken(
+	ctx context.Context,
+	token string,
+) (jwt.Claims, error) {
+	const operation = "oauth.VerifyClientToken"
+
+	claims, err := jwt.ParseToken(token, o.jwtSecret)
+	if err != nil || !claims.IsClient() {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidClientToken)
+	}
+
+	client, err := o.clientProvider.OAuthClient(ctx, claims.ClientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotFound) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidClientToken)
+		}
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !client.AllowsGrantType(GrantTypeClientCredentials) {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidClientToken)
+	}
+
+	if claims.PrincipalType == models.PrincipalServiceAccount {
+		if claims.UserID != client.ServiceAccountID {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidClientToken)
+		}
+		if err := o.checkServiceAccountActive(ctx, claims.UserID); err != nil {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", operation, ErrInvalidClientToken)
+		}
+	}
+
+	return claims, nil
+}
+
+// checkServiceAccountActive checks that a service account can still
+// authenticate.
+func (o *OAuth) checkServiceAccountActive(ctx context.Context, accountID int64) error {
+	user, err := o.userProvider.UserByID(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return newError(UnauthorizedClient, "the service account of the client no longer exists")
+		}
+		return err
+	}
+	if !user.IsServiceAccount() || user.Status != models.UserStatusActive {
+		return newError(UnauthorizedClient, "the service account of the client is not active")
+	}
+
+	return nil
+}
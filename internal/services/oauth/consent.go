@@ -0,0 +1,144 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+// NeedsConsent reports whether the user of session has to approve the
+// scopes of an authorization request before a code is issued. First-party
+// clients never ask; other clients ask for scopes the user has not granted
+// them yet, or every time with prompt=consent. When consent is needed but
+// the client asked for prompt=none, a consent_required error is returned.
+func (o *OAuth) NeedsConsent(
+	ctx context.Context,
+	client models.OAuthClient,
+	req AuthorizeRequest,
+	session models.Session,
+) (bool, error) {
+	const operation = "oauth.NeedsConsent"
+
+	if client.FirstParty {
+		return false, nil
+	}
+
+	prompts := strings.Fields(req.Prompt)
+
+	needed := slices.Contains(prompts, PromptConsent)
+	if !needed {
+		grant, err := o.grants.OAuthGrant(ctx, session.UserID, client.ID)
+		switch {
+		case errors.Is(err, storage.ErrGrantNotFound):
+			needed = true
+		case err != nil:
+			return false, fmt.Errorf("%s: %w", operation, err)
+		default:
+			needed = !coversScope(grant.Scope, req.Scope)
+		}
+	}
+
+	if needed && slices.Contains(prompts, PromptNone) {
+		return false, newError(ConsentRequired, "the user must consent to the requested scopes")
+	}
+
+	return needed, nil
+}
+
+// GrantConsent records that the user of session approved the scopes of an
+// authorization request. They are added to what the user granted the
+// client before.
+func (o *OAuth) GrantConsent(
+	ctx context.Context,
+	req AuthorizeRequest,
+	session models.Session,
+) error {
+	const operation = "oauth.GrantConsent"
+
+	now := time.Now()
+	grant := models.OAuthGrant{
+		UserID:    session.UserID,
+		ClientID:  req.ClientID,
+		CreatedAt: now,
+	}
+
+	previous, err := o.grants.OAuthGrant(ctx, session.UserID, req.ClientID)
+	switch {
+	case errors.Is(err, storage.ErrGrantNotFound):
+	case err != nil:
+		return fmt.Errorf("%s: %w", operation, err)
+	default:
+		grant.CreatedAt = previous.CreatedAt
+		grant.Scope = previous.Scope
+	}
+
+	grant.Scope = normalizeScope(grant.Scope + " " + req.Scope)
+	grant.UpdatedAt = now
+
+	if err := o.grants.SaveOAuthGrant(ctx, grant); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	o.log.Info(
+		"consent granted",
+		slog.String("operation", operation),
+		slog.String("client_id", req.ClientID),
+		slog.Int64("user_id", session.UserID),
+		slog.String("scope", grant.Scope),
+	)
+
+	return nil
+}
+
+// Grants returns the clients the caller has consented to and the scopes
+// they were granted.
+func (o *OAuth) Grants(ctx context.Context, caller jwt.Claims) ([]models.OAuthGrant, error) {
+	const operation = "oauth.Grants"
+
+	grants, err := o.grants.OAuthGrants(ctx, caller.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return grants, nil
+}
+
+// RevokeGrant withdraws the consent the caller gave a client. The refresh
+// tokens the client holds for the caller stop working and the client will
+// ask for consent again.
+func (o *OAuth) RevokeGrant(ctx context.Context, caller jwt.Claims, clientID string) error {
+	const operation = "oauth.RevokeGrant"
+
+	if err := o.grants.DeleteOAuthGrant(ctx, caller.UserID, clientID, time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	o.log.Info(
+		"grant revoked",
+		slog.String("operation", operation),
+		slog.String("client_id", clientID),
+		slog.Int64("user_id", caller.UserID),
+	)
+
+	return nil
+}
+
+// coversScope reports whether every scope of requested is in granted.
+func coversScope(granted string, requested string) bool {
+	grantedScopes := strings.Fields(granted)
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(grantedScopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,286 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+const (
+	// userCodeAlphabet leaves out vowels, to avoid spelling words, and
+	// characters that are easily confused, as suggested by RFC 8628.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	// slowDownStep is added to the polling interval of a device each time
+	// it polls too fast (RFC 8628 section 3.5).
+	slowDownStep = 5 * time.Second
+)
+
+// DeviceAuthorization is the response of the device authorization
+// endpoint.
+type DeviceAuthorization struct {
+	DeviceCode string
+	// UserCode is formatted for display, e.g. "BDFG-HJKL".
+	UserCode string
+	// VerificationURI is the page users enter the user code on;
+	// VerificationURIComplete already carries the code, e.g. for QR codes.
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// AuthorizeDevice starts a device authorization request for a client that
+// cannot show a login page itself.
+func (o *OAuth) AuthorizeDevice(
+	ctx context.Context,
+	client models.OAuthClient,
+	scope string,
+) (DeviceAuthorization, error) {
+	const operation = "oauth.AuthorizeDevice"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+		slog.String("client_id", client.ID),
+	)
+
+	if !client.AllowsGrantType(GrantTypeDeviceCode) {
+		return DeviceAuthorization{}, newError(UnauthorizedClient, "the client may not use the device authorization grant")
+	}
+
+	deviceCode, err := random.Token(32)
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	code := models.DeviceCode{
+		ClientID:  client.ID,
+		Scope:     normalizeScope(scope),
+		Interval:  o.pollInterval,
+		ExpiresAt: time.Now().Add(o.deviceCodeTTL),
+	}
+
+	// User codes are short enough to collide once in a while.
+	for attempt := 0; ; attempt++ {
+		code.UserCode, err = random.Code(userCodeLength, userCodeAlphabet)
+		if err != nil {
+			return DeviceAuthorization{}, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		err = o.deviceCodes.SaveDeviceCode(ctx, random.Hash(deviceCode), code)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, storage.ErrUserCodeExists) || attempt == 2 {
+			log.Error("failed to save device code", slog.String("error", err.Error()))
+			return DeviceAuthorization{}, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	userCode := formatUserCode(code.UserCode)
+	verificationURI := strings.TrimSuffix(o.issuer, "/") + "/device"
+
+	log.Info("device authorization started")
+
+	return DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + userCode,
+		ExpiresIn:               o.deviceCodeTTL,
+		Interval:                o.pollInterval,
+	}, nil
+}
+
+// DeviceRequest returns the pending device authorization request with the
+// given user code and the client that made it, for the user to review.
+func (o *OAuth) DeviceRequest(
+	ctx context.Context,
+	userCode string,
+) (models.DeviceCode, models.OAuthClient, error) {
+	const operation = "oauth.DeviceRequest"
+
+	code, err := o.deviceCodes.DeviceCodeByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return models.DeviceCode{}, models.OAuthClient{}, fmt.Errorf("%s: %w", operation, ErrInvalidUserCode)
+		}
+		return models.DeviceCode{}, models.OAuthClient{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if code.Status != models.DeviceCodePending || !time.Now().Before(code.ExpiresAt) {
+		return models.DeviceCode{}, models.OAuthClient{}, fmt.Errorf("%s: %w", operation, ErrInvalidUserCode)
+	}
+
+	client, err := o.clientProvider.OAuthClient(ctx, code.ClientID)
+	if err != nil {
+		return models.DeviceCode{}, models.OAuthClient{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	code.UserCode = formatUserCode(code.UserCode)
+
+	return code, client, nil
+}
+
+// DecideDeviceRequest records whether the user of the browser session
+// approved or denied the device authorization request with userCode.
+func (o *OAuth) DecideDeviceRequest(
+	ctx context.Context,
+	userCode string,
+	session models.Session,
+	approved bool,
+) error {
+	const operation = "oauth.DecideDeviceRequest"
+
+	status := models.DeviceCodeDenied
+	if approved {
+		status = models.DeviceCodeApproved
+	}
+
+	if err := o.deviceCodes.DecideDeviceCode(ctx, normalizeUserCode(userCode), status, session); err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return fmt.Errorf("%s: %w", operation, ErrInvalidUserCode)
+		}
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	o.log.Info(
+		"device authorization decided",
+		slog.String("operation", operation),
+		slog.Int64("user_id", session.UserID),
+		slog.String("status", string(status)),
+	)
+
+	return nil
+}
+
+// DeviceToken handles the device_code grant polled by the device until the
+// user has decided on its request.
+func (o *OAuth) DeviceToken(
+	ctx context.Context,
+	client models.OAuthClient,
+	deviceCode string,
+) (TokenResponse, error) {
+	const operation = "oauth.DeviceToken"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+		slog.String("client_id", client.ID),
+	)
+
+	if !client.AllowsGrantType(GrantTypeDeviceCode) {
+		return TokenResponse{}, newError(UnauthorizedClient, "the client may not use the device authorization grant")
+	}
+
+	if deviceCode == "" {
+		return TokenResponse{}, newError(InvalidRequest, "device_code is required")
+	}
+
+	deviceCodeHash := random.Hash(deviceCode)
+
+	code, err := o.deviceCodes.DeviceCode(ctx, deviceCodeHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return TokenResponse{}, newError(InvalidGrant, "invalid device code")
+		}
+		return TokenResponse{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+
+	switch {
+	case code.ClientID != client.ID:
+		return TokenResponse{}, newError(InvalidGrant, "device code was issued to another client")
+	case code.Status == models.DeviceCodeUsed:
+		return TokenResponse{}, newError(InvalidGrant, "device code already used")
+	case !now.Before(code.ExpiresAt):
+		return TokenResponse{}, newError(ExpiredToken, "")
+	}
+
+	interval := code.Interval
+	tooFast := !code.LastPolledAt.IsZero() && now.Before(code.LastPolledAt.Add(code.Interval))
+	if tooFast {
+		interval += slowDownStep
+	}
+
+	if err := o.deviceCodes.PollDeviceCode(ctx, deviceCodeHash, now, interval); err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if tooFast {
+		return TokenResponse{}, newError(SlowDown, "")
+	}
+
+	switch code.Status {
+	case models.DeviceCodePending:
+		return TokenResponse{}, newError(AuthorizationPending, "")
+	case models.DeviceCodeDenied:
+		return TokenResponse{}, newError(AccessDenied, "the user denied the request")
+	}
+
+	if err := o.deviceCodes.UseDeviceCode(ctx, deviceCodeHash); err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return TokenResponse{}, newError(InvalidGrant, "device code already used")
+		}
+		return TokenResponse{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	tokens, err := o.sessions.StartClientSession(ctx, code.SessionID, client, code.Scope)
+	if err != nil {
+		log.Warn("failed to start client session", slog.String("error", err.Error()))
+		return TokenResponse{}, newError(InvalidGrant, "the authorization is no longer valid")
+	}
+
+	res := TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Scope:        code.Scope,
+		ExpiresIn:    o.accessTokenTTL(client),
+	}
+
+	if hasScope(code.Scope, ScopeOpenID) {
+		res.IDToken, err = o.idToken(ctx, client, authentication{
+			UserID:    code.UserID,
+			SessionID: code.SessionID,
+			Scope:     code.Scope,
+			AuthTime:  code.AuthTime,
+			AMR:       code.AMR,
+		}, tokens.AccessToken)
+		if err != nil {
+			log.Error("failed to issue id token", slog.String("error", err.Error()))
+			return TokenResponse{}, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	log.Info("device code exchanged", slog.Int64("user_id", code.UserID))
+
+	return res, nil
+}
+
+// normalizeUserCode undoes the formatting of a user code and what users
+// tend to do when typing it: lower case letters, spaces and dashes.
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+}
+
+// formatUserCode splits a user code in two halves for readability.
+func formatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
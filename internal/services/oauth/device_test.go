@@ -0,0 +1,169 @@
+package oauth_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/oauth"
+)
+
+func newDeviceEnv(t *testing.T) (env, models.OAuthClient) {
+	t.Helper()
+
+	e := newEnv(t, oauth.Config{DeviceCodeTTL: 10 * time.Minute})
+	client := e.saveClient(t, models.OAuthClient{
+		ID:         "cli",
+		GrantTypes: []string{oauth.GrantTypeDeviceCode, "refresh_token"},
+	})
+
+	return e, client
+}
+
+func TestDeviceFlow(t *testing.T) {
+	e, client := newDeviceEnv(t)
+	ctx := context.Background()
+
+	device, err := e.oauth.AuthorizeDevice(ctx, client, "openid email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(device.VerificationURIComplete, "?user_code="+device.UserCode) {
+		t.Errorf("verification uri = %q, want it to carry %q", device.VerificationURIComplete, device.UserCode)
+	}
+
+	_, err = e.oauth.DeviceToken(ctx, client, device.DeviceCode)
+	wantOAuthError(t, err, oauth.AuthorizationPending)
+
+	// Users may type the code in lower case and without the dash.
+	typed := strings.ToLower(strings.ReplaceAll(device.UserCode, "-", " "))
+	code, requester, err := e.oauth.DeviceRequest(ctx, typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requester.ID != client.ID || code.UserCode != device.UserCode {
+		t.Errorf("request = %s from %s, want %s from %s", code.UserCode, requester.ID, device.UserCode, client.ID)
+	}
+
+	if err := e.oauth.DecideDeviceRequest(ctx, typed, e.session, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The code cannot be decided twice.
+	if _, _, err := e.oauth.DeviceRequest(ctx, device.UserCode); !errors.Is(err, oauth.ErrInvalidUserCode) {
+		t.Errorf("err = %v, want %v", err, oauth.ErrInvalidUserCode)
+	}
+	if err := e.oauth.DecideDeviceRequest(ctx, device.UserCode, e.session, false); !errors.Is(err, oauth.ErrInvalidUserCode) {
+		t.Errorf("err = %v, want %v", err, oauth.ErrInvalidUserCode)
+	}
+
+	res, err := e.oauth.DeviceToken(ctx, client, device.DeviceCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.AccessToken == "" || res.RefreshToken == "" || res.IDToken == "" {
+		t.Errorf("response = %+v, want access, refresh and id tokens", res)
+	}
+
+	claims, err := e.auth.VerifyToken(ctx, res.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != e.userID || claims.ClientID != client.ID {
+		t.Errorf("token of user %d for %q, want %d for %q", claims.UserID, claims.ClientID, e.userID, client.ID)
+	}
+
+	_, err = e.oauth.DeviceToken(ctx, client, device.DeviceCode)
+	wantOAuthError(t, err, oauth.InvalidGrant)
+}
+
+func TestDeviceTokenRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		// arrange changes the pending device code before the device polls.
+		arrange func(t *testing.T, e env, device oauth.DeviceAuthorization)
+		client  string
+		want    string
+	}{
+		{
+			name: "denied",
+			arrange: func(t *testing.T, e env, device oauth.DeviceAuthorization) {
+				if err := e.oauth.DecideDeviceRequest(context.Background(), device.UserCode, e.session, false); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: oauth.AccessDenied,
+		},
+		{
+			name: "expired",
+			arrange: func(t *testing.T, e env, _ oauth.DeviceAuthorization) {
+				e.exec(t, "UPDATE device_codes SET expires_at = ?", time.Now().Add(-time.Minute).UTC())
+			},
+			want: oauth.ExpiredToken,
+		},
+		{
+			name: "polling too fast",
+			arrange: func(t *testing.T, e env, _ oauth.DeviceAuthorization) {
+				e.exec(t, "UPDATE device_codes SET poll_interval = 60, last_polled_at = ?", time.Now().UTC())
+			},
+			want: oauth.SlowDown,
+		},
+		{
+			name:   "another client",
+			client: "other",
+			want:   oauth.InvalidGrant,
+		},
+		{
+			name:   "client without the grant",
+			client: "web",
+			want:   oauth.UnauthorizedClient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, client := newDeviceEnv(t)
+			ctx := context.Background()
+
+			device, err := e.oauth.AuthorizeDevice(ctx, client, "openid")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.arrange != nil {
+				tt.arrange(t, e, device)
+			}
+
+			poller := client
+			switch tt.client {
+			case "other":
+				poller = e.saveClient(t, models.OAuthClient{ID: "other", GrantTypes: client.GrantTypes})
+			case "web":
+				poller = e.saveClient(t, models.OAuthClient{ID: "web", GrantTypes: []string{"authorization_code"}})
+			}
+
+			_, err = e.oauth.DeviceToken(ctx, poller, device.DeviceCode)
+			wantOAuthError(t, err, tt.want)
+		})
+	}
+}
+
+func TestAuthorizeDeviceUnauthorizedClient(t *testing.T) {
+	e, _ := newDeviceEnv(t)
+
+	web := e.saveClient(t, models.OAuthClient{ID: "web", GrantTypes: []string{"authorization_code"}})
+
+	_, err := e.oauth.AuthorizeDevice(context.Background(), web, "openid")
+	wantOAuthError(t, err, oauth.UnauthorizedClient)
+}
+
+func TestDeviceRequestUnknownCode(t *testing.T) {
+	e, _ := newDeviceEnv(t)
+
+	if _, _, err := e.oauth.DeviceRequest(context.Background(), "BBBB-BBBB"); !errors.Is(err, oauth.ErrInvalidUserCode) {
+		t.Fatalf("err = %v, want %v", err, oauth.ErrInvalidUserCode)
+	}
+}
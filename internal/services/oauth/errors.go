@@ -0,0 +1,73 @@
+package oauth
+
+import "errors"
+
+// Error codes defined by RFC 6749 for the authorization and token endpoints.
+const (
+	InvalidRequest          = "invalid_request"
+	InvalidClient           = "invalid_client"
+	InvalidGrant            = "invalid_grant"
+	UnauthorizedClient      = "unauthorized_client"
+	UnsupportedGrantType    = "unsupported_grant_type"
+	UnsupportedResponseType = "unsupported_response_type"
+	InvalidScope            = "invalid_scope"
+	AccessDenied            = "access_denied"
+	ServerError             = "server_error"
+
+	// LoginRequired is defined by OpenID Connect Core for prompt=none
+	// requests that cannot be answered without showing a login page.
+	LoginRequired = "login_required"
+	// ConsentRequired is defined by OpenID Connect Core for prompt=none
+	// requests the user has not consented to.
+	ConsentRequired = "consent_required"
+
+	// Device authorization grant errors defined by RFC 8628.
+	AuthorizationPending = "authorization_pending"
+	SlowDown             = "slow_down"
+	ExpiredToken         = "expired_token"
+
+	// InvalidTarget is defined by RFC 8693 for audiences a token cannot be
+	// issued for.
+	InvalidTarget = "invalid_target"
+
+	// Client registration errors defined by RFC 7591.
+	InvalidRedirectURI    = "invalid_redirect_uri"
+	InvalidClientMetadata = "invalid_client_metadata"
+
+	// Bearer token errors defined by RFC 6750.
+	InvalidToken      = "invalid_token"
+	InsufficientScope = "insufficient_scope"
+)
+
+var (
+	// ErrUnknownClient and ErrInvalidRedirectURI mean an authorization
+	// request cannot be answered by redirecting back to the client, because
+	// the redirect URI cannot be trusted.
+	ErrUnknownClient      = errors.New("unknown client")
+	ErrInvalidRedirectURI = errors.New("redirect uri is not registered for the client")
+	// ErrInvalidUserCode means a user code entered on the verification page
+	// does not belong to a pending device authorization request.
+	ErrInvalidUserCode = errors.New("invalid or expired user code")
+	// ErrInvalidIDTokenHint and ErrInvalidPostLogoutRedirectURI mean a
+	// logout request cannot be trusted to redirect back to the client.
+	ErrInvalidIDTokenHint           = errors.New("invalid id token hint")
+	ErrInvalidPostLogoutRedirectURI = errors.New("post logout redirect uri is not registered for the client")
+)
+
+// Error is an OAuth 2.0 error response.
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+
+	return e.Code + ": " + e.Description
+}
+
+func newError(code string, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
@@ -0,0 +1,230 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	authservice "github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+// Token types of RFC 8693 section 3, plus one to name the user an admin
+// wants to impersonate.
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	TokenTypeUserID      = "urn:gia-sso:params:oauth:token-type:user_id"
+)
+
+// TokenExchangeRequest holds the parameters of a token exchange request.
+type TokenExchangeRequest struct {
+	// SubjectToken is the access token of the user to act for or, with
+	// TokenTypeUserID, the id of the user to impersonate.
+	SubjectToken     string
+	SubjectTokenType string
+	// ActorToken is the access token of who is going to act. It defaults
+	// to the client making the request and is required to impersonate.
+	ActorToken         string
+	ActorTokenType     string
+	RequestedTokenType string
+	Audience           []string
+	Scope              string
+}
+
+// ExchangeToken handles the token exchange grant (RFC 8693). A client can
+// exchange a user's token for one restricted to a narrower audience to call
+// a downstream service on the user's behalf, and an admin can obtain a
+// token to act as another user. The issued token names the actor in its
+// act claim.
+func (o *OAuth) ExchangeToken(
+	ctx context.Context,
+	client models.OAuthClient,
+	req TokenExchangeRequest,
+) (TokenResponse, error) {
+	const operation = "oauth.ExchangeToken"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+		slog.String("client_id", client.ID),
+	)
+
+	if !client.AllowsGrantType(GrantTypeTokenExchange) {
+		return TokenResponse{}, newError(UnauthorizedClient, "the client may not use the token exchange grant")
+	}
+
+	switch req.RequestedTokenType {
+	case "", TokenTypeAccessToken, TokenTypeJWT:
+	default:
+		return TokenResponse{}, newError(InvalidRequest, "only access tokens can be requested")
+	}
+
+	if req.SubjectToken == "" || req.SubjectTokenType == "" {
+		return TokenResponse{}, newError(InvalidRequest, "subject_token and subject_token_type are required")
+	}
+
+	actor := models.Actor{Subject: client.ID, ClientID: client.ID}
+
+	var actorClaims *jwt.Claims
+	if req.ActorToken != "" {
+		if !isAccessTokenType(req.ActorTokenType) {
+			return TokenResponse{}, newError(InvalidRequest, "unsupported actor_token_type")
+		}
+
+		claims, err := o.verifyAnyToken(ctx, req.ActorToken)
+		if err != nil {
+			return TokenResponse{}, newError(InvalidGrant, "invalid actor token")
+		}
+
+		actorClaims = &claims
+		actor = actorOf(claims)
+	}
+
+	exchange := models.TokenExchange{
+		ClientID: client.ID,
+		Actor:    actor,
+	}
+
+	var (
+		token string
+		err   error
+	)
+
+	switch {
+	case req.SubjectTokenType == TokenTypeUserID:
+		if actorClaims == nil || actorClaims.IsClient() {
+			return TokenResponse{}, newError(InvalidRequest, "impersonation requires the actor_token of a user")
+		}
+
+		userID, parseErr := strconv.ParseInt(req.SubjectToken, 10, 64)
+		if parseErr != nil || userID <= 0 {
+			return TokenResponse{}, newError(InvalidRequest, "subject_token must be a user id")
+		}
+
+		if exchange.Audience, err = downscopeAudience(client.Audience, req.Audience); err != nil {
+			return TokenResponse{}, err
+		}
+		exchange.Scope = normalizeScope(req.Scope)
+
+		token, err = o.sessions.ImpersonateUser(ctx, *actorClaims, userID, exchange)
+	case isAccessTokenType(req.SubjectTokenType):
+		subject, verifyErr := o.sessions.VerifyToken(ctx, req.SubjectToken)
+		if verifyErr != nil {
+			return TokenResponse{}, newError(InvalidGrant, "invalid subject token")
+		}
+
+		allowed := subject.Audience
+		if len(allowed) == 0 {
+			allowed = client.Audience
+		}
+		if exchange.Audience, err = downscopeAudience(allowed, req.Audience); err != nil {
+			return TokenResponse{}, err
+		}
+		if exchange.Scope, err = downscopeScope(subject.Scope, req.Scope); err != nil {
+			return TokenResponse{}, err
+		}
+
+		if exchange.Actor.Actor == nil {
+			exchange.Actor.Actor = subject.Actor
+		}
+
+		token, err = o.sessions.DelegateToken(ctx, subject, exchange)
+	default:
+		return TokenResponse{}, newError(InvalidRequest, "unsupported subject_token_type")
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, authservice.ErrPermissionDenied):
+			return TokenResponse{}, newError(AccessDenied, "only admins may impersonate other users")
+		case errors.Is(err, authservice.ErrInvalidToken):
+			return TokenResponse{}, newError(InvalidGrant, "invalid subject token")
+		}
+
+		log.Warn("token exchange failed", slog.String("error", err.Error()))
+		return TokenResponse{}, newError(InvalidGrant, "the subject cannot be acted for")
+	}
+
+	log.Info(
+		"token exchanged",
+		slog.String("subject_token_type", req.SubjectTokenType),
+		slog.String("actor", actor.Subject),
+	)
+
+	return TokenResponse{
+		AccessToken:     token,
+		IssuedTokenType: TokenTypeAccessToken,
+		Scope:           exchange.Scope,
+		ExpiresIn:       o.tokenTTL,
+	}, nil
+}
+
+// verifyAnyToken verifies an access token issued to a user or to a client
+// for itself.
+func (o *OAuth) verifyAnyToken(ctx context.Context, token string) (jwt.Claims, error) {
+	claims, err := o.sessions.VerifyToken(ctx, token)
+	if err == nil {
+		return claims, nil
+	}
+
+	return o.VerifyClientToken(ctx, token)
+}
+
+func actorOf(claims jwt.Claims) models.Actor {
+	if claims.IsClient() {
+		return models.Actor{Subject: claims.ClientID, ClientID: claims.ClientID}
+	}
+
+	return models.Actor{Subject: subject(claims.UserID), Actor: claims.Actor}
+}
+
+func isAccessTokenType(tokenType string) bool {
+	return tokenType == TokenTypeAccessToken || tokenType == TokenTypeJWT
+}
+
+// downscopeAudience checks that the requested audience is within allowed.
+// No requested audience means all of allowed.
+func downscopeAudience(allowed []string, requested []string) ([]string, error) {
+	var audience []string
+	for _, aud := range requested {
+		audience = append(audience, strings.Fields(aud)...)
+	}
+
+	if len(audience) == 0 {
+		audience = allowed
+	}
+	if len(audience) == 0 {
+		return nil, newError(InvalidTarget, "audience is required")
+	}
+
+	for _, aud := range audience {
+		if !slices.Contains(allowed, aud) {
+			return nil, newError(InvalidTarget, "audience "+aud+" is not allowed")
+		}
+	}
+
+	return audience, nil
+}
+
+// downscopeScope checks that the requested scope is within the scope of the
+// subject token. Tokens without a scope are not restricted.
+func downscopeScope(allowed string, requested string) (string, error) {
+	requested = normalizeScope(requested)
+	if requested == "" {
+		return allowed, nil
+	}
+	if allowed == "" {
+		return requested, nil
+	}
+
+	for _, s := range strings.Fields(requested) {
+		if !hasScope(allowed, s) {
+			return "", newError(InvalidScope, "scope "+s+" exceeds the scope of the subject token")
+		}
+	}
+
+	return requested, nil
+}
@@ -0,0 +1,281 @@
+package oauth_test
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/oauth"
+)
+
+// newExchangeEnv returns an env with a client that may exchange tokens for
+// the audiences api and billing, and an access token of the signed in user.
+func newExchangeEnv(t *testing.T) (env, models.OAuthClient, string) {
+	t.Helper()
+
+	e := newEnv(t, oauth.Config{})
+	client := e.saveClient(t, models.OAuthClient{
+		ID:         "gateway",
+		GrantTypes: []string{oauth.GrantTypeTokenExchange},
+		Audience:   []string{"api", "billing"},
+	})
+
+	tokens, err := e.auth.Login(context.Background(), testEmail, testPassword, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e, client, tokens.AccessToken
+}
+
+// adminToken registers an admin and returns their id and access token.
+func (e env) adminToken(t *testing.T) (int64, string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	adminID, err := e.auth.RegisterNewUser(ctx, "admin@example.com", testPassword, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.storage.SetUserAdmin(ctx, adminID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := e.auth.Login(ctx, "admin@example.com", testPassword, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return adminID, tokens.AccessToken
+}
+
+// parties are who a token exchange can be about.
+type parties struct {
+	userToken  string
+	adminID    string
+	adminToken string
+}
+
+func TestExchangeTokenDelegation(t *testing.T) {
+	e, client, userToken := newExchangeEnv(t)
+	ctx := context.Background()
+
+	res, err := e.oauth.ExchangeToken(ctx, client, oauth.TokenExchangeRequest{
+		SubjectToken:     userToken,
+		SubjectTokenType: oauth.TokenTypeAccessToken,
+		Audience:         []string{"api"},
+		Scope:            "read write",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IssuedTokenType != oauth.TokenTypeAccessToken || res.Scope != "read write" {
+		t.Errorf("response = %+v", res)
+	}
+
+	claims, err := e.auth.VerifyToken(ctx, res.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != e.userID || !slices.Equal(claims.Audience, []string{"api"}) {
+		t.Errorf("token of user %d for %v, want %d for [api]", claims.UserID, claims.Audience, e.userID)
+	}
+	if claims.Actor == nil || claims.Actor.ClientID != client.ID {
+		t.Fatalf("actor = %+v, want client %s", claims.Actor, client.ID)
+	}
+
+	// Exchanging the delegated token again narrows it further and keeps
+	// the chain of actors.
+	res, err = e.oauth.ExchangeToken(ctx, client, oauth.TokenExchangeRequest{
+		SubjectToken:     res.AccessToken,
+		SubjectTokenType: oauth.TokenTypeJWT,
+		Scope:            "read",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err = e.auth.VerifyToken(ctx, res.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Scope != "read" || !slices.Equal(claims.Audience, []string{"api"}) {
+		t.Errorf("token for %q and %v, want read and [api]", claims.Scope, claims.Audience)
+	}
+	if claims.Actor == nil || claims.Actor.Actor == nil || claims.Actor.Actor.ClientID != client.ID {
+		t.Errorf("actor = %+v, want a chain of two", claims.Actor)
+	}
+}
+
+func TestExchangeTokenImpersonation(t *testing.T) {
+	e, client, _ := newExchangeEnv(t)
+	ctx := context.Background()
+
+	adminID, adminToken := e.adminToken(t)
+
+	res, err := e.oauth.ExchangeToken(ctx, client, oauth.TokenExchangeRequest{
+		SubjectToken:     strconv.FormatInt(e.userID, 10),
+		SubjectTokenType: oauth.TokenTypeUserID,
+		ActorToken:       adminToken,
+		ActorTokenType:   oauth.TokenTypeAccessToken,
+		Audience:         []string{"billing"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := e.auth.VerifyToken(ctx, res.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != e.userID {
+		t.Errorf("subject = %d, want %d", claims.UserID, e.userID)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != strconv.FormatInt(adminID, 10) || claims.Actor.ClientID != "" {
+		t.Errorf("actor = %+v, want admin %d", claims.Actor, adminID)
+	}
+}
+
+func TestExchangeTokenRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		request func(p parties) oauth.TokenExchangeRequest
+		client  string
+		want    string
+	}{
+		{
+			name: "client without the grant",
+			request: func(p parties) oauth.TokenExchangeRequest {
+				return oauth.TokenExchangeRequest{SubjectToken: p.userToken, SubjectTokenType: oauth.TokenTypeAccessToken}
+			},
+			client: "web",
+			want:   oauth.UnauthorizedClient,
+		},
+		{
+			name: "invalid subject token",
+			request: func(p parties) oauth.TokenExchangeRequest {
+				return oauth.TokenExchangeRequest{SubjectToken: "garbage", SubjectTokenType: oauth.TokenTypeAccessToken}
+			},
+			want: oauth.InvalidGrant,
+		},
+		{
+			name: "unsupported subject token type",
+			request: func(p parties) oauth.TokenExchangeRequest {
+				return oauth.TokenExchangeRequest{SubjectToken: p.userToken, SubjectTokenType: "urn:ietf:params:oauth:token-type:saml2"}
+			},
+			want: oauth.InvalidRequest,
+		},
+		{
+			name: "audience outside the client's",
+			request: func(p parties) oauth.TokenExchangeRequest {
+				return oauth.TokenExchangeRequest{
+					SubjectToken:     p.userToken,
+					SubjectTokenType: oauth.TokenTypeAccessToken,
+					Audience:         []string{"admin-api"},
+				}
+			},
+			want: oauth.InvalidTarget,
+		},
+		{
+			name: "invalid actor token",
+			request: func(p parties) oauth.TokenExchangeRequest {
+				return oauth.TokenExchangeRequest{
+					SubjectToken:     p.userToken,
+					SubjectTokenType: oauth.TokenTypeAccessToken,
+					ActorToken:       "garbage",
+					ActorTokenType:   oauth.TokenTypeAccessToken,
+				}
+			},
+			want: oauth.InvalidGrant,
+		},
+		{
+			name: "impersonation without an actor",
+			request: func(p parties) oauth.TokenExchangeRequest {
+				return oauth.TokenExchangeRequest{SubjectToken: "1", SubjectTokenType: oauth.TokenTypeUserID}
+			},
+			want: oauth.InvalidRequest,
+		},
+		{
+			name: "impersonation of a malformed user id",
+			request: func(p parties) oauth.TokenExchangeRequest {
+				return oauth.TokenExchangeRequest{
+					SubjectToken:     "user@example.com",
+					SubjectTokenType: oauth.TokenTypeUserID,
+					ActorToken:       p.adminToken,
+					ActorTokenType:   oauth.TokenTypeAccessToken,
+				}
+			},
+			want: oauth.InvalidRequest,
+		},
+		{
+			// The actor is the user, not an admin: a token does not let its
+			// holder act as anybody else.
+			name: "impersonation by a non-admin",
+			request: func(p parties) oauth.TokenExchangeRequest {
+				return oauth.TokenExchangeRequest{
+					SubjectToken:     p.adminID,
+					SubjectTokenType: oauth.TokenTypeUserID,
+					ActorToken:       p.userToken,
+					ActorTokenType:   oauth.TokenTypeAccessToken,
+				}
+			},
+			want: oauth.AccessDenied,
+		},
+		{
+			// The admin's token is the actor, so the subject must be
+			// someone else than the admin.
+			name: "impersonation of the actor",
+			request: func(p parties) oauth.TokenExchangeRequest {
+				return oauth.TokenExchangeRequest{
+					SubjectToken:     p.adminID,
+					SubjectTokenType: oauth.TokenTypeUserID,
+					ActorToken:       p.adminToken,
+					ActorTokenType:   oauth.TokenTypeAccessToken,
+				}
+			},
+			want: oauth.AccessDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, client, userToken := newExchangeEnv(t)
+			adminID, adminToken := e.adminToken(t)
+
+			if tt.client == "web" {
+				client = e.saveClient(t, models.OAuthClient{ID: "web", GrantTypes: []string{"authorization_code"}})
+			}
+
+			_, err := e.oauth.ExchangeToken(context.Background(), client, tt.request(parties{
+				userToken:  userToken,
+				adminID:    strconv.FormatInt(adminID, 10),
+				adminToken: adminToken,
+			}))
+			wantOAuthError(t, err, tt.want)
+		})
+	}
+}
+
+func TestExchangeTokenScopeEscalation(t *testing.T) {
+	e, client, userToken := newExchangeEnv(t)
+	ctx := context.Background()
+
+	res, err := e.oauth.ExchangeToken(ctx, client, oauth.TokenExchangeRequest{
+		SubjectToken:     userToken,
+		SubjectTokenType: oauth.TokenTypeAccessToken,
+		Scope:            "read",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.oauth.ExchangeToken(ctx, client, oauth.TokenExchangeRequest{
+		SubjectToken:     res.AccessToken,
+		SubjectTokenType: oauth.TokenTypeAccessToken,
+		Scope:            "read write",
+	})
+	wantOAuthError(t, err, oauth.InvalidScope)
+}
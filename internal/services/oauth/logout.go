@@ -0,0 +1,278 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+const (
+	// logoutTokenTTL is how long a logout token is valid once sent.
+	logoutTokenTTL = 2 * time.Minute
+	// logoutBatchSize is how many logout notifications are delivered per
+	// run of DeliverLogoutNotifications.
+	logoutBatchSize = 100
+)
+
+// EndSessionRequest holds the parameters of an RP-initiated logout request
+// (OpenID Connect RP-Initiated Logout 1.0).
+type EndSessionRequest struct {
+	IDTokenHint           string
+	ClientID              string
+	PostLogoutRedirectURI string
+	State                 string
+}
+
+// EndSession is a validated logout request.
+type EndSession struct {
+	// Client is the client that asked for the logout, if it is known.
+	Client models.OAuthClient
+	// Subject and SessionID are those of the ID token hint, if any.
+	Subject   string
+	SessionID string
+	// RedirectURI is where to send the user after logging out, with the
+	// state of the request. It is empty if the client did not ask for a
+	// redirect.
+	RedirectURI string
+}
+
+// CheckEndSessionRequest validates a logout request. The errors it returns
+// must be shown to the user, since there is no trusted URI to redirect to.
+func (o *OAuth) CheckEndSessionRequest(
+	ctx context.Context,
+	req EndSessionRequest,
+) (EndSession, error) {
+	const operation = "oauth.CheckEndSessionRequest"
+
+	var end EndSession
+
+	clientID := req.ClientID
+	if req.IDTokenHint != "" {
+		hint, err := jwt.ParseIDTokenHint(o.signingKey, o.issuer, req.IDTokenHint)
+		if err != nil {
+			return EndSession{}, fmt.Errorf("%s: %w", operation, ErrInvalidIDTokenHint)
+		}
+
+		if clientID == "" && len(hint.Audience) > 0 {
+			clientID = hint.Audience[0]
+		}
+		if !slices.Contains(hint.Audience, clientID) {
+			return EndSession{}, fmt.Errorf("%s: %w", operation, ErrInvalidIDTokenHint)
+		}
+
+		end.Subject = hint.Subject
+		end.SessionID = hint.SessionID
+	}
+
+	if clientID != "" {
+		client, err := o.clientProvider.OAuthClient(ctx, clientID)
+		if err != nil {
+			if errors.Is(err, storage.ErrClientNotFound) {
+				return EndSession{}, fmt.Errorf("%s: %w", operation, ErrUnknownClient)
+			}
+			return EndSession{}, fmt.Errorf("%s: %w", operation, err)
+		}
+		end.Client = client
+	}
+
+	if req.PostLogoutRedirectURI != "" {
+		// Without a client there is no list of URIs to check against.
+		if end.Client.ID == "" || !end.Client.AllowsPostLogoutRedirectURI(req.PostLogoutRedirectURI) {
+			return EndSession{}, fmt.Errorf("%s: %w", operation, ErrInvalidPostLogoutRedirectURI)
+		}
+
+		end.RedirectURI = req.PostLogoutRedirectURI
+		if req.State != "" {
+			end.RedirectURI = withQuery(end.RedirectURI, url.Values{"state": {req.State}})
+		}
+	}
+
+	return end, nil
+}
+
+// Logout ends a browser session and the sessions of every client opened
+// from it. Clients with a back-channel logout URI are notified by
+// DeliverLogoutNotifications; the front-channel logout URIs returned are
+// for the browser to load.
+func (o *OAuth) Logout(ctx context.Context, session models.Session) ([]string, error) {
+	const operation = "oauth.Logout"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+		slog.String("session_id", session.ID),
+	)
+
+	children, err := o.sessions.EndBrowserSession(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var clientIDs []string
+	for _, child := range children {
+		if !slices.Contains(clientIDs, child.ClientID) {
+			clientIDs = append(clientIDs, child.ClientID)
+		}
+	}
+
+	var uris []string
+	for _, clientID := range clientIDs {
+		client, err := o.clientProvider.OAuthClient(ctx, clientID)
+		if err != nil {
+			log.Warn(
+				"failed to get client of ended session",
+				slog.String("client_id", clientID),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+
+		if client.FrontchannelLogoutURI == "" {
+			continue
+		}
+
+		uris = append(uris, withQuery(client.FrontchannelLogoutURI, url.Values{
+			"iss": {o.issuer},
+			"sid": {session.ID},
+		}))
+	}
+
+	log.Info("user logged out", slog.Int("frontchannel_clients", len(uris)))
+
+	return uris, nil
+}
+
+// DeliverLogoutNotifications sends the logout tokens of the back-channel
+// logouts that are due. Failed deliveries are retried with exponential
+// backoff until they have been attempted maxLogoutAttempts times. It
+// returns how many were delivered.
+func (o *OAuth) DeliverLogoutNotifications(ctx context.Context) (int, error) {
+	const operation = "oauth.DeliverLogoutNotifications"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+	)
+
+	notifications, err := o.logouts.DueLogoutNotifications(ctx, time.Now(), logoutBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	delivered := 0
+	for _, notification := range notifications {
+		deliveryErr := o.deliverLogout(ctx, notification)
+		if deliveryErr == nil {
+			delivered++
+			if err := o.logouts.DeleteLogoutNotification(ctx, notification.ID); err != nil {
+				return delivered, fmt.Errorf("%s: %w", operation, err)
+			}
+			continue
+		}
+
+		log := log.With(
+			slog.String("client_id", notification.ClientID),
+			slog.String("session_id", notification.SessionID),
+			slog.Int("attempts", notification.Attempts+1),
+			slog.String("error", deliveryErr.Error()),
+		)
+
+		if notification.Attempts+1 >= o.maxLogoutAttempts {
+			log.Error("giving up on back-channel logout")
+			if err := o.logouts.DeleteLogoutNotification(ctx, notification.ID); err != nil {
+				return delivered, fmt.Errorf("%s: %w", operation, err)
+			}
+			continue
+		}
+
+		log.Warn("back-channel logout failed")
+
+		backoff := o.logoutRetryInterval << notification.Attempts
+		if err := o.logouts.RetryLogoutNotification(
+			ctx,
+			notification.ID,
+			time.Now().Add(backoff),
+			deliveryErr.Error(),
+		); err != nil {
+			return delivered, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	if delivered > 0 {
+		log.Info("back-channel logouts delivered", slog.Int("count", delivered))
+	}
+
+	return delivered, nil
+}
+
+// deliverLogout POSTs a logout token to the back-channel logout URI of a
+// client as described in section 2.5 of the specification.
+func (o *OAuth) deliverLogout(ctx context.Context, notification models.LogoutNotification) error {
+	jti, err := random.Token(16)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	token, err := jwt.NewLogoutToken(o.signingKey, jwt.LogoutToken{
+		ID:        jti,
+		Issuer:    o.issuer,
+		Subject:   subject(notification.UserID),
+		Audience:  notification.ClientID,
+		SessionID: notification.SessionID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(logoutTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		notification.LogoutURI,
+		strings.NewReader(url.Values{"logout_token": {token}}.Encode()),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return nil
+}
+
+// withQuery adds params to the query of uri, keeping the ones it has.
+func withQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,232 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/oauth"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+// newLogoutEnv returns an env that gives up on logout notifications after
+// maxAttempts deliveries.
+func newLogoutEnv(t *testing.T, maxAttempts int) env {
+	t.Helper()
+
+	return newEnv(t, oauth.Config{
+		LogoutTimeout:       time.Second,
+		LogoutRetryInterval: time.Millisecond,
+		MaxLogoutAttempts:   maxAttempts,
+	})
+}
+
+// openClientSession registers a client with the given back-channel logout
+// URI and opens a session for it from the browser session.
+func (e env) openClientSession(t *testing.T, clientID string, logoutURI string) {
+	t.Helper()
+
+	client := e.saveClient(t, models.OAuthClient{
+		ID:                   clientID,
+		GrantTypes:           []string{"authorization_code", "refresh_token"},
+		BackchannelLogoutURI: logoutURI,
+	})
+
+	if _, err := e.auth.StartClientSession(context.Background(), e.session.ID, client, "openid"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deliver runs DeliverLogoutNotifications until nothing is left to deliver
+// and returns how many notifications were delivered in total. Retries are
+// due after a millisecond of backoff, doubled on every attempt.
+func (e env) deliver(t *testing.T) int {
+	t.Helper()
+
+	total := 0
+	for range 10 {
+		delivered, err := e.oauth.DeliverLogoutNotifications(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += delivered
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return total
+}
+
+// logoutReceiver is the back-channel logout endpoint of a client. It fails
+// the first failures requests with a server error.
+type logoutReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	requests int
+	tokens   []string
+}
+
+func newLogoutReceiver(t *testing.T, failures int) *logoutReceiver {
+	t.Helper()
+
+	r := &logoutReceiver{failures: failures}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.requests++
+		if r.requests <= r.failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		r.tokens = append(r.tokens, req.PostFormValue("logout_token"))
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func (r *logoutReceiver) received() (requests int, tokens []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.requests, append([]string(nil), r.tokens...)
+}
+
+// checkLogoutToken verifies a logout token sent to clientID for the browser
+// session of e.
+func (e env) checkLogoutToken(t *testing.T, token string, clientID string) {
+	t.Helper()
+
+	claims := gojwt.MapClaims{}
+	parsed, err := gojwt.ParseWithClaims(
+		token,
+		claims,
+		func(*gojwt.Token) (any, error) { return &e.key.PublicKey, nil },
+		gojwt.WithValidMethods([]string{"RS256"}),
+		gojwt.WithIssuer(testIssuer),
+		gojwt.WithAudience(clientID),
+		gojwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		t.Fatalf("invalid logout token for %s: %v", clientID, err)
+	}
+
+	if typ := parsed.Header["typ"]; typ != "logout+jwt" {
+		t.Errorf("typ = %v, want logout+jwt", typ)
+	}
+	if claims["sub"] != strconv.FormatInt(e.userID, 10) {
+		t.Errorf("sub = %v, want %d", claims["sub"], e.userID)
+	}
+	if claims["sid"] != e.session.ID {
+		t.Errorf("sid = %v, want %s", claims["sid"], e.session.ID)
+	}
+	if _, ok := claims["nonce"]; ok {
+		t.Error("logout token must not have a nonce")
+	}
+
+	events, _ := claims["events"].(map[string]any)
+	if _, ok := events[jwt.BackchannelLogoutEvent]; !ok {
+		t.Errorf("events = %v, want the back-channel logout event", claims["events"])
+	}
+}
+
+func TestBackchannelLogoutFanOut(t *testing.T) {
+	e := newLogoutEnv(t, 3)
+
+	first := newLogoutReceiver(t, 0)
+	second := newLogoutReceiver(t, 0)
+
+	e.openClientSession(t, "first", first.URL)
+	e.openClientSession(t, "second", second.URL)
+	// Clients without a back-channel logout URI are not notified.
+	e.openClientSession(t, "silent", "")
+
+	if _, err := e.oauth.Logout(context.Background(), e.session); err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered := e.deliver(t); delivered != 2 {
+		t.Fatalf("delivered %d notifications, want 2", delivered)
+	}
+
+	for clientID, receiver := range map[string]*logoutReceiver{"first": first, "second": second} {
+		requests, tokens := receiver.received()
+		if requests != 1 || len(tokens) != 1 {
+			t.Fatalf("%s got %d requests and %d tokens, want one each", clientID, requests, len(tokens))
+		}
+
+		e.checkLogoutToken(t, tokens[0], clientID)
+	}
+}
+
+func TestBackchannelLogoutRetries(t *testing.T) {
+	e := newLogoutEnv(t, 3)
+
+	healthy := newLogoutReceiver(t, 0)
+	flaky := newLogoutReceiver(t, 2)
+
+	e.openClientSession(t, "healthy", healthy.URL)
+	e.openClientSession(t, "flaky", flaky.URL)
+
+	if _, err := e.oauth.Logout(context.Background(), e.session); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing client does not hold up the others.
+	delivered, err := e.oauth.DeliverLogoutNotifications(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 1 {
+		t.Fatalf("delivered %d notifications on the first run, want 1", delivered)
+	}
+
+	if delivered := e.deliver(t); delivered != 1 {
+		t.Fatalf("delivered %d notifications on retry, want 1", delivered)
+	}
+
+	requests, tokens := flaky.received()
+	if requests != 3 || len(tokens) != 1 {
+		t.Fatalf("flaky client got %d requests and %d tokens, want 3 and 1", requests, len(tokens))
+	}
+	e.checkLogoutToken(t, tokens[0], "flaky")
+
+	if requests, _ := healthy.received(); requests != 1 {
+		t.Errorf("healthy client got %d requests, want 1", requests)
+	}
+}
+
+func TestBackchannelLogoutGivesUp(t *testing.T) {
+	e := newLogoutEnv(t, 3)
+
+	broken := newLogoutReceiver(t, 100)
+	e.openClientSession(t, "broken", broken.URL)
+
+	if _, err := e.oauth.Logout(context.Background(), e.session); err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered := e.deliver(t); delivered != 0 {
+		t.Fatalf("delivered %d notifications, want 0", delivered)
+	}
+
+	if requests, _ := broken.received(); requests != 3 {
+		t.Fatalf("broken client got %d requests, want 3 before giving up", requests)
+	}
+}
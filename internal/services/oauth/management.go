@@ -0,0 +1,187 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	authservice "github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+// CreateClient registers a client on behalf of an admin. The client id is
+// generated unless metadata has one.
+func (o *OAuth) CreateClient(
+	ctx context.Context,
+	caller jwt.Claims,
+	metadata models.OAuthClient,
+) (ClientRegistration, error) {
+	const operation = "oauth.CreateClient"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	if err := authservice.RequireAdmin(ctx, o.userProvider, caller); err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if metadata.ID == "" {
+		clientID, err := random.Token(16)
+		if err != nil {
+			return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+		}
+		metadata.ID = clientID
+	}
+	metadata.RegistrationTokenHash = nil
+
+	reg, err := o.saveClient(ctx, metadata)
+	if err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log.Info("client created", slog.String("client_id", reg.Client.ID))
+
+	return reg, nil
+}
+
+// Client returns a registered client to an admin.
+func (o *OAuth) Client(
+	ctx context.Context,
+	caller jwt.Claims,
+	clientID string,
+) (models.OAuthClient, error) {
+	const operation = "oauth.Client"
+
+	if err := authservice.RequireAdmin(ctx, o.userProvider, caller); err != nil {
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	client, err := o.clientProvider.OAuthClient(ctx, clientID)
+	if err != nil {
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return client, nil
+}
+
+// Clients returns all registered clients to an admin.
+func (o *OAuth) Clients(ctx context.Context, caller jwt.Claims) ([]models.OAuthClient, error) {
+	const operation = "oauth.Clients"
+
+	if err := authservice.RequireAdmin(ctx, o.userProvider, caller); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	clients, err := o.clients.OAuthClients(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return clients, nil
+}
+
+// UpdateClient replaces the metadata of the client metadata.ID on behalf of
+// an admin.
+func (o *OAuth) UpdateClient(
+	ctx context.Context,
+	caller jwt.Claims,
+	metadata models.OAuthClient,
+) (ClientRegistration, error) {
+	const operation = "oauth.UpdateClient"
+
+	if err := authservice.RequireAdmin(ctx, o.userProvider, caller); err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	client, err := o.clientProvider.OAuthClient(ctx, metadata.ID)
+	if err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	reg, err := o.updateClient(ctx, client, metadata)
+	if err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	o.log.Info(
+		"client updated",
+		slog.String("operation", operation),
+		slog.String("client_id", client.ID),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	return reg, nil
+}
+
+// RotateClientSecret replaces the secret of a client on behalf of an admin
+// and returns the new one. The old secret stops working immediately.
+func (o *OAuth) RotateClientSecret(
+	ctx context.Context,
+	caller jwt.Claims,
+	clientID string,
+) (string, error) {
+	const operation = "oauth.RotateClientSecret"
+
+	if err := authservice.RequireAdmin(ctx, o.userProvider, caller); err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	client, err := o.clientProvider.OAuthClient(ctx, clientID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !usesSecret(client) {
+		return "", newError(InvalidRequest, "the client does not authenticate with a secret")
+	}
+
+	secret, err := random.Token(32)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := o.clients.SetClientSecret(ctx, client.ID, random.Hash(secret), time.Now()); err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	o.log.Warn(
+		"client secret rotated",
+		slog.String("operation", operation),
+		slog.String("client_id", client.ID),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	return secret, nil
+}
+
+// DeleteClient deletes a client on behalf of an admin. The sessions the
+// client holds tokens for are revoked.
+func (o *OAuth) DeleteClient(
+	ctx context.Context,
+	caller jwt.Claims,
+	clientID string,
+) error {
+	const operation = "oauth.DeleteClient"
+
+	if err := authservice.RequireAdmin(ctx, o.userProvider, caller); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := o.clients.DeleteOAuthClient(ctx, clientID, time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	o.log.Warn(
+		"client deleted",
+		slog.String("operation", operation),
+		slog.String("client_id", clientID),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	return nil
+}
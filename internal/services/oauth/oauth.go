@@ -0,0 +1,525 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+const (
+	ResponseTypeCode = "code"
+
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// CodeChallengeMethodS256 is the only PKCE method accepted; "plain"
+	// offers no protection against intercepted codes.
+	CodeChallengeMethodS256 = "S256"
+)
+
+type OAuth struct {
+	log            *slog.Logger
+	clientProvider ClientProvider
+	codeStorage    CodeStorage
+	userProvider   UserProvider
+	sessions       SessionIssuer
+	assertions     AssertionStorage
+	deviceCodes    DeviceCodeStorage
+	logouts        LogoutStorage
+	clients        ClientStorage
+	grants         GrantStorage
+	issuer         string
+	signingKey     *jwt.SigningKey
+	jwtSecret      string
+	tokenTTL       time.Duration
+	codeTTL        time.Duration
+	deviceCodeTTL  time.Duration
+	pollInterval   time.Duration
+
+	httpClient          *http.Client
+	logoutRetryInterval time.Duration
+	maxLogoutAttempts   int
+
+	registrationToken string
+}
+
+// Config holds the settings of the OAuth service.
+type Config struct {
+	// Issuer is the OpenID Connect issuer identifier, the public base URL
+	// of the HTTP endpoints.
+	Issuer string
+	// SigningKey signs ID tokens.
+	SigningKey *jwt.SigningKey
+	// JWTSecret signs access tokens issued to clients for themselves.
+	JWTSecret string
+	// TokenTTL is the lifetime of access and ID tokens.
+	TokenTTL time.Duration
+	// CodeTTL is how long an authorization code can be exchanged for.
+	CodeTTL time.Duration
+	// DeviceCodeTTL is how long users have to approve a device.
+	DeviceCodeTTL time.Duration
+	// PollInterval is how long devices must wait between two polls of the
+	// token endpoint.
+	PollInterval time.Duration
+	// LogoutTimeout bounds each delivery of a back-channel logout token.
+	LogoutTimeout time.Duration
+	// LogoutRetryInterval is the wait before the first retry of a failed
+	// back-channel logout, doubled with each further attempt.
+	LogoutRetryInterval time.Duration
+	// MaxLogoutAttempts is how many times a back-channel logout is tried
+	// before it is given up on.
+	MaxLogoutAttempts int
+	// RegistrationToken is the initial access token required to register
+	// clients dynamically. Dynamic registration is disabled without one.
+	RegistrationToken string
+}
+
+type ClientProvider interface {
+	OAuthClient(ctx context.Context, clientID string) (models.OAuthClient, error)
+}
+
+type CodeStorage interface {
+	SaveAuthorizationCode(ctx context.Context, codeHash []byte, code models.AuthorizationCode) error
+	UseAuthorizationCode(ctx context.Context, codeHash []byte, usedAt time.Time) (models.AuthorizationCode, error)
+	SetCodeSession(ctx context.Context, codeHash []byte, sessionID string) error
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+}
+
+type AssertionStorage interface {
+	SaveClientAssertion(ctx context.Context, clientID string, jti string, expiresAt time.Time) error
+}
+
+type DeviceCodeStorage interface {
+	SaveDeviceCode(ctx context.Context, deviceCodeHash []byte, code models.DeviceCode) error
+	DeviceCode(ctx context.Context, deviceCodeHash []byte) (models.DeviceCode, error)
+	DeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error)
+	DecideDeviceCode(
+		ctx context.Context,
+		userCode string,
+		status models.DeviceCodeStatus,
+		session models.Session,
+	) error
+	PollDeviceCode(ctx context.Context, deviceCodeHash []byte, polledAt time.Time, interval time.Duration) error
+	UseDeviceCode(ctx context.Context, deviceCodeHash []byte) error
+}
+
+type ClientStorage interface {
+	OAuthClients(ctx context.Context) ([]models.OAuthClient, error)
+	SaveOAuthClient(ctx context.Context, client models.OAuthClient) error
+	UpdateOAuthClient(ctx context.Context, client models.OAuthClient) error
+	SetClientSecret(ctx context.Context, clientID string, secretHash []byte, updatedAt time.Time) error
+	DeleteOAuthClient(ctx context.Context, clientID string, deletedAt time.Time) error
+}
+
+type GrantStorage interface {
+	OAuthGrant(ctx context.Context, userID int64, clientID string) (models.OAuthGrant, error)
+	OAuthGrants(ctx context.Context, userID int64) ([]models.OAuthGrant, error)
+	SaveOAuthGrant(ctx context.Context, grant models.OAuthGrant) error
+	DeleteOAuthGrant(ctx context.Context, userID int64, clientID string, revokedAt time.Time) error
+}
+
+type LogoutStorage interface {
+	DueLogoutNotifications(ctx context.Context, now time.Time, limit int) ([]models.LogoutNotification, error)
+	DeleteLogoutNotification(ctx context.Context, id int64) error
+	RetryLogoutNotification(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string) error
+}
+
+type Provider interface {
+	ClientProvider
+	CodeStorage
+	UserProvider
+	AssertionStorage
+	DeviceCodeStorage
+	LogoutStorage
+	ClientStorage
+	GrantStorage
+}
+
+// SessionIssuer opens and refreshes the sessions tokens are issued for. It
+// is implemented by the auth service.
+type SessionIssuer interface {
+	StartClientSession(
+		ctx context.Context,
+		parentID string,
+		client models.OAuthClient,
+		scope string,
+	) (models.TokenPair, error)
+	RefreshClientSession(
+		ctx context.Context,
+		client models.OAuthClient,
+		refreshToken string,
+	) (models.TokenPair, error)
+	RevokeClientSession(ctx context.Context, sessionID string) error
+	EndBrowserSession(ctx context.Context, session models.Session) ([]models.Session, error)
+	VerifyToken(ctx context.Context, token string) (jwt.Claims, error)
+	DelegateToken(
+		ctx context.Context,
+		subject jwt.Claims,
+		exchange models.TokenExchange,
+	) (string, error)
+	ImpersonateUser(
+		ctx context.Context,
+		caller jwt.Claims,
+		userID int64,
+		exchange models.TokenExchange,
+	) (string, error)
+}
+
+func New(
+	log *slog.Logger,
+	provider Provider,
+	sessions SessionIssuer,
+	cfg Config,
+) *OAuth {
+	return &OAuth{
+		log:            log,
+		clientProvider: provider,
+		codeStorage:    provider,
+		userProvider:   provider,
+		assertions:     provider,
+		deviceCodes:    provider,
+		logouts:        provider,
+		clients:        provider,
+		grants:         provider,
+		sessions:       sessions,
+		issuer:         cfg.Issuer,
+		signingKey:     cfg.SigningKey,
+		jwtSecret:      cfg.JWTSecret,
+		tokenTTL:       cfg.TokenTTL,
+		codeTTL:        cfg.CodeTTL,
+		deviceCodeTTL:  cfg.DeviceCodeTTL,
+		pollInterval:   cfg.PollInterval,
+
+		httpClient:          &http.Client{Timeout: cfg.LogoutTimeout},
+		logoutRetryInterval: cfg.LogoutRetryInterval,
+		maxLogoutAttempts:   cfg.MaxLogoutAttempts,
+
+		registrationToken: cfg.RegistrationToken,
+	}
+}
+
+// AuthorizeRequest holds the parameters of an authorization request.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce, Prompt and MaxAge are the OpenID Connect parameters.
+	Nonce  string
+	Prompt string
+	MaxAge string
+}
+
+// TokenResponse is what the token endpoint returns to a client.
+type TokenResponse struct {
+	AccessToken  string
+	RefreshToken string
+	// IDToken is only issued for the openid scope.
+	IDToken string
+	// IssuedTokenType is only set by the token exchange grant.
+	IssuedTokenType string
+	Scope           string
+	ExpiresIn       time.Duration
+}
+
+// CheckAuthorizeRequest validates an authorization request and returns the
+// client it was made by. ErrUnknownClient and ErrInvalidRedirectURI must be
+// shown to the user; any *Error is to be sent back to the redirect URI.
+func (o *OAuth) CheckAuthorizeRequest(
+	ctx context.Context,
+	req AuthorizeRequest,
+) (models.OAuthClient, error) {
+	const operation = "oauth.CheckAuthorizeRequest"
+
+	client, err := o.clientProvider.OAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotFound) {
+			return models.OAuthClient{}, fmt.Errorf("%s: %w", operation, ErrUnknownClient)
+		}
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", operation, ErrInvalidRedirectURI)
+	}
+
+	if !client.AllowsGrantType(GrantTypeAuthorizationCode) {
+		return client, newError(UnauthorizedClient, "the client may not use the authorization code grant")
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return client, newError(UnsupportedResponseType, "only the code response type is supported")
+	}
+
+	if req.CodeChallenge == "" {
+		return client, newError(InvalidRequest, "code_challenge is required")
+	}
+
+	if req.CodeChallengeMethod != CodeChallengeMethodS256 {
+		return client, newError(InvalidRequest, "code_challenge_method must be S256")
+	}
+
+	if !validCodeChallenge(req.CodeChallenge) {
+		return client, newError(InvalidRequest, "code_challenge is malformed")
+	}
+
+	if err := checkOIDCParams(req); err != nil {
+		return client, err
+	}
+
+	return client, nil
+}
+
+// IssueCode creates an authorization code for a request that was checked by
+// CheckAuthorizeRequest and approved in the browser session.
+func (o *OAuth) IssueCode(
+	ctx context.Context,
+	req AuthorizeRequest,
+	session models.Session,
+) (string, error) {
+	const operation = "oauth.IssueCode"
+
+	code, err := random.Token(32)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	err = o.codeStorage.SaveAuthorizationCode(ctx, random.Hash(code), models.AuthorizationCode{
+		ClientID:            req.ClientID,
+		UserID:              session.UserID,
+		SessionID:           session.ID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               normalizeScope(req.Scope),
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            session.AuthTime,
+		AMR:                 session.AMR,
+		ExpiresAt:           time.Now().Add(o.codeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	o.log.Info(
+		"authorization code issued",
+		slog.String("operation", operation),
+		slog.String("client_id", req.ClientID),
+		slog.Int64("user_id", session.UserID),
+	)
+
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code for tokens. A code presented a
+// second time revokes the tokens issued for it, since one of the two
+// requests must come from an attacker.
+func (o *OAuth) ExchangeCode(
+	ctx context.Context,
+	client models.OAuthClient,
+	code string,
+	redirectURI string,
+	codeVerifier string,
+) (TokenResponse, error) {
+	const operation = "oauth.ExchangeCode"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+		slog.String("client_id", client.ID),
+	)
+
+	if !client.AllowsGrantType(GrantTypeAuthorizationCode) {
+		return TokenResponse{}, newError(UnauthorizedClient, "the client may not use the authorization code grant")
+	}
+
+	if code == "" {
+		return TokenResponse{}, newError(InvalidRequest, "code is required")
+	}
+
+	codeHash := random.Hash(code)
+	now := time.Now()
+
+	authCode, err := o.codeStorage.UseAuthorizationCode(ctx, codeHash, now)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrCodeNotFound):
+			return TokenResponse{}, newError(InvalidGrant, "invalid authorization code")
+		case errors.Is(err, storage.ErrCodeUsed):
+			log.Warn("authorization code replayed", slog.Int64("user_id", authCode.UserID))
+			if authCode.IssuedSessionID != "" {
+				if err := o.sessions.RevokeClientSession(ctx, authCode.IssuedSessionID); err != nil {
+					log.Error("failed to revoke session of replayed code", slog.String("error", err.Error()))
+				}
+			}
+			return TokenResponse{}, newError(InvalidGrant, "invalid authorization code")
+		default:
+			return TokenResponse{}, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	switch {
+	case authCode.ClientID != client.ID:
+		return TokenResponse{}, newError(InvalidGrant, "authorization code was issued to another client")
+	case !now.Before(authCode.ExpiresAt):
+		return TokenResponse{}, newError(InvalidGrant, "authorization code expired")
+	case authCode.RedirectURI != redirectURI:
+		return TokenResponse{}, newError(InvalidGrant, "redirect_uri does not match the authorization request")
+	case !verifyCodeChallenge(authCode.CodeChallenge, codeVerifier):
+		return TokenResponse{}, newError(InvalidGrant, "code_verifier does not match the code_challenge")
+	}
+
+	tokens, err := o.sessions.StartClientSession(ctx, authCode.SessionID, client, authCode.Scope)
+	if err != nil {
+		log.Warn("failed to start client session", slog.String("error", err.Error()))
+		return TokenResponse{}, newError(InvalidGrant, "the authorization is no longer valid")
+	}
+
+	if err := o.codeStorage.SetCodeSession(ctx, codeHash, tokens.SessionID); err != nil {
+		log.Error("failed to record session of code", slog.String("error", err.Error()))
+	}
+
+	res := TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Scope:        authCode.Scope,
+		ExpiresIn:    o.accessTokenTTL(client),
+	}
+
+	if hasScope(authCode.Scope, ScopeOpenID) {
+		res.IDToken, err = o.idToken(ctx, client, authentication{
+			UserID:    authCode.UserID,
+			SessionID: authCode.SessionID,
+			Scope:     authCode.Scope,
+			Nonce:     authCode.Nonce,
+			AuthTime:  authCode.AuthTime,
+			AMR:       authCode.AMR,
+		}, tokens.AccessToken)
+		if err != nil {
+			log.Error("failed to issue id token", slog.String("error", err.Error()))
+			return TokenResponse{}, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	log.Info("authorization code exchanged", slog.Int64("user_id", authCode.UserID))
+
+	return res, nil
+}
+
+// Refresh handles the refresh_token grant.
+func (o *OAuth) Refresh(
+	ctx context.Context,
+	client models.OAuthClient,
+	refreshToken string,
+) (TokenResponse, error) {
+	const operation = "oauth.Refresh"
+
+	if !client.AllowsGrantType(GrantTypeRefreshToken) {
+		return TokenResponse{}, newError(UnauthorizedClient, "the client may not use refresh tokens")
+	}
+
+	if refreshToken == "" {
+		return TokenResponse{}, newError(InvalidRequest, "refresh_token is required")
+	}
+
+	tokens, err := o.sessions.RefreshClientSession(ctx, client, refreshToken)
+	if err != nil {
+		o.log.Warn(
+			"failed to refresh client session",
+			slog.String("operation", operation),
+			slog.String("client_id", client.ID),
+			slog.String("error", err.Error()),
+		)
+		return TokenResponse{}, newError(InvalidGrant, "invalid refresh token")
+	}
+
+	return TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    o.accessTokenTTL(client),
+	}, nil
+}
+
+// accessTokenTTL returns how long the access tokens issued to client are
+// valid.
+func (o *OAuth) accessTokenTTL(client models.OAuthClient) time.Duration {
+	if client.AccessTokenTTL > 0 {
+		return client.AccessTokenTTL
+	}
+
+	return o.tokenTTL
+}
+
+// validCodeChallenge checks that challenge looks like an unpadded base64url
+// SHA-256 hash, as produced by the S256 method.
+func validCodeChallenge(challenge string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// verifyCodeChallenge implements the S256 check of RFC 7636.
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	// RFC 7636 section 4.1: 43 to 128 unreserved characters.
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	for _, r := range verifier {
+		if !isUnreserved(r) {
+			return false
+		}
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func isUnreserved(r rune) bool {
+	return r >= 'A' && r <= 'Z' ||
+		r >= 'a' && r <= 'z' ||
+		r >= '0' && r <= '9' ||
+		r == '-' || r == '.' || r == '_' || r == '~'
+}
+
+func hasScope(scope string, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
+
+// normalizeScope removes duplicate and extra whitespace from a scope string.
+func normalizeScope(scope string) string {
+	seen := make(map[string]struct{})
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		scopes = append(scopes, s)
+	}
+
+	return strings.Join(scopes, " ")
+}
@@ -0,0 +1,147 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/services/oauth"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite/sqlitetest"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+const (
+	testIssuer   = "https://sso.test"
+	testEmail    = "user@example.com"
+	testPassword = "correct horse battery"
+)
+
+// env is an OAuth service over a fresh database with a user signed in to
+// the hosted login pages.
+type env struct {
+	storage *sqlite.Storage
+	auth    *auth.Auth
+	oauth   *oauth.OAuth
+	key     *rsa.PrivateKey
+	userID  int64
+	session models.Session
+	// db is a second handle on the database, to arrange states the services
+	// cannot be asked for, such as expired records.
+	db *sql.DB
+}
+
+// newEnv returns an OAuth service configured by cfg, with the issuer, keys
+// and token lifetimes every test needs filled in.
+func newEnv(t *testing.T, cfg oauth.Config) env {
+	t.Helper()
+
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := sqlitetest.Path(t)
+
+	storage, err := sqlite.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := jwt.NewSigningKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authService := auth.New(log, storage, auth.Config{
+		JWTSecret:       "secret",
+		TokenTTL:        time.Hour,
+		RefreshTokenTTL: time.Hour,
+		PasswordPolicy: auth.PasswordPolicy{
+			PasswordPolicy: validator.PasswordPolicy{MinLength: 8},
+		},
+	})
+
+	cfg.Issuer = testIssuer
+	cfg.SigningKey = signingKey
+	cfg.JWTSecret = "secret"
+	cfg.TokenTTL = time.Hour
+	cfg.CodeTTL = time.Minute
+	oauthService := oauth.New(log, storage, authService, cfg)
+
+	userID, err := authService.RegisterNewUser(ctx, testEmail, testPassword, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := authService.Login(ctx, testEmail, testPassword, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, session, err := authService.StartBrowserSession(ctx, tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return env{
+		storage: storage,
+		auth:    authService,
+		oauth:   oauthService,
+		key:     key,
+		userID:  userID,
+		session: session,
+		db:      db,
+	}
+}
+
+// saveClient registers client as a public first-party client, with a name
+// and redirect URI derived from its id.
+func (e env) saveClient(t *testing.T, client models.OAuthClient) models.OAuthClient {
+	t.Helper()
+
+	client.Name = client.ID
+	client.RedirectURIs = []string{"https://" + client.ID + ".test/callback"}
+	client.TokenEndpointAuthMethod = models.AuthMethodNone
+	client.FirstParty = true
+
+	if err := e.storage.SaveOAuthClient(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func (e env) exec(t *testing.T, query string, args ...any) {
+	t.Helper()
+
+	if _, err := e.db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// wantOAuthError fails unless err is an OAuth error response with code.
+func wantOAuthError(t *testing.T, err error, code string) {
+	t.Helper()
+
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != code {
+		t.Fatalf("err = %v, want %s", err, code)
+	}
+}
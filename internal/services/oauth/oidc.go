@@ -0,0 +1,199 @@
+package oauth
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+)
+
+// Scopes defined by OpenID Connect Core that gia-sso releases claims for.
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+	ScopePhone   = "phone"
+)
+
+// Values of the prompt parameter.
+const (
+	PromptNone          = "none"
+	PromptLogin         = "login"
+	PromptConsent       = "consent"
+	PromptSelectAccount = "select_account"
+)
+
+// Issuer returns the OpenID Connect issuer identifier.
+func (o *OAuth) Issuer() string {
+	return o.issuer
+}
+
+// JWKS returns the keys ID token signatures can be verified with.
+func (o *OAuth) JWKS() jwt.JSONWebKeySet {
+	return o.signingKey.JWKS()
+}
+
+// ReuseSession decides whether an authorization request can be answered
+// from the user's existing browser session, which is nil if there is none.
+// When the user has to log in but the client asked for prompt=none, a
+// login_required error is returned.
+func (o *OAuth) ReuseSession(req AuthorizeRequest, session *models.Session) (bool, error) {
+	prompts := strings.Fields(req.Prompt)
+
+	if session != nil && !slices.Contains(prompts, PromptLogin) && !slices.Contains(prompts, PromptSelectAccount) {
+		maxAge, ok := parseMaxAge(req.MaxAge)
+		if !ok || time.Since(session.AuthTime) <= maxAge {
+			return true, nil
+		}
+	}
+
+	if slices.Contains(prompts, PromptNone) {
+		return false, newError(LoginRequired, "the user must log in")
+	}
+
+	return false, nil
+}
+
+// UserInfo returns the claims about the user an access token was issued
+// for that its scopes allow the client to see.
+func (o *OAuth) UserInfo(ctx context.Context, claims jwt.Claims) (map[string]any, error) {
+	if claims.ClientID == "" || !hasScope(claims.Scope, ScopeOpenID) {
+		return nil, newError(InsufficientScope, "the access token was not issued for the openid scope")
+	}
+
+	user, err := o.userProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		o.log.Error(
+			"failed to get user",
+			slog.String("operation", "oauth.UserInfo"),
+			slog.String("error", err.Error()),
+		)
+		return nil, newError(InvalidToken, "")
+	}
+
+	return userClaims(user, claims.Scope), nil
+}
+
+// authentication describes the login of the user an ID token is issued for.
+type authentication struct {
+	UserID    int64
+	SessionID string
+	Scope     string
+	Nonce     string
+	AuthTime  time.Time
+	AMR       []string
+}
+
+func (o *OAuth) idToken(
+	ctx context.Context,
+	client models.OAuthClient,
+	authn authentication,
+	accessToken string,
+) (string, error) {
+	user, err := o.userProvider.UserByID(ctx, authn.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	return jwt.NewIDToken(o.signingKey, jwt.IDToken{
+		Issuer:      o.issuer,
+		Subject:     subject(user.ID),
+		Audience:    client.ID,
+		Nonce:       authn.Nonce,
+		AuthTime:    authn.AuthTime,
+		ACR:         models.ACR(authn.AMR),
+		AMR:         authn.AMR,
+		SessionID:   authn.SessionID,
+		AccessToken: accessToken,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(o.accessTokenTTL(client)),
+		Claims:      userClaims(user, authn.Scope),
+	})
+}
+
+// userClaims returns the standard claims about user released for scope.
+func userClaims(user models.User, scope string) map[string]any {
+	claims := map[string]any{
+		"sub": subject(user.ID),
+	}
+
+	if hasScope(scope, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.Status != models.UserStatusPendingVerification
+	}
+
+	if hasScope(scope, ScopeProfile) {
+		profile := user.Profile
+		claims["preferred_username"] = user.Email
+		for claim, value := range map[string]string{
+			"name":        profile.DisplayName,
+			"given_name":  profile.GivenName,
+			"family_name": profile.FamilyName,
+			"locale":      profile.Locale,
+			"zoneinfo":    profile.Timezone,
+			"picture":     profile.AvatarURL,
+		} {
+			if value != "" {
+				claims[claim] = value
+			}
+		}
+		if !profile.UpdatedAt.IsZero() {
+			claims["updated_at"] = profile.UpdatedAt.Unix()
+		}
+	}
+
+	if hasScope(scope, ScopePhone) && user.Profile.Phone != "" {
+		claims["phone_number"] = user.Profile.Phone
+		claims["phone_number_verified"] = user.Profile.PhoneVerified()
+	}
+
+	return claims
+}
+
+func subject(userID int64) string {
+	return strconv.FormatInt(userID, 10)
+}
+
+// checkOIDCParams validates the prompt and max_age parameters.
+func checkOIDCParams(req AuthorizeRequest) error {
+	prompts := strings.Fields(req.Prompt)
+	for _, prompt := range prompts {
+		switch prompt {
+		case PromptNone, PromptLogin, PromptConsent, PromptSelectAccount:
+		default:
+			return newError(InvalidRequest, "unsupported prompt value "+strconv.Quote(prompt))
+		}
+	}
+
+	if slices.Contains(prompts, PromptNone) && len(prompts) > 1 {
+		return newError(InvalidRequest, "prompt=none cannot be combined with other values")
+	}
+
+	if req.MaxAge != "" {
+		if _, ok := parseMaxAge(req.MaxAge); !ok {
+			return newError(InvalidRequest, "max_age must be a non-negative number of seconds")
+		}
+	}
+
+	return nil
+}
+
+func parseMaxAge(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
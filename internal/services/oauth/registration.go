@@ -0,0 +1,428 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+// ClientRegistration is a newly registered or updated client together with
+// the credentials that are only returned once.
+type ClientRegistration struct {
+	Client models.OAuthClient
+	// Secret is set when a new client secret was generated.
+	Secret string
+	// RegistrationAccessToken and RegistrationClientURI let a dynamically
+	// registered client manage its registration (RFC 7592).
+	RegistrationAccessToken string
+	RegistrationClientURI   string
+}
+
+// RegisterClient handles dynamic client registration (RFC 7591). Only
+// callers holding the initial access token configured for the server may
+// register clients.
+func (o *OAuth) RegisterClient(
+	ctx context.Context,
+	initialAccessToken string,
+	metadata models.OAuthClient,
+) (ClientRegistration, error) {
+	const operation = "oauth.RegisterClient"
+
+	log := o.log.With(
+		slog.String("operation", operation),
+	)
+
+	if o.registrationToken == "" || subtle.ConstantTimeCompare(
+		random.Hash(initialAccessToken),
+		random.Hash(o.registrationToken),
+	) != 1 {
+		log.Warn("client registration with invalid initial access token")
+		return ClientRegistration{}, newError(InvalidToken, "invalid initial access token")
+	}
+
+	clientID, err := random.Token(16)
+	if err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	metadata.ID = clientID
+
+	registrationToken, err := random.Token(32)
+	if err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	metadata.RegistrationTokenHash = random.Hash(registrationToken)
+	metadata.AccessTokenTTL = 0
+	metadata.RefreshTokenTTL = 0
+	metadata.FirstParty = false
+	metadata.ServiceAccountID = 0
+
+	reg, err := o.saveClient(ctx, metadata)
+	if err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	reg.RegistrationAccessToken = registrationToken
+	reg.RegistrationClientURI = o.registrationClientURI(clientID)
+
+	log.Info("client registered", slog.String("client_id", clientID))
+
+	return reg, nil
+}
+
+// RegisteredClient returns the registration of a dynamically registered
+// client to the holder of its registration access token.
+func (o *OAuth) RegisteredClient(
+	ctx context.Context,
+	clientID string,
+	registrationToken string,
+) (ClientRegistration, error) {
+	const operation = "oauth.RegisteredClient"
+
+	client, err := o.registeredClient(ctx, clientID, registrationToken)
+	if err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return ClientRegistration{
+		Client:                client,
+		RegistrationClientURI: o.registrationClientURI(client.ID),
+	}, nil
+}
+
+// UpdateRegisteredClient replaces the metadata of a dynamically registered
+// client, as described in RFC 7592 section 2.2.
+func (o *OAuth) UpdateRegisteredClient(
+	ctx context.Context,
+	clientID string,
+	registrationToken string,
+	metadata models.OAuthClient,
+) (ClientRegistration, error) {
+	const operation = "oauth.UpdateRegisteredClient"
+
+	client, err := o.registeredClient(ctx, clientID, registrationToken)
+	if err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if metadata.ID != "" && metadata.ID != client.ID {
+		return ClientRegistration{}, newError(InvalidRequest, "client_id does not match the registration")
+	}
+
+	// Token lifetimes, first-party status and the service account can only
+	// be set by admins.
+	metadata.AccessTokenTTL = client.AccessTokenTTL
+	metadata.RefreshTokenTTL = client.RefreshTokenTTL
+	metadata.FirstParty = client.FirstParty
+	metadata.ServiceAccountID = client.ServiceAccountID
+
+	reg, err := o.updateClient(ctx, client, metadata)
+	if err != nil {
+		return ClientRegistration{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	reg.RegistrationClientURI = o.registrationClientURI(client.ID)
+
+	o.log.Info("client registration updated", slog.String("operation", operation), slog.String("client_id", client.ID))
+
+	return reg, nil
+}
+
+// DeleteRegisteredClient deletes a dynamically registered client.
+func (o *OAuth) DeleteRegisteredClient(
+	ctx context.Context,
+	clientID string,
+	registrationToken string,
+) error {
+	const operation = "oauth.DeleteRegisteredClient"
+
+	client, err := o.registeredClient(ctx, clientID, registrationToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := o.clients.DeleteOAuthClient(ctx, client.ID, time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	o.log.Info("client registration deleted", slog.String("operation", operation), slog.String("client_id", client.ID))
+
+	return nil
+}
+
+// registeredClient authenticates a request to the client configuration
+// endpoint. Unknown clients and wrong tokens are not told apart.
+func (o *OAuth) registeredClient(
+	ctx context.Context,
+	clientID string,
+	registrationToken string,
+) (models.OAuthClient, error) {
+	client, err := o.clientProvider.OAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotFound) {
+			return models.OAuthClient{}, newError(InvalidToken, "invalid registration access token")
+		}
+		return models.OAuthClient{}, err
+	}
+
+	if registrationToken == "" || len(client.RegistrationTokenHash) == 0 ||
+		subtle.ConstantTimeCompare(random.Hash(registrationToken), client.RegistrationTokenHash) != 1 {
+		return models.OAuthClient{}, newError(InvalidToken, "invalid registration access token")
+	}
+
+	return client, nil
+}
+
+func (o *OAuth) registrationClientURI(clientID string) string {
+	return strings.TrimSuffix(o.issuer, "/") + "/register/" + url.PathEscape(clientID)
+}
+
+// saveClient validates and stores a new client, generating a secret if its
+// authentication method needs one.
+func (o *OAuth) saveClient(ctx context.Context, client models.OAuthClient) (ClientRegistration, error) {
+	if err := checkClientMetadata(&client); err != nil {
+		return ClientRegistration{}, err
+	}
+	if err := o.checkServiceAccount(ctx, client); err != nil {
+		return ClientRegistration{}, err
+	}
+
+	var (
+		reg ClientRegistration
+		err error
+	)
+	if usesSecret(client) {
+		reg.Secret, err = random.Token(32)
+		if err != nil {
+			return ClientRegistration{}, err
+		}
+		client.SecretHash = random.Hash(reg.Secret)
+	}
+
+	now := time.Now()
+	client.CreatedAt = now
+	client.UpdatedAt = now
+
+	if err := o.clients.SaveOAuthClient(ctx, client); err != nil {
+		return ClientRegistration{}, err
+	}
+
+	reg.Client = client
+
+	return reg, nil
+}
+
+// updateClient validates and stores the new metadata of client. A secret is
+// generated when the client switches to secret authentication and dropped
+// when it stops using one.
+func (o *OAuth) updateClient(
+	ctx context.Context,
+	client models.OAuthClient,
+	metadata models.OAuthClient,
+) (ClientRegistration, error) {
+	metadata.ID = client.ID
+	if err := checkClientMetadata(&metadata); err != nil {
+		return ClientRegistration{}, err
+	}
+	if err := o.checkServiceAccount(ctx, metadata); err != nil {
+		return ClientRegistration{}, err
+	}
+
+	now := time.Now()
+	metadata.CreatedAt = client.CreatedAt
+	metadata.UpdatedAt = now
+	metadata.RegistrationTokenHash = client.RegistrationTokenHash
+	metadata.SecretHash = client.SecretHash
+
+	if err := o.clients.UpdateOAuthClient(ctx, metadata); err != nil {
+		return ClientRegistration{}, err
+	}
+
+	var reg ClientRegistration
+
+	switch {
+	case usesSecret(metadata) && len(client.SecretHash) == 0:
+		secret, err := random.Token(32)
+		if err != nil {
+			return ClientRegistration{}, err
+		}
+		metadata.SecretHash = random.Hash(secret)
+		reg.Secret = secret
+	case !usesSecret(metadata) && len(client.SecretHash) > 0:
+		metadata.SecretHash = nil
+	}
+
+	if !slices.Equal(metadata.SecretHash, client.SecretHash) {
+		if err := o.clients.SetClientSecret(ctx, client.ID, metadata.SecretHash, now); err != nil {
+			return ClientRegistration{}, err
+		}
+	}
+
+	reg.Client = metadata
+
+	return reg, nil
+}
+
+// checkServiceAccount checks that the service account a client is bound to
+// exists and that the client can obtain tokens for it.
+func (o *OAuth) checkServiceAccount(ctx context.Context, client models.OAuthClient) error {
+	if client.ServiceAccountID == 0 {
+		return nil
+	}
+
+	if !client.AllowsGrantType(GrantTypeClientCredentials) {
+		return newError(InvalidClientMetadata, "a service account requires the client credentials grant")
+	}
+
+	user, err := o.userProvider.UserByID(ctx, client.ServiceAccountID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return newError(InvalidClientMetadata, "service account not found")
+		}
+		return err
+	}
+	if !user.IsServiceAccount() {
+		return newError(InvalidClientMetadata, "service_account_id is not a service account")
+	}
+
+	return nil
+}
+
+func usesSecret(client models.OAuthClient) bool {
+	method := client.AuthMethod()
+	return method == models.AuthMethodSecretBasic || method == models.AuthMethodSecretPost
+}
+
+// supportedGrantTypes are the grant types clients can be registered for.
+var supportedGrantTypes = []string{
+	GrantTypeAuthorizationCode,
+	GrantTypeRefreshToken,
+	GrantTypeClientCredentials,
+	GrantTypeDeviceCode,
+	GrantTypeTokenExchange,
+}
+
+// checkClientMetadata validates the metadata of a client and fills in the
+// defaults of RFC 7591 section 2.
+func checkClientMetadata(client *models.OAuthClient) error {
+	if client.Name == "" {
+		client.Name = client.ID
+	}
+
+	if client.TokenEndpointAuthMethod == "" {
+		client.TokenEndpointAuthMethod = models.AuthMethodSecretBasic
+	}
+	switch client.TokenEndpointAuthMethod {
+	case models.AuthMethodSecretBasic, models.AuthMethodSecretPost, models.AuthMethodNone:
+	case models.AuthMethodPrivateKeyJWT:
+		if client.JWKS == "" {
+			return newError(InvalidClientMetadata, "jwks is required for private_key_jwt")
+		}
+	default:
+		return newError(InvalidClientMetadata, "unsupported token_endpoint_auth_method")
+	}
+
+	if client.JWKS != "" {
+		if err := jwt.ParseJWKS(client.JWKS); err != nil {
+			return newError(InvalidClientMetadata, "invalid jwks")
+		}
+	}
+
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{GrantTypeAuthorizationCode}
+	}
+	for _, grantType := range client.GrantTypes {
+		if !slices.Contains(supportedGrantTypes, grantType) {
+			return newError(InvalidClientMetadata, "unsupported grant type "+grantType)
+		}
+	}
+	client.GrantTypes = slices.Compact(slices.Sorted(slices.Values(client.GrantTypes)))
+
+	if client.AllowsGrantType(GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return newError(InvalidRedirectURI, "the authorization code grant requires a redirect uri")
+	}
+	if client.AllowsGrantType(GrantTypeClientCredentials) && !client.IsConfidential() {
+		return newError(InvalidClientMetadata, "the client credentials grant requires client authentication")
+	}
+
+	for _, uri := range client.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return newError(InvalidRedirectURI, "invalid redirect uri "+uri)
+		}
+	}
+	for _, uri := range client.PostLogoutRedirectURIs {
+		if !validRedirectURI(uri) {
+			return newError(InvalidClientMetadata, "invalid post logout redirect uri "+uri)
+		}
+	}
+	for _, uri := range []string{client.FrontchannelLogoutURI, client.BackchannelLogoutURI} {
+		if uri != "" && !validWebURI(uri) {
+			return newError(InvalidClientMetadata, "invalid logout uri "+uri)
+		}
+	}
+
+	for _, scope := range client.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\n") {
+			return newError(InvalidClientMetadata, "invalid scope")
+		}
+	}
+	if slices.Contains(client.Audience, "") {
+		return newError(InvalidClientMetadata, "invalid audience")
+	}
+
+	if client.AccessTokenTTL < 0 || client.RefreshTokenTTL < 0 {
+		return newError(InvalidClientMetadata, "token lifetimes cannot be negative")
+	}
+
+	return nil
+}
+
+// validRedirectURI accepts absolute URIs without a fragment. Plain http is
+// only accepted for loopback addresses, as used by native apps (RFC 8252).
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		return isLoopback(u.Hostname())
+	case "javascript", "data", "file", "vbscript":
+		return false
+	default:
+		// Private-use schemes of native apps, e.g. com.example.app:/cb.
+		return true
+	}
+}
+
+// validWebURI accepts absolute https URIs, or http ones on loopback.
+func validWebURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+
+	return u.Scheme == "https" || u.Scheme == "http" && isLoopback(u.Hostname())
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
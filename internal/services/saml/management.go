@@ -0,0 +1,236 @@
+package saml
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	authservice "github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	samlproto "github.com/VariableSan/gia-sso/pkg/saml"
+)
+
+// nameIDFormats are the name identifier formats service providers can be
+// sent: the email address of users, or their user id as a persistent
+// identifier that survives changes of their email address.
+var nameIDFormats = []string{
+	samlproto.NameIDFormatEmail,
+	samlproto.NameIDFormatPersistent,
+}
+
+// defaultAttributes are sent to service providers registered without an
+// attribute mapping.
+var defaultAttributes = map[string]string{
+	"email": models.UserFieldEmail,
+}
+
+// InvalidServiceProviderError explains why the registration of a service
+// provider was rejected.
+type InvalidServiceProviderError struct {
+	Reason string
+}
+
+func (e *InvalidServiceProviderError) Error() string {
+	return "invalid service provider: " + e.Reason
+}
+
+// CreateServiceProvider registers a service provider on behalf of an admin.
+func (s *SAML) CreateServiceProvider(
+	ctx context.Context,
+	caller jwt.Claims,
+	sp models.SAMLServiceProvider,
+) (models.SAMLServiceProvider, error) {
+	const operation = "saml.CreateServiceProvider"
+
+	if err := authservice.RequireAdmin(ctx, s.userProvider, caller); err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := checkServiceProvider(&sp); err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+	sp.CreatedAt = now
+	sp.UpdatedAt = now
+
+	if err := s.providers.SaveSAMLServiceProvider(ctx, sp); err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	s.log.Info(
+		"service provider created",
+		slog.String("operation", operation),
+		slog.String("entity_id", sp.EntityID),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	return sp, nil
+}
+
+// ServiceProvider returns a registered service provider to an admin.
+func (s *SAML) ServiceProvider(
+	ctx context.Context,
+	caller jwt.Claims,
+	entityID string,
+) (models.SAMLServiceProvider, error) {
+	const operation = "saml.ServiceProvider"
+
+	if err := authservice.RequireAdmin(ctx, s.userProvider, caller); err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	sp, err := s.providers.SAMLServiceProvider(ctx, entityID)
+	if err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return sp, nil
+}
+
+// ServiceProviders returns all registered service providers to an admin.
+func (s *SAML) ServiceProviders(ctx context.Context, caller jwt.Claims) ([]models.SAMLServiceProvider, error) {
+	const operation = "saml.ServiceProviders"
+
+	if err := authservice.RequireAdmin(ctx, s.userProvider, caller); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	providers, err := s.providers.SAMLServiceProviders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return providers, nil
+}
+
+// UpdateServiceProvider replaces the registration of the service provider
+// sp.EntityID on behalf of an admin.
+func (s *SAML) UpdateServiceProvider(
+	ctx context.Context,
+	caller jwt.Claims,
+	sp models.SAMLServiceProvider,
+) (models.SAMLServiceProvider, error) {
+	const operation = "saml.UpdateServiceProvider"
+
+	if err := authservice.RequireAdmin(ctx, s.userProvider, caller); err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	current, err := s.providers.SAMLServiceProvider(ctx, sp.EntityID)
+	if err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := checkServiceProvider(&sp); err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	sp.CreatedAt = current.CreatedAt
+	sp.UpdatedAt = time.Now()
+
+	if err := s.providers.UpdateSAMLServiceProvider(ctx, sp); err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	s.log.Info(
+		"service provider updated",
+		slog.String("operation", operation),
+		slog.String("entity_id", sp.EntityID),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	return sp, nil
+}
+
+// DeleteServiceProvider removes a service provider on behalf of an admin.
+func (s *SAML) DeleteServiceProvider(
+	ctx context.Context,
+	caller jwt.Claims,
+	entityID string,
+) error {
+	const operation = "saml.DeleteServiceProvider"
+
+	if err := authservice.RequireAdmin(ctx, s.userProvider, caller); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := s.providers.DeleteSAMLServiceProvider(ctx, entityID); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	s.log.Warn(
+		"service provider deleted",
+		slog.String("operation", operation),
+		slog.String("entity_id", entityID),
+		slog.Int64("caller_id", caller.UserID),
+	)
+
+	return nil
+}
+
+// checkServiceProvider validates the registration of sp and fills in the
+// defaults of the settings it leaves out.
+func checkServiceProvider(sp *models.SAMLServiceProvider) error {
+	if sp.EntityID == "" {
+		return &InvalidServiceProviderError{Reason: "entity id is required"}
+	}
+	if sp.Name == "" {
+		sp.Name = sp.EntityID
+	}
+
+	if len(sp.ACSURLs) == 0 {
+		return &InvalidServiceProviderError{Reason: "at least one assertion consumer service url is required"}
+	}
+	for _, acsURL := range sp.ACSURLs {
+		if !validACSURL(acsURL) {
+			return &InvalidServiceProviderError{Reason: "invalid assertion consumer service url " + acsURL}
+		}
+	}
+
+	switch sp.NameIDFormat {
+	case "":
+		sp.NameIDFormat = samlproto.NameIDFormatEmail
+	case samlproto.NameIDFormatEmail, samlproto.NameIDFormatPersistent:
+	default:
+		return &InvalidServiceProviderError{Reason: "unsupported name id format " + sp.NameIDFormat}
+	}
+
+	if len(sp.Attributes) == 0 {
+		sp.Attributes = maps.Clone(defaultAttributes)
+	}
+	for name, field := range sp.Attributes {
+		if name == "" {
+			return &InvalidServiceProviderError{Reason: "attribute names cannot be empty"}
+		}
+
+		switch field {
+		case models.UserFieldID, models.UserFieldEmail, models.UserFieldRoles:
+		default:
+			return &InvalidServiceProviderError{Reason: "unknown user field " + field}
+		}
+	}
+
+	return nil
+}
+
+// validACSURL accepts absolute https URLs, or http ones on loopback.
+func validACSURL(acsURL string) bool {
+	u, err := url.Parse(acsURL)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+
+	if u.Scheme == "http" {
+		host := u.Hostname()
+		ip := net.ParseIP(host)
+		return host == "localhost" || ip != nil && ip.IsLoopback()
+	}
+
+	return u.Scheme == "https"
+}
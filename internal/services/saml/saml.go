@@ -0,0 +1,396 @@
+// Package saml signs users in to service providers that speak SAML 2.0,
+// with gia-sso acting as their identity provider.
+package saml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	samlproto "github.com/VariableSan/gia-sso/pkg/saml"
+)
+
+var (
+	// ErrInvalidRequest, ErrUnknownServiceProvider and ErrInvalidACSURL mean
+	// a request cannot be answered, because there is no trusted assertion
+	// consumer service to send the answer to.
+	ErrInvalidRequest         = errors.New("invalid saml request")
+	ErrUnknownServiceProvider = errors.New("unknown saml service provider")
+	ErrInvalidACSURL          = errors.New("assertion consumer service is not registered for the service provider")
+	// ErrIdPInitiatedDisabled means the service provider only accepts
+	// responses to its own requests.
+	ErrIdPInitiatedDisabled = errors.New("idp-initiated login is disabled for the service provider")
+)
+
+// Error is a failure reported back to the service provider in a response.
+type Error struct {
+	// Status is a top-level status code and SubStatus an optional
+	// second-level one.
+	Status    string
+	SubStatus string
+}
+
+func (e *Error) Error() string {
+	if e.SubStatus != "" {
+		return "saml status " + e.SubStatus
+	}
+	return "saml status " + e.Status
+}
+
+type SAML struct {
+	log          *slog.Logger
+	providers    ServiceProviderStorage
+	userProvider UserProvider
+	auditLogger  AuditLogger
+	entityID     string
+	ssoURL       string
+	signingKey   *jwt.SigningKey
+	certificate  []byte
+	assertionTTL time.Duration
+}
+
+// Config holds the settings of the SAML identity provider.
+type Config struct {
+	// EntityID identifies gia-sso to service providers. It is the URL its
+	// metadata is served at.
+	EntityID string
+	// SSOURL is the single sign-on service requests are sent to.
+	SSOURL string
+	// SigningKey signs assertions.
+	SigningKey *jwt.SigningKey
+	// AssertionTTL is how long service providers accept an assertion.
+	AssertionTTL time.Duration
+}
+
+type ServiceProviderStorage interface {
+	SAMLServiceProvider(ctx context.Context, entityID string) (models.SAMLServiceProvider, error)
+	SAMLServiceProviders(ctx context.Context) ([]models.SAMLServiceProvider, error)
+	SaveSAMLServiceProvider(ctx context.Context, sp models.SAMLServiceProvider) error
+	UpdateSAMLServiceProvider(ctx context.Context, sp models.SAMLServiceProvider) error
+	DeleteSAMLServiceProvider(ctx context.Context, entityID string) error
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+}
+
+type AuditLogger interface {
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+}
+
+type Storage interface {
+	ServiceProviderStorage
+	UserProvider
+	AuditLogger
+}
+
+func New(log *slog.Logger, storage Storage, cfg Config) (*SAML, error) {
+	certificate, err := cfg.SigningKey.Certificate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing certificate: %w", err)
+	}
+
+	return &SAML{
+		log:          log,
+		providers:    storage,
+		userProvider: storage,
+		auditLogger:  storage,
+		entityID:     cfg.EntityID,
+		ssoURL:       cfg.SSOURL,
+		signingKey:   cfg.SigningKey,
+		certificate:  certificate,
+		assertionTTL: cfg.AssertionTTL,
+	}, nil
+}
+
+// Request is a login at a service provider, checked against its
+// registration.
+type Request struct {
+	ServiceProvider models.SAMLServiceProvider
+	// ID is the ID of the AuthnRequest, empty for IdP-initiated logins.
+	ID           string
+	ACSURL       string
+	NameIDFormat string
+	// ForceAuthn asks for the user to log in again even with a session, and
+	// IsPassive for no login page to be shown.
+	ForceAuthn bool
+	IsPassive  bool
+}
+
+// Response is a SAML response for the browser to post to an assertion
+// consumer service.
+type Response struct {
+	ACSURL string
+	// SAMLResponse is the response encoded for the HTTP-POST binding.
+	SAMLResponse string
+}
+
+// Metadata returns the metadata service providers are configured with.
+func (s *SAML) Metadata() []byte {
+	return samlproto.Metadata(samlproto.IdentityProvider{
+		EntityID:      s.entityID,
+		SSOURL:        s.ssoURL,
+		NameIDFormats: nameIDFormats,
+		Certificate:   s.certificate,
+	})
+}
+
+// CheckRequest reads and checks an AuthnRequest. Errors of type *Error
+// come with a request that can be answered with them through Fail.
+func (s *SAML) CheckRequest(ctx context.Context, data []byte) (Request, error) {
+	const operation = "saml.CheckRequest"
+
+	authnRequest, err := samlproto.ParseAuthnRequest(data)
+	if err != nil {
+		return Request{}, fmt.Errorf("%s: %w: %v", operation, ErrInvalidRequest, err)
+	}
+
+	if authnRequest.Destination != "" && authnRequest.Destination != s.ssoURL {
+		return Request{}, fmt.Errorf("%s: %w: wrong destination", operation, ErrInvalidRequest)
+	}
+	if authnRequest.ProtocolBinding != "" && authnRequest.ProtocolBinding != samlproto.BindingHTTPPost {
+		return Request{}, fmt.Errorf("%s: %w: unsupported protocol binding", operation, ErrInvalidRequest)
+	}
+
+	sp, err := s.serviceProvider(ctx, authnRequest.Issuer)
+	if err != nil {
+		return Request{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	acsURL, err := pickACSURL(sp, authnRequest)
+	if err != nil {
+		return Request{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	req := Request{
+		ServiceProvider: sp,
+		ID:              authnRequest.ID,
+		ACSURL:          acsURL,
+		NameIDFormat:    sp.NameIDFormat,
+		ForceAuthn:      authnRequest.ForceAuthn,
+		IsPassive:       authnRequest.IsPassive,
+	}
+
+	switch authnRequest.NameIDFormat {
+	case "", samlproto.NameIDFormatUnspecified:
+	case samlproto.NameIDFormatEmail, samlproto.NameIDFormatPersistent:
+		req.NameIDFormat = authnRequest.NameIDFormat
+	default:
+		return req, &Error{
+			Status:    samlproto.StatusRequester,
+			SubStatus: samlproto.StatusInvalidNameIDPolicy,
+		}
+	}
+
+	return req, nil
+}
+
+// StartLogin starts an IdP-initiated login at the service provider
+// entityID, which signs the user in without a request of it.
+func (s *SAML) StartLogin(ctx context.Context, entityID string) (Request, error) {
+	const operation = "saml.StartLogin"
+
+	sp, err := s.serviceProvider(ctx, entityID)
+	if err != nil {
+		return Request{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !sp.IdPInitiated {
+		return Request{}, fmt.Errorf("%s: %w", operation, ErrIdPInitiatedDisabled)
+	}
+
+	return Request{
+		ServiceProvider: sp,
+		ACSURL:          sp.ACSURLs[0],
+		NameIDFormat:    sp.NameIDFormat,
+	}, nil
+}
+
+// Respond answers req with a signed assertion about the user of session.
+func (s *SAML) Respond(
+	ctx context.Context,
+	req Request,
+	session models.Session,
+) (Response, error) {
+	const operation = "saml.Respond"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+		slog.String("entity_id", req.ServiceProvider.EntityID),
+		slog.Int64("user_id", session.UserID),
+	)
+
+	user, err := s.userProvider.UserByID(ctx, session.UserID)
+	if err != nil {
+		return Response{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if user.Status != models.UserStatusActive {
+		log.Warn("login of inactive account", slog.String("status", string(user.Status)))
+		return Response{}, &Error{
+			Status:    samlproto.StatusResponder,
+			SubStatus: samlproto.StatusAuthnFailed,
+		}
+	}
+
+	nameID := user.Email
+	if req.NameIDFormat == samlproto.NameIDFormatPersistent {
+		nameID = strconv.FormatInt(user.ID, 10)
+	}
+
+	attributes, err := s.attributes(ctx, req.ServiceProvider, user)
+	if err != nil {
+		return Response{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	authnContext := samlproto.AuthnContextUnspecified
+	if slices.Contains(session.AMR, models.AMRPassword) {
+		authnContext = samlproto.AuthnContextPasswordProtectedTransport
+	}
+
+	now := time.Now()
+
+	data, err := samlproto.NewResponse(samlproto.Assertion{
+		Issuer:       s.entityID,
+		Audience:     req.ServiceProvider.EntityID,
+		Destination:  req.ACSURL,
+		InResponseTo: req.ID,
+		NameID:       nameID,
+		NameIDFormat: req.NameIDFormat,
+		SessionIndex: session.ID,
+		AuthnInstant: session.AuthTime,
+		AuthnContext: authnContext,
+		Attributes:   attributes,
+		IssueInstant: now,
+		NotOnOrAfter: now.Add(s.assertionTTL),
+	}, s.signingKey, s.certificate)
+	if err != nil {
+		return Response{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	details := map[string]string{
+		"entity_id":  req.ServiceProvider.EntityID,
+		"session_id": session.ID,
+	}
+	if req.ID == "" {
+		details["idp_initiated"] = "true"
+	}
+
+	if err := s.auditLogger.SaveAuditEvent(ctx, models.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   user.ID,
+		Action:    models.AuditSAMLLogin,
+		Details:   details,
+		CreatedAt: now,
+	}); err != nil {
+		log.Error("failed to save audit event", slog.String("error", err.Error()))
+	}
+
+	log.Info("user signed in to service provider")
+
+	return Response{
+		ACSURL:       req.ACSURL,
+		SAMLResponse: samlproto.EncodePost(data),
+	}, nil
+}
+
+// Fail answers req with the failure samlErr.
+func (s *SAML) Fail(req Request, samlErr *Error) (Response, error) {
+	const operation = "saml.Fail"
+
+	data, err := samlproto.NewErrorResponse(
+		s.entityID,
+		req.ACSURL,
+		req.ID,
+		samlErr.Status,
+		samlErr.SubStatus,
+		time.Now(),
+	)
+	if err != nil {
+		return Response{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return Response{
+		ACSURL:       req.ACSURL,
+		SAMLResponse: samlproto.EncodePost(data),
+	}, nil
+}
+
+// attributes fills the attributes sp is configured with from the fields of
+// user. Fields without a value are left out.
+func (s *SAML) attributes(
+	ctx context.Context,
+	sp models.SAMLServiceProvider,
+	user models.User,
+) ([]samlproto.Attribute, error) {
+	names := make([]string, 0, len(sp.Attributes))
+	for name := range sp.Attributes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	attributes := make([]samlproto.Attribute, 0, len(names))
+	for _, name := range names {
+		var values []string
+
+		switch sp.Attributes[name] {
+		case models.UserFieldID:
+			values = []string{strconv.FormatInt(user.ID, 10)}
+		case models.UserFieldEmail:
+			values = []string{user.Email}
+		case models.UserFieldRoles:
+			isAdmin, err := s.userProvider.IsAdmin(ctx, user.ID)
+			if err != nil {
+				return nil, err
+			}
+			if isAdmin {
+				values = []string{models.RoleAdmin}
+			}
+		}
+
+		if len(values) > 0 {
+			attributes = append(attributes, samlproto.Attribute{Name: name, Values: values})
+		}
+	}
+
+	return attributes, nil
+}
+
+func (s *SAML) serviceProvider(ctx context.Context, entityID string) (models.SAMLServiceProvider, error) {
+	sp, err := s.providers.SAMLServiceProvider(ctx, entityID)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceProviderNotFound) {
+			return models.SAMLServiceProvider{}, ErrUnknownServiceProvider
+		}
+		return models.SAMLServiceProvider{}, err
+	}
+
+	return sp, nil
+}
+
+// pickACSURL returns the assertion consumer service a request asks to be
+// answered at, which must be registered for sp.
+func pickACSURL(sp models.SAMLServiceProvider, req samlproto.AuthnRequest) (string, error) {
+	switch {
+	case req.ACSURL != "":
+		if !slices.Contains(sp.ACSURLs, req.ACSURL) {
+			return "", ErrInvalidACSURL
+		}
+		return req.ACSURL, nil
+	case req.ACSIndex != nil:
+		if *req.ACSIndex >= len(sp.ACSURLs) {
+			return "", ErrInvalidACSURL
+		}
+		return sp.ACSURLs[*req.ACSIndex], nil
+	default:
+		return sp.ACSURLs[0], nil
+	}
+}
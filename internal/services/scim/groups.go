@@ -0,0 +1,252 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/random"
+	scimproto "github.com/VariableSan/gia-sso/pkg/scim"
+)
+
+// Groups answers a query of groups.
+func (s *SCIM) Groups(ctx context.Context, query Query) (scimproto.ListResponse, error) {
+	const operation = "scim.Groups"
+
+	groups, err := s.groups.SCIMGroups(ctx)
+	if err != nil {
+		return scimproto.ListResponse{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	resources := make([]map[string]any, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, s.groupResource(group))
+	}
+
+	res, err := s.list(resources, query)
+	if err != nil {
+		return scimproto.ListResponse{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return res, nil
+}
+
+func (s *SCIM) Group(ctx context.Context, id string, projection Projection) (map[string]any, error) {
+	const operation = "scim.Group"
+
+	group, err := s.group(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return project(s.groupResource(group), projection), nil
+}
+
+// CreateGroup creates a group. Groups only mirror the directory of the
+// client and grant no permissions.
+func (s *SCIM) CreateGroup(ctx context.Context, resource map[string]any) (map[string]any, error) {
+	const operation = "scim.CreateGroup"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+	)
+
+	var input groupInput
+	if err := fromObject(resource, &input); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	id, err := random.Token(16)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+	group := models.SCIMGroup{
+		ID:        id,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.readGroup(ctx, &group, input); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := s.groups.SaveSCIMGroup(ctx, group); err != nil {
+		if errors.Is(err, storage.ErrGroupExists) {
+			log.Warn("group already exists")
+			return nil, fmt.Errorf("%s: %w", operation, scimproto.Conflict("a group with this displayName already exists"))
+		}
+
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	log.Info("group created", slog.String("group_id", group.ID))
+
+	created, err := s.groups.SCIMGroup(ctx, group.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return s.groupResource(created), nil
+}
+
+// ReplaceGroup replaces the attributes and members of a group.
+func (s *SCIM) ReplaceGroup(ctx context.Context, id string, resource map[string]any) (map[string]any, error) {
+	const operation = "scim.ReplaceGroup"
+
+	group, err := s.group(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	updated, err := s.updateGroup(ctx, group, resource)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return updated, nil
+}
+
+// PatchGroup applies PATCH operations to a group, which is how most
+// clients add and remove members.
+func (s *SCIM) PatchGroup(
+	ctx context.Context,
+	id string,
+	operations []scimproto.PatchOperation,
+) (map[string]any, error) {
+	const operation = "scim.PatchGroup"
+
+	group, err := s.group(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	resource := s.groupResource(group)
+	if err := scimproto.Patch(resource, operations); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	updated, err := s.updateGroup(ctx, group, resource)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return updated, nil
+}
+
+// DeleteGroup deletes a group. Its members are left as they are.
+func (s *SCIM) DeleteGroup(ctx context.Context, id string) error {
+	const operation = "scim.DeleteGroup"
+
+	if err := s.groups.DeleteSCIMGroup(ctx, id); err != nil {
+		if errors.Is(err, storage.ErrGroupNotFound) {
+			return fmt.Errorf("%s: %w", operation, scimproto.NotFound("group not found"))
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	s.log.Info(
+		"group deleted",
+		slog.String("operation", operation),
+		slog.String("group_id", id),
+	)
+
+	return nil
+}
+
+func (s *SCIM) updateGroup(
+	ctx context.Context,
+	group models.SCIMGroup,
+	resource map[string]any,
+) (map[string]any, error) {
+	var input groupInput
+	if err := fromObject(resource, &input); err != nil {
+		return nil, err
+	}
+
+	if err := s.readGroup(ctx, &group, input); err != nil {
+		return nil, err
+	}
+	group.UpdatedAt = time.Now()
+
+	if err := s.groups.UpdateSCIMGroup(ctx, group); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrGroupExists):
+			return nil, scimproto.Conflict("a group with this displayName already exists")
+		case errors.Is(err, storage.ErrGroupNotFound):
+			return nil, scimproto.NotFound("group not found")
+		}
+
+		return nil, err
+	}
+
+	s.log.Info(
+		"group updated",
+		slog.String("operation", "scim.updateGroup"),
+		slog.String("group_id", group.ID),
+		slog.Int("members", len(group.Members)),
+	)
+
+	updated, err := s.groups.SCIMGroup(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.groupResource(updated), nil
+}
+
+// readGroup sets the attributes and members of group from input. Members
+// must be users that exist.
+func (s *SCIM) readGroup(ctx context.Context, group *models.SCIMGroup, input groupInput) error {
+	displayName := strings.TrimSpace(input.DisplayName)
+	if displayName == "" {
+		return scimproto.BadRequest(scimproto.ErrorInvalidValue, "displayName is required")
+	}
+
+	members := make([]int64, 0, len(input.Members))
+	for _, member := range input.Members {
+		user, err := s.user(ctx, member.Value)
+		if err != nil {
+			var scimErr *scimproto.Error
+			if errors.As(err, &scimErr) {
+				return scimproto.BadRequest(
+					scimproto.ErrorInvalidValue,
+					fmt.Sprintf("member %q is not a user", member.Value),
+				)
+			}
+
+			return err
+		}
+
+		if !slices.Contains(members, user.ID) {
+			members = append(members, user.ID)
+		}
+	}
+
+	group.DisplayName = displayName
+	group.ExternalID = input.ExternalID
+	group.Members = members
+
+	return nil
+}
+
+// group returns the group with the SCIM id id.
+func (s *SCIM) group(ctx context.Context, id string) (models.SCIMGroup, error) {
+	group, err := s.groups.SCIMGroup(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrGroupNotFound) {
+			return models.SCIMGroup{}, scimproto.NotFound("group not found")
+		}
+
+		return models.SCIMGroup{}, err
+	}
+
+	return group, nil
+}
@@ -0,0 +1,208 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	scimproto "github.com/VariableSan/gia-sso/pkg/scim"
+)
+
+// userResource is a user as SCIM clients see it. The userName of users is
+// their email address.
+type userResource struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Active      bool         `json:"active"`
+	Emails      []multiValue `json:"emails"`
+	Groups      []multiValue `json:"groups,omitempty"`
+	Meta        meta         `json:"meta"`
+}
+
+type name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type groupResource struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []multiValue `json:"members"`
+	Meta        meta         `json:"meta"`
+}
+
+type multiValue struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location"`
+}
+
+// userInput is what SCIM clients send of a user. Other attributes, such
+// as passwords, are ignored.
+type userInput struct {
+	ExternalID  string    `json:"externalId"`
+	UserName    string    `json:"userName"`
+	Name        name      `json:"name"`
+	DisplayName string    `json:"displayName"`
+	Active      *flexBool `json:"active"`
+}
+
+type groupInput struct {
+	ExternalID  string `json:"externalId"`
+	DisplayName string `json:"displayName"`
+	Members     []struct {
+		Value string `json:"value"`
+	} `json:"members"`
+}
+
+// flexBool is a boolean some clients, Azure AD among them, send as the
+// string "True" or "False".
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		value, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*b = flexBool(value)
+		return nil
+	}
+
+	var value bool
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*b = flexBool(value)
+
+	return nil
+}
+
+func (s *SCIM) userResource(user models.SCIMUser) map[string]any {
+	id := strconv.FormatInt(user.ID, 10)
+
+	res := userResource{
+		Schemas:     []string{scimproto.SchemaUser},
+		ID:          id,
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		DisplayName: user.DisplayName,
+		Active:      user.Status == models.UserStatusActive,
+		Emails: []multiValue{{
+			Value:   user.Email,
+			Type:    "work",
+			Primary: true,
+		}},
+		Meta: meta{
+			ResourceType: "User",
+			Created:      formatTime(user.CreatedAt),
+			LastModified: formatTime(user.UpdatedAt),
+			Location:     s.baseURL + "/Users/" + id,
+		},
+	}
+
+	if user.GivenName != "" || user.FamilyName != "" {
+		res.Name = &name{
+			Formatted:  strings.TrimSpace(user.GivenName + " " + user.FamilyName),
+			GivenName:  user.GivenName,
+			FamilyName: user.FamilyName,
+		}
+	}
+
+	for _, group := range user.Groups {
+		res.Groups = append(res.Groups, multiValue{
+			Value:   group.ID,
+			Ref:     s.baseURL + "/Groups/" + group.ID,
+			Display: group.DisplayName,
+			Type:    "direct",
+		})
+	}
+
+	return toObject(res)
+}
+
+func (s *SCIM) groupResource(group models.SCIMGroup) map[string]any {
+	res := groupResource{
+		Schemas:     []string{scimproto.SchemaGroup},
+		ID:          group.ID,
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Members:     []multiValue{},
+		Meta: meta{
+			ResourceType: "Group",
+			Created:      formatTime(group.CreatedAt),
+			LastModified: formatTime(group.UpdatedAt),
+			Location:     s.baseURL + "/Groups/" + group.ID,
+		},
+	}
+
+	for _, userID := range group.Members {
+		id := strconv.FormatInt(userID, 10)
+		res.Members = append(res.Members, multiValue{
+			Value: id,
+			Ref:   s.baseURL + "/Users/" + id,
+			Type:  "User",
+		})
+	}
+
+	return toObject(res)
+}
+
+// toObject turns a resource into the decoded JSON object filters and
+// PATCH operations work on. Resources are plain structs of strings, so
+// encoding them cannot fail.
+func toObject(resource any) map[string]any {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		panic(err)
+	}
+
+	var object map[string]any
+	if err := json.Unmarshal(data, &object); err != nil {
+		panic(err)
+	}
+
+	return object
+}
+
+// fromObject reads a resource sent by a client into dest. Attribute names
+// are matched case-insensitively, as SCIM requires.
+func fromObject(object map[string]any, dest any) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return scimproto.BadRequest(scimproto.ErrorInvalidSyntax, err.Error())
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return scimproto.BadRequest(scimproto.ErrorInvalidValue, err.Error())
+	}
+
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,189 @@
+// Package scim provisions users and groups on behalf of SCIM 2.0 clients,
+// such as HR systems that create accounts for joiners and disable those of
+// leavers.
+package scim
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/pkg/random"
+	scimproto "github.com/VariableSan/gia-sso/pkg/scim"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+// ErrInvalidToken is returned for requests without the bearer token SCIM
+// clients are configured with, and for all requests while there is none.
+var ErrInvalidToken = errors.New("invalid scim token")
+
+// deprovisionReason is the status reason of accounts disabled or deleted
+// by SCIM clients.
+const deprovisionReason = "deprovisioned by scim client"
+
+type SCIM struct {
+	log             *slog.Logger
+	users           UserStorage
+	groups          GroupStorage
+	sessionProvider SessionProvider
+	auditLogger     AuditLogger
+	tokenHash       []byte
+	baseURL         string
+	maxResults      int
+	emailNormalizer validator.EmailNormalizer
+}
+
+// Config holds the settings of the SCIM service provider.
+type Config struct {
+	// Token is the bearer token SCIM clients authenticate with. Empty
+	// rejects all requests.
+	Token string
+	// BaseURL is the URL the SCIM endpoints are served at, which resource
+	// locations are built from.
+	BaseURL string
+	// MaxResults bounds the number of resources returned by one query.
+	MaxResults      int
+	EmailNormalizer validator.EmailNormalizer
+}
+
+type UserStorage interface {
+	SCIMUsers(ctx context.Context) ([]models.SCIMUser, error)
+	SCIMUser(ctx context.Context, userID int64) (models.SCIMUser, error)
+	SaveSCIMUser(ctx context.Context, user models.SCIMUser, emailNormalized string) (int64, error)
+	UpdateSCIMUser(ctx context.Context, user models.SCIMUser, emailNormalized string) error
+	SetUserStatus(
+		ctx context.Context,
+		userID int64,
+		status models.UserStatus,
+		reason string,
+		changedAt time.Time,
+	) error
+}
+
+type GroupStorage interface {
+	SCIMGroups(ctx context.Context) ([]models.SCIMGroup, error)
+	SCIMGroup(ctx context.Context, groupID string) (models.SCIMGroup, error)
+	SaveSCIMGroup(ctx context.Context, group models.SCIMGroup) error
+	UpdateSCIMGroup(ctx context.Context, group models.SCIMGroup) error
+	DeleteSCIMGroup(ctx context.Context, groupID string) error
+}
+
+type SessionProvider interface {
+	RevokeUserSessions(
+		ctx context.Context,
+		userID int64,
+		exceptID string,
+		revokedAt time.Time,
+	) (int64, error)
+}
+
+type AuditLogger interface {
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+}
+
+type Storage interface {
+	UserStorage
+	GroupStorage
+	SessionProvider
+	AuditLogger
+}
+
+func New(log *slog.Logger, storage Storage, cfg Config) *SCIM {
+	s := &SCIM{
+		log:             log,
+		users:           storage,
+		groups:          storage,
+		sessionProvider: storage,
+		auditLogger:     storage,
+		baseURL:         cfg.BaseURL,
+		maxResults:      cfg.MaxResults,
+		emailNormalizer: cfg.EmailNormalizer,
+	}
+	if cfg.Token != "" {
+		s.tokenHash = random.Hash(cfg.Token)
+	}
+
+	return s
+}
+
+// Authenticate checks the bearer token of a SCIM client.
+func (s *SCIM) Authenticate(token string) error {
+	if s.tokenHash == nil || subtle.ConstantTimeCompare(random.Hash(token), s.tokenHash) != 1 {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+// Query selects resources and the attributes returned of them.
+type Query struct {
+	// Filter is a filter of RFC 7644 section 3.4.2.2, empty for all
+	// resources.
+	Filter string
+	// StartIndex is the 1-based index of the first resource returned and
+	// Count the most resources returned, nil for as many as allowed.
+	StartIndex int
+	Count      *int
+	Projection
+}
+
+// Projection names the attributes returned of resources, as in the
+// attributes and excludedAttributes parameters.
+type Projection struct {
+	Attributes         []string
+	ExcludedAttributes []string
+}
+
+// list answers a query of resources.
+func (s *SCIM) list(resources []map[string]any, query Query) (scimproto.ListResponse, error) {
+	if query.Filter != "" {
+		filter, err := scimproto.ParseFilter(query.Filter)
+		if err != nil {
+			return scimproto.ListResponse{}, err
+		}
+
+		matching := resources[:0]
+		for _, resource := range resources {
+			if filter.Match(resource) {
+				matching = append(matching, resource)
+			}
+		}
+		resources = matching
+	}
+
+	count := s.maxResults
+	if query.Count != nil {
+		count = min(*query.Count, s.maxResults)
+	}
+
+	res := scimproto.NewListResponse(resources, query.StartIndex, count)
+	for i, resource := range res.Resources {
+		res.Resources[i] = project(resource, query.Projection)
+	}
+
+	return res, nil
+}
+
+func project(resource map[string]any, projection Projection) map[string]any {
+	return scimproto.Project(resource, projection.Attributes, projection.ExcludedAttributes)
+}
+
+func (s *SCIM) audit(ctx context.Context, event models.AuditEvent) {
+	event.CreatedAt = time.Now()
+	if event.Details == nil {
+		event.Details = map[string]string{}
+	}
+	event.Details["source"] = "scim"
+
+	if err := s.auditLogger.SaveAuditEvent(ctx, event); err != nil {
+		s.log.Error(
+			"failed to save audit event",
+			slog.String("action", event.Action),
+			slog.Int64("user_id", event.UserID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
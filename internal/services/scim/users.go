@@ -0,0 +1,310 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	scimproto "github.com/VariableSan/gia-sso/pkg/scim"
+)
+
+// Users answers a query of users.
+func (s *SCIM) Users(ctx context.Context, query Query) (scimproto.ListResponse, error) {
+	const operation = "scim.Users"
+
+	users, err := s.users.SCIMUsers(ctx)
+	if err != nil {
+		return scimproto.ListResponse{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	resources := make([]map[string]any, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, s.userResource(user))
+	}
+
+	res, err := s.list(resources, query)
+	if err != nil {
+		return scimproto.ListResponse{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return res, nil
+}
+
+func (s *SCIM) User(ctx context.Context, id string, projection Projection) (map[string]any, error) {
+	const operation = "scim.User"
+
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return project(s.userResource(user), projection), nil
+}
+
+// CreateUser provisions a user. The account has no password, so users sign
+// in through an upstream identity provider or the directory.
+func (s *SCIM) CreateUser(ctx context.Context, resource map[string]any) (map[string]any, error) {
+	const operation = "scim.CreateUser"
+
+	log := s.log.With(
+		slog.String("operation", operation),
+	)
+
+	var input userInput
+	if err := fromObject(resource, &input); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	email, emailNormalized, err := s.userName(input)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	now := time.Now()
+	user := models.SCIMUser{
+		User: models.User{
+			Email:  email,
+			Status: models.UserStatusActive,
+		},
+		ExternalID:  input.ExternalID,
+		GivenName:   input.Name.GivenName,
+		FamilyName:  input.Name.FamilyName,
+		DisplayName: input.DisplayName,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if input.Active != nil && !*input.Active {
+		user.Status = models.UserStatusDisabled
+		user.StatusReason = deprovisionReason
+	}
+
+	id, err := s.users.SaveSCIMUser(ctx, user, emailNormalized)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			log.Warn("user already exists")
+			return nil, fmt.Errorf("%s: %w", operation, scimproto.Conflict("a user with this userName already exists"))
+		}
+
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	s.audit(ctx, models.AuditEvent{
+		UserID: id,
+		Action: models.AuditUserRegistered,
+	})
+
+	log.Info("user provisioned", slog.Int64("user_id", id))
+
+	created, err := s.users.SCIMUser(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return s.userResource(created), nil
+}
+
+// ReplaceUser replaces the attributes of a user. Setting active to false
+// disables the account and revokes its sessions; setting it back to true
+// re-enables it.
+func (s *SCIM) ReplaceUser(ctx context.Context, id string, resource map[string]any) (map[string]any, error) {
+	const operation = "scim.ReplaceUser"
+
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	updated, err := s.updateUser(ctx, user, resource)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return updated, nil
+}
+
+// PatchUser applies PATCH operations to a user, with the same effects as
+// replacing the user with the result.
+func (s *SCIM) PatchUser(
+	ctx context.Context,
+	id string,
+	operations []scimproto.PatchOperation,
+) (map[string]any, error) {
+	const operation = "scim.PatchUser"
+
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	resource := s.userResource(user)
+	if err := scimproto.Patch(resource, operations); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	updated, err := s.updateUser(ctx, user, resource)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return updated, nil
+}
+
+// DeleteUser deprovisions a user by deleting the account, which revokes
+// its sessions. The account can still be restored by an admin until the
+// deletion grace period runs out.
+func (s *SCIM) DeleteUser(ctx context.Context, id string) error {
+	const operation = "scim.DeleteUser"
+
+	user, err := s.user(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := s.changeStatus(ctx, user.ID, models.UserStatusDeleted); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	s.log.Info(
+		"user deprovisioned",
+		slog.String("operation", operation),
+		slog.Int64("user_id", user.ID),
+	)
+
+	return nil
+}
+
+func (s *SCIM) updateUser(
+	ctx context.Context,
+	user models.SCIMUser,
+	resource map[string]any,
+) (map[string]any, error) {
+	var input userInput
+	if err := fromObject(resource, &input); err != nil {
+		return nil, err
+	}
+
+	email, emailNormalized, err := s.userName(input)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	user.UpdatedAt = now
+	user.Email = email
+	user.ExternalID = input.ExternalID
+	user.GivenName = input.Name.GivenName
+	user.FamilyName = input.Name.FamilyName
+	user.DisplayName = input.DisplayName
+
+	if err := s.users.UpdateSCIMUser(ctx, user, emailNormalized); err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			return nil, scimproto.Conflict("a user with this userName already exists")
+		}
+
+		return nil, err
+	}
+
+	active := input.Active == nil || bool(*input.Active)
+	switch {
+	case !active && user.Status != models.UserStatusDisabled:
+		err = s.changeStatus(ctx, user.ID, models.UserStatusDisabled)
+	case active && user.Status == models.UserStatusDisabled && user.StatusReason == deprovisionReason:
+		// SCIM clients only undo their own deprovisioning. Accounts an
+		// admin disabled or locked stay so.
+		err = s.changeStatus(ctx, user.ID, models.UserStatusActive)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.users.SCIMUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userResource(updated), nil
+}
+
+// changeStatus moves an account to status, revoking its sessions unless
+// it becomes active.
+func (s *SCIM) changeStatus(ctx context.Context, userID int64, status models.UserStatus) error {
+	reason := deprovisionReason
+	if status == models.UserStatusActive {
+		reason = "reprovisioned by scim client"
+	}
+
+	now := time.Now()
+	if err := s.users.SetUserStatus(ctx, userID, status, reason, now); err != nil {
+		return err
+	}
+
+	if status != models.UserStatusActive {
+		if _, err := s.sessionProvider.RevokeUserSessions(ctx, userID, "", now); err != nil {
+			return err
+		}
+	}
+
+	action := models.AuditAccountStatusChanged
+	if status == models.UserStatusDeleted {
+		action = models.AuditAccountDeleted
+	}
+
+	s.audit(ctx, models.AuditEvent{
+		UserID:  userID,
+		Action:  action,
+		Details: map[string]string{"status": string(status), "reason": reason},
+	})
+
+	s.log.Info(
+		"account status changed",
+		slog.String("operation", "scim.changeStatus"),
+		slog.Int64("user_id", userID),
+		slog.String("status", string(status)),
+	)
+
+	return nil
+}
+
+// user returns the user with the SCIM id id.
+func (s *SCIM) user(ctx context.Context, id string) (models.SCIMUser, error) {
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return models.SCIMUser{}, scimproto.NotFound("user not found")
+	}
+
+	user, err := s.users.SCIMUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.SCIMUser{}, scimproto.NotFound("user not found")
+		}
+
+		return models.SCIMUser{}, err
+	}
+
+	return user, nil
+}
+
+// userName returns the email address a user is known by, which is their
+// userName, and its normalized form.
+func (s *SCIM) userName(input userInput) (string, string, error) {
+	email := strings.TrimSpace(input.UserName)
+	if email == "" {
+		return "", "", scimproto.BadRequest(scimproto.ErrorInvalidValue, "userName is required")
+	}
+
+	emailNormalized, err := s.emailNormalizer.Normalize(email)
+	if err != nil {
+		return "", "", scimproto.BadRequest(scimproto.ErrorInvalidValue, "userName must be an email address")
+	}
+
+	return email, emailNormalized, nil
+}
@@ -0,0 +1,139 @@
+// Package sms sends the text messages of gia-sso, such as phone
+// verification codes and one-time codes used as a second factor.
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+)
+
+// LogSender writes messages to the log instead of sending them. It is meant
+// for local development, where codes are read from the log.
+type LogSender struct {
+	log *slog.Logger
+}
+
+func NewLogSender(log *slog.Logger) *LogSender {
+	return &LogSender{log: log}
+}
+
+func (s *LogSender) Send(_ context.Context, msg models.SMSMessage) error {
+	s.log.Info(
+		"sms",
+		slog.String("operation", "sms.LogSender.Send"),
+		slog.String("to", msg.To),
+		slog.String("body", msg.Body),
+	)
+
+	return nil
+}
+
+// FileSender appends messages to a file as JSON lines, so that end-to-end
+// tests can read the codes sent.
+type FileSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (s *FileSender) Send(_ context.Context, msg models.SMSMessage) error {
+	const operation = "sms.FileSender.Send"
+
+	line, err := json.Marshal(map[string]any{
+		"to":      msg.To,
+		"body":    msg.Body,
+		"sent_at": time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// HTTPSender sends messages through an SMS gateway that accepts a JSON
+// POST of {"from", "to", "body"}. Gateways with other APIs are usually
+// put behind a small adapter speaking this format.
+type HTTPSender struct {
+	cfg    HTTPConfig
+	client *http.Client
+}
+
+// HTTPConfig holds the settings of the SMS gateway.
+type HTTPConfig struct {
+	// URL is the endpoint messages are posted to.
+	URL string
+	// AuthToken, when set, is sent as a bearer token.
+	AuthToken string
+	// From is the sender id or number, if the gateway needs one.
+	From    string
+	Timeout time.Duration
+}
+
+func NewHTTPSender(cfg HTTPConfig) *HTTPSender {
+	return &HTTPSender{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (s *HTTPSender) Send(ctx context.Context, msg models.SMSMessage) error {
+	const operation = "sms.HTTPSender.Send"
+
+	body, err := json.Marshal(map[string]string{
+		"from": s.cfg.From,
+		"to":   msg.To,
+		"body": msg.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.AuthToken)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: gateway returned %s: %s", operation, resp.Status, bytes.TrimSpace(detail))
+	}
+
+	return nil
+}
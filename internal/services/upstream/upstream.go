@@ -0,0 +1,560 @@
+// Package upstream lets users sign in with an account at an upstream OpenID
+// Connect provider, such as their company's identity provider, instead of a
+// gia-sso password.
+package upstream
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	authservice "github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+// maxResponseBody bounds the documents read from providers.
+const maxResponseBody = 1 << 20
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	// ErrInvalidState is returned for callbacks that do not belong to a
+	// login in progress, or whose login has expired.
+	ErrInvalidState = errors.New("invalid or expired login state")
+	// ErrProvider is returned when the provider rejects the login or
+	// answers with something that cannot be trusted.
+	ErrProvider = errors.New("identity provider login failed")
+)
+
+type Upstream struct {
+	log         *slog.Logger
+	logins      LoginStorage
+	accounts    Accounts
+	providers   map[string]*provider
+	order       []string
+	httpClient  *http.Client
+	callbackURL string
+	linkURL     string
+	loginTTL    time.Duration
+}
+
+// Config holds the settings of the upstream login service.
+type Config struct {
+	// CallbackURL is the redirect URI registered at every provider.
+	CallbackURL string
+	// LinkURL is the page that sends signed in users to a provider to link
+	// their identity there.
+	LinkURL   string
+	Providers []ProviderConfig
+	// Timeout bounds each request to a provider.
+	Timeout time.Duration
+	// LoginTTL is how long users have to log in at the provider.
+	LoginTTL time.Duration
+}
+
+// ProviderConfig describes an upstream OpenID provider and the client
+// gia-sso is registered as there.
+type ProviderConfig struct {
+	// ID names the provider in URLs and linked identities; it must not
+	// change once users have logged in with it.
+	ID string
+	// Name is shown on the login page.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Scopes are requested in addition to openid.
+	Scopes []string
+}
+
+// Provider is an upstream provider users can pick on the login page.
+type Provider struct {
+	ID   string
+	Name string
+}
+
+// Result is the outcome of a login at a provider.
+type Result struct {
+	// Tokens are those of the browser session the login opened, and
+	// ReturnTo is where the user continues.
+	Tokens   models.TokenPair
+	ReturnTo string
+	// Linked is set instead when the login linked the identity to the
+	// account of a signed in user.
+	Linked   bool
+	Provider Provider
+}
+
+type LoginStorage interface {
+	SaveUpstreamLogin(ctx context.Context, stateHash []byte, login models.UpstreamLogin) error
+	UpstreamLogin(ctx context.Context, stateHash []byte) (models.UpstreamLogin, error)
+	UseUpstreamLogin(ctx context.Context, stateHash []byte) (models.UpstreamLogin, error)
+}
+
+// Accounts signs in or links the users providers vouch for. It is
+// implemented by the auth service.
+type Accounts interface {
+	FederatedLogin(
+		ctx context.Context,
+		identity authservice.FederatedIdentity,
+		client models.ClientInfo,
+	) (models.TokenPair, error)
+	LinkIdentity(
+		ctx context.Context,
+		userID int64,
+		identity authservice.FederatedIdentity,
+	) error
+}
+
+type provider struct {
+	ProviderConfig
+
+	// mu guards the metadata and keys, which are fetched on first use.
+	mu       sync.Mutex
+	metadata *metadata
+	jwks     string
+}
+
+// metadata is the part of a provider's discovery document gia-sso uses.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func New(
+	log *slog.Logger,
+	logins LoginStorage,
+	accounts Accounts,
+	cfg Config,
+) *Upstream {
+	u := &Upstream{
+		log:         log,
+		logins:      logins,
+		accounts:    accounts,
+		providers:   make(map[string]*provider, len(cfg.Providers)),
+		httpClient:  &http.Client{Timeout: cfg.Timeout},
+		callbackURL: cfg.CallbackURL,
+		linkURL:     cfg.LinkURL,
+		loginTTL:    cfg.LoginTTL,
+	}
+
+	for _, p := range cfg.Providers {
+		u.providers[p.ID] = &provider{ProviderConfig: p}
+		u.order = append(u.order, p.ID)
+	}
+
+	return u
+}
+
+// Providers returns the configured providers in configuration order.
+func (u *Upstream) Providers() []Provider {
+	providers := make([]Provider, 0, len(u.order))
+	for _, id := range u.order {
+		providers = append(providers, Provider{
+			ID:   id,
+			Name: u.providers[id].Name,
+		})
+	}
+
+	return providers
+}
+
+// StartLogin begins a login at a provider and returns the URL to send the
+// user to, along with the state the callback must come back with. Once
+// logged in, the user continues at returnTo, a local path.
+func (u *Upstream) StartLogin(
+	ctx context.Context,
+	providerID string,
+	returnTo string,
+) (string, string, error) {
+	const operation = "upstream.StartLogin"
+
+	authURL, state, err := u.start(ctx, providerID, models.UpstreamLogin{
+		ReturnTo: returnTo,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return authURL, state, nil
+}
+
+// StartLink begins linking the caller's identity at a provider to their
+// account. It returns the URL of the page the user opens in their browser
+// to log in at the provider. Anyone holding the URL can link their identity
+// until it expires, so it must only be handed to the caller.
+func (u *Upstream) StartLink(
+	ctx context.Context,
+	caller jwt.Claims,
+	providerID string,
+) (string, error) {
+	const operation = "upstream.StartLink"
+
+	// A new way to log in is only added by users themselves, not by someone
+	// acting on their behalf or by an OAuth client holding their token.
+	if caller.UserID == 0 || caller.Actor != nil || caller.ClientID != "" {
+		return "", fmt.Errorf("%s: %w", operation, authservice.ErrPermissionDenied)
+	}
+
+	_, state, err := u.start(ctx, providerID, models.UpstreamLogin{
+		LinkUserID: caller.UserID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	u.log.Info(
+		"identity linking started",
+		slog.String("operation", operation),
+		slog.String("provider", providerID),
+		slog.Int64("user_id", caller.UserID),
+	)
+
+	return u.linkURL + "?" + url.Values{"state": {state}}.Encode(), nil
+}
+
+// ResumeLink returns the URL to send the user to for the link started with
+// the given state.
+func (u *Upstream) ResumeLink(ctx context.Context, state string) (string, error) {
+	const operation = "upstream.ResumeLink"
+
+	login, err := u.logins.UpstreamLogin(ctx, random.Hash(state))
+	if err != nil {
+		if errors.Is(err, storage.ErrUpstreamLoginNotFound) {
+			return "", fmt.Errorf("%s: %w", operation, ErrInvalidState)
+		}
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if login.LinkUserID == 0 || !time.Now().Before(login.ExpiresAt) {
+		return "", fmt.Errorf("%s: %w", operation, ErrInvalidState)
+	}
+
+	p, ok := u.providers[login.Provider]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", operation, ErrUnknownProvider)
+	}
+
+	authURL, err := u.authURL(ctx, p, state, login)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return authURL, nil
+}
+
+// start stores login as a new login at the provider and returns the URL to
+// send the user to and its state.
+func (u *Upstream) start(
+	ctx context.Context,
+	providerID string,
+	login models.UpstreamLogin,
+) (string, string, error) {
+	p, ok := u.providers[providerID]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	// Discovery fails before a login is stored for an unreachable provider.
+	if _, err := u.metadata(ctx, p); err != nil {
+		return "", "", err
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := random.Token(32)
+		if err != nil {
+			return "", "", err
+		}
+		secrets[i] = secret
+	}
+	state := secrets[0]
+
+	login.Provider = p.ID
+	login.Nonce = secrets[1]
+	login.CodeVerifier = secrets[2]
+	login.ExpiresAt = time.Now().Add(u.loginTTL)
+
+	if err := u.logins.SaveUpstreamLogin(ctx, random.Hash(state), login); err != nil {
+		return "", "", err
+	}
+
+	authURL, err := u.authURL(ctx, p, state, login)
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// authURL returns the authorization request of login at p.
+func (u *Upstream) authURL(
+	ctx context.Context,
+	p *provider,
+	state string,
+	login models.UpstreamLogin,
+) (string, error) {
+	meta, err := u.metadata(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(login.CodeVerifier))
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", u.callbackURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, p.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", login.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// FinishLogin completes the login with the given state using the code the
+// provider sent the user back with. The user is either signed in to a new
+// browser session or, for logins started by StartLink, has the identity
+// linked to their account.
+func (u *Upstream) FinishLogin(
+	ctx context.Context,
+	state string,
+	code string,
+	client models.ClientInfo,
+) (Result, error) {
+	const operation = "upstream.FinishLogin"
+
+	log := u.log.With(
+		slog.String("operation", operation),
+	)
+
+	login, err := u.logins.UseUpstreamLogin(ctx, random.Hash(state))
+	if err != nil {
+		if errors.Is(err, storage.ErrUpstreamLoginNotFound) {
+			return Result{}, fmt.Errorf("%s: %w", operation, ErrInvalidState)
+		}
+		return Result{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if !time.Now().Before(login.ExpiresAt) {
+		return Result{}, fmt.Errorf("%s: %w", operation, ErrInvalidState)
+	}
+
+	p, ok := u.providers[login.Provider]
+	if !ok {
+		return Result{}, fmt.Errorf("%s: %w", operation, ErrUnknownProvider)
+	}
+
+	log = log.With(slog.String("provider", p.ID))
+
+	idToken, err := u.exchangeCode(ctx, p, code, login)
+	if err != nil {
+		log.Warn("failed to verify login at provider", slog.String("error", err.Error()))
+		return Result{}, fmt.Errorf("%s: %w: %w", operation, ErrProvider, err)
+	}
+
+	identity := authservice.FederatedIdentity{
+		Provider:      p.ID,
+		Subject:       idToken.Subject,
+		Email:         idToken.Email,
+		EmailVerified: idToken.EmailVerified,
+	}
+	result := Result{
+		Provider: Provider{ID: p.ID, Name: p.Name},
+	}
+
+	if login.LinkUserID != 0 {
+		if err := u.accounts.LinkIdentity(ctx, login.LinkUserID, identity); err != nil {
+			return Result{}, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		result.Linked = true
+		return result, nil
+	}
+
+	result.Tokens, err = u.accounts.FederatedLogin(ctx, identity, client)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	result.ReturnTo = login.ReturnTo
+
+	return result, nil
+}
+
+// exchangeCode redeems an authorization code at the provider's token
+// endpoint and verifies the ID token it returns.
+func (u *Upstream) exchangeCode(
+	ctx context.Context,
+	p *provider,
+	code string,
+	login models.UpstreamLogin,
+) (jwt.UpstreamIDToken, error) {
+	meta, err := u.metadata(ctx, p)
+	if err != nil {
+		return jwt.UpstreamIDToken{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {u.callbackURL},
+		"code_verifier": {login.CodeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return jwt.UpstreamIDToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// RFC 6749 section 2.3.1: credentials are form-encoded before being
+	// used for basic authentication.
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	var res struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := u.fetchJSON(req, &res)
+	if err != nil {
+		return jwt.UpstreamIDToken{}, err
+	}
+	if status != http.StatusOK {
+		return jwt.UpstreamIDToken{}, fmt.Errorf("token endpoint: %s %s", res.Error, res.ErrorDescription)
+	}
+	if res.IDToken == "" {
+		return jwt.UpstreamIDToken{}, errors.New("token endpoint returned no id token")
+	}
+
+	jwks, err := u.keys(ctx, p, false)
+	if err != nil {
+		return jwt.UpstreamIDToken{}, err
+	}
+
+	idToken, err := jwt.ParseUpstreamIDToken(res.IDToken, jwks, meta.Issuer, p.ClientID, login.Nonce)
+	if errors.Is(err, jwt.ErrUnknownKey) {
+		// The provider may have rotated its keys since they were fetched.
+		if jwks, err = u.keys(ctx, p, true); err != nil {
+			return jwt.UpstreamIDToken{}, err
+		}
+		idToken, err = jwt.ParseUpstreamIDToken(res.IDToken, jwks, meta.Issuer, p.ClientID, login.Nonce)
+	}
+	if err != nil {
+		return jwt.UpstreamIDToken{}, err
+	}
+
+	return idToken, nil
+}
+
+// metadata returns the discovery document of p, fetching it on first use.
+func (u *Upstream) metadata(ctx context.Context, p *provider) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration",
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta metadata
+	status, err := u.fetchJSON(req, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery: unexpected status %d", status)
+	}
+
+	// OpenID Connect Discovery section 4.3.
+	if meta.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", meta.Issuer, p.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery: missing endpoints")
+	}
+
+	p.metadata = &meta
+
+	return p.metadata, nil
+}
+
+// keys returns the JSON Web Key Set of p, fetching it on first use or when
+// refresh is set.
+func (u *Upstream) keys(ctx context.Context, p *provider, refresh bool) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.jwks != "" && !refresh {
+		return p.jwks, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.metadata.JWKSURI, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var jwks json.RawMessage
+	status, err := u.fetchJSON(req, &jwks)
+	if err != nil {
+		return "", fmt.Errorf("jwks: %w", err)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("jwks: unexpected status %d", status)
+	}
+
+	if err := jwt.ParseJWKS(string(jwks)); err != nil {
+		return "", fmt.Errorf("jwks: %w", err)
+	}
+
+	p.jwks = string(jwks)
+
+	return p.jwks, nil
+}
+
+// fetchJSON sends req and decodes the JSON body of the response into v. It
+// returns the status code of the response.
+func (u *Upstream) fetchJSON(req *http.Request, v any) (int, error) {
+	res, err := u.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponseBody)).Decode(v); err != nil {
+		return res.StatusCode, fmt.Errorf("malformed response with status %d: %w", res.StatusCode, err)
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,538 @@
+package upstream_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/services/auth"
+	"github.com/VariableSan/gia-sso/internal/services/upstream"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite/sqlitetest"
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/validator"
+)
+
+const (
+	providerID   = "corp"
+	clientID     = "gia-sso"
+	clientSecret = "provider secret"
+	callbackURL  = "https://sso.test/upstream/callback"
+)
+
+// mockProvider is an OpenID provider serving discovery, its keys and a
+// token endpoint that answers with the ID token the test set.
+type mockProvider struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// issuer is announced by discovery; it defaults to the server URL.
+	issuer string
+	// jwks replaces the key set of the provider when set.
+	jwks    string
+	key     *rsa.PrivateKey
+	keyID   string
+	idToken string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	p := &mockProvider{}
+	p.key, p.keyID = newKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		writeJSON(w, map[string]string{
+			"issuer":                 p.issuer,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.jwks != "" {
+			io.WriteString(w, p.jwks)
+			return
+		}
+
+		signingKey, err := jwt.NewSigningKey(p.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, signingKey.JWKS())
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		user, pass, _ := r.BasicAuth()
+		if user != url.QueryEscape(clientID) || pass != url.QueryEscape(clientSecret) ||
+			r.PostFormValue("grant_type") != "authorization_code" ||
+			r.PostFormValue("redirect_uri") != callbackURL ||
+			r.PostFormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_request"})
+			return
+		}
+
+		writeJSON(w, map[string]string{"id_token": p.idToken})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	p.issuer = p.URL
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// issue makes the token endpoint answer with claims signed by key.
+func (p *mockProvider) issue(t *testing.T, key *rsa.PrivateKey, keyID string, claims gojwt.MapClaims) {
+	t.Helper()
+
+	token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	p.idToken = signed
+	p.mu.Unlock()
+}
+
+// claims returns valid ID token claims for subject, answering the
+// authentication request with nonce.
+func (p *mockProvider) claims(subject string, email string, nonce string) gojwt.MapClaims {
+	now := time.Now()
+
+	return gojwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            clientID,
+		"sub":            subject,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          email,
+		"email_verified": true,
+	}
+}
+
+func newKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingKey, err := jwt.NewSigningKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, signingKey.ID
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type env struct {
+	provider *mockProvider
+	storage  *sqlite.Storage
+	auth     *auth.Auth
+	upstream *upstream.Upstream
+}
+
+func newEnv(t *testing.T) env {
+	t.Helper()
+
+	return newEnvWithRegistration(t, auth.RegistrationConfig{})
+}
+
+// newEnvWithRegistration is newEnv with registration deciding who gets an
+// account on their first login.
+func newEnvWithRegistration(t *testing.T, registration auth.RegistrationConfig) env {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	storage, err := sqlite.New(sqlitetest.Path(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := newMockProvider(t)
+
+	authService := auth.New(log, storage, auth.Config{
+		JWTSecret:       "secret",
+		TokenTTL:        time.Hour,
+		RefreshTokenTTL: time.Hour,
+		PasswordPolicy: auth.PasswordPolicy{
+			PasswordPolicy: validator.PasswordPolicy{MinLength: 8},
+		},
+		Registration: registration,
+	})
+
+	return env{
+		provider: provider,
+		storage:  storage,
+		auth:     authService,
+		upstream: upstream.New(log, storage, authService, upstream.Config{
+			CallbackURL: callbackURL,
+			LinkURL:     "https://sso.test/upstream/link",
+			Providers: []upstream.ProviderConfig{{
+				ID:           providerID,
+				Name:         "Corp",
+				Issuer:       provider.URL,
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+			}},
+			Timeout:  5 * time.Second,
+			LoginTTL: time.Minute,
+		}),
+	}
+}
+
+// start begins a login at the provider and returns its state and nonce.
+func (e env) start(t *testing.T) (string, string) {
+	t.Helper()
+
+	authURL, state, err := e.upstream.StartLogin(context.Background(), providerID, "/account")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	if query.Get("client_id") != clientID || query.Get("redirect_uri") != callbackURL ||
+		query.Get("state") != state || query.Get("code_challenge_method") != "S256" ||
+		query.Get("nonce") == "" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	return state, query.Get("nonce")
+}
+
+// login signs in at the provider with claims built from the nonce of the
+// login and returns the id of the gia-sso user it opened a session for.
+func (e env) login(t *testing.T, claims func(nonce string) gojwt.MapClaims) (int64, error) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	state, nonce := e.start(t)
+	e.provider.issue(t, e.provider.key, e.provider.keyID, claims(nonce))
+
+	result, err := e.upstream.FinishLogin(ctx, state, "code", models.ClientInfo{})
+	if err != nil {
+		return 0, err
+	}
+
+	if result.ReturnTo != "/account" {
+		t.Errorf("return to = %q, want /account", result.ReturnTo)
+	}
+
+	caller, err := e.auth.VerifyToken(ctx, result.Tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return caller.UserID, nil
+}
+
+func TestDiscovery(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(p *mockProvider)
+	}{
+		{
+			name:   "issuer mismatch",
+			change: func(p *mockProvider) { p.issuer = "https://evil.test" },
+		},
+		{
+			name:   "provider down",
+			change: func(p *mockProvider) { p.Close() },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEnv(t)
+			tt.change(e.provider)
+
+			if _, _, err := e.upstream.StartLogin(context.Background(), providerID, "/"); err == nil {
+				t.Fatal("login started with a provider that failed discovery")
+			}
+		})
+	}
+
+	t.Run("unknown provider", func(t *testing.T) {
+		e := newEnv(t)
+
+		_, _, err := e.upstream.StartLogin(context.Background(), "other", "/")
+		if !errors.Is(err, upstream.ErrUnknownProvider) {
+			t.Fatalf("err = %v, want ErrUnknownProvider", err)
+		}
+	})
+}
+
+func TestJWKSValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		jwks string
+	}{
+		{name: "not json", jwks: "<html>"},
+		{name: "no keys", jwks: `{"keys": "none"}`},
+		{name: "unsupported key", jwks: `{"keys": [{"kty": "oct", "kid": "k", "k": "c2VjcmV0"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEnv(t)
+			e.provider.jwks = tt.jwks
+
+			_, err := e.login(t, func(nonce string) gojwt.MapClaims {
+				return e.provider.claims("alice", "alice@example.com", nonce)
+			})
+			if !errors.Is(err, upstream.ErrProvider) {
+				t.Fatalf("err = %v, want ErrProvider", err)
+			}
+		})
+	}
+}
+
+func TestIDTokenValidation(t *testing.T) {
+	otherKey, otherKeyID := newKey(t)
+
+	tests := []struct {
+		name   string
+		change func(claims gojwt.MapClaims)
+		// foreignKey signs the token with a key the provider does not
+		// publish.
+		foreignKey bool
+	}{
+		{
+			name:   "wrong issuer",
+			change: func(claims gojwt.MapClaims) { claims["iss"] = "https://evil.test" },
+		},
+		{
+			name:   "wrong audience",
+			change: func(claims gojwt.MapClaims) { claims["aud"] = "someone-else" },
+		},
+		{
+			name: "several audiences without azp",
+			change: func(claims gojwt.MapClaims) {
+				claims["aud"] = []string{clientID, "someone-else"}
+			},
+		},
+		{
+			name:   "wrong nonce",
+			change: func(claims gojwt.MapClaims) { claims["nonce"] = "replayed" },
+		},
+		{
+			name:   "missing nonce",
+			change: func(claims gojwt.MapClaims) { delete(claims, "nonce") },
+		},
+		{
+			name: "expired",
+			change: func(claims gojwt.MapClaims) {
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			},
+		},
+		{
+			name:   "missing expiry",
+			change: func(claims gojwt.MapClaims) { delete(claims, "exp") },
+		},
+		{
+			name:   "missing subject",
+			change: func(claims gojwt.MapClaims) { delete(claims, "sub") },
+		},
+		{
+			name:       "unknown signing key",
+			change:     func(gojwt.MapClaims) {},
+			foreignKey: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEnv(t)
+			ctx := context.Background()
+
+			state, nonce := e.start(t)
+
+			claims := e.provider.claims("alice", "alice@example.com", nonce)
+			tt.change(claims)
+
+			key, keyID := e.provider.key, e.provider.keyID
+			if tt.foreignKey {
+				key, keyID = otherKey, otherKeyID
+			}
+			e.provider.issue(t, key, keyID, claims)
+
+			_, err := e.upstream.FinishLogin(ctx, state, "code", models.ClientInfo{})
+			if !errors.Is(err, upstream.ErrProvider) {
+				t.Fatalf("err = %v, want ErrProvider", err)
+			}
+
+			// The state is spent even when the login fails.
+			_, err = e.upstream.FinishLogin(ctx, state, "code", models.ClientInfo{})
+			if !errors.Is(err, upstream.ErrInvalidState) {
+				t.Fatalf("err = %v, want ErrInvalidState on reuse", err)
+			}
+		})
+	}
+}
+
+func TestLinkByVerifiedEmail(t *testing.T) {
+	e := newEnv(t)
+	ctx := context.Background()
+
+	userID, err := e.auth.RegisterNewUser(ctx, "alice@example.com", "correct horse battery", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A provider that does not vouch for the email cannot take over the
+	// account with the same address.
+	_, err = e.login(t, func(nonce string) gojwt.MapClaims {
+		claims := e.provider.claims("mallory", "alice@example.com", nonce)
+		claims["email_verified"] = false
+		return claims
+	})
+	if !errors.Is(err, auth.ErrEmailNotVerified) {
+		t.Fatalf("err = %v, want ErrEmailNotVerified", err)
+	}
+
+	got, err := e.login(t, func(nonce string) gojwt.MapClaims {
+		return e.provider.claims("alice", "Alice@Example.com", nonce)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != userID {
+		t.Fatalf("logged in as user %d, want the account with the same email %d", got, userID)
+	}
+
+	// Once linked the identity logs in by its subject, whatever email the
+	// provider reports.
+	got, err = e.login(t, func(nonce string) gojwt.MapClaims {
+		claims := e.provider.claims("alice", "alice@corp.example.com", nonce)
+		claims["email_verified"] = false
+		return claims
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != userID {
+		t.Fatalf("logged in as user %d, want the linked user %d", got, userID)
+	}
+
+	// Unknown identities with a verified email get an account of their own.
+	got, err = e.login(t, func(nonce string) gojwt.MapClaims {
+		return e.provider.claims("bob", "bob@example.com", nonce)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == 0 || got == userID {
+		t.Fatalf("logged in as user %d, want a new account", got)
+	}
+}
+
+func TestProvisioningFollowsRegistrationMode(t *testing.T) {
+	ctx := context.Background()
+
+	closed := newEnvWithRegistration(t, auth.RegistrationConfig{Mode: models.RegistrationClosed})
+	_, err := closed.login(t, func(nonce string) gojwt.MapClaims {
+		return closed.provider.claims("bob", "bob@example.com", nonce)
+	})
+	if !errors.Is(err, auth.ErrRegistrationClosed) {
+		t.Fatalf("closed: err = %v, want ErrRegistrationClosed", err)
+	}
+
+	domains, err := validator.NewEmailDomainPolicy([]string{"corp.example.com"}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restricted := newEnvWithRegistration(t, auth.RegistrationConfig{
+		Mode:    models.RegistrationDomainRestricted,
+		Domains: domains,
+	})
+	_, err = restricted.login(t, func(nonce string) gojwt.MapClaims {
+		return restricted.provider.claims("bob", "bob@example.com", nonce)
+	})
+	if !errors.Is(err, auth.ErrInvitationRequired) {
+		t.Fatalf("domain restricted: err = %v, want ErrInvitationRequired", err)
+	}
+	if _, err := restricted.login(t, func(nonce string) gojwt.MapClaims {
+		return restricted.provider.claims("carol", "carol@corp.example.com", nonce)
+	}); err != nil {
+		t.Fatalf("domain restricted: allowed domain: %v", err)
+	}
+
+	inviteOnly := newEnvWithRegistration(t, auth.RegistrationConfig{Mode: models.RegistrationInviteOnly})
+	_, err = inviteOnly.login(t, func(nonce string) gojwt.MapClaims {
+		return inviteOnly.provider.claims("bob", "bob@example.com", nonce)
+	})
+	if !errors.Is(err, auth.ErrInvitationRequired) {
+		t.Fatalf("invite only: err = %v, want ErrInvitationRequired", err)
+	}
+
+	adminID, err := inviteOnly.storage.SaveUser(ctx, "admin@example.com", "admin@example.com", []byte("hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	invitation := models.Invitation{
+		ID:        "invitation",
+		Email:     "bob@example.com",
+		InvitedBy: adminID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := inviteOnly.storage.SaveInvitation(ctx, invitation, "bob@example.com", []byte("code")); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, err := inviteOnly.login(t, func(nonce string) gojwt.MapClaims {
+		return inviteOnly.provider.claims("bob", "Bob@Example.com", nonce)
+	})
+	if err != nil {
+		t.Fatalf("invite only: invited address: %v", err)
+	}
+
+	accepted, err := inviteOnly.storage.AcceptedInvitation(ctx, userID)
+	if err != nil || accepted.ID != invitation.ID {
+		t.Fatalf("accepted invitation = %q, %v, want %q", accepted.ID, err, invitation.ID)
+	}
+}
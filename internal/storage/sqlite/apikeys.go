@@ -0,0 +1,173 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+const apiKeyColumns = "id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at, revoked_at"
+
+// SaveAPIKey stores a new API key by the hash of its secret.
+func (s *Storage) SaveAPIKey(ctx context.Context, key models.APIKey, keyHash []byte) error {
+	const operation = "storage.sqlite.SaveAPIKey"
+
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO api_keys(id, user_id, name, prefix, key_hash, scopes, created_at, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		keyHash,
+		strings.Join(key.Scopes, " "),
+		key.CreatedAt.UTC(),
+		nullTime(key.ExpiresAt),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// APIKey returns the API key with the given id.
+func (s *Storage) APIKey(ctx context.Context, keyID string) (models.APIKey, error) {
+	const operation = "storage.sqlite.APIKey"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", keyID)
+
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.APIKey{}, fmt.Errorf("%s: %w", operation, storage.ErrAPIKeyNotFound)
+		}
+		return models.APIKey{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return key, nil
+}
+
+// APIKeyByHash returns the API key whose secret hashes to keyHash.
+func (s *Storage) APIKeyByHash(ctx context.Context, keyHash []byte) (models.APIKey, error) {
+	const operation = "storage.sqlite.APIKeyByHash"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", keyHash)
+
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.APIKey{}, fmt.Errorf("%s: %w", operation, storage.ErrAPIKeyNotFound)
+		}
+		return models.APIKey{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return key, nil
+}
+
+// APIKeys returns the API keys of a user that are not revoked, including
+// expired ones.
+func (s *Storage) APIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	const operation = "storage.sqlite.APIKeys"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return keys, nil
+}
+
+// TouchAPIKey records that an API key was used.
+func (s *Storage) TouchAPIKey(ctx context.Context, keyID string, usedAt time.Time) error {
+	const operation = "storage.sqlite.TouchAPIKey"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", usedAt.UTC(), keyID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrAPIKeyNotFound)
+}
+
+// RevokeAPIKey revokes an API key that is not revoked yet.
+func (s *Storage) RevokeAPIKey(ctx context.Context, keyID string, revokedAt time.Time) error {
+	const operation = "storage.sqlite.RevokeAPIKey"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		revokedAt.UTC(),
+		keyID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrAPIKeyNotFound)
+}
+
+func scanAPIKey(row scanner) (models.APIKey, error) {
+	var (
+		key        models.APIKey
+		scopes     string
+		expiresAt  sql.NullTime
+		lastUsedAt sql.NullTime
+		revokedAt  sql.NullTime
+	)
+
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&key.CreatedAt,
+		&expiresAt,
+		&lastUsedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	key.ExpiresAt = expiresAt.Time
+	key.LastUsedAt = lastUsedAt.Time
+	key.RevokedAt = revokedAt.Time
+
+	return key, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
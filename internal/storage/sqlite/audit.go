@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+)
+
+func (s *Storage) SaveAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	const operation = "storage.sqlite.SaveAuditEvent"
+
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var actorID sql.NullInt64
+	if event.ActorID != 0 {
+		actorID = sql.NullInt64{Int64: event.ActorID, Valid: true}
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO audit_events(user_id, actor_id, action, ip, user_agent, details, created_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		event.UserID,
+		actorID,
+		event.Action,
+		event.IP,
+		event.UserAgent,
+		string(details),
+		event.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// AuditEvents returns the events that happened to a user or were caused by
+// them, oldest first.
+func (s *Storage) AuditEvents(ctx context.Context, userID int64) ([]models.AuditEvent, error) {
+	const operation = "storage.sqlite.AuditEvents"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, user_id, actor_id, action, ip, user_agent, details, created_at
+		FROM audit_events
+		WHERE user_id = ? OR actor_id = ?
+		ORDER BY id`,
+		userID,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var (
+			event   models.AuditEvent
+			actorID sql.NullInt64
+			details string
+		)
+
+		err := rows.Scan(
+			&event.ID,
+			&event.UserID,
+			&actorID,
+			&event.Action,
+			&event.IP,
+			&event.UserAgent,
+			&details,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		event.ActorID = actorID.Int64
+		if err := json.Unmarshal([]byte(details), &event.Details); err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,293 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+const clientColumns = `id, name, secret_hash, redirect_uris, token_endpoint_auth_method, grant_types, scopes, audience, jwks,
+	post_logout_redirect_uris, frontchannel_logout_uri, backchannel_logout_uri, access_token_ttl, refresh_token_ttl,
+	registration_token_hash, first_party, service_account_id, created_at, updated_at`
+
+// OAuthClients returns all registered clients ordered by id.
+func (s *Storage) OAuthClients(ctx context.Context) ([]models.OAuthClient, error) {
+	const operation = "storage.sqlite.OAuthClients"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+clientColumns+" FROM oauth_clients ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var clients []models.OAuthClient
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		clients = append(clients, client)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return clients, nil
+}
+
+func (s *Storage) SaveOAuthClient(ctx context.Context, client models.OAuthClient) error {
+	const operation = "storage.sqlite.SaveOAuthClient"
+
+	lists, err := clientLists(client)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO oauth_clients(id, name, secret_hash, redirect_uris, token_endpoint_auth_method, grant_types, scopes,
+		audience, jwks, post_logout_redirect_uris, frontchannel_logout_uri, backchannel_logout_uri, access_token_ttl,
+		refresh_token_ttl, registration_token_hash, first_party, service_account_id, created_at, updated_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		client.ID,
+		client.Name,
+		client.SecretHash,
+		lists[0],
+		client.TokenEndpointAuthMethod,
+		lists[1],
+		lists[2],
+		lists[3],
+		client.JWKS,
+		lists[4],
+		client.FrontchannelLogoutURI,
+		client.BackchannelLogoutURI,
+		int64(client.AccessTokenTTL.Seconds()),
+		int64(client.RefreshTokenTTL.Seconds()),
+		client.RegistrationTokenHash,
+		client.FirstParty,
+		client.ServiceAccountID,
+		client.CreatedAt.UTC(),
+		client.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return fmt.Errorf("%s: %w", operation, storage.ErrClientExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// UpdateOAuthClient replaces the metadata of a client. Its secret and
+// registration access token are left as they are.
+func (s *Storage) UpdateOAuthClient(ctx context.Context, client models.OAuthClient) error {
+	const operation = "storage.sqlite.UpdateOAuthClient"
+
+	lists, err := clientLists(client)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE oauth_clients SET name = ?, redirect_uris = ?, token_endpoint_auth_method = ?, grant_types = ?,
+		scopes = ?, audience = ?, jwks = ?, post_logout_redirect_uris = ?, frontchannel_logout_uri = ?,
+		backchannel_logout_uri = ?, access_token_ttl = ?, refresh_token_ttl = ?, first_party = ?, service_account_id = ?,
+		updated_at = ?
+		WHERE id = ?`,
+		client.Name,
+		lists[0],
+		client.TokenEndpointAuthMethod,
+		lists[1],
+		lists[2],
+		lists[3],
+		client.JWKS,
+		lists[4],
+		client.FrontchannelLogoutURI,
+		client.BackchannelLogoutURI,
+		int64(client.AccessTokenTTL.Seconds()),
+		int64(client.RefreshTokenTTL.Seconds()),
+		client.FirstParty,
+		client.ServiceAccountID,
+		client.UpdatedAt.UTC(),
+		client.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrClientNotFound)
+}
+
+// SetClientSecret replaces the secret of a client. A nil hash turns it
+// into a client without a secret.
+func (s *Storage) SetClientSecret(
+	ctx context.Context,
+	clientID string,
+	secretHash []byte,
+	updatedAt time.Time,
+) error {
+	const operation = "storage.sqlite.SetClientSecret"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE oauth_clients SET secret_hash = ?, updated_at = ? WHERE id = ?",
+		secretHash,
+		updatedAt.UTC(),
+		clientID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrClientNotFound)
+}
+
+// DeleteOAuthClient removes a client together with its pending codes and
+// revokes the sessions it holds tokens for.
+func (s *Storage) DeleteOAuthClient(ctx context.Context, clientID string, deletedAt time.Time) error {
+	const operation = "storage.sqlite.DeleteOAuthClient"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"UPDATE sessions SET revoked_at = ? WHERE client_id = ? AND revoked_at IS NULL",
+		deletedAt.UTC(),
+		clientID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	for _, query := range []string{
+		"DELETE FROM authorization_codes WHERE client_id = ?",
+		"DELETE FROM device_codes WHERE client_id = ?",
+		"DELETE FROM client_assertions WHERE client_id = ?",
+		"DELETE FROM logout_notifications WHERE client_id = ?",
+		"DELETE FROM oauth_grants WHERE client_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, clientID); err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM oauth_clients WHERE id = ?", clientID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrClientNotFound); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+func scanClient(row scanner) (models.OAuthClient, error) {
+	var (
+		client          models.OAuthClient
+		redirectURIs    string
+		grantTypes      string
+		scopes          string
+		audience        string
+		postLogout      string
+		accessTokenTTL  int64
+		refreshTokenTTL int64
+		updatedAt       sql.NullTime
+	)
+
+	err := row.Scan(
+		&client.ID,
+		&client.Name,
+		&client.SecretHash,
+		&redirectURIs,
+		&client.TokenEndpointAuthMethod,
+		&grantTypes,
+		&scopes,
+		&audience,
+		&client.JWKS,
+		&postLogout,
+		&client.FrontchannelLogoutURI,
+		&client.BackchannelLogoutURI,
+		&accessTokenTTL,
+		&refreshTokenTTL,
+		&client.RegistrationTokenHash,
+		&client.FirstParty,
+		&client.ServiceAccountID,
+		&client.CreatedAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+
+	for _, list := range []struct {
+		data string
+		dest *[]string
+	}{
+		{redirectURIs, &client.RedirectURIs},
+		{grantTypes, &client.GrantTypes},
+		{scopes, &client.Scopes},
+		{audience, &client.Audience},
+		{postLogout, &client.PostLogoutRedirectURIs},
+	} {
+		if err := json.Unmarshal([]byte(list.data), list.dest); err != nil {
+			return models.OAuthClient{}, err
+		}
+	}
+
+	client.AccessTokenTTL = time.Duration(accessTokenTTL) * time.Second
+	client.RefreshTokenTTL = time.Duration(refreshTokenTTL) * time.Second
+	if updatedAt.Valid {
+		client.UpdatedAt = updatedAt.Time
+	} else {
+		client.UpdatedAt = client.CreatedAt
+	}
+
+	return client, nil
+}
+
+// clientLists encodes the redirect URIs, grant types, scopes, audience and
+// post logout redirect URIs of client as JSON arrays, in that order.
+func clientLists(client models.OAuthClient) ([5]string, error) {
+	var lists [5]string
+
+	for i, list := range [][]string{
+		client.RedirectURIs,
+		client.GrantTypes,
+		client.Scopes,
+		client.Audience,
+		client.PostLogoutRedirectURIs,
+	} {
+		if list == nil {
+			list = []string{}
+		}
+
+		data, err := json.Marshal(list)
+		if err != nil {
+			return lists, err
+		}
+		lists[i] = string(data)
+	}
+
+	return lists, nil
+}
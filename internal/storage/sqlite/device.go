@@ -0,0 +1,219 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+// SaveDeviceCode stores a new device authorization request. Expired
+// requests are forgotten so that their user codes can be handed out again.
+func (s *Storage) SaveDeviceCode(
+	ctx context.Context,
+	deviceCodeHash []byte,
+	code models.DeviceCode,
+) error {
+	const operation = "storage.sqlite.SaveDeviceCode"
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM device_codes WHERE expires_at < ?",
+		time.Now().UTC(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO device_codes(device_code_hash, user_code, client_id, scope, status, poll_interval, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		deviceCodeHash,
+		code.UserCode,
+		code.ClientID,
+		code.Scope,
+		string(models.DeviceCodePending),
+		int64(code.Interval.Seconds()),
+		code.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return fmt.Errorf("%s: %w", operation, storage.ErrUserCodeExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// DeviceCode returns the device authorization request with the given
+// device code hash.
+func (s *Storage) DeviceCode(ctx context.Context, deviceCodeHash []byte) (models.DeviceCode, error) {
+	const operation = "storage.sqlite.DeviceCode"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+deviceCodeColumns+" FROM device_codes WHERE device_code_hash = ?",
+		deviceCodeHash,
+	)
+
+	code, err := scanDeviceCode(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+		}
+
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return code, nil
+}
+
+// DeviceCodeByUserCode returns the device authorization request with the
+// given user code.
+func (s *Storage) DeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const operation = "storage.sqlite.DeviceCodeByUserCode"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+deviceCodeColumns+" FROM device_codes WHERE user_code = ?",
+		userCode,
+	)
+
+	code, err := scanDeviceCode(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, storage.ErrDeviceCodeNotFound)
+		}
+
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return code, nil
+}
+
+// DecideDeviceCode records the decision taken in a browser session on a
+// pending request that has not expired yet.
+func (s *Storage) DecideDeviceCode(
+	ctx context.Context,
+	userCode string,
+	status models.DeviceCodeStatus,
+	session models.Session,
+) error {
+	const operation = "storage.sqlite.DecideDeviceCode"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE device_codes SET status = ?, user_id = ?, session_id = ?, auth_time = ?, amr = ?
+		WHERE user_code = ? AND status = ? AND expires_at > ?`,
+		string(status),
+		session.UserID,
+		session.ID,
+		session.AuthTime.UTC(),
+		strings.Join(session.AMR, " "),
+		userCode,
+		string(models.DeviceCodePending),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrDeviceCodeNotFound)
+}
+
+// PollDeviceCode records a poll of the token endpoint and the interval the
+// device has to wait before the next one.
+func (s *Storage) PollDeviceCode(
+	ctx context.Context,
+	deviceCodeHash []byte,
+	polledAt time.Time,
+	interval time.Duration,
+) error {
+	const operation = "storage.sqlite.PollDeviceCode"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE device_codes SET last_polled_at = ?, poll_interval = ? WHERE device_code_hash = ?",
+		polledAt.UTC(),
+		int64(interval.Seconds()),
+		deviceCodeHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrDeviceCodeNotFound)
+}
+
+// UseDeviceCode marks an approved request as used. It fails with
+// storage.ErrDeviceCodeNotFound if the request is not approved, so that
+// tokens are only ever issued once for it.
+func (s *Storage) UseDeviceCode(ctx context.Context, deviceCodeHash []byte) error {
+	const operation = "storage.sqlite.UseDeviceCode"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE device_codes SET status = ? WHERE device_code_hash = ? AND status = ?",
+		string(models.DeviceCodeUsed),
+		deviceCodeHash,
+		string(models.DeviceCodeApproved),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrDeviceCodeNotFound)
+}
+
+const deviceCodeColumns = `user_code, client_id, scope, status, COALESCE(user_id, 0), COALESCE(session_id, ''),
+	auth_time, amr, poll_interval, last_polled_at, expires_at, created_at`
+
+func scanDeviceCode(row scanner) (models.DeviceCode, error) {
+	var (
+		code         models.DeviceCode
+		status       string
+		interval     int64
+		authTime     sql.NullTime
+		amr          string
+		lastPolledAt sql.NullTime
+	)
+
+	err := row.Scan(
+		&code.UserCode,
+		&code.ClientID,
+		&code.Scope,
+		&status,
+		&code.UserID,
+		&code.SessionID,
+		&authTime,
+		&amr,
+		&interval,
+		&lastPolledAt,
+		&code.ExpiresAt,
+		&code.CreatedAt,
+	)
+	if err != nil {
+		return models.DeviceCode{}, err
+	}
+
+	code.Status = models.DeviceCodeStatus(status)
+	code.AMR = strings.Fields(amr)
+	code.Interval = time.Duration(interval) * time.Second
+	if authTime.Valid {
+		code.AuthTime = authTime.Time
+	}
+	if lastPolledAt.Valid {
+		code.LastPolledAt = lastPolledAt.Time
+	}
+
+	return code, nil
+}
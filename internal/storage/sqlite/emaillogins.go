@@ -0,0 +1,223 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+const emailLoginColumns = "id, user_id, method, attempts, expires_at, used_at, created_at"
+
+// SaveEmailLogin stores a new passwordless login by the hash of its secret.
+// Other logins of the user that are still pending are dropped, so that only
+// the latest code or link works, and expired ones are forgotten.
+func (s *Storage) SaveEmailLogin(ctx context.Context, login models.EmailLogin, secretHash []byte) error {
+	const operation = "storage.sqlite.SaveEmailLogin"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM email_logins WHERE expires_at < ? OR (user_id = ? AND used_at IS NULL)",
+		login.CreatedAt.UTC(),
+		login.UserID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO email_logins(id, user_id, method, secret_hash, expires_at, created_at)
+		VALUES(?, ?, ?, ?, ?, ?)`,
+		login.ID,
+		login.UserID,
+		string(login.Method),
+		secretHash,
+		login.ExpiresAt.UTC(),
+		login.CreatedAt.UTC(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// EmailLogin returns the passwordless login with the given id together with
+// the hash of its secret.
+func (s *Storage) EmailLogin(ctx context.Context, loginID string) (models.EmailLogin, []byte, error) {
+	const operation = "storage.sqlite.EmailLogin"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+emailLoginColumns+", secret_hash FROM email_logins WHERE id = ?",
+		loginID,
+	)
+
+	login, secretHash, err := scanEmailLogin(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.EmailLogin{}, nil, fmt.Errorf("%s: %w", operation, storage.ErrEmailLoginNotFound)
+		}
+
+		return models.EmailLogin{}, nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return login, secretHash, nil
+}
+
+// EmailLoginByHash returns the passwordless login whose secret hashes to
+// secretHash.
+func (s *Storage) EmailLoginByHash(ctx context.Context, secretHash []byte) (models.EmailLogin, error) {
+	const operation = "storage.sqlite.EmailLoginByHash"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+emailLoginColumns+", secret_hash FROM email_logins WHERE secret_hash = ?",
+		secretHash,
+	)
+
+	login, _, err := scanEmailLogin(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, storage.ErrEmailLoginNotFound)
+		}
+
+		return models.EmailLogin{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return login, nil
+}
+
+// ThrottleEmailLogin records that a passwordless login was requested for
+// emailNormalized at requestedAt. It returns storage.ErrEmailLoginThrottled
+// instead when the previous request for the address came after notBefore.
+// Requests older than notBefore are forgotten.
+func (s *Storage) ThrottleEmailLogin(
+	ctx context.Context,
+	emailNormalized string,
+	requestedAt time.Time,
+	notBefore time.Time,
+) error {
+	const operation = "storage.sqlite.ThrottleEmailLogin"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM email_login_requests WHERE requested_at <= ? AND email_normalized != ?",
+		notBefore.UTC(),
+		emailNormalized,
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	res, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO email_login_requests(email_normalized, requested_at) VALUES(?, ?)
+		ON CONFLICT(email_normalized) DO UPDATE SET requested_at = excluded.requested_at
+		WHERE email_login_requests.requested_at <= ?`,
+		emailNormalized,
+		requestedAt.UTC(),
+		notBefore.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrEmailLoginThrottled); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// AddEmailLoginAttempt counts a wrong or right guess of the code of a
+// pending login and returns the number of attempts so far.
+func (s *Storage) AddEmailLoginAttempt(ctx context.Context, loginID string) (int, error) {
+	const operation = "storage.sqlite.AddEmailLoginAttempt"
+
+	var attempts int
+
+	err := s.db.QueryRowContext(
+		ctx,
+		"UPDATE email_logins SET attempts = attempts + 1 WHERE id = ? AND used_at IS NULL RETURNING attempts",
+		loginID,
+	).Scan(&attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrEmailLoginNotFound)
+		}
+
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return attempts, nil
+}
+
+// UseEmailLogin marks a pending login as used. It fails with
+// storage.ErrEmailLoginNotFound if the login was used already, so that
+// two concurrent requests cannot both complete it.
+func (s *Storage) UseEmailLogin(ctx context.Context, loginID string, usedAt time.Time) error {
+	const operation = "storage.sqlite.UseEmailLogin"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE email_logins SET used_at = ? WHERE id = ? AND used_at IS NULL",
+		usedAt.UTC(),
+		loginID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrEmailLoginNotFound)
+}
+
+func scanEmailLogin(row scanner) (models.EmailLogin, []byte, error) {
+	var (
+		login      models.EmailLogin
+		method     string
+		usedAt     sql.NullTime
+		secretHash []byte
+	)
+
+	err := row.Scan(
+		&login.ID,
+		&login.UserID,
+		&method,
+		&login.Attempts,
+		&login.ExpiresAt,
+		&usedAt,
+		&login.CreatedAt,
+		&secretHash,
+	)
+	if err != nil {
+		return models.EmailLogin{}, nil, err
+	}
+
+	login.Method = models.EmailLoginMethod(method)
+	login.UsedAt = usedAt.Time
+
+	return login, secretHash, nil
+}
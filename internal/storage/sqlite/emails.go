@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+)
+
+// CanonicalizeEmails recomputes the normalized email of every user that has
+// not been purged. When two users end up with the same normalized address,
+// the oldest one keeps it and the others are disabled without a normalized
+// address so that an admin can resolve the conflict. It returns how many
+// users were updated and how many of them were disabled.
+func (s *Storage) CanonicalizeEmails(
+	ctx context.Context,
+	normalize func(email string) (string, error),
+) (updated int, disabled int, err error) {
+	const operation = "storage.sqlite.CanonicalizeEmails"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT id, email, email_normalized FROM users WHERE email IS NOT NULL ORDER BY id",
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	type user struct {
+		id         int64
+		email      string
+		normalized sql.NullString
+	}
+
+	var users []user
+	for rows.Next() {
+		var u user
+		if err := rows.Scan(&u.id, &u.email, &u.normalized); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("%s: %w", operation, err)
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// The oldest user claiming an address owns it.
+	targets := make(map[int64]sql.NullString, len(users))
+	owners := make(map[string]int64, len(users))
+	for _, u := range users {
+		target := u.normalized
+		if normalized, err := normalize(u.email); err == nil {
+			target = sql.NullString{String: normalized, Valid: true}
+		}
+		targets[u.id] = target
+
+		if _, taken := owners[target.String]; target.Valid && !taken {
+			owners[target.String] = u.id
+		}
+	}
+
+	// Clear every address that changes first so that the unique index does
+	// not trip over values that are only being moved between users.
+	var pending []user
+	for _, u := range users {
+		target := targets[u.id]
+		if !target.Valid || (u.normalized == target && owners[target.String] == u.id) {
+			continue
+		}
+		// Duplicates disabled by an earlier run have nothing left to change.
+		if !u.normalized.Valid && owners[target.String] != u.id {
+			continue
+		}
+
+		pending = append(pending, u)
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET email_normalized = NULL WHERE id = ?", u.id); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, u := range pending {
+		target := targets[u.id]
+		ownerID := owners[target.String]
+
+		if ownerID != u.id {
+			_, err := tx.ExecContext(
+				ctx,
+				"UPDATE users SET status = ?, status_reason = ?, status_changed_at = ? WHERE id = ?",
+				string(models.UserStatusDisabled),
+				fmt.Sprintf("duplicate email of user %d", ownerID),
+				now,
+				u.id,
+			)
+			if err != nil {
+				return 0, 0, fmt.Errorf("%s: %w", operation, err)
+			}
+			disabled++
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET email_normalized = ? WHERE id = ?", target.String, u.id); err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return len(pending), disabled, nil
+}
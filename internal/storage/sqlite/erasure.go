@@ -0,0 +1,203 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+)
+
+// PurgeUsers irreversibly erases the personal data of users soft-deleted
+// before deletedBefore, and the service accounts they own, and returns their
+// ids.
+func (s *Storage) PurgeUsers(
+	ctx context.Context,
+	deletedBefore time.Time,
+	purgedAt time.Time,
+) ([]int64, error) {
+	const operation = "storage.sqlite.PurgeUsers"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT id FROM users WHERE status = ? AND deleted_at < ? AND purged_at IS NULL",
+		string(models.UserStatusDeleted),
+		deletedBefore.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	var purged []int64
+	for _, userID := range userIDs {
+		// Service accounts are named and described by their owner and
+		// would outlive them without anyone to manage them.
+		accountIDs, err := ownedServiceAccounts(ctx, tx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+
+		for _, accountID := range append(accountIDs, userID) {
+			if err := eraseUser(ctx, tx, accountID, purgedAt); err != nil {
+				return nil, fmt.Errorf("%s: %w", operation, err)
+			}
+			purged = append(purged, accountID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return purged, nil
+}
+
+// ownedServiceAccounts returns the ids of the service accounts owned by
+// userID that have not been purged yet.
+func ownedServiceAccounts(ctx context.Context, tx *sql.Tx, userID int64) ([]int64, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT a.user_id FROM service_accounts a JOIN users ON users.id = a.user_id
+		WHERE a.owner_id = ? AND users.purged_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accountIDs []int64
+	for rows.Next() {
+		var accountID int64
+		if err := rows.Scan(&accountID); err != nil {
+			return nil, err
+		}
+		accountIDs = append(accountIDs, accountID)
+	}
+
+	return accountIDs, rows.Err()
+}
+
+// eraseUser removes or pseudonymizes every piece of personal data stored
+// about a user. The users row itself is kept as a tombstone without email or
+// credentials so that audit events keep pointing at a valid id.
+//
+// Every table that stores personal data must be handled here.
+func eraseUser(ctx context.Context, tx *sql.Tx, userID int64, purgedAt time.Time) error {
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{
+			query: "DELETE FROM authorization_codes WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM device_codes WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM logout_notifications WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			// Pending logins that would link an upstream identity.
+			query: "DELETE FROM upstream_logins WHERE link_user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM user_identities WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM oauth_grants WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM sessions WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM api_keys WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM service_accounts WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM email_logins WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM phone_codes WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM email_login_requests WHERE email_normalized = (SELECT email_normalized FROM users WHERE id = ?)",
+			args:  []any{userID},
+		},
+		{
+			// Invitations addressed to the user; those they sent hold
+			// other people's addresses and are kept.
+			query: "DELETE FROM invitations WHERE accepted_by = ? OR email_normalized = (SELECT email_normalized FROM users WHERE id = ?)",
+			args:  []any{userID, userID},
+		},
+		{
+			query: "DELETE FROM password_history WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM org_members WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM scim_group_members WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "DELETE FROM scim_users WHERE user_id = ?",
+			args:  []any{userID},
+		},
+		{
+			query: "UPDATE audit_events SET ip = '', user_agent = '', details = '{}' WHERE user_id = ? OR actor_id = ?",
+			args:  []any{userID, userID},
+		},
+		{
+			query: `UPDATE users SET email = NULL, email_normalized = NULL, pass_hash = X'', is_admin = FALSE, status_reason = '',
+			display_name = '', given_name = '', family_name = '', locale = '', timezone = '', avatar_url = '', phone = '', phone_verified_at = NULL,
+			metadata = '{}', admin_metadata = '{}', status = ?, deleted_at = COALESCE(deleted_at, ?), purged_at = ?
+			WHERE id = ?`,
+			args: []any{string(models.UserStatusDeleted), purgedAt.UTC(), purgedAt.UTC(), userID},
+		},
+	}
+
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,244 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite/sqlitetest"
+)
+
+// person is the personal data planted for a user across the tables.
+type person struct {
+	email string
+	login string
+	phone string
+}
+
+func TestPurgeUsersErasesPersonalData(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(sqlitetest.Path(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	erased := person{email: "Erase.Me@example.com", login: "erase.login", phone: "+15550100001"}
+	kept := person{email: "Keep.Me@example.com", login: "keep.login", phone: "+15550100002"}
+
+	keptID := plantPerson(t, s, kept, 0)
+	erasedID := plantPerson(t, s, erased, keptID)
+
+	orgID, err := s.SaveOrg(ctx, models.Org{Name: "Shared", CreatedAt: time.Now()}, keptID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, s, "INSERT INTO org_members(org_id, user_id, role) VALUES(?, ?, ?)", orgID, erasedID, models.OrgRoleMember)
+
+	now := time.Now()
+	mustExec(t, s,
+		"UPDATE users SET status = ?, deleted_at = ? WHERE id = ?",
+		string(models.UserStatusDeleted), now.Add(-time.Hour).UTC(), erasedID,
+	)
+
+	purged, err := s.PurgeUsers(ctx, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 2 || purged[len(purged)-1] != erasedID {
+		t.Fatalf("purged %v, want the owned service account and %d", purged, erasedID)
+	}
+
+	if orgs, err := s.UserOrgs(ctx, erasedID); err != nil || len(orgs) != 0 {
+		t.Errorf("memberships of the erased user = %v, %v, want none", orgs, err)
+	}
+	if members, err := s.OrgMembers(ctx, orgID); err != nil || len(members) != 1 || members[0].UserID != keptID {
+		t.Errorf("members of the organization = %v, %v, want the other user", members, err)
+	}
+
+	values := scanDatabase(t, s)
+	for _, needle := range []string{erased.email, erased.login, erased.phone} {
+		if places := values.find(needle); len(places) > 0 {
+			t.Errorf("%q survived erasure in %v", needle, places)
+		}
+	}
+	for _, needle := range []string{kept.email, kept.login, kept.phone} {
+		if len(values.find(needle)) == 0 {
+			t.Errorf("%q of another user was erased", needle)
+		}
+	}
+
+	var status string
+	if err := s.db.QueryRowContext(ctx, "SELECT status FROM users WHERE id = ?", purged[0]).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != string(models.UserStatusDeleted) {
+		t.Errorf("owned service account status = %q, want deleted", status)
+	}
+}
+
+// plantPerson creates a user and stores p in every table that can hold
+// personal data. The user accepted an invitation from invitedBy unless it is
+// zero.
+func plantPerson(t *testing.T, s *Storage, p person, invitedBy int64) int64 {
+	t.Helper()
+
+	ctx := context.Background()
+	normalized := strings.ToLower(p.email)
+	expires := time.Now().Add(time.Hour).UTC()
+
+	userID, err := s.SaveUser(ctx, p.email, normalized, []byte("hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustExec(t, s,
+		"UPDATE users SET display_name = ?, phone = ?, metadata = ? WHERE id = ?",
+		p.login, p.phone, fmt.Sprintf(`{"contact":%q}`, p.email), userID,
+	)
+	mustExec(t, s,
+		`INSERT INTO sessions(id, user_id, refresh_hash, device, ip, user_agent, created_at, last_seen_at, expires_at)
+		VALUES(?, ?, ?, ?, '192.0.2.1', 'test', ?, ?, ?)`,
+		p.login, userID, []byte(p.login), p.login+" laptop", expires, expires, expires,
+	)
+	mustExec(t, s,
+		"INSERT INTO user_identities(provider, subject, user_id, email) VALUES('ldap', ?, ?, ?)",
+		p.login, userID, p.email,
+	)
+	mustExec(t, s,
+		`INSERT INTO upstream_logins(state_hash, provider, nonce, code_verifier, return_to, expires_at, link_user_id)
+		VALUES(?, 'corp', 'nonce', 'verifier', ?, ?, ?)`,
+		[]byte(p.login), "/account?login="+p.login, expires, userID,
+	)
+	mustExec(t, s,
+		"INSERT INTO scim_users(user_id, external_id, display_name) VALUES(?, ?, ?)",
+		userID, p.login, p.login,
+	)
+	mustExec(t, s,
+		`INSERT INTO phone_codes(id, user_id, phone, purpose, code_hash, expires_at)
+		VALUES(?, ?, ?, 'verification', ?, ?)`,
+		p.login, userID, p.phone, []byte(p.login), expires,
+	)
+	mustExec(t, s,
+		"INSERT INTO email_login_requests(email_normalized, requested_at) VALUES(?, ?)",
+		normalized, expires,
+	)
+	mustExec(t, s,
+		"INSERT INTO api_keys(id, user_id, name, prefix, key_hash) VALUES(?, ?, ?, 'sso', ?)",
+		p.login, userID, p.login+" key", []byte(p.login),
+	)
+	mustExec(t, s,
+		"INSERT INTO audit_events(user_id, action, ip, user_agent, details, created_at) VALUES(?, 'login', '192.0.2.1', 'test', ?, ?)",
+		userID, fmt.Sprintf(`{"email":%q,"phone":%q}`, p.email, p.phone), expires,
+	)
+	if invitedBy != 0 {
+		mustExec(t, s,
+			`INSERT INTO invitations(id, email, email_normalized, code_hash, invited_by, expires_at, accepted_at, accepted_by)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.login, p.email, normalized, []byte(p.login), invitedBy, expires, expires, userID,
+		)
+	}
+
+	if _, err := s.SaveServiceAccount(ctx, models.ServiceAccount{
+		Name:        p.login + " bot",
+		Description: "owned by " + p.email,
+		OwnerID:     userID,
+		CreatedAt:   time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return userID
+}
+
+// storedValue is a text or blob value found in a database column.
+type storedValue struct {
+	place string
+	value string
+}
+
+type storedValues []storedValue
+
+// find returns the table.column places whose values contain needle,
+// ignoring case.
+func (values storedValues) find(needle string) []string {
+	needle = strings.ToLower(needle)
+
+	var places []string
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v.value), needle) {
+			places = append(places, v.place)
+		}
+	}
+
+	return places
+}
+
+// scanDatabase returns every text and blob value of every table.
+func scanDatabase(t *testing.T, s *Storage) storedValues {
+	t.Helper()
+
+	ctx := context.Background()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	var values storedValues
+	for _, table := range tables {
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %q", table))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		columns, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for rows.Next() {
+			row := make([]any, len(columns))
+			dest := make([]any, len(columns))
+			for i := range row {
+				dest[i] = &row[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, v := range row {
+				switch v := v.(type) {
+				case string:
+					values = append(values, storedValue{place: table + "." + columns[i], value: v})
+				case []byte:
+					values = append(values, storedValue{place: table + "." + columns[i], value: string(v)})
+				}
+			}
+		}
+		rows.Close()
+	}
+
+	return values
+}
+
+func mustExec(t *testing.T, s *Storage, query string, args ...any) {
+	t.Helper()
+
+	if _, err := s.db.ExecContext(context.Background(), query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
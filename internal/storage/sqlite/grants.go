@@ -0,0 +1,170 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// OAuthGrant returns the scopes userID has consented to give clientID.
+func (s *Storage) OAuthGrant(ctx context.Context, userID int64, clientID string) (models.OAuthGrant, error) {
+	const operation = "storage.sqlite.OAuthGrant"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT g.user_id, g.client_id, c.name, g.scope, g.created_at, g.updated_at
+		FROM oauth_grants g JOIN oauth_clients c ON c.id = g.client_id
+		WHERE g.user_id = ? AND g.client_id = ?`,
+		userID,
+		clientID,
+	)
+
+	grant, err := scanGrant(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OAuthGrant{}, fmt.Errorf("%s: %w", operation, storage.ErrGrantNotFound)
+		}
+		return models.OAuthGrant{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return grant, nil
+}
+
+// OAuthGrants returns the grants userID has given, most recent first.
+func (s *Storage) OAuthGrants(ctx context.Context, userID int64) ([]models.OAuthGrant, error) {
+	const operation = "storage.sqlite.OAuthGrants"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT g.user_id, g.client_id, c.name, g.scope, g.created_at, g.updated_at
+		FROM oauth_grants g JOIN oauth_clients c ON c.id = g.client_id
+		WHERE g.user_id = ?
+		ORDER BY g.updated_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	grants := []models.OAuthGrant{}
+	for rows.Next() {
+		grant, err := scanGrant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		grants = append(grants, grant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return grants, nil
+}
+
+// SaveOAuthGrant stores a grant, replacing the scope of an earlier grant of
+// the user to the same client.
+func (s *Storage) SaveOAuthGrant(ctx context.Context, grant models.OAuthGrant) error {
+	const operation = "storage.sqlite.SaveOAuthGrant"
+
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO oauth_grants(user_id, client_id, scope, created_at, updated_at)
+		VALUES(?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, client_id) DO UPDATE SET scope = excluded.scope, updated_at = excluded.updated_at`,
+		grant.UserID,
+		grant.ClientID,
+		grant.Scope,
+		grant.CreatedAt.UTC(),
+		grant.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// DeleteOAuthGrant withdraws the grant of userID to clientID. The sessions
+// the client holds for the user are revoked and its unused authorization
+// codes deleted, so that it loses access right away.
+func (s *Storage) DeleteOAuthGrant(
+	ctx context.Context,
+	userID int64,
+	clientID string,
+	revokedAt time.Time,
+) error {
+	const operation = "storage.sqlite.DeleteOAuthGrant"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM oauth_grants WHERE user_id = ? AND client_id = ?",
+		userID,
+		clientID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrGrantNotFound); err != nil {
+		return err
+	}
+
+	const where = "user_id = ? AND client_id = ? AND revoked_at IS NULL"
+
+	if err := queueLogoutNotifications(ctx, tx, revokedAt, where, userID, clientID); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"UPDATE sessions SET revoked_at = ? WHERE "+where,
+		revokedAt.UTC(),
+		userID,
+		clientID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM authorization_codes WHERE user_id = ? AND client_id = ? AND used_at IS NULL",
+		userID,
+		clientID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+func scanGrant(row scanner) (models.OAuthGrant, error) {
+	var grant models.OAuthGrant
+
+	err := row.Scan(
+		&grant.UserID,
+		&grant.ClientID,
+		&grant.ClientName,
+		&grant.Scope,
+		&grant.CreatedAt,
+		&grant.UpdatedAt,
+	)
+
+	return grant, err
+}
@@ -0,0 +1,245 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+const identityColumns = "provider, subject, user_id, email, created_at, last_login_at"
+
+const upstreamLoginColumns = "provider, nonce, code_verifier, return_to, link_user_id, expires_at"
+
+// Identity returns the identity with the given subject at provider.
+func (s *Storage) Identity(ctx context.Context, provider string, subject string) (models.Identity, error) {
+	const operation = "storage.sqlite.Identity"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+identityColumns+" FROM user_identities WHERE provider = ? AND subject = ?",
+		provider,
+		subject,
+	)
+
+	identity, err := scanIdentity(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Identity{}, fmt.Errorf("%s: %w", operation, storage.ErrIdentityNotFound)
+		}
+		return models.Identity{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return identity, nil
+}
+
+// Identities returns the identities linked to a user.
+func (s *Storage) Identities(ctx context.Context, userID int64) ([]models.Identity, error) {
+	const operation = "storage.sqlite.Identities"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT "+identityColumns+" FROM user_identities WHERE user_id = ? ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	identities := []models.Identity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return identities, nil
+}
+
+// SaveIdentity links an identity to its user.
+func (s *Storage) SaveIdentity(ctx context.Context, identity models.Identity) error {
+	const operation = "storage.sqlite.SaveIdentity"
+
+	_, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO user_identities("+identityColumns+") VALUES(?, ?, ?, ?, ?, ?)",
+		identity.Provider,
+		identity.Subject,
+		identity.UserID,
+		identity.Email,
+		identity.CreatedAt.UTC(),
+		identity.LastLoginAt.UTC(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return fmt.Errorf("%s: %w", operation, storage.ErrIdentityExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// TouchIdentity records a login with an identity and the email the
+// provider reported for it.
+func (s *Storage) TouchIdentity(
+	ctx context.Context,
+	provider string,
+	subject string,
+	email string,
+	loggedInAt time.Time,
+) error {
+	const operation = "storage.sqlite.TouchIdentity"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE user_identities SET email = ?, last_login_at = ? WHERE provider = ? AND subject = ?",
+		email,
+		loggedInAt.UTC(),
+		provider,
+		subject,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrIdentityNotFound)
+}
+
+// DeleteIdentity unlinks an identity from its user.
+func (s *Storage) DeleteIdentity(ctx context.Context, userID int64, provider string, subject string) error {
+	const operation = "storage.sqlite.DeleteIdentity"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM user_identities WHERE user_id = ? AND provider = ? AND subject = ?",
+		userID,
+		provider,
+		subject,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrIdentityNotFound)
+}
+
+// SaveUpstreamLogin stores a login at an upstream provider under the hash
+// of its state. Expired logins are deleted on the way.
+func (s *Storage) SaveUpstreamLogin(ctx context.Context, stateHash []byte, login models.UpstreamLogin) error {
+	const operation = "storage.sqlite.SaveUpstreamLogin"
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM upstream_logins WHERE expires_at < ?",
+		time.Now().UTC(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO upstream_logins(state_hash, provider, nonce, code_verifier, return_to, link_user_id, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		stateHash,
+		login.Provider,
+		login.Nonce,
+		login.CodeVerifier,
+		login.ReturnTo,
+		login.LinkUserID,
+		login.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// UpstreamLogin returns the login with the given state hash without using
+// it up.
+func (s *Storage) UpstreamLogin(ctx context.Context, stateHash []byte) (models.UpstreamLogin, error) {
+	const operation = "storage.sqlite.UpstreamLogin"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+upstreamLoginColumns+" FROM upstream_logins WHERE state_hash = ?",
+		stateHash,
+	)
+
+	login, err := scanUpstreamLogin(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UpstreamLogin{}, fmt.Errorf("%s: %w", operation, storage.ErrUpstreamLoginNotFound)
+		}
+		return models.UpstreamLogin{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return login, nil
+}
+
+// UseUpstreamLogin deletes and returns the login with the given state hash,
+// so that each state can only be used once.
+func (s *Storage) UseUpstreamLogin(ctx context.Context, stateHash []byte) (models.UpstreamLogin, error) {
+	const operation = "storage.sqlite.UseUpstreamLogin"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"DELETE FROM upstream_logins WHERE state_hash = ? RETURNING "+upstreamLoginColumns,
+		stateHash,
+	)
+
+	login, err := scanUpstreamLogin(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UpstreamLogin{}, fmt.Errorf("%s: %w", operation, storage.ErrUpstreamLoginNotFound)
+		}
+		return models.UpstreamLogin{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return login, nil
+}
+
+func scanIdentity(row scanner) (models.Identity, error) {
+	var identity models.Identity
+
+	err := row.Scan(
+		&identity.Provider,
+		&identity.Subject,
+		&identity.UserID,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+
+	return identity, err
+}
+
+func scanUpstreamLogin(row scanner) (models.UpstreamLogin, error) {
+	var login models.UpstreamLogin
+
+	err := row.Scan(
+		&login.Provider,
+		&login.Nonce,
+		&login.CodeVerifier,
+		&login.ReturnTo,
+		&login.LinkUserID,
+		&login.ExpiresAt,
+	)
+
+	return login, err
+}
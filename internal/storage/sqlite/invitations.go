@@ -0,0 +1,280 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+const invitationColumns = "id, email, role, org_id, org_role, invited_by, created_at, expires_at, accepted_at, accepted_by, revoked_at"
+
+// SaveInvitation stores a new invitation by the hash of its code. It fails
+// with storage.ErrUserExists if emailNormalized already has an account, which
+// is checked by the same statement so that no invitation is left for an
+// account registered meanwhile.
+func (s *Storage) SaveInvitation(
+	ctx context.Context,
+	invitation models.Invitation,
+	emailNormalized string,
+	codeHash []byte,
+) error {
+	const operation = "storage.sqlite.SaveInvitation"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO invitations(id, email, email_normalized, role, org_id, org_role, code_hash, invited_by, created_at, expires_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE email_normalized = ?)`,
+		invitation.ID,
+		invitation.Email,
+		emailNormalized,
+		invitation.Role,
+		sql.NullInt64{Int64: invitation.OrgID, Valid: invitation.OrgID != 0},
+		invitation.OrgRole,
+		codeHash,
+		invitation.InvitedBy,
+		invitation.CreatedAt.UTC(),
+		invitation.ExpiresAt.UTC(),
+		emailNormalized,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrUserExists)
+}
+
+// Invitation returns the invitation with the given id.
+func (s *Storage) Invitation(ctx context.Context, invitationID string) (models.Invitation, error) {
+	const operation = "storage.sqlite.Invitation"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+invitationColumns+" FROM invitations WHERE id = ?", invitationID)
+
+	invitation, err := scanInvitation(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Invitation{}, fmt.Errorf("%s: %w", operation, storage.ErrInvitationNotFound)
+		}
+		return models.Invitation{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return invitation, nil
+}
+
+// InvitationByHash returns the invitation whose code hashes to codeHash
+// together with the normalized address it was sent to.
+func (s *Storage) InvitationByHash(ctx context.Context, codeHash []byte) (models.Invitation, string, error) {
+	const operation = "storage.sqlite.InvitationByHash"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+invitationColumns+", email_normalized FROM invitations WHERE code_hash = ?",
+		codeHash,
+	)
+
+	var emailNormalized string
+
+	invitation, err := scanInvitation(row, &emailNormalized)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, storage.ErrInvitationNotFound)
+		}
+		return models.Invitation{}, "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return invitation, emailNormalized, nil
+}
+
+// AcceptedInvitation returns the invitation userID registered with.
+func (s *Storage) AcceptedInvitation(ctx context.Context, userID int64) (models.Invitation, error) {
+	const operation = "storage.sqlite.AcceptedInvitation"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+invitationColumns+" FROM invitations WHERE accepted_by = ?", userID)
+
+	invitation, err := scanInvitation(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Invitation{}, fmt.Errorf("%s: %w", operation, storage.ErrInvitationNotFound)
+		}
+		return models.Invitation{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return invitation, nil
+}
+
+// PendingInvitation returns the newest invitation sent to emailNormalized
+// that is neither accepted, revoked nor expired at now.
+func (s *Storage) PendingInvitation(
+	ctx context.Context,
+	emailNormalized string,
+	now time.Time,
+) (models.Invitation, error) {
+	const operation = "storage.sqlite.PendingInvitation"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+invitationColumns+` FROM invitations
+		WHERE email_normalized = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY created_at DESC LIMIT 1`,
+		emailNormalized,
+		now.UTC(),
+	)
+
+	invitation, err := scanInvitation(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Invitation{}, fmt.Errorf("%s: %w", operation, storage.ErrInvitationNotFound)
+		}
+		return models.Invitation{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return invitation, nil
+}
+
+// Invitations returns the invitations that are not revoked, newest first,
+// including accepted and expired ones.
+func (s *Storage) Invitations(ctx context.Context) ([]models.Invitation, error) {
+	const operation = "storage.sqlite.Invitations"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT "+invitationColumns+" FROM invitations WHERE revoked_at IS NULL ORDER BY created_at DESC",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return invitations, nil
+}
+
+// SaveInvitedUser creates a user who registered with invitation, marks the
+// invitation as accepted by them, grants them its role and adds them to its
+// organization, all at once. It
+// fails with storage.ErrInvitationNotFound if the invitation was accepted or
+// revoked already, so that it is used at most once.
+func (s *Storage) SaveInvitedUser(
+	ctx context.Context,
+	email string,
+	emailNormalized string,
+	passHash []byte,
+	invitation models.Invitation,
+	acceptedAt time.Time,
+) (int64, error) {
+	const operation = "storage.sqlite.SaveInvitedUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	id, err := insertUser(ctx, tx, email, emailNormalized, passHash)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	res, err := tx.ExecContext(
+		ctx,
+		`UPDATE invitations SET accepted_at = ?, accepted_by = ?
+		WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL`,
+		acceptedAt.UTC(),
+		id,
+		invitation.ID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrInvitationNotFound); err != nil {
+		return 0, err
+	}
+
+	if invitation.Role == models.RoleAdmin {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET is_admin = 1 WHERE id = ?", id); err != nil {
+			return 0, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	if invitation.OrgID != 0 {
+		if err := insertOrgMember(ctx, tx, invitation.OrgID, id, invitation.OrgRole); err != nil {
+			return 0, fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// RevokeInvitation revokes an invitation that is neither accepted nor
+// revoked yet.
+func (s *Storage) RevokeInvitation(ctx context.Context, invitationID string, revokedAt time.Time) error {
+	const operation = "storage.sqlite.RevokeInvitation"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE invitations SET revoked_at = ? WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL",
+		revokedAt.UTC(),
+		invitationID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrInvitationNotFound)
+}
+
+// scanInvitation scans the invitation columns followed by extra.
+func scanInvitation(row scanner, extra ...any) (models.Invitation, error) {
+	var (
+		invitation models.Invitation
+		orgID      sql.NullInt64
+		acceptedAt sql.NullTime
+		revokedAt  sql.NullTime
+	)
+
+	dest := []any{
+		&invitation.ID,
+		&invitation.Email,
+		&invitation.Role,
+		&orgID,
+		&invitation.OrgRole,
+		&invitation.InvitedBy,
+		&invitation.CreatedAt,
+		&invitation.ExpiresAt,
+		&acceptedAt,
+		&invitation.AcceptedBy,
+		&revokedAt,
+	}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return models.Invitation{}, err
+	}
+
+	invitation.OrgID = orgID.Int64
+	invitation.AcceptedAt = acceptedAt.Time
+	invitation.RevokedAt = revokedAt.Time
+
+	return invitation, nil
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite/sqlitetest"
+)
+
+func TestSaveInvitedUser(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(sqlitetest.Path(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adminID, err := s.SaveUser(ctx, "admin@example.com", "admin@example.com", []byte("hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	invitation := models.Invitation{
+		ID:        "invitation",
+		Email:     "new@example.com",
+		Role:      models.RoleAdmin,
+		InvitedBy: adminID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := s.SaveInvitation(ctx, invitation, "new@example.com", []byte("code")); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, err := s.SaveInvitedUser(ctx, "New@example.com", "new@example.com", []byte("hash"), invitation, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted, err := s.AcceptedInvitation(ctx, userID)
+	if err != nil || accepted.ID != invitation.ID {
+		t.Fatalf("accepted invitation = %v, %v, want %s", accepted.ID, err, invitation.ID)
+	}
+	if isAdmin, err := s.IsAdmin(ctx, userID); err != nil || !isAdmin {
+		t.Fatalf("is admin = %v, %v, want the role of the invitation", isAdmin, err)
+	}
+
+	// A used invitation fails the registration without leaving an account.
+	_, err = s.SaveInvitedUser(ctx, "other@example.com", "other@example.com", []byte("hash"), invitation, now)
+	if !errors.Is(err, storage.ErrInvitationNotFound) {
+		t.Fatalf("err = %v, want ErrInvitationNotFound", err)
+	}
+	if _, err := s.User(ctx, "other@example.com"); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Fatalf("user of the failed registration: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestSaveInvitedUserJoinsOrg(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(sqlitetest.Path(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ownerID, err := s.SaveUser(ctx, "owner@example.com", "owner@example.com", []byte("hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	orgID, err := s.SaveOrg(ctx, models.Org{Name: "Example", CreatedAt: now}, ownerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invitation := models.Invitation{
+		ID:        "invitation",
+		Email:     "new@example.com",
+		OrgID:     orgID,
+		OrgRole:   models.OrgRoleMember,
+		InvitedBy: ownerID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := s.SaveInvitation(ctx, invitation, "new@example.com", []byte("code")); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.Invitation(ctx, invitation.ID)
+	if err != nil || stored.OrgID != orgID || stored.OrgRole != models.OrgRoleMember {
+		t.Fatalf("stored invitation = %+v, %v, want org %d", stored, err, orgID)
+	}
+
+	userID, err := s.SaveInvitedUser(ctx, "new@example.com", "new@example.com", []byte("hash"), stored, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	role, err := s.OrgRole(ctx, orgID, userID)
+	if err != nil || role != models.OrgRoleMember {
+		t.Fatalf("org role = %q, %v, want %q", role, err, models.OrgRoleMember)
+	}
+	if isAdmin, err := s.IsAdmin(ctx, userID); err != nil || isAdmin {
+		t.Fatalf("is admin = %v, %v, want no global role", isAdmin, err)
+	}
+}
+
+func TestSaveInvitationForExistingUser(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(sqlitetest.Path(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adminID, err := s.SaveUser(ctx, "admin@example.com", "admin@example.com", []byte("hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	invitation := models.Invitation{
+		ID:        "invitation",
+		Email:     "Admin@example.com",
+		InvitedBy: adminID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+
+	err = s.SaveInvitation(ctx, invitation, "admin@example.com", []byte("code"))
+	if !errors.Is(err, storage.ErrUserExists) {
+		t.Fatalf("err = %v, want ErrUserExists", err)
+	}
+	if _, err := s.Invitation(ctx, invitation.ID); !errors.Is(err, storage.ErrInvitationNotFound) {
+		t.Fatalf("invitation for an existing account: err = %v, want ErrInvitationNotFound", err)
+	}
+}
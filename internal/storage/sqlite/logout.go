@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// queueLogoutNotifications queues a back-channel logout for the client
+// sessions among the sessions matching where that are about to be revoked,
+// if their client registered a back-channel logout URI. where is a
+// condition on the sessions table.
+func queueLogoutNotifications(
+	ctx context.Context,
+	tx *sql.Tx,
+	queuedAt time.Time,
+	where string,
+	args ...any,
+) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT OR IGNORE INTO logout_notifications(client_id, user_id, session_id, next_attempt_at)
+		SELECT DISTINCT client_id, user_id, COALESCE(parent_id, id), ?
+		FROM sessions
+		WHERE client_id IN (SELECT id FROM oauth_clients WHERE backchannel_logout_uri != '') AND `+where,
+		append([]any{queuedAt.UTC()}, args...)...,
+	)
+
+	return err
+}
+
+// DueLogoutNotifications returns up to limit queued back-channel logouts
+// whose next attempt is due.
+func (s *Storage) DueLogoutNotifications(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+) ([]models.LogoutNotification, error) {
+	const operation = "storage.sqlite.DueLogoutNotifications"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT n.id, n.client_id, c.backchannel_logout_uri, n.user_id, n.session_id, n.attempts, n.next_attempt_at
+		FROM logout_notifications n JOIN oauth_clients c ON c.id = n.client_id
+		WHERE n.next_attempt_at <= ?
+		ORDER BY n.next_attempt_at
+		LIMIT ?`,
+		now.UTC(),
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var notifications []models.LogoutNotification
+	for rows.Next() {
+		var notification models.LogoutNotification
+		if err := rows.Scan(
+			&notification.ID,
+			&notification.ClientID,
+			&notification.LogoutURI,
+			&notification.UserID,
+			&notification.SessionID,
+			&notification.Attempts,
+			&notification.NextAttemptAt,
+		); err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		notifications = append(notifications, notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return notifications, nil
+}
+
+// DeleteLogoutNotification removes a back-channel logout from the queue once
+// it was delivered or given up on.
+func (s *Storage) DeleteLogoutNotification(ctx context.Context, id int64) error {
+	const operation = "storage.sqlite.DeleteLogoutNotification"
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM logout_notifications WHERE id = ?", id); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// RetryLogoutNotification records a failed delivery and when to try again.
+func (s *Storage) RetryLogoutNotification(
+	ctx context.Context,
+	id int64,
+	nextAttemptAt time.Time,
+	lastError string,
+) error {
+	const operation = "storage.sqlite.RetryLogoutNotification"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE logout_notifications SET attempts = attempts + 1, next_attempt_at = ?, last_error = ?
+		WHERE id = ?`,
+		nextAttemptAt.UTC(),
+		lastError,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrLogoutNotificationNotFound)
+}
@@ -0,0 +1,197 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+func (s *Storage) OAuthClient(ctx context.Context, clientID string) (models.OAuthClient, error) {
+	const operation = "storage.sqlite.OAuthClient"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+clientColumns+" FROM oauth_clients WHERE id = ?", clientID)
+
+	client, err := scanClient(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OAuthClient{}, fmt.Errorf("%s: %w", operation, storage.ErrClientNotFound)
+		}
+
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return client, nil
+}
+
+func (s *Storage) SaveAuthorizationCode(
+	ctx context.Context,
+	codeHash []byte,
+	code models.AuthorizationCode,
+) error {
+	const operation = "storage.sqlite.SaveAuthorizationCode"
+
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO authorization_codes(code_hash, client_id, user_id, session_id, redirect_uri, scope, code_challenge, code_challenge_method, nonce, auth_time, amr, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		codeHash,
+		code.ClientID,
+		code.UserID,
+		code.SessionID,
+		code.RedirectURI,
+		code.Scope,
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.Nonce,
+		code.AuthTime.UTC(),
+		strings.Join(code.AMR, " "),
+		code.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// UseAuthorizationCode marks a code as used and returns it. A code that was
+// already used is returned together with storage.ErrCodeUsed so that the
+// caller can revoke what was issued for it.
+func (s *Storage) UseAuthorizationCode(
+	ctx context.Context,
+	codeHash []byte,
+	usedAt time.Time,
+) (models.AuthorizationCode, error) {
+	const operation = "storage.sqlite.UseAuthorizationCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	var (
+		code            models.AuthorizationCode
+		codeUsedAt      sql.NullTime
+		issuedSessionID sql.NullString
+		authTime        sql.NullTime
+		amr             string
+	)
+
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT client_id, user_id, session_id, redirect_uri, scope, code_challenge, code_challenge_method, nonce, auth_time, amr, expires_at, used_at, issued_session_id
+		FROM authorization_codes WHERE code_hash = ?`,
+		codeHash,
+	).Scan(
+		&code.ClientID,
+		&code.UserID,
+		&code.SessionID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.CodeChallenge,
+		&code.CodeChallengeMethod,
+		&code.Nonce,
+		&authTime,
+		&amr,
+		&code.ExpiresAt,
+		&codeUsedAt,
+		&issuedSessionID,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AuthorizationCode{}, fmt.Errorf("%s: %w", operation, storage.ErrCodeNotFound)
+		}
+
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	code.IssuedSessionID = issuedSessionID.String
+	code.AMR = strings.Fields(amr)
+	if authTime.Valid {
+		code.AuthTime = authTime.Time
+	}
+
+	if codeUsedAt.Valid {
+		code.UsedAt = codeUsedAt.Time
+		return code, fmt.Errorf("%s: %w", operation, storage.ErrCodeUsed)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"UPDATE authorization_codes SET used_at = ? WHERE code_hash = ?",
+		usedAt.UTC(),
+		codeHash,
+	); err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	code.UsedAt = usedAt
+
+	return code, nil
+}
+
+// SetCodeSession records the session that was created by exchanging a code.
+func (s *Storage) SetCodeSession(ctx context.Context, codeHash []byte, sessionID string) error {
+	const operation = "storage.sqlite.SetCodeSession"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE authorization_codes SET issued_session_id = ? WHERE code_hash = ?",
+		sessionID,
+		codeHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrCodeNotFound)
+}
+
+// SaveClientAssertion records the jti of a client assertion so that it can
+// only be used once. Assertions that have expired are forgotten.
+func (s *Storage) SaveClientAssertion(
+	ctx context.Context,
+	clientID string,
+	jti string,
+	expiresAt time.Time,
+) error {
+	const operation = "storage.sqlite.SaveClientAssertion"
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM client_assertions WHERE expires_at < ?",
+		time.Now().UTC(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	_, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO client_assertions(client_id, jti, expires_at) VALUES(?, ?, ?)",
+		clientID,
+		jti,
+		expiresAt.UTC(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return fmt.Errorf("%s: %w", operation, storage.ErrAssertionReplayed)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
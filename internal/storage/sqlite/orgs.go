@@ -0,0 +1,152 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// SaveOrg creates an organization with ownerID as its owner and returns its
+// id.
+func (s *Storage) SaveOrg(ctx context.Context, org models.Org, ownerID int64) (int64, error) {
+	const operation = "storage.sqlite.SaveOrg"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO orgs(name, created_at) VALUES(?, ?)",
+		org.Name,
+		org.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := insertOrgMember(ctx, tx, id, ownerID, models.OrgRoleOwner); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// Org returns the organization with the given id.
+func (s *Storage) Org(ctx context.Context, orgID int64) (models.Org, error) {
+	const operation = "storage.sqlite.Org"
+
+	var org models.Org
+
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, created_at FROM orgs WHERE id = ?", orgID).
+		Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Org{}, fmt.Errorf("%s: %w", operation, storage.ErrOrgNotFound)
+		}
+		return models.Org{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return org, nil
+}
+
+// OrgRole returns the role of userID in the organization orgID.
+func (s *Storage) OrgRole(ctx context.Context, orgID int64, userID int64) (string, error) {
+	const operation = "storage.sqlite.OrgRole"
+
+	var role string
+
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT role FROM org_members WHERE org_id = ? AND user_id = ?",
+		orgID,
+		userID,
+	).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", operation, storage.ErrOrgMemberNotFound)
+		}
+		return "", fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return role, nil
+}
+
+// OrgMembers returns the members of the organization orgID.
+func (s *Storage) OrgMembers(ctx context.Context, orgID int64) ([]models.OrgMember, error) {
+	const operation = "storage.sqlite.OrgMembers"
+
+	members, err := s.orgMembers(
+		ctx,
+		"SELECT org_id, user_id, role FROM org_members WHERE org_id = ? ORDER BY user_id",
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return members, nil
+}
+
+// UserOrgs returns the memberships of userID.
+func (s *Storage) UserOrgs(ctx context.Context, userID int64) ([]models.OrgMember, error) {
+	const operation = "storage.sqlite.UserOrgs"
+
+	members, err := s.orgMembers(
+		ctx,
+		"SELECT org_id, user_id, role FROM org_members WHERE user_id = ? ORDER BY org_id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return members, nil
+}
+
+func (s *Storage) orgMembers(ctx context.Context, query string, args ...any) ([]models.OrgMember, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.OrgMember{}
+	for rows.Next() {
+		var member models.OrgMember
+		if err := rows.Scan(&member.OrgID, &member.UserID, &member.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// insertOrgMember adds userID to the organization orgID with role.
+func insertOrgMember(ctx context.Context, tx *sql.Tx, orgID int64, userID int64, role string) error {
+	_, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO org_members(org_id, user_id, role) VALUES(?, ?, ?)",
+		orgID,
+		userID,
+		role,
+	)
+
+	return err
+}
@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// UpdatePassword replaces the password hash of a user and records it in the
+// user's password history.
+func (s *Storage) UpdatePassword(
+	ctx context.Context,
+	userID int64,
+	passHash []byte,
+	changedAt time.Time,
+) error {
+	const operation = "storage.sqlite.UpdatePassword"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"UPDATE users SET pass_hash = ?, password_changed_at = ? WHERE id = ? AND purged_at IS NULL",
+		passHash,
+		changedAt.UTC(),
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrUserNotFound); err != nil {
+		return err
+	}
+
+	if err := savePasswordHistory(ctx, tx, userID, passHash, changedAt); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// PasswordHistory returns the hashes of the last limit passwords of a user,
+// newest first. The current password is included.
+func (s *Storage) PasswordHistory(ctx context.Context, userID int64, limit int) ([][]byte, error) {
+	const operation = "storage.sqlite.PasswordHistory"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT pass_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?",
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var hashes [][]byte
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return hashes, nil
+}
+
+func savePasswordHistory(
+	ctx context.Context,
+	tx *sql.Tx,
+	userID int64,
+	passHash []byte,
+	createdAt time.Time,
+) error {
+	_, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO password_history(user_id, pass_hash, created_at) VALUES(?, ?, ?)",
+		userID,
+		passHash,
+		createdAt.UTC(),
+	)
+
+	return err
+}
@@ -0,0 +1,209 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+const phoneCodeColumns = "id, user_id, phone, purpose, attempts, expires_at, used_at, created_at, code_hash"
+
+// SavePhoneCode stores a new code sent by text message by its hash. Pending
+// codes of the user for the same purpose expire, so that only the latest
+// one works. It returns storage.ErrPhoneCodeThrottled instead when a code
+// was sent to the number after lastBefore or limit codes were sent since
+// since. Codes created before since are deleted.
+func (s *Storage) SavePhoneCode(
+	ctx context.Context,
+	code models.PhoneCode,
+	codeHash []byte,
+	lastBefore time.Time,
+	since time.Time,
+	limit int,
+) error {
+	const operation = "storage.sqlite.SavePhoneCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM phone_codes WHERE created_at < ?",
+		since.UTC(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE phone_codes SET expires_at = ?
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?`,
+		code.CreatedAt.UTC(),
+		code.UserID,
+		string(code.Purpose),
+		code.CreatedAt.UTC(),
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	// The limits are checked by the insert itself, so that concurrent
+	// sends to a number cannot both pass them.
+	res, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO phone_codes(id, user_id, phone, purpose, code_hash, expires_at, created_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM phone_codes WHERE phone = ? AND created_at > ?)
+		AND (SELECT COUNT(*) FROM phone_codes WHERE phone = ? AND created_at >= ?) < ?`,
+		code.ID,
+		code.UserID,
+		code.Phone,
+		string(code.Purpose),
+		codeHash,
+		code.ExpiresAt.UTC(),
+		code.CreatedAt.UTC(),
+		code.Phone,
+		lastBefore.UTC(),
+		code.Phone,
+		since.UTC(),
+		limit,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrPhoneCodeThrottled); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// PhoneCode returns the code with the given id together with its hash.
+func (s *Storage) PhoneCode(ctx context.Context, codeID string) (models.PhoneCode, []byte, error) {
+	const operation = "storage.sqlite.PhoneCode"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+phoneCodeColumns+" FROM phone_codes WHERE id = ?",
+		codeID,
+	)
+
+	code, codeHash, err := scanPhoneCode(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PhoneCode{}, nil, fmt.Errorf("%s: %w", operation, storage.ErrPhoneCodeNotFound)
+		}
+
+		return models.PhoneCode{}, nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return code, codeHash, nil
+}
+
+// AddPhoneCodeAttempt counts a guess of a pending code and returns the
+// number of attempts so far.
+func (s *Storage) AddPhoneCodeAttempt(ctx context.Context, codeID string) (int, error) {
+	const operation = "storage.sqlite.AddPhoneCodeAttempt"
+
+	var attempts int
+
+	err := s.db.QueryRowContext(
+		ctx,
+		"UPDATE phone_codes SET attempts = attempts + 1 WHERE id = ? AND used_at IS NULL RETURNING attempts",
+		codeID,
+	).Scan(&attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrPhoneCodeNotFound)
+		}
+
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return attempts, nil
+}
+
+// UsePhoneCode marks a pending code as used. It fails with
+// storage.ErrPhoneCodeNotFound if the code was used already.
+func (s *Storage) UsePhoneCode(ctx context.Context, codeID string, usedAt time.Time) error {
+	const operation = "storage.sqlite.UsePhoneCode"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE phone_codes SET used_at = ? WHERE id = ? AND used_at IS NULL",
+		usedAt.UTC(),
+		codeID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrPhoneCodeNotFound)
+}
+
+// SetPhoneVerified marks phone as the verified number of a user, provided
+// it is still the number on their profile. It fails with
+// storage.ErrPhoneTaken if another user verified the number first.
+func (s *Storage) SetPhoneVerified(ctx context.Context, userID int64, phone string, verifiedAt time.Time) error {
+	const operation = "storage.sqlite.SetPhoneVerified"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE users SET phone_verified_at = ? WHERE id = ? AND phone = ?",
+		verifiedAt.UTC(),
+		userID,
+		phone,
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return fmt.Errorf("%s: %w", operation, storage.ErrPhoneTaken)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrUserNotFound)
+}
+
+func scanPhoneCode(row scanner) (models.PhoneCode, []byte, error) {
+	var (
+		code     models.PhoneCode
+		purpose  string
+		usedAt   sql.NullTime
+		codeHash []byte
+	)
+
+	err := row.Scan(
+		&code.ID,
+		&code.UserID,
+		&code.Phone,
+		&purpose,
+		&code.Attempts,
+		&code.ExpiresAt,
+		&usedAt,
+		&code.CreatedAt,
+		&codeHash,
+	)
+	if err != nil {
+		return models.PhoneCode{}, nil, err
+	}
+
+	code.Purpose = models.PhoneCodePurpose(purpose)
+	code.UsedAt = usedAt.Time
+
+	return code, codeHash, nil
+}
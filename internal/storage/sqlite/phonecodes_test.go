@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/VariableSan/gia-sso/internal/storage/sqlite/sqlitetest"
+)
+
+func TestSavePhoneCodeLimitsConcurrentSends(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(sqlitetest.Path(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, err := s.SaveUser(ctx, "user@example.com", "user@example.com", []byte("hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		phone          string
+		resendInterval time.Duration
+		limit          int
+		want           int
+	}{
+		{name: "resend interval", phone: "+15550100001", resendInterval: time.Minute, limit: 10, want: 1},
+		{name: "hourly limit", phone: "+15550100002", limit: 3, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				wg        sync.WaitGroup
+				mu        sync.Mutex
+				saved     int
+				throttled int
+			)
+
+			now := time.Now()
+
+			for i := range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					err := s.SavePhoneCode(ctx, models.PhoneCode{
+						ID:        fmt.Sprintf("%s-%d", tt.phone, i),
+						UserID:    userID,
+						Phone:     tt.phone,
+						Purpose:   models.PhoneCodeVerification,
+						ExpiresAt: now.Add(time.Minute),
+						CreatedAt: now,
+					}, []byte(fmt.Sprintf("%s-%d", tt.phone, i)), now.Add(-tt.resendInterval), now.Add(-time.Hour), tt.limit)
+
+					mu.Lock()
+					defer mu.Unlock()
+
+					switch {
+					case err == nil:
+						saved++
+					case errors.Is(err, storage.ErrPhoneCodeThrottled):
+						throttled++
+					default:
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if saved != tt.want || throttled != 10-tt.want {
+				t.Fatalf("saved %d and throttled %d codes, want %d and %d", saved, throttled, tt.want, 10-tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// UpdateProfile replaces the profile attributes of a user. A phone number
+// that changes is no longer verified.
+func (s *Storage) UpdateProfile(ctx context.Context, userID int64, profile models.Profile) error {
+	const operation = "storage.sqlite.UpdateProfile"
+
+	metadata, err := marshalMetadata(profile.Metadata)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	adminMetadata, err := marshalMetadata(profile.AdminMetadata)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE users SET display_name = ?, given_name = ?, family_name = ?, locale = ?, timezone = ?,
+		avatar_url = ?, phone = ?, metadata = ?, admin_metadata = ?, profile_updated_at = ?,
+		phone_verified_at = CASE WHEN phone = ? THEN phone_verified_at END
+		WHERE id = ?`,
+		profile.DisplayName,
+		profile.GivenName,
+		profile.FamilyName,
+		profile.Locale,
+		profile.Timezone,
+		profile.AvatarURL,
+		profile.Phone,
+		metadata,
+		adminMetadata,
+		nullTime(profile.UpdatedAt),
+		profile.Phone,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrUserNotFound)
+}
+
+// marshalMetadata encodes a metadata bag, storing a missing one as an empty
+// object.
+func marshalMetadata(metadata map[string]any) (string, error) {
+	if metadata == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,195 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+const serviceProviderColumns = `entity_id, name, acs_urls, name_id_format, attributes, idp_initiated, created_at,
+	updated_at`
+
+func (s *Storage) SAMLServiceProvider(ctx context.Context, entityID string) (models.SAMLServiceProvider, error) {
+	const operation = "storage.sqlite.SAMLServiceProvider"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+serviceProviderColumns+" FROM saml_service_providers WHERE entity_id = ?",
+		entityID,
+	)
+
+	sp, err := scanServiceProvider(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, storage.ErrServiceProviderNotFound)
+		}
+
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return sp, nil
+}
+
+// SAMLServiceProviders returns all registered service providers ordered by
+// entity id.
+func (s *Storage) SAMLServiceProviders(ctx context.Context) ([]models.SAMLServiceProvider, error) {
+	const operation = "storage.sqlite.SAMLServiceProviders"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT "+serviceProviderColumns+" FROM saml_service_providers ORDER BY entity_id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var providers []models.SAMLServiceProvider
+	for rows.Next() {
+		sp, err := scanServiceProvider(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		providers = append(providers, sp)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return providers, nil
+}
+
+func (s *Storage) SaveSAMLServiceProvider(ctx context.Context, sp models.SAMLServiceProvider) error {
+	const operation = "storage.sqlite.SaveSAMLServiceProvider"
+
+	acsURLs, attributes, err := serviceProviderJSON(sp)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO saml_service_providers(entity_id, name, acs_urls, name_id_format, attributes, idp_initiated,
+		created_at, updated_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+		sp.EntityID,
+		sp.Name,
+		acsURLs,
+		sp.NameIDFormat,
+		attributes,
+		sp.IdPInitiated,
+		sp.CreatedAt.UTC(),
+		sp.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return fmt.Errorf("%s: %w", operation, storage.ErrServiceProviderExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdateSAMLServiceProvider(ctx context.Context, sp models.SAMLServiceProvider) error {
+	const operation = "storage.sqlite.UpdateSAMLServiceProvider"
+
+	acsURLs, attributes, err := serviceProviderJSON(sp)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE saml_service_providers SET name = ?, acs_urls = ?, name_id_format = ?, attributes = ?,
+		idp_initiated = ?, updated_at = ?
+		WHERE entity_id = ?`,
+		sp.Name,
+		acsURLs,
+		sp.NameIDFormat,
+		attributes,
+		sp.IdPInitiated,
+		sp.UpdatedAt.UTC(),
+		sp.EntityID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrServiceProviderNotFound)
+}
+
+func (s *Storage) DeleteSAMLServiceProvider(ctx context.Context, entityID string) error {
+	const operation = "storage.sqlite.DeleteSAMLServiceProvider"
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM saml_service_providers WHERE entity_id = ?", entityID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrServiceProviderNotFound)
+}
+
+func scanServiceProvider(row scanner) (models.SAMLServiceProvider, error) {
+	var (
+		sp         models.SAMLServiceProvider
+		acsURLs    string
+		attributes string
+	)
+
+	err := row.Scan(
+		&sp.EntityID,
+		&sp.Name,
+		&acsURLs,
+		&sp.NameIDFormat,
+		&attributes,
+		&sp.IdPInitiated,
+		&sp.CreatedAt,
+		&sp.UpdatedAt,
+	)
+	if err != nil {
+		return models.SAMLServiceProvider{}, err
+	}
+
+	if err := json.Unmarshal([]byte(acsURLs), &sp.ACSURLs); err != nil {
+		return models.SAMLServiceProvider{}, err
+	}
+	if err := json.Unmarshal([]byte(attributes), &sp.Attributes); err != nil {
+		return models.SAMLServiceProvider{}, err
+	}
+
+	return sp, nil
+}
+
+// serviceProviderJSON encodes the assertion consumer service URLs and the
+// attribute mapping of sp.
+func serviceProviderJSON(sp models.SAMLServiceProvider) (string, string, error) {
+	acsURLs := sp.ACSURLs
+	if acsURLs == nil {
+		acsURLs = []string{}
+	}
+	attributes := sp.Attributes
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+
+	acsData, err := json.Marshal(acsURLs)
+	if err != nil {
+		return "", "", err
+	}
+	attributeData, err := json.Marshal(attributes)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(acsData), string(attributeData), nil
+}
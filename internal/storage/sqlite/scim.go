@@ -0,0 +1,510 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+// scimUserQuery selects users that are neither deleted nor purged together
+// with their SCIM attributes. Service accounts are not provisioned by SCIM
+// clients and are left out.
+const scimUserQuery = `SELECT ` + userColumns + `, COALESCE(s.external_id, ''), COALESCE(s.given_name, ''),
+	COALESCE(s.family_name, ''), COALESCE(s.display_name, ''), s.created_at, s.updated_at
+	FROM users LEFT JOIN scim_users s ON s.user_id = users.id
+	WHERE users.status != 'deleted' AND users.purged_at IS NULL AND users.principal_type = 'user'`
+
+// scimMemberCondition limits group members to the users SCIM clients see.
+const scimMemberCondition = `user_id IN (SELECT id FROM users WHERE status != 'deleted' AND purged_at IS NULL
+	AND principal_type = 'user')`
+
+const scimGroupColumns = "id, display_name, external_id, created_at, updated_at"
+
+// SCIMUsers returns all users that are not deleted ordered by id.
+func (s *Storage) SCIMUsers(ctx context.Context) ([]models.SCIMUser, error) {
+	const operation = "storage.sqlite.SCIMUsers"
+
+	rows, err := s.db.QueryContext(ctx, scimUserQuery+" ORDER BY users.id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var users []models.SCIMUser
+	for rows.Next() {
+		user, err := scanSCIMUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	groups, err := s.userGroups(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	for i := range users {
+		users[i].Groups = groups[users[i].ID]
+	}
+
+	return users, nil
+}
+
+// SCIMUser returns a user that is not deleted.
+func (s *Storage) SCIMUser(ctx context.Context, userID int64) (models.SCIMUser, error) {
+	const operation = "storage.sqlite.SCIMUser"
+
+	row := s.db.QueryRowContext(ctx, scimUserQuery+" AND users.id = ?", userID)
+
+	user, err := scanSCIMUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.SCIMUser{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+		}
+
+		return models.SCIMUser{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	groups, err := s.userGroups(ctx, "WHERE m.user_id = ?", userID)
+	if err != nil {
+		return models.SCIMUser{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	user.Groups = groups[userID]
+
+	return user, nil
+}
+
+// SaveSCIMUser creates a user without a password together with its SCIM
+// attributes.
+func (s *Storage) SaveSCIMUser(ctx context.Context, user models.SCIMUser, emailNormalized string) (int64, error) {
+	const operation = "storage.sqlite.SaveSCIMUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO users(email, email_normalized, pass_hash, status, status_reason, status_changed_at)
+		VALUES(?, ?, X'', ?, ?, ?)`,
+		user.Email,
+		emailNormalized,
+		string(user.Status),
+		user.StatusReason,
+		user.CreatedAt.UTC(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return 0, fmt.Errorf("%s: %w", operation, storage.ErrUserExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	user.ID = id
+
+	if err := saveSCIMAttributes(ctx, tx, user); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// UpdateSCIMUser changes the email and the SCIM attributes of a user that
+// is not deleted.
+func (s *Storage) UpdateSCIMUser(ctx context.Context, user models.SCIMUser, emailNormalized string) error {
+	const operation = "storage.sqlite.UpdateSCIMUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		`UPDATE users SET email = ?, email_normalized = ?
+		WHERE id = ? AND status != 'deleted' AND purged_at IS NULL`,
+		user.Email,
+		emailNormalized,
+		user.ID,
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return fmt.Errorf("%s: %w", operation, storage.ErrUserExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrUserNotFound); err != nil {
+		return err
+	}
+
+	if err := saveSCIMAttributes(ctx, tx, user); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// saveSCIMAttributes creates or replaces the SCIM attributes of a user.
+// The creation time is kept from the first save.
+func saveSCIMAttributes(ctx context.Context, tx *sql.Tx, user models.SCIMUser) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO scim_users(user_id, external_id, given_name, family_name, display_name, created_at, updated_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET external_id = excluded.external_id, given_name = excluded.given_name,
+		family_name = excluded.family_name, display_name = excluded.display_name, updated_at = excluded.updated_at`,
+		user.ID,
+		user.ExternalID,
+		user.GivenName,
+		user.FamilyName,
+		user.DisplayName,
+		user.CreatedAt.UTC(),
+		user.UpdatedAt.UTC(),
+	)
+
+	return err
+}
+
+// userGroups returns the groups of the users that the membership
+// condition where selects, by user id.
+func (s *Storage) userGroups(ctx context.Context, where string, args ...any) (map[int64][]models.SCIMGroup, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT m.user_id, g.id, g.display_name
+		FROM scim_group_members m JOIN scim_groups g ON g.id = m.group_id `+where+`
+		ORDER BY g.display_name`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[int64][]models.SCIMGroup)
+	for rows.Next() {
+		var (
+			userID int64
+			group  models.SCIMGroup
+		)
+		if err := rows.Scan(&userID, &group.ID, &group.DisplayName); err != nil {
+			return nil, err
+		}
+		groups[userID] = append(groups[userID], group)
+	}
+
+	return groups, rows.Err()
+}
+
+// SCIMGroups returns all groups ordered by display name.
+func (s *Storage) SCIMGroups(ctx context.Context) ([]models.SCIMGroup, error) {
+	const operation = "storage.sqlite.SCIMGroups"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+scimGroupColumns+" FROM scim_groups ORDER BY display_name")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	var groups []models.SCIMGroup
+	for rows.Next() {
+		group, err := scanSCIMGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	members, err := s.groupMembers(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	for i := range groups {
+		groups[i].Members = members[groups[i].ID]
+	}
+
+	return groups, nil
+}
+
+func (s *Storage) SCIMGroup(ctx context.Context, groupID string) (models.SCIMGroup, error) {
+	const operation = "storage.sqlite.SCIMGroup"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+scimGroupColumns+" FROM scim_groups WHERE id = ?", groupID)
+
+	group, err := scanSCIMGroup(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.SCIMGroup{}, fmt.Errorf("%s: %w", operation, storage.ErrGroupNotFound)
+		}
+
+		return models.SCIMGroup{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	members, err := s.groupMembers(ctx, "AND group_id = ?", groupID)
+	if err != nil {
+		return models.SCIMGroup{}, fmt.Errorf("%s: %w", operation, err)
+	}
+	group.Members = members[groupID]
+
+	return group, nil
+}
+
+func (s *Storage) SaveSCIMGroup(ctx context.Context, group models.SCIMGroup) error {
+	const operation = "storage.sqlite.SaveSCIMGroup"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO scim_groups(id, display_name, external_id, created_at, updated_at) VALUES(?, ?, ?, ?, ?)",
+		group.ID,
+		group.DisplayName,
+		group.ExternalID,
+		group.CreatedAt.UTC(),
+		group.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", operation, storage.ErrGroupExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := saveGroupMembers(ctx, tx, group); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// UpdateSCIMGroup replaces the attributes and the members of a group.
+func (s *Storage) UpdateSCIMGroup(ctx context.Context, group models.SCIMGroup) error {
+	const operation = "storage.sqlite.UpdateSCIMGroup"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"UPDATE scim_groups SET display_name = ?, external_id = ?, updated_at = ? WHERE id = ?",
+		group.DisplayName,
+		group.ExternalID,
+		group.UpdatedAt.UTC(),
+		group.ID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", operation, storage.ErrGroupExists)
+		}
+
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrGroupNotFound); err != nil {
+		return err
+	}
+
+	// Deleted users keep their memberships in case they are restored.
+	if _, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM scim_group_members WHERE group_id = ? AND "+scimMemberCondition,
+		group.ID,
+	); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := saveGroupMembers(ctx, tx, group); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteSCIMGroup(ctx context.Context, groupID string) error {
+	const operation = "storage.sqlite.DeleteSCIMGroup"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM scim_group_members WHERE group_id = ?", groupID); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM scim_groups WHERE id = ?", groupID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrGroupNotFound); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+func saveGroupMembers(ctx context.Context, tx *sql.Tx, group models.SCIMGroup) error {
+	for _, userID := range group.Members {
+		if _, err := tx.ExecContext(
+			ctx,
+			"INSERT OR IGNORE INTO scim_group_members(group_id, user_id) VALUES(?, ?)",
+			group.ID,
+			userID,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// groupMembers returns the ids of the members SCIM clients see of the
+// groups that the condition and selects, by group id.
+func (s *Storage) groupMembers(ctx context.Context, and string, args ...any) (map[string][]int64, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT group_id, user_id FROM scim_group_members WHERE "+scimMemberCondition+" "+and+" ORDER BY user_id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make(map[string][]int64)
+	for rows.Next() {
+		var (
+			groupID string
+			userID  int64
+		)
+		if err := rows.Scan(&groupID, &userID); err != nil {
+			return nil, err
+		}
+		members[groupID] = append(members[groupID], userID)
+	}
+
+	return members, rows.Err()
+}
+
+func scanSCIMUser(row scanner) (models.SCIMUser, error) {
+	var (
+		user      models.SCIMUser
+		createdAt sql.NullTime
+		updatedAt sql.NullTime
+	)
+
+	base, err := scanUser(extraScanner{
+		row: row,
+		extra: []any{
+			&user.ExternalID,
+			&user.GivenName,
+			&user.FamilyName,
+			&user.DisplayName,
+			&createdAt,
+			&updatedAt,
+		},
+	})
+	if err != nil {
+		return models.SCIMUser{}, err
+	}
+
+	user.User = base
+	if createdAt.Valid {
+		user.CreatedAt = createdAt.Time
+	}
+	if updatedAt.Valid {
+		user.UpdatedAt = updatedAt.Time
+	}
+
+	return user, nil
+}
+
+func scanSCIMGroup(row scanner) (models.SCIMGroup, error) {
+	var group models.SCIMGroup
+
+	err := row.Scan(
+		&group.ID,
+		&group.DisplayName,
+		&group.ExternalID,
+		&group.CreatedAt,
+		&group.UpdatedAt,
+	)
+	if err != nil {
+		return models.SCIMGroup{}, err
+	}
+
+	return group, nil
+}
+
+// extraScanner scans the columns selected after those a scan function
+// knows about into extra.
+type extraScanner struct {
+	row   scanner
+	extra []any
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// isUniqueViolation reports whether err is a violated primary key or
+// unique constraint.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+// serviceAccountQuery selects service accounts that have not been purged
+// together with their users row.
+const serviceAccountQuery = `SELECT a.user_id, a.name, a.description, a.owner_id, users.is_admin, users.status, a.created_at
+	FROM service_accounts a JOIN users ON users.id = a.user_id
+	WHERE users.purged_at IS NULL`
+
+// SaveServiceAccount creates a service account and the users row behind it,
+// which has no email and no password, and returns its user id.
+func (s *Storage) SaveServiceAccount(ctx context.Context, account models.ServiceAccount) (int64, error) {
+	const operation = "storage.sqlite.SaveServiceAccount"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO users(pass_hash, principal_type) VALUES(X'', ?)",
+		string(models.PrincipalServiceAccount),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO service_accounts(user_id, name, description, owner_id, created_at) VALUES(?, ?, ?, ?, ?)",
+		id,
+		account.Name,
+		account.Description,
+		account.OwnerID,
+		account.CreatedAt.UTC(),
+	); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// ServiceAccount returns the service account with the given user id.
+func (s *Storage) ServiceAccount(ctx context.Context, accountID int64) (models.ServiceAccount, error) {
+	const operation = "storage.sqlite.ServiceAccount"
+
+	row := s.db.QueryRowContext(ctx, serviceAccountQuery+" AND a.user_id = ?", accountID)
+
+	account, err := scanServiceAccount(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, storage.ErrServiceAccountNotFound)
+		}
+
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return account, nil
+}
+
+// ServiceAccounts returns the service accounts owned by ownerID, or all of
+// them when ownerID is zero, ordered by id.
+func (s *Storage) ServiceAccounts(ctx context.Context, ownerID int64) ([]models.ServiceAccount, error) {
+	const operation = "storage.sqlite.ServiceAccounts"
+
+	query := serviceAccountQuery
+	args := []any{}
+	if ownerID != 0 {
+		query += " AND a.owner_id = ?"
+		args = append(args, ownerID)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY a.user_id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer rows.Close()
+
+	accounts := []models.ServiceAccount{}
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", operation, err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return accounts, nil
+}
+
+func scanServiceAccount(row scanner) (models.ServiceAccount, error) {
+	var (
+		account models.ServiceAccount
+		isAdmin bool
+		status  string
+	)
+
+	err := row.Scan(
+		&account.ID,
+		&account.Name,
+		&account.Description,
+		&account.OwnerID,
+		&isAdmin,
+		&status,
+		&account.CreatedAt,
+	)
+	if err != nil {
+		return models.ServiceAccount{}, err
+	}
+
+	account.Status = models.UserStatus(status)
+	account.Roles = []string{}
+	if isAdmin {
+		account.Roles = append(account.Roles, models.RoleAdmin)
+	}
+
+	return account, nil
+}
@@ -0,0 +1,346 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/VariableSan/gia-sso/internal/storage"
+)
+
+const sessionColumns = "id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at, revoked_at, client_id, parent_id, scope, auth_time, amr, browser"
+
+func (s *Storage) SaveSession(ctx context.Context, session models.Session, refreshHash []byte) error {
+	const operation = "storage.sqlite.SaveSession"
+
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO sessions(id, user_id, refresh_hash, device, ip, user_agent, created_at, last_seen_at, expires_at, client_id, parent_id, scope, auth_time, amr)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID,
+		session.UserID,
+		refreshHash,
+		session.Device,
+		session.IP,
+		session.UserAgent,
+		session.CreatedAt.UTC(),
+		session.LastSeenAt.UTC(),
+		session.ExpiresAt.UTC(),
+		nullString(session.ClientID),
+		nullString(session.ParentID),
+		session.Scope,
+		session.AuthTime.UTC(),
+		strings.Join(session.AMR, " "),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Session(ctx context.Context, sessionID string) (models.Session, error) {
+	const operation = "storage.sqlite.Session"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = ?", sessionID)
+
+	session, err := scanSession(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Session{}, fmt.Errorf("%s: %w", operation, storage.ErrSessionNotFound)
+		}
+
+		return models.Session{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return session, nil
+}
+
+func (s *Storage) SessionByRefreshHash(ctx context.Context, refreshHash []byte) (models.Session, error) {
+	const operation = "storage.sqlite.SessionByRefreshHash"
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE refresh_hash = ?", refreshHash)
+
+	session, err := scanSession(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Session{}, fmt.Errorf("%s: %w", operation, storage.ErrSessionNotFound)
+		}
+
+		return models.Session{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return session, nil
+}
+
+// Sessions returns the sessions of a user that are neither revoked nor expired,
+// most recently used first.
+func (s *Storage) Sessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const operation = "storage.sqlite.Sessions"
+
+	sessions, err := s.querySessions(
+		ctx,
+		"SELECT "+sessionColumns+` FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_seen_at DESC`,
+		userID,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return sessions, nil
+}
+
+// AllSessions returns every session a user ever had, including revoked and
+// expired ones, oldest first.
+func (s *Storage) AllSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const operation = "storage.sqlite.AllSessions"
+
+	sessions, err := s.querySessions(
+		ctx,
+		"SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return sessions, nil
+}
+
+// RotateSession replaces the refresh token of an active session and extends its lifetime.
+func (s *Storage) RotateSession(
+	ctx context.Context,
+	sessionID string,
+	refreshHash []byte,
+	lastSeenAt time.Time,
+	expiresAt time.Time,
+) error {
+	const operation = "storage.sqlite.RotateSession"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE sessions SET refresh_hash = ?, last_seen_at = ?, expires_at = ? WHERE id = ? AND revoked_at IS NULL",
+		refreshHash,
+		lastSeenAt.UTC(),
+		expiresAt.UTC(),
+		sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrSessionNotFound)
+}
+
+// StartBrowserSession turns a session opened by Login into a browser session
+// whose refresh hash is replaced with the hash of its cookie.
+func (s *Storage) StartBrowserSession(ctx context.Context, sessionID string, cookieHash []byte) error {
+	const operation = "storage.sqlite.StartBrowserSession"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE sessions SET browser = TRUE, refresh_hash = ?
+		WHERE id = ? AND client_id IS NULL AND revoked_at IS NULL`,
+		cookieHash,
+		sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrSessionNotFound)
+}
+
+func (s *Storage) TouchSession(ctx context.Context, sessionID string, lastSeenAt time.Time) error {
+	const operation = "storage.sqlite.TouchSession"
+
+	_, err := s.db.ExecContext(
+		ctx,
+		"UPDATE sessions SET last_seen_at = ? WHERE id = ?",
+		lastSeenAt.UTC(),
+		sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// RevokeSession revokes a session together with the client sessions that
+// were opened from it.
+func (s *Storage) RevokeSession(ctx context.Context, sessionID string, revokedAt time.Time) error {
+	const operation = "storage.sqlite.RevokeSession"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	const where = "(id = ? OR parent_id = ?) AND revoked_at IS NULL"
+
+	if err := queueLogoutNotifications(ctx, tx, revokedAt, where, sessionID, sessionID); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	res, err := tx.ExecContext(
+		ctx,
+		"UPDATE sessions SET revoked_at = ? WHERE "+where,
+		revokedAt.UTC(),
+		sessionID,
+		sessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := expectAffected(operation, res, storage.ErrSessionNotFound); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of a user except exceptID
+// and the client sessions opened from it. exceptID may be empty to revoke all
+// of them.
+func (s *Storage) RevokeUserSessions(
+	ctx context.Context,
+	userID int64,
+	exceptID string,
+	revokedAt time.Time,
+) (int64, error) {
+	const operation = "storage.sqlite.RevokeUserSessions"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+	defer tx.Rollback()
+
+	const where = "user_id = ? AND id != ? AND (parent_id IS NULL OR parent_id != ?) AND revoked_at IS NULL"
+
+	if err := queueLogoutNotifications(ctx, tx, revokedAt, where, userID, exceptID, exceptID); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	res, err := tx.ExecContext(
+		ctx,
+		"UPDATE sessions SET revoked_at = ? WHERE "+where,
+		revokedAt.UTC(),
+		userID,
+		exceptID,
+		exceptID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	revoked, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return revoked, nil
+}
+
+func (s *Storage) querySessions(ctx context.Context, query string, args ...any) ([]models.Session, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row scanner) (models.Session, error) {
+	var (
+		session   models.Session
+		revokedAt sql.NullTime
+		clientID  sql.NullString
+		parentID  sql.NullString
+		authTime  sql.NullTime
+		amr       string
+	)
+
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.IP,
+		&session.UserAgent,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+		&revokedAt,
+		&clientID,
+		&parentID,
+		&session.Scope,
+		&authTime,
+		&amr,
+		&session.Browser,
+	)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	if revokedAt.Valid {
+		session.RevokedAt = revokedAt.Time
+	}
+	session.ClientID = clientID.String
+	session.ParentID = parentID.String
+	session.AMR = strings.Fields(amr)
+	if authTime.Valid {
+		session.AuthTime = authTime.Time
+	}
+
+	return session, nil
+}
+
+func expectAffected(operation string, res sql.Result, notFound error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", operation, notFound)
+	}
+
+	return nil
+}
+
+// nullString stores empty strings as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -3,8 +3,11 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/VariableSan/gia-sso/internal/domain/models"
 	"github.com/VariableSan/gia-sso/internal/storage"
@@ -18,7 +21,9 @@ type Storage struct {
 func New(storagePath string) (*Storage, error) {
 	const operation = "storage.sqlite.New"
 
-	db, err := sql.Open("sqlite3", storagePath)
+	// SQLite leaves foreign keys unenforced unless asked to on every
+	// connection, which the driver does for _foreign_keys.
+	db, err := sql.Open("sqlite3", withForeignKeys(storagePath))
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", operation, err)
 	}
@@ -26,48 +31,100 @@ func New(storagePath string) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
+// withForeignKeys adds the DSN parameter that turns on foreign key
+// enforcement to storagePath, which may already carry parameters.
+func withForeignKeys(storagePath string) string {
+	separator := "?"
+	if strings.Contains(storagePath, "?") {
+		separator = "&"
+	}
+
+	return storagePath + separator + "_foreign_keys=on"
+}
+
 func (s *Storage) Stop() error {
 	return s.db.Close()
 }
 
-func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (int64, error) {
+// SaveUser creates a user. emailNormalized is the canonical form of email
+// that users are looked up and kept unique by.
+func (s *Storage) SaveUser(
+	ctx context.Context,
+	email string,
+	emailNormalized string,
+	passHash []byte,
+) (int64, error) {
 	const operation = "storage.sqlite.SaveUser"
 
-	stmt, err := s.db.Prepare("INSERT INTO users(email, pass_hash) VALUES(?, ?)")
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", operation, err)
 	}
+	defer tx.Rollback()
 
-	res, err := stmt.ExecContext(ctx, email, passHash)
+	id, err := insertUser(ctx, tx, email, emailNormalized, passHash)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return id, nil
+}
+
+// insertUser creates a user within tx and starts their password history.
+func insertUser(
+	ctx context.Context,
+	tx *sql.Tx,
+	email string,
+	emailNormalized string,
+	passHash []byte,
+) (int64, error) {
+	now := time.Now().UTC()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO users(email, email_normalized, pass_hash, password_changed_at) VALUES(?, ?, ?, ?)",
+		email,
+		emailNormalized,
+		passHash,
+		now,
+	)
 	if err != nil {
 		var sqliteErr sqlite3.Error
 		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-			return 0, fmt.Errorf("%s: %w", operation, storage.ErrUserExists)
+			return 0, storage.ErrUserExists
 		}
 
-		return 0, fmt.Errorf("%s: %w", operation, err)
+		return 0, err
 	}
 
 	id, err := res.LastInsertId()
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w", operation, err)
+		return 0, err
+	}
+
+	if err := savePasswordHistory(ctx, tx, id, passHash, now); err != nil {
+		return 0, err
 	}
 
 	return id, nil
 }
 
-func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
+// User returns the user with the given normalized email.
+func (s *Storage) User(ctx context.Context, emailNormalized string) (models.User, error) {
 	const operation = "storage.sqlite.User"
 
-	stmt, err := s.db.Prepare("SELECT id, email, pass_hash FROM users WHERE email = ?")
+	stmt, err := s.db.Prepare("SELECT " + userColumns + " FROM users WHERE email_normalized = ?")
 	if err != nil {
 		return models.User{}, fmt.Errorf("%s: %w", operation, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, email)
+	row := stmt.QueryRowContext(ctx, emailNormalized)
 
-	var user models.User
-	err = row.Scan(&user.ID, &user.Email, &user.PassHash)
+	user, err := scanUser(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
@@ -102,3 +159,146 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 
 	return isAdmin, nil
 }
+
+// SetUserAdmin grants or revokes the admin role of a user.
+func (s *Storage) SetUserAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	const operation = "storage.sqlite.SetUserAdmin"
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"UPDATE users SET is_admin = ? WHERE id = ? AND purged_at IS NULL",
+		isAdmin,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrUserNotFound)
+}
+
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const operation = "storage.sqlite.UserByID"
+
+	stmt, err := s.db.Prepare("SELECT " + userColumns + " FROM users WHERE id = ?")
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, userID)
+
+	user, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", operation, storage.ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return user, nil
+}
+
+// SetUserStatus changes the status of a user that has not been purged.
+// Moving a user to the deleted status starts the deletion grace period,
+// moving it anywhere else cancels it.
+func (s *Storage) SetUserStatus(
+	ctx context.Context,
+	userID int64,
+	status models.UserStatus,
+	reason string,
+	changedAt time.Time,
+) error {
+	const operation = "storage.sqlite.SetUserStatus"
+
+	var deletedAt sql.NullTime
+	if status == models.UserStatusDeleted {
+		deletedAt = sql.NullTime{Time: changedAt.UTC(), Valid: true}
+	}
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE users SET status = ?, status_reason = ?, status_changed_at = ?, deleted_at = ?
+		WHERE id = ? AND purged_at IS NULL`,
+		string(status),
+		reason,
+		changedAt.UTC(),
+		deletedAt,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return expectAffected(operation, res, storage.ErrUserNotFound)
+}
+
+// userColumns are qualified, as scim_users has name columns of its own.
+const userColumns = `users.id, COALESCE(users.email, ''), users.pass_hash, users.status, users.status_reason,
+	users.status_changed_at, users.deleted_at, users.password_changed_at, users.principal_type,
+	users.display_name, users.given_name, users.family_name, users.locale, users.timezone, users.avatar_url,
+	users.phone, users.phone_verified_at, users.metadata, users.admin_metadata, users.profile_updated_at`
+
+func scanUser(row scanner) (models.User, error) {
+	var (
+		user              models.User
+		status            string
+		principalType     string
+		statusChangedAt   sql.NullTime
+		deletedAt         sql.NullTime
+		passwordChangedAt sql.NullTime
+		phoneVerifiedAt   sql.NullTime
+		metadata          string
+		adminMetadata     string
+		profileUpdatedAt  sql.NullTime
+	)
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.PassHash,
+		&status,
+		&user.StatusReason,
+		&statusChangedAt,
+		&deletedAt,
+		&passwordChangedAt,
+		&principalType,
+		&user.Profile.DisplayName,
+		&user.Profile.GivenName,
+		&user.Profile.FamilyName,
+		&user.Profile.Locale,
+		&user.Profile.Timezone,
+		&user.Profile.AvatarURL,
+		&user.Profile.Phone,
+		&phoneVerifiedAt,
+		&metadata,
+		&adminMetadata,
+		&profileUpdatedAt,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := json.Unmarshal([]byte(metadata), &user.Profile.Metadata); err != nil {
+		return models.User{}, fmt.Errorf("malformed metadata: %w", err)
+	}
+	if err := json.Unmarshal([]byte(adminMetadata), &user.Profile.AdminMetadata); err != nil {
+		return models.User{}, fmt.Errorf("malformed admin metadata: %w", err)
+	}
+	user.Profile.PhoneVerifiedAt = phoneVerifiedAt.Time
+	user.Profile.UpdatedAt = profileUpdatedAt.Time
+
+	user.Status = models.UserStatus(status)
+	user.PrincipalType = models.PrincipalType(principalType)
+	if statusChangedAt.Valid {
+		user.StatusChangedAt = statusChangedAt.Time
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = deletedAt.Time
+	}
+	if passwordChangedAt.Valid {
+		user.PasswordChangedAt = passwordChangedAt.Time
+	}
+
+	return user, nil
+}
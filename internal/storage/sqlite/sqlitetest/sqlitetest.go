@@ -0,0 +1,34 @@
+// Package sqlitetest creates migrated sqlite databases for tests.
+package sqlitetest
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+// Path creates a database in a temporary directory of t, applies every
+// migration to it and returns its path.
+func Path(t testing.TB) string {
+	t.Helper()
+
+	_, file, _, _ := runtime.Caller(0)
+	migrations := filepath.Join(filepath.Dir(file), "..", "..", "..", "..", "migrations")
+	storagePath := filepath.Join(t.TempDir(), "sso.db")
+
+	m, err := migrate.New("file://"+migrations, "sqlite3://"+storagePath)
+	if err != nil {
+		t.Fatalf("failed to open migrations: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+
+	return storagePath
+}
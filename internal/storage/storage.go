@@ -3,7 +3,48 @@ package storage
 import "errors"
 
 var (
-	ErrUserExists   = errors.New("user already exists")
-	ErrUserNotFound = errors.New("user not found")
-	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrClientNotFound     = errors.New("oauth client not found")
+	ErrClientExists       = errors.New("oauth client already exists")
+	ErrCodeNotFound       = errors.New("authorization code not found")
+	// ErrCodeUsed is returned when an authorization code is presented again
+	// after it has already been exchanged.
+	ErrCodeUsed = errors.New("authorization code already used")
+	// ErrAssertionReplayed is returned when a client assertion id is seen
+	// a second time.
+	ErrAssertionReplayed  = errors.New("client assertion already used")
+	ErrDeviceCodeNotFound = errors.New("device code not found")
+	// ErrUserCodeExists is returned when a newly generated user code
+	// collides with one that is still stored.
+	ErrUserCodeExists             = errors.New("user code already exists")
+	ErrLogoutNotificationNotFound = errors.New("logout notification not found")
+	ErrGrantNotFound              = errors.New("oauth grant not found")
+	ErrIdentityNotFound           = errors.New("identity not found")
+	ErrIdentityExists             = errors.New("identity already linked")
+	ErrUpstreamLoginNotFound      = errors.New("upstream login not found")
+	ErrServiceProviderNotFound    = errors.New("saml service provider not found")
+	ErrServiceProviderExists      = errors.New("saml service provider already exists")
+	ErrGroupNotFound              = errors.New("group not found")
+	// ErrGroupExists is returned when another group has the same display
+	// name.
+	ErrGroupExists            = errors.New("group already exists")
+	ErrAPIKeyNotFound         = errors.New("api key not found")
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrEmailLoginNotFound     = errors.New("email login not found")
+	ErrInvitationNotFound     = errors.New("invitation not found")
+	ErrPhoneCodeNotFound      = errors.New("phone code not found")
+	ErrOrgNotFound            = errors.New("organization not found")
+	ErrOrgMemberNotFound      = errors.New("organization member not found")
+	// ErrPhoneTaken is returned when a phone number is already verified by
+	// another user.
+	ErrPhoneTaken = errors.New("phone number already verified by another user")
+	// ErrEmailLoginThrottled is returned when a passwordless login was
+	// requested for the same address too recently.
+	ErrEmailLoginThrottled = errors.New("email login requested too often")
+	// ErrPhoneCodeThrottled is returned when too many codes were sent to a
+	// phone number recently.
+	ErrPhoneCodeThrottled = errors.New("too many codes sent to this phone number")
 )
@@ -0,0 +1,15 @@
+ALTER TABLE sessions
+    ADD COLUMN auth_time DATETIME;
+-- Space separated authentication method references (RFC 8176).
+ALTER TABLE sessions
+    ADD COLUMN amr TEXT NOT NULL DEFAULT '';
+UPDATE sessions
+SET auth_time = created_at,
+    amr       = 'pwd';
+
+ALTER TABLE authorization_codes
+    ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
+ALTER TABLE authorization_codes
+    ADD COLUMN auth_time DATETIME;
+ALTER TABLE authorization_codes
+    ADD COLUMN amr TEXT NOT NULL DEFAULT '';
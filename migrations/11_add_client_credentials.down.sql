@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS client_assertions;
+ALTER TABLE oauth_clients DROP COLUMN jwks;
+ALTER TABLE oauth_clients DROP COLUMN audience;
+ALTER TABLE oauth_clients DROP COLUMN scopes;
+ALTER TABLE oauth_clients DROP COLUMN grant_types;
+ALTER TABLE oauth_clients DROP COLUMN token_endpoint_auth_method;
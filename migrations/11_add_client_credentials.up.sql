@@ -0,0 +1,25 @@
+-- client_secret_basic, client_secret_post, private_key_jwt or none. Empty
+-- means a secret if the client has one and none otherwise.
+ALTER TABLE oauth_clients
+    ADD COLUMN token_endpoint_auth_method TEXT NOT NULL DEFAULT '';
+ALTER TABLE oauth_clients
+    ADD COLUMN grant_types TEXT NOT NULL DEFAULT '["authorization_code","refresh_token"]';
+-- JSON arrays of the scopes and audiences client_credentials tokens may be
+-- issued for.
+ALTER TABLE oauth_clients
+    ADD COLUMN scopes TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE oauth_clients
+    ADD COLUMN audience TEXT NOT NULL DEFAULT '[]';
+-- JSON Web Key Set with the public keys of private_key_jwt clients.
+ALTER TABLE oauth_clients
+    ADD COLUMN jwks TEXT NOT NULL DEFAULT '';
+
+-- jti values of client assertions seen, kept until the assertion expires to
+-- reject replays.
+CREATE TABLE IF NOT EXISTS client_assertions
+(
+    client_id  TEXT     NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    jti        TEXT     NOT NULL,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (client_id, jti)
+);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS device_codes
+(
+    device_code_hash BLOB PRIMARY KEY,
+    -- Code the user types on the verification page, stored without the
+    -- separator.
+    user_code        TEXT     NOT NULL UNIQUE,
+    client_id        TEXT     NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    scope            TEXT     NOT NULL DEFAULT '',
+    -- pending, approved, denied or used.
+    status           TEXT     NOT NULL DEFAULT 'pending',
+    -- User and browser session that approved or denied the request.
+    user_id          INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    session_id       TEXT REFERENCES sessions (id) ON DELETE CASCADE,
+    auth_time        DATETIME,
+    amr              TEXT     NOT NULL DEFAULT '',
+    -- Minimum number of seconds between two polls of the token endpoint.
+    poll_interval    INTEGER  NOT NULL,
+    last_polled_at   DATETIME,
+    expires_at       DATETIME NOT NULL,
+    created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_device_codes_user_id ON device_codes (user_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS logout_notifications;
+ALTER TABLE oauth_clients DROP COLUMN backchannel_logout_uri;
+ALTER TABLE oauth_clients DROP COLUMN frontchannel_logout_uri;
+ALTER TABLE oauth_clients DROP COLUMN post_logout_redirect_uris;
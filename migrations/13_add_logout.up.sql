@@ -0,0 +1,28 @@
+-- JSON array of the exact URIs users may be sent to after logging out.
+ALTER TABLE oauth_clients
+    ADD COLUMN post_logout_redirect_uris TEXT NOT NULL DEFAULT '[]';
+-- URI loaded in a hidden frame when the browser session ends.
+ALTER TABLE oauth_clients
+    ADD COLUMN frontchannel_logout_uri TEXT NOT NULL DEFAULT '';
+-- URI logout tokens are POSTed to when a session the client holds tokens
+-- for ends.
+ALTER TABLE oauth_clients
+    ADD COLUMN backchannel_logout_uri TEXT NOT NULL DEFAULT '';
+
+-- Back-channel logout tokens waiting to be delivered. Rows are queued when
+-- sessions are revoked and removed once delivered or given up on.
+CREATE TABLE IF NOT EXISTS logout_notifications
+(
+    id              INTEGER PRIMARY KEY,
+    client_id       TEXT     NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id         INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- sid of the ID tokens issued to the client, i.e. the browser session.
+    session_id      TEXT     NOT NULL,
+    attempts        INTEGER  NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error      TEXT     NOT NULL DEFAULT '',
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (client_id, session_id)
+);
+CREATE INDEX IF NOT EXISTS idx_logout_notifications_next_attempt_at ON logout_notifications (next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_logout_notifications_user_id ON logout_notifications (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE oauth_clients DROP COLUMN updated_at;
+ALTER TABLE oauth_clients DROP COLUMN registration_token_hash;
+ALTER TABLE oauth_clients DROP COLUMN refresh_token_ttl;
+ALTER TABLE oauth_clients DROP COLUMN access_token_ttl;
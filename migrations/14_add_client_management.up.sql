@@ -0,0 +1,12 @@
+-- Lifetimes of the tokens issued to the client in seconds, 0 for the
+-- server defaults.
+ALTER TABLE oauth_clients
+    ADD COLUMN access_token_ttl INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE oauth_clients
+    ADD COLUMN refresh_token_ttl INTEGER NOT NULL DEFAULT 0;
+-- SHA-256 of the registration access token of clients registered through
+-- dynamic client registration, which lets them manage their registration.
+ALTER TABLE oauth_clients
+    ADD COLUMN registration_token_hash BLOB;
+ALTER TABLE oauth_clients
+    ADD COLUMN updated_at DATETIME;
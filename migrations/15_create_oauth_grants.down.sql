@@ -0,0 +1,3 @@
+ALTER TABLE oauth_clients DROP COLUMN first_party;
+DROP INDEX IF EXISTS idx_oauth_grants_client_id;
+DROP TABLE IF EXISTS oauth_grants;
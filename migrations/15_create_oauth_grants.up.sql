@@ -0,0 +1,17 @@
+-- Scopes users have consented to give third-party clients.
+CREATE TABLE IF NOT EXISTS oauth_grants
+(
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id  TEXT     NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    scope      TEXT     NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id)
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_grants_client_id ON oauth_grants (client_id);
+
+-- First-party clients skip the consent screen. Existing clients predate
+-- consent and are all operated by us.
+ALTER TABLE oauth_clients
+    ADD COLUMN first_party BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE oauth_clients SET first_party = TRUE;
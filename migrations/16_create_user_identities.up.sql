@@ -0,0 +1,24 @@
+-- Accounts of users at upstream identity providers.
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    provider      TEXT     NOT NULL,
+    subject       TEXT     NOT NULL,
+    user_id       INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email         TEXT     NOT NULL DEFAULT '',
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+-- Logins at upstream providers in progress, keyed by the SHA-256 of their
+-- state parameter.
+CREATE TABLE IF NOT EXISTS upstream_logins
+(
+    state_hash    BLOB PRIMARY KEY,
+    provider      TEXT     NOT NULL,
+    nonce         TEXT     NOT NULL,
+    code_verifier TEXT     NOT NULL,
+    return_to     TEXT     NOT NULL,
+    expires_at    DATETIME NOT NULL
+);
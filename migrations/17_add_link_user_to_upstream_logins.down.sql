@@ -0,0 +1 @@
+ALTER TABLE upstream_logins DROP COLUMN link_user_id;
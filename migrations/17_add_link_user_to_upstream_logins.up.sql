@@ -0,0 +1,4 @@
+-- Logins at upstream providers started to link an identity to an account
+-- that is already signed in, rather than to sign in.
+ALTER TABLE upstream_logins
+    ADD COLUMN link_user_id INTEGER NOT NULL DEFAULT 0;
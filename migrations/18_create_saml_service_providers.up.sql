@@ -0,0 +1,13 @@
+-- Applications that sign users in with SAML 2.0. acs_urls and attributes
+-- are JSON.
+CREATE TABLE IF NOT EXISTS saml_service_providers
+(
+    entity_id      TEXT PRIMARY KEY,
+    name           TEXT     NOT NULL,
+    acs_urls       TEXT     NOT NULL,
+    name_id_format TEXT     NOT NULL,
+    attributes     TEXT     NOT NULL,
+    idp_initiated  BOOLEAN  NOT NULL DEFAULT FALSE,
+    created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,30 @@
+-- Attributes of users provisioned by SCIM clients that gia-sso does not
+-- otherwise keep.
+CREATE TABLE IF NOT EXISTS scim_users
+(
+    user_id      INTEGER PRIMARY KEY REFERENCES users (id),
+    external_id  TEXT     NOT NULL DEFAULT '',
+    given_name   TEXT     NOT NULL DEFAULT '',
+    family_name  TEXT     NOT NULL DEFAULT '',
+    display_name TEXT     NOT NULL DEFAULT '',
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS scim_groups
+(
+    id           TEXT PRIMARY KEY,
+    display_name TEXT     NOT NULL,
+    external_id  TEXT     NOT NULL DEFAULT '',
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_groups_display_name ON scim_groups (display_name COLLATE NOCASE);
+
+CREATE TABLE IF NOT EXISTS scim_group_members
+(
+    group_id TEXT    NOT NULL REFERENCES scim_groups (id),
+    user_id  INTEGER NOT NULL REFERENCES users (id),
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_scim_group_members_user_id ON scim_group_members (user_id);
@@ -0,0 +1,15 @@
+-- Long-lived API keys of users, keyed by the SHA-256 of the key.
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           TEXT PRIMARY KEY,
+    user_id      INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT     NOT NULL,
+    prefix       TEXT     NOT NULL,
+    key_hash     BLOB     NOT NULL UNIQUE,
+    scopes       TEXT     NOT NULL DEFAULT '',
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at   DATETIME,
+    last_used_at DATETIME,
+    revoked_at   DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
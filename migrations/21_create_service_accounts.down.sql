@@ -0,0 +1,3 @@
+ALTER TABLE oauth_clients DROP COLUMN service_account_id;
+DROP TABLE IF EXISTS service_accounts;
+ALTER TABLE users DROP COLUMN principal_type;
@@ -0,0 +1,18 @@
+-- user for people, service_account for the non-human accounts described in
+-- service_accounts. Service accounts have no email and an empty pass_hash.
+ALTER TABLE users
+    ADD COLUMN principal_type TEXT NOT NULL DEFAULT 'user';
+
+CREATE TABLE IF NOT EXISTS service_accounts
+(
+    user_id     INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    name        TEXT     NOT NULL,
+    description TEXT     NOT NULL DEFAULT '',
+    owner_id    INTEGER  NOT NULL REFERENCES users (id),
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_service_accounts_owner_id ON service_accounts (owner_id);
+
+-- The service account tokens of the client credentials grant are issued for.
+ALTER TABLE oauth_clients
+    ADD COLUMN service_account_id INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+-- Passwordless logins with a code or magic link sent by email. secret_hash
+-- is an HMAC of the code or the SHA-256 of the link token.
+CREATE TABLE IF NOT EXISTS email_logins
+(
+    id          TEXT PRIMARY KEY,
+    user_id     INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    method      TEXT     NOT NULL,
+    secret_hash BLOB     NOT NULL UNIQUE,
+    attempts    INTEGER  NOT NULL DEFAULT 0,
+    expires_at  DATETIME NOT NULL,
+    used_at     DATETIME,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_email_logins_user_id ON email_logins (user_id);
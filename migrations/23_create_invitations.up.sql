@@ -0,0 +1,17 @@
+-- Invitations to register, keyed by the SHA-256 of their code.
+CREATE TABLE IF NOT EXISTS invitations
+(
+    id               TEXT PRIMARY KEY,
+    email            TEXT     NOT NULL,
+    email_normalized TEXT     NOT NULL,
+    role             TEXT     NOT NULL DEFAULT '',
+    code_hash        BLOB     NOT NULL UNIQUE,
+    invited_by       INTEGER  NOT NULL REFERENCES users (id),
+    created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at       DATETIME NOT NULL,
+    accepted_at      DATETIME,
+    accepted_by      INTEGER  NOT NULL DEFAULT 0,
+    revoked_at       DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_invitations_email_normalized ON invitations (email_normalized);
+CREATE INDEX IF NOT EXISTS idx_invitations_accepted_by ON invitations (accepted_by);
@@ -0,0 +1,10 @@
+ALTER TABLE users DROP COLUMN profile_updated_at;
+ALTER TABLE users DROP COLUMN admin_metadata;
+ALTER TABLE users DROP COLUMN metadata;
+ALTER TABLE users DROP COLUMN phone;
+ALTER TABLE users DROP COLUMN avatar_url;
+ALTER TABLE users DROP COLUMN timezone;
+ALTER TABLE users DROP COLUMN locale;
+ALTER TABLE users DROP COLUMN family_name;
+ALTER TABLE users DROP COLUMN given_name;
+ALTER TABLE users DROP COLUMN display_name;
@@ -0,0 +1,12 @@
+-- Profile attributes of users. The metadata bags are JSON objects; users
+-- edit metadata, only admins edit admin_metadata.
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN given_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN family_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN phone TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN admin_metadata TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN profile_updated_at DATETIME;
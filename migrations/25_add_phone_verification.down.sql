@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS phone_codes;
+DROP INDEX IF EXISTS idx_users_verified_phone;
+ALTER TABLE users DROP COLUMN phone_verified_at;
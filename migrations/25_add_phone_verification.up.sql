@@ -0,0 +1,21 @@
+-- A verified phone number identifies a single user.
+ALTER TABLE users ADD COLUMN phone_verified_at DATETIME;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verified_phone ON users (phone) WHERE phone_verified_at IS NOT NULL;
+
+-- One-time codes sent by text message, to verify a number or as a second
+-- factor. code_hash is an HMAC of the code. Codes are kept for a while after
+-- they expire, as sends are rate limited per number.
+CREATE TABLE IF NOT EXISTS phone_codes
+(
+    id         TEXT PRIMARY KEY,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    phone      TEXT     NOT NULL,
+    purpose    TEXT     NOT NULL,
+    code_hash  BLOB     NOT NULL,
+    attempts   INTEGER  NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL,
+    used_at    DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_phone_codes_user_id ON phone_codes (user_id);
+CREATE INDEX IF NOT EXISTS idx_phone_codes_phone ON phone_codes (phone, created_at);
@@ -0,0 +1,2 @@
+-- Deleted orphan rows cannot be restored.
+SELECT 1;
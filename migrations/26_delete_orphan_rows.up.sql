@@ -0,0 +1,55 @@
+-- Foreign keys were not enforced before, so rows may point at users,
+-- clients or sessions that no longer exist. Remove them so that enforcing
+-- the constraints does not trip over them.
+WITH RECURSIVE orphaned(id) AS (
+    SELECT id
+    FROM sessions
+    WHERE user_id NOT IN (SELECT id FROM users)
+       OR (client_id IS NOT NULL AND client_id NOT IN (SELECT id FROM oauth_clients))
+       OR (parent_id IS NOT NULL AND parent_id NOT IN (SELECT id FROM sessions))
+    UNION
+    SELECT sessions.id
+    FROM sessions
+             JOIN orphaned ON sessions.parent_id = orphaned.id
+)
+DELETE FROM sessions WHERE id IN (SELECT id FROM orphaned);
+
+DELETE FROM authorization_codes
+WHERE client_id NOT IN (SELECT id FROM oauth_clients)
+   OR user_id NOT IN (SELECT id FROM users)
+   OR session_id NOT IN (SELECT id FROM sessions);
+
+DELETE FROM device_codes
+WHERE client_id NOT IN (SELECT id FROM oauth_clients)
+   OR (user_id IS NOT NULL AND user_id NOT IN (SELECT id FROM users))
+   OR (session_id IS NOT NULL AND session_id NOT IN (SELECT id FROM sessions));
+
+DELETE FROM client_assertions WHERE client_id NOT IN (SELECT id FROM oauth_clients);
+
+DELETE FROM logout_notifications
+WHERE client_id NOT IN (SELECT id FROM oauth_clients)
+   OR user_id NOT IN (SELECT id FROM users);
+
+DELETE FROM oauth_grants
+WHERE client_id NOT IN (SELECT id FROM oauth_clients)
+   OR user_id NOT IN (SELECT id FROM users);
+
+DELETE FROM scim_group_members
+WHERE group_id NOT IN (SELECT id FROM scim_groups)
+   OR user_id NOT IN (SELECT id FROM users);
+
+DELETE FROM service_accounts
+WHERE user_id NOT IN (SELECT id FROM users)
+   OR owner_id NOT IN (SELECT id FROM users);
+
+DELETE FROM invitations WHERE invited_by NOT IN (SELECT id FROM users);
+
+DELETE FROM user_identities WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM scim_users WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM api_keys WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM email_logins WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM phone_codes WHERE user_id NOT IN (SELECT id FROM users);
+DELETE FROM password_history WHERE user_id NOT IN (SELECT id FROM users);
+
+DELETE FROM audit_events WHERE user_id NOT IN (SELECT id FROM users);
+UPDATE audit_events SET actor_id = NULL WHERE actor_id NOT IN (SELECT id FROM users);
@@ -0,0 +1,9 @@
+-- When a passwordless login was last requested for an address, whether or
+-- not it belongs to an account, so that every address is rate limited the
+-- same way. Rows are forgotten once the resend interval has passed.
+CREATE TABLE IF NOT EXISTS email_login_requests
+(
+    email_normalized TEXT PRIMARY KEY,
+    requested_at     DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_email_login_requests_requested_at ON email_login_requests (requested_at);
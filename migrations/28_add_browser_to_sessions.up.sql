@@ -0,0 +1,4 @@
+-- Browser sessions of the hosted login pages are kept in a cookie and
+-- cannot be refreshed.
+ALTER TABLE sessions
+    ADD COLUMN browser BOOLEAN NOT NULL DEFAULT FALSE;
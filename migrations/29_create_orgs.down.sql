@@ -0,0 +1,4 @@
+ALTER TABLE invitations DROP COLUMN org_role;
+ALTER TABLE invitations DROP COLUMN org_id;
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS orgs;
@@ -0,0 +1,23 @@
+-- Organizations users belong to with an owner or member role. Owners may
+-- invite people to their organization.
+CREATE TABLE IF NOT EXISTS orgs
+(
+    id         INTEGER PRIMARY KEY,
+    name       TEXT     NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS org_members
+(
+    org_id  INTEGER NOT NULL REFERENCES orgs (id),
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    role    TEXT    NOT NULL,
+    PRIMARY KEY (org_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_org_members_user_id ON org_members (user_id);
+
+-- Invitations may attach the new account to an organization.
+ALTER TABLE invitations
+    ADD COLUMN org_id INTEGER REFERENCES orgs (id);
+ALTER TABLE invitations
+    ADD COLUMN org_role TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           TEXT PRIMARY KEY,
+    user_id      INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_hash BLOB     NOT NULL UNIQUE,
+    device       TEXT     NOT NULL DEFAULT '',
+    ip           TEXT     NOT NULL DEFAULT '',
+    user_agent   TEXT     NOT NULL DEFAULT '',
+    created_at   DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    expires_at   DATETIME NOT NULL,
+    revoked_at   DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
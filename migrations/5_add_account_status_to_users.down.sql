@@ -0,0 +1,17 @@
+CREATE TABLE users_old
+(
+    id        INTEGER PRIMARY KEY,
+    email     TEXT    NOT NULL UNIQUE,
+    pass_hash BLOB    NOT NULL,
+    is_admin  BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO users_old (id, email, pass_hash, is_admin)
+SELECT id, email, pass_hash, is_admin
+FROM users
+WHERE purged_at IS NULL;
+
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+
+CREATE INDEX IF NOT EXISTS idx_email ON users (email);
@@ -0,0 +1,25 @@
+-- SQLite cannot drop a column constraint in place, so the table is rebuilt to
+-- make email nullable: purged accounts keep their row (and id) as a tombstone
+-- while their address becomes free to register again.
+CREATE TABLE users_new
+(
+    id                INTEGER PRIMARY KEY,
+    email             TEXT,
+    pass_hash         BLOB     NOT NULL,
+    is_admin          BOOLEAN  NOT NULL DEFAULT FALSE,
+    status            TEXT     NOT NULL DEFAULT 'active',
+    status_reason     TEXT     NOT NULL DEFAULT '',
+    status_changed_at DATETIME,
+    deleted_at        DATETIME,
+    purged_at         DATETIME
+);
+
+INSERT INTO users_new (id, email, pass_hash, is_admin)
+SELECT id, email, pass_hash, is_admin
+FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_status ON users (status, deleted_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id         INTEGER PRIMARY KEY,
+    user_id    INTEGER  NOT NULL REFERENCES users (id),
+    actor_id   INTEGER REFERENCES users (id),
+    action     TEXT     NOT NULL,
+    ip         TEXT     NOT NULL DEFAULT '',
+    user_agent TEXT     NOT NULL DEFAULT '',
+    details    TEXT     NOT NULL DEFAULT '{}',
+    created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events (user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
@@ -0,0 +1,19 @@
+ALTER TABLE users
+    ADD COLUMN password_changed_at DATETIME;
+UPDATE users
+SET password_changed_at = CURRENT_TIMESTAMP
+WHERE purged_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS password_history
+(
+    id         INTEGER PRIMARY KEY,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    pass_hash  BLOB     NOT NULL,
+    created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id);
+
+INSERT INTO password_history (user_id, pass_hash, created_at)
+SELECT id, pass_hash, password_changed_at
+FROM users
+WHERE purged_at IS NULL;
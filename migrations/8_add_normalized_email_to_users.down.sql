@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_email_normalized;
+ALTER TABLE users DROP COLUMN email_normalized;
+DROP INDEX IF EXISTS idx_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email ON users (email);
@@ -0,0 +1,25 @@
+ALTER TABLE users
+    ADD COLUMN email_normalized TEXT;
+
+-- Case folding is all that can be done in SQL; the service re-canonicalizes
+-- addresses (IDNA domains, provider rules) when it starts.
+UPDATE users
+SET email_normalized = lower(trim(email))
+WHERE email IS NOT NULL;
+
+-- Accounts whose addresses only differed by case are kept, but all except
+-- the oldest one are disabled and lose their normalized address so that an
+-- admin can resolve them.
+UPDATE users
+SET status            = 'disabled',
+    status_reason     = 'duplicate email of user ' || (SELECT min(u.id)
+                                                      FROM users u
+                                                      WHERE u.email_normalized = users.email_normalized),
+    status_changed_at = CURRENT_TIMESTAMP,
+    email_normalized  = NULL
+WHERE email_normalized IS NOT NULL
+  AND id > (SELECT min(u.id) FROM users u WHERE u.email_normalized = users.email_normalized);
+
+DROP INDEX IF EXISTS idx_email;
+CREATE INDEX IF NOT EXISTS idx_email ON users (email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_normalized ON users (email_normalized);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_sessions_parent_id;
+ALTER TABLE sessions DROP COLUMN scope;
+ALTER TABLE sessions DROP COLUMN parent_id;
+ALTER TABLE sessions DROP COLUMN client_id;
+DROP TABLE IF EXISTS authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
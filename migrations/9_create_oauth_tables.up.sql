@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS oauth_clients
+(
+    id            TEXT PRIMARY KEY,
+    name          TEXT     NOT NULL,
+    -- SHA-256 of the client secret, NULL for public clients.
+    secret_hash   BLOB,
+    -- JSON array of the exact redirect URIs the client may use.
+    redirect_uris TEXT     NOT NULL DEFAULT '[]',
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS authorization_codes
+(
+    code_hash             BLOB PRIMARY KEY,
+    client_id             TEXT     NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id               INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    session_id            TEXT     NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    redirect_uri          TEXT     NOT NULL,
+    scope                 TEXT     NOT NULL DEFAULT '',
+    code_challenge        TEXT     NOT NULL,
+    code_challenge_method TEXT     NOT NULL,
+    expires_at            DATETIME NOT NULL,
+    used_at               DATETIME,
+    -- Session created when the code was exchanged, revoked if the code is
+    -- ever presented again.
+    issued_session_id     TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_authorization_codes_user_id ON authorization_codes (user_id);
+
+ALTER TABLE sessions
+    ADD COLUMN client_id TEXT REFERENCES oauth_clients (id) ON DELETE CASCADE;
+ALTER TABLE sessions
+    ADD COLUMN parent_id TEXT REFERENCES sessions (id) ON DELETE CASCADE;
+ALTER TABLE sessions
+    ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_sessions_parent_id ON sessions (parent_id);
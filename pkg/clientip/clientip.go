@@ -0,0 +1,103 @@
+// Package clientip finds the address of the client behind a request that
+// may have passed through reverse proxies.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Proxies are the reverse proxies whose X-Forwarded-For headers are
+// trusted. The nil value trusts no proxy.
+type Proxies struct {
+	prefixes []netip.Prefix
+}
+
+// ParseProxies parses trusted proxies given as IP addresses or CIDR
+// ranges, e.g. "10.0.0.0/8".
+func ParseProxies(proxies []string) (*Proxies, error) {
+	p := &Proxies{}
+
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy range %q: %w", proxy, err)
+			}
+			p.prefixes = append(p.prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy address %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		p.prefixes = append(p.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return p, nil
+}
+
+// ClientIP returns the address of the client. It is the peer address
+// remoteAddr, unless the peer is a trusted proxy: then the addresses the
+// proxies appended to forwardedFor are walked from the right, and the
+// first one that is not a trusted proxy is the client. Anything left of it
+// was sent by the client and cannot be trusted.
+func (p *Proxies) ClientIP(remoteAddr string, forwardedFor []string) string {
+	client := host(remoteAddr)
+
+	if !p.trusts(client) {
+		return client
+	}
+
+	var hops []string
+	for _, header := range forwardedFor {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+
+		client = hop
+		if !p.trusts(hop) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (p *Proxies) trusts(ip string) bool {
+	if p == nil {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func host(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -0,0 +1,216 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClientAssertionType is the client_assertion_type of private_key_jwt
+// client authentication (RFC 7523).
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// maxAssertionLifetime bounds how far in the future client assertions may
+// expire, which also bounds how long their ids are remembered.
+const maxAssertionLifetime = time.Hour
+
+// AssertionAlgorithms are the signature algorithms accepted on client
+// assertions.
+var AssertionAlgorithms = []string{
+	jwt.SigningMethodRS256.Name,
+	jwt.SigningMethodPS256.Name,
+	jwt.SigningMethodES256.Name,
+}
+
+// ClientAssertion holds the verified claims of a client assertion.
+type ClientAssertion struct {
+	ClientID  string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// AssertionIssuer returns the unverified issuer of a client assertion, so
+// that the keys to verify it with can be looked up.
+func AssertionIssuer(assertion string) (string, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(assertion, jwt.MapClaims{})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil || issuer == "" {
+		return "", fmt.Errorf("%w: missing iss claim", ErrInvalidToken)
+	}
+
+	return issuer, nil
+}
+
+// ParseClientAssertion verifies a client assertion against the client's
+// JSON Web Key Set. The assertion must be issued by and about clientID,
+// addressed to one of audiences and carry a jti.
+func ParseClientAssertion(
+	assertion string,
+	jwks string,
+	clientID string,
+	audiences []string,
+) (ClientAssertion, error) {
+	keys, err := parseJWKS(jwks)
+	if err != nil {
+		return ClientAssertion{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	token, err := jwt.Parse(
+		assertion,
+		keyFunc(keys),
+		jwt.WithValidMethods(AssertionAlgorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(clientID),
+		jwt.WithSubject(clientID),
+	)
+	if err != nil {
+		return ClientAssertion{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	audience, err := claims.GetAudience()
+	if err != nil || !slices.ContainsFunc(audience, func(aud string) bool {
+		return slices.Contains(audiences, aud)
+	}) {
+		return ClientAssertion{}, fmt.Errorf("%w: invalid aud claim", ErrInvalidToken)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return ClientAssertion{}, fmt.Errorf("%w: missing jti claim", ErrInvalidToken)
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		return ClientAssertion{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if time.Until(exp.Time) > maxAssertionLifetime {
+		return ClientAssertion{}, fmt.Errorf("%w: exp is too far in the future", ErrInvalidToken)
+	}
+
+	return ClientAssertion{
+		ClientID:  clientID,
+		ID:        jti,
+		ExpiresAt: exp.Time,
+	}, nil
+}
+
+// ParseJWKS checks that data is a JSON Web Key Set of supported keys.
+func ParseJWKS(data string) error {
+	_, err := parseJWKS(data)
+	return err
+}
+
+// keyFunc picks the key of keys a token names in its kid header. Tokens
+// without a kid are accepted from key sets with a single key.
+func keyFunc(keys map[string]crypto.PublicKey) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+		return nil, ErrUnknownKey
+	}
+}
+
+func parseJWKS(data string) (map[string]crypto.PublicKey, error) {
+	var set JSONWebKeySet
+	if err := json.Unmarshal([]byte(data), &set); err != nil {
+		return nil, fmt.Errorf("malformed key set: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+
+	return keys, nil
+}
+
+func (k JSONWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC point")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("malformed key parameter")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,51 @@
+package jwt
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/VariableSan/gia-sso/internal/domain/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// reservedClaims are the claims gia-sso sets itself, which a claim mapping
+// may not override.
+var reservedClaims = []string{
+	"id", "email", "sid", "sub", "iss", "aud", "exp", "iat", "nbf", "jti",
+	"scope", "client_id", "act", "amr", "acr", "auth_time",
+	"principal_type", "service_account_id",
+}
+
+// ClaimMapping maps names of custom token claims to the profile attributes
+// they carry, e.g. "tenant" to "admin_metadata.tenant".
+type ClaimMapping map[string]string
+
+// Validate checks that the mapping neither overrides a reserved claim nor
+// refers to an unknown attribute.
+func (m ClaimMapping) Validate() error {
+	for claim, attribute := range m {
+		if claim == "" || slices.Contains(reservedClaims, claim) {
+			return fmt.Errorf("claim %q is reserved", claim)
+		}
+		if !models.IsProfileAttribute(attribute) {
+			return fmt.Errorf("claim %q: unknown profile attribute %q", claim, attribute)
+		}
+	}
+
+	return nil
+}
+
+// WithProfileClaims adds the attributes of profile selected by mapping.
+// Attributes that are not set are left out.
+func WithProfileClaims(mapping ClaimMapping, profile models.Profile) Option {
+	return func(claims jwt.MapClaims) {
+		for claim, attribute := range mapping {
+			if slices.Contains(reservedClaims, claim) {
+				continue
+			}
+			if value, ok := profile.Attribute(attribute); ok {
+				claims[claim] = value
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDToken describes an OpenID Connect ID token.
+type IDToken struct {
+	Issuer   string
+	Subject  string
+	Audience string
+	// Nonce is echoed from the authentication request, if it had one.
+	Nonce    string
+	AuthTime time.Time
+	ACR      string
+	AMR      []string
+	// SessionID identifies the browser session the user logged in with.
+	SessionID string
+	// AccessToken, when set, is bound to the ID token through at_hash.
+	AccessToken string
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+	// Claims holds the user claims released for the requested scopes.
+	Claims map[string]any
+}
+
+// NewIDToken signs an ID token with key.
+func NewIDToken(key *SigningKey, token IDToken) (string, error) {
+	claims := jwt.MapClaims{}
+	for name, value := range token.Claims {
+		claims[name] = value
+	}
+
+	claims["iss"] = token.Issuer
+	claims["sub"] = token.Subject
+	claims["aud"] = token.Audience
+	claims["iat"] = token.IssuedAt.Unix()
+	claims["exp"] = token.ExpiresAt.Unix()
+	claims["auth_time"] = token.AuthTime.Unix()
+
+	if token.Nonce != "" {
+		claims["nonce"] = token.Nonce
+	}
+	if token.ACR != "" {
+		claims["acr"] = token.ACR
+	}
+	if len(token.AMR) > 0 {
+		claims["amr"] = token.AMR
+	}
+	if token.SessionID != "" {
+		claims["sid"] = token.SessionID
+	}
+	if token.AccessToken != "" {
+		// OIDC Core section 3.1.3.6: the left half of the hash of the
+		// access token, for RS256 a SHA-256 hash.
+		sum := sha256.Sum256([]byte(token.AccessToken))
+		claims["at_hash"] = base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	}
+
+	return key.sign(claims)
+}
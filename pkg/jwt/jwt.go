@@ -1,6 +1,9 @@
 package jwt
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -8,18 +11,123 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrUnknownKey is returned when a token is signed with a key missing
+	// from the key set it is verified against.
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// Claims are the claims gia-sso puts into the access tokens it issues.
+type Claims struct {
+	UserID    int64
+	Email     string
+	SessionID string
+	// ClientID and Scope are set on tokens issued to OAuth clients.
+	ClientID string
+	Scope    string
+	// Audience is set on tokens a client obtained for itself through the
+	// client credentials grant and on tokens issued by a token exchange.
+	Audience []string
+	// Actor is set on tokens issued by a token exchange to someone acting
+	// on behalf of the user.
+	Actor *models.Actor
+	// APIKeyID is set on principals authenticated with an API key rather
+	// than a token. They have no session, and ExpiresAt is zero for keys
+	// that do not expire.
+	APIKeyID string
+	// PrincipalType is who the token was issued to. Tokens a client
+	// obtained for the service account it is bound to carry the user id of
+	// the service account.
+	PrincipalType models.PrincipalType
+	// AuthTime is when the user last actively authenticated, AMR how they
+	// did and ACR the authentication context class that satisfies. They are
+	// only set on tokens issued for a session.
+	AuthTime  time.Time
+	AMR       []string
+	ACR       string
+	ExpiresAt time.Time
+}
+
+// IsClient reports whether the token was issued to a client acting on its
+// own behalf, or for its service account, rather than for a session.
+func (c Claims) IsClient() bool {
+	return c.SessionID == "" && c.ClientID != ""
+}
+
+// Option adds optional claims to a token issued by NewToken.
+type Option func(claims jwt.MapClaims)
+
+// WithClient marks a token as issued to an OAuth client for the given scope.
+func WithClient(clientID string, scope string) Option {
+	return func(claims jwt.MapClaims) {
+		claims["client_id"] = clientID
+		if scope != "" {
+			claims["scope"] = scope
+		}
+	}
+}
+
+// WithServiceAccount marks a client token as issued for the service account
+// the client is bound to.
+func WithServiceAccount(serviceAccountID int64) Option {
+	return func(claims jwt.MapClaims) {
+		claims["principal_type"] = string(models.PrincipalServiceAccount)
+		claims["service_account_id"] = strconv.FormatInt(serviceAccountID, 10)
+	}
+}
+
+// WithAuthentication records when and how the user authenticated. The acr
+// claim is derived from amr.
+func WithAuthentication(authTime time.Time, amr []string) Option {
+	return func(claims jwt.MapClaims) {
+		if !authTime.IsZero() {
+			claims["auth_time"] = authTime.Unix()
+		}
+		if len(amr) > 0 {
+			claims["amr"] = amr
+			claims["acr"] = models.ACR(amr)
+		}
+	}
+}
+
+// WithAudience restricts a token to the given audience.
+func WithAudience(audience []string) Option {
+	return func(claims jwt.MapClaims) {
+		if len(audience) > 0 {
+			claims["aud"] = audience
+		}
+	}
+}
+
+// WithActor records who the token was issued to act on behalf of its
+// subject.
+func WithActor(actor models.Actor) Option {
+	return func(claims jwt.MapClaims) {
+		claims["act"] = actor
+	}
+}
+
 func NewToken(
 	user models.User,
+	sessionID string,
 	jwtSecret string,
 	duration time.Duration,
+	opts ...Option,
 ) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
 	claims["id"] = strconv.Itoa(int(user.ID))
 	claims["email"] = user.Email
+	claims["sid"] = sessionID
+	claims["principal_type"] = string(models.PrincipalUser)
 	claims["exp"] = time.Now().Add(duration).Unix()
 
+	for _, opt := range opts {
+		opt(claims)
+	}
+
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
 		return "", err
@@ -27,3 +135,165 @@ func NewToken(
 
 	return tokenString, nil
 }
+
+// NewClientToken issues an access token to a client for itself, as done by
+// the client credentials grant. The client is the subject of the token.
+func NewClientToken(
+	clientID string,
+	scope string,
+	audience []string,
+	jwtSecret string,
+	duration time.Duration,
+	opts ...Option,
+) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"sub":            clientID,
+		"client_id":      clientID,
+		"principal_type": string(models.PrincipalClient),
+		"iat":            now.Unix(),
+		"exp":            now.Add(duration).Unix(),
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	if len(audience) > 0 {
+		claims["aud"] = audience
+	}
+
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+}
+
+// ParseToken verifies the signature and expiry of a token issued by NewToken
+// or NewClientToken and returns its claims.
+func ParseToken(tokenString string, jwtSecret string) (Claims, error) {
+	token, err := jwt.Parse(
+		tokenString,
+		func(*jwt.Token) (any, error) {
+			return []byte(jwtSecret), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	clientID, _ := claims["client_id"].(string)
+	scope, _ := claims["scope"].(string)
+	principalType, _ := claims["principal_type"].(string)
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	audience, err := claims.GetAudience()
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if _, ok := claims["id"]; !ok && clientID != "" {
+		clientClaims := Claims{
+			ClientID:      clientID,
+			Scope:         scope,
+			Audience:      audience,
+			PrincipalType: models.PrincipalClient,
+			ExpiresAt:     exp.Time,
+		}
+
+		if principalType == string(models.PrincipalServiceAccount) {
+			id, _ := claims["service_account_id"].(string)
+			clientClaims.UserID, err = strconv.ParseInt(id, 10, 64)
+			if err != nil || clientClaims.UserID <= 0 {
+				return Claims{}, fmt.Errorf("%w: malformed service_account_id claim", ErrInvalidToken)
+			}
+			clientClaims.PrincipalType = models.PrincipalServiceAccount
+		}
+
+		return clientClaims, nil
+	}
+
+	id, _ := claims["id"].(string)
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed id claim", ErrInvalidToken)
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" {
+		return Claims{}, fmt.Errorf("%w: missing sid claim", ErrInvalidToken)
+	}
+
+	email, _ := claims["email"].(string)
+
+	actor, err := parseActor(claims["act"])
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed act claim", ErrInvalidToken)
+	}
+
+	var authTime time.Time
+	if at, ok := claims["auth_time"].(float64); ok {
+		authTime = time.Unix(int64(at), 0)
+	}
+
+	var amr []string
+	if methods, ok := claims["amr"].([]any); ok {
+		for _, method := range methods {
+			if method, ok := method.(string); ok {
+				amr = append(amr, method)
+			}
+		}
+	}
+
+	acr, _ := claims["acr"].(string)
+
+	// Tokens issued before principal types were introduced only went to
+	// users.
+	if principalType == "" {
+		principalType = string(models.PrincipalUser)
+	}
+
+	return Claims{
+		UserID:        userID,
+		Email:         email,
+		SessionID:     sessionID,
+		ClientID:      clientID,
+		Scope:         scope,
+		Audience:      audience,
+		Actor:         actor,
+		PrincipalType: models.PrincipalType(principalType),
+		AuthTime:      authTime,
+		AMR:           amr,
+		ACR:           acr,
+		ExpiresAt:     exp.Time,
+	}, nil
+}
+
+func parseActor(claim any) (*models.Actor, error) {
+	if claim == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(claim)
+	if err != nil {
+		return nil, err
+	}
+
+	var actor models.Actor
+	if err := json.Unmarshal(data, &actor); err != nil {
+		return nil, err
+	}
+	if actor.Subject == "" {
+		return nil, errors.New("missing sub")
+	}
+
+	return &actor, nil
+}
@@ -0,0 +1,197 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const signingKeyBits = 2048
+
+// SigningKey is the RSA key ID tokens are signed with. Clients verify them
+// with the public half, published as a JSON Web Key Set.
+type SigningKey struct {
+	ID  string
+	key *rsa.PrivateKey
+}
+
+// JSONWebKey is a public RSA or EC key (RFC 7517).
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewSigningKey wraps key, identifying it by its RFC 7638 thumbprint.
+func NewSigningKey(key *rsa.PrivateKey) (*SigningKey, error) {
+	n, e := publicKeyParams(&key.PublicKey)
+
+	// The members must be in lexicographic order and without whitespace.
+	thumbprint, err := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{E: e, Kty: "RSA", N: n})
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(thumbprint)
+
+	return &SigningKey{
+		ID:  base64.RawURLEncoding.EncodeToString(sum[:]),
+		key: key,
+	}, nil
+}
+
+// LoadOrCreateSigningKey reads a PEM encoded RSA private key from path. If
+// the file does not exist, a new key is generated and saved there so that
+// tokens stay valid across restarts.
+func LoadOrCreateSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createSigningKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = parsed.(*rsa.PrivateKey); !ok {
+				return nil, fmt.Errorf("%s: not an RSA key", path)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return NewSigningKey(key)
+}
+
+func createSigningKey(path string) (*SigningKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, signingKeyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	return NewSigningKey(key)
+}
+
+// JWKS returns the public key set clients verify signatures with.
+func (k *SigningKey) JWKS() JSONWebKeySet {
+	n, e := publicKeyParams(&k.key.PublicKey)
+
+	return JSONWebKeySet{
+		Keys: []JSONWebKey{{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodRS256.Name,
+			KeyID:     k.ID,
+			N:         n,
+			E:         e,
+		}},
+	}
+}
+
+// Certificate returns a self-signed X.509 certificate of the public key in
+// DER form, for protocols such as SAML that publish keys as certificates.
+// It is derived from the key alone, so it stays the same across restarts.
+func (k *SigningKey) Certificate() ([]byte, error) {
+	id, err := base64.RawURLEncoding.DecodeString(k.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: new(big.Int).SetBytes(id[:16]),
+		Subject:      pkix.Name{CommonName: "gia-sso"},
+		// Relying parties pin the certificate, so it never expires; the key
+		// is rotated by replacing it.
+		NotBefore: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+
+	return x509.CreateCertificate(rand.Reader, template, template, &k.key.PublicKey, k.key)
+}
+
+// SignSHA256 signs data with RSASSA-PKCS1-v1_5 and SHA-256, the rsa-sha256
+// algorithm of XML signatures.
+func (k *SigningKey) SignSHA256(data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+
+	return rsa.SignPKCS1v15(nil, k.key, crypto.SHA256, sum[:])
+}
+
+func (k *SigningKey) sign(claims jwt.MapClaims) (string, error) {
+	return k.signWithType(claims, "JWT")
+}
+
+// signWithType signs claims with an explicit typ header, which keeps tokens
+// of one kind from being mistaken for another.
+func (k *SigningKey) signWithType(claims jwt.MapClaims, typ string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.ID
+	token.Header["typ"] = typ
+
+	return token.SignedString(k.key)
+}
+
+func publicKeyParams(key *rsa.PublicKey) (n string, e string) {
+	return base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+}
@@ -0,0 +1,86 @@
+package jwt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// BackchannelLogoutEvent identifies logout tokens in their events claim
+// (OpenID Connect Back-Channel Logout 1.0).
+const BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// LogoutToken describes a back-channel logout token sent to a client when
+// a session it was issued tokens for ends.
+type LogoutToken struct {
+	ID       string
+	Issuer   string
+	Subject  string
+	Audience string
+	// SessionID is the sid of the ID tokens issued for the session.
+	SessionID string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// NewLogoutToken signs a logout token with key.
+func NewLogoutToken(key *SigningKey, token LogoutToken) (string, error) {
+	claims := jwt.MapClaims{
+		"jti":    token.ID,
+		"iss":    token.Issuer,
+		"sub":    token.Subject,
+		"aud":    token.Audience,
+		"sid":    token.SessionID,
+		"iat":    token.IssuedAt.Unix(),
+		"exp":    token.ExpiresAt.Unix(),
+		"events": map[string]any{BackchannelLogoutEvent: map[string]any{}},
+	}
+
+	return key.signWithType(claims, "logout+jwt")
+}
+
+// IDTokenHint holds the claims of an ID token that a client passed back as
+// id_token_hint.
+type IDTokenHint struct {
+	Subject   string
+	Audience  []string
+	SessionID string
+}
+
+// ParseIDTokenHint verifies that token is an ID token issued by issuer and
+// signed with key. Expired tokens are accepted, since clients often only
+// log users out after their ID token has expired.
+func ParseIDTokenHint(key *SigningKey, issuer string, token string) (IDTokenHint, error) {
+	parsed, err := jwt.Parse(
+		token,
+		func(*jwt.Token) (any, error) {
+			return &key.key.PublicKey, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Name}),
+		jwt.WithoutClaimsValidation(),
+	)
+	if err != nil {
+		return IDTokenHint{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims := parsed.Claims.(jwt.MapClaims)
+
+	if iss, _ := claims.GetIssuer(); iss != issuer {
+		return IDTokenHint{}, fmt.Errorf("%w: invalid iss claim", ErrInvalidToken)
+	}
+
+	audience, err := claims.GetAudience()
+	if err != nil {
+		return IDTokenHint{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	subject, _ := claims.GetSubject()
+	sessionID, _ := claims["sid"].(string)
+
+	return IDTokenHint{
+		Subject:   subject,
+		Audience:  audience,
+		SessionID: sessionID,
+	}, nil
+}
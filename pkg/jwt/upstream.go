@@ -0,0 +1,87 @@
+package jwt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// UpstreamIDToken holds the verified claims of an ID token issued by an
+// upstream OpenID provider users sign in with.
+type UpstreamIDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	AuthTime      time.Time
+}
+
+// ParseUpstreamIDToken verifies an ID token of an upstream provider as
+// described in section 3.1.3.7 of OpenID Connect Core: it must be signed
+// with one of the keys of jwks, issued by issuer to clientID and carry the
+// nonce of the authentication request. ErrUnknownKey is wrapped when the
+// signing key is not in jwks, which happens after a key rotation.
+func ParseUpstreamIDToken(
+	token string,
+	jwks string,
+	issuer string,
+	clientID string,
+	nonce string,
+) (UpstreamIDToken, error) {
+	keys, err := parseJWKS(jwks)
+	if err != nil {
+		return UpstreamIDToken{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	parsed, err := jwt.Parse(
+		token,
+		keyFunc(keys),
+		jwt.WithValidMethods(AssertionAlgorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return UpstreamIDToken{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	claims := parsed.Claims.(jwt.MapClaims)
+
+	// A token for several audiences must name the client it was issued to.
+	audience, _ := claims.GetAudience()
+	azp, hasAZP := claims["azp"].(string)
+	if hasAZP && azp != clientID || !hasAZP && len(audience) > 1 {
+		return UpstreamIDToken{}, fmt.Errorf("%w: invalid azp claim", ErrInvalidToken)
+	}
+
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return UpstreamIDToken{}, fmt.Errorf("%w: invalid nonce claim", ErrInvalidToken)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return UpstreamIDToken{}, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+
+	idToken := UpstreamIDToken{
+		Subject: subject,
+	}
+	idToken.Email, _ = claims["email"].(string)
+	idToken.Name, _ = claims["name"].(string)
+
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		idToken.EmailVerified = verified
+	case string:
+		idToken.EmailVerified = verified == "true"
+	}
+
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		idToken.AuthTime = time.Unix(int64(authTime), 0)
+	}
+
+	return idToken, nil
+}
@@ -0,0 +1,42 @@
+package random
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+)
+
+// Token returns a URL-safe random string built from size random bytes.
+func Token(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash returns the SHA-256 digest of a random token, suitable for storing
+// high-entropy secrets at rest.
+func Hash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// Code returns a random string of length characters picked uniformly from
+// alphabet, for codes that people have to read or type.
+func Code(length int, alphabet string) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
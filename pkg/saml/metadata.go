@@ -0,0 +1,44 @@
+package saml
+
+// IdentityProvider describes an identity provider in its metadata.
+type IdentityProvider struct {
+	EntityID string
+	// SSOURL is the single sign-on service, reachable with both the
+	// HTTP-Redirect and HTTP-POST bindings.
+	SSOURL        string
+	NameIDFormats []string
+	// Certificate is the DER encoded certificate assertions are signed
+	// with.
+	Certificate []byte
+}
+
+// Metadata writes the metadata service providers are configured with.
+func Metadata(idp IdentityProvider) []byte {
+	descriptor := newElement("md:IDPSSODescriptor").
+		attr("WantAuthnRequestsSigned", "false").
+		attr("protocolSupportEnumeration", NamespaceProtocol).
+		add(
+			newElement("md:KeyDescriptor").
+				attr("use", "signing").
+				add(keyInfo(idp.Certificate).declare("ds", NamespaceSignature)),
+		)
+
+	for _, format := range idp.NameIDFormats {
+		descriptor.add(newElement("md:NameIDFormat").setText(format))
+	}
+
+	for _, binding := range []string{BindingHTTPRedirect, BindingHTTPPost} {
+		descriptor.add(
+			newElement("md:SingleSignOnService").
+				attr("Binding", binding).
+				attr("Location", idp.SSOURL),
+		)
+	}
+
+	entity := newElement("md:EntityDescriptor").
+		declare("md", NamespaceMetadata).
+		attr("entityID", idp.EntityID).
+		add(descriptor)
+
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + entity.String())
+}
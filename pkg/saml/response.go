@@ -0,0 +1,242 @@
+package saml
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/VariableSan/gia-sso/pkg/random"
+)
+
+// Algorithms of the assertion signatures.
+const (
+	algorithmExcC14N            = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algorithmRSASHA256          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algorithmSHA256             = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algorithmEnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+const (
+	attrNameFormatBasic = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+	confirmationBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// clockSkew is how far assertions are valid before they were issued, for
+// service providers whose clocks run behind.
+const clockSkew = time.Minute
+
+// Signer signs assertions with RSA-SHA256. It is implemented by
+// *jwt.SigningKey.
+type Signer interface {
+	SignSHA256(data []byte) ([]byte, error)
+}
+
+// Assertion is what a response states about a signed in user.
+type Assertion struct {
+	// Issuer is the entity ID of the identity provider and Audience the
+	// one of the service provider.
+	Issuer   string
+	Audience string
+	// Destination is the assertion consumer service the response is posted
+	// to, and InResponseTo the ID of the request it answers, if any.
+	Destination  string
+	InResponseTo string
+	NameID       string
+	NameIDFormat string
+	// SessionIndex identifies the session of the user at the identity
+	// provider.
+	SessionIndex string
+	AuthnInstant time.Time
+	AuthnContext string
+	Attributes   []Attribute
+	IssueInstant time.Time
+	NotOnOrAfter time.Time
+}
+
+type Attribute struct {
+	Name   string
+	Values []string
+}
+
+// NewResponse writes a successful response carrying the assertion, signed
+// by signer. The certificate of the signing key is included in the
+// signature.
+func NewResponse(a Assertion, signer Signer, certificate []byte) ([]byte, error) {
+	responseID, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	assertionID, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	assertion := newElement("saml:Assertion").
+		declare("saml", NamespaceAssertion).
+		attr("ID", assertionID).
+		attr("IssueInstant", formatTime(a.IssueInstant)).
+		attr("Version", "2.0").
+		add(
+			newElement("saml:Issuer").setText(a.Issuer),
+			newElement("saml:Subject").add(
+				newElement("saml:NameID").
+					attr("Format", a.NameIDFormat).
+					attr("SPNameQualifier", a.Audience).
+					setText(a.NameID),
+				newElement("saml:SubjectConfirmation").
+					attr("Method", confirmationBearer).
+					add(
+						newElement("saml:SubjectConfirmationData").
+							attr("InResponseTo", a.InResponseTo).
+							attr("NotOnOrAfter", formatTime(a.NotOnOrAfter)).
+							attr("Recipient", a.Destination),
+					),
+			),
+			newElement("saml:Conditions").
+				attr("NotBefore", formatTime(a.IssueInstant.Add(-clockSkew))).
+				attr("NotOnOrAfter", formatTime(a.NotOnOrAfter)).
+				add(
+					newElement("saml:AudienceRestriction").add(
+						newElement("saml:Audience").setText(a.Audience),
+					),
+				),
+			newElement("saml:AuthnStatement").
+				attr("AuthnInstant", formatTime(a.AuthnInstant)).
+				attr("SessionIndex", a.SessionIndex).
+				add(
+					newElement("saml:AuthnContext").add(
+						newElement("saml:AuthnContextClassRef").setText(a.AuthnContext),
+					),
+				),
+		)
+
+	if len(a.Attributes) > 0 {
+		statement := newElement("saml:AttributeStatement")
+		for _, attribute := range a.Attributes {
+			values := newElement("saml:Attribute").
+				attr("Name", attribute.Name).
+				attr("NameFormat", attrNameFormatBasic)
+			for _, value := range attribute.Values {
+				values.add(newElement("saml:AttributeValue").setText(value))
+			}
+			statement.add(values)
+		}
+		assertion.add(statement)
+	}
+
+	signature, err := sign(assertion, assertionID, signer, certificate)
+	if err != nil {
+		return nil, fmt.Errorf("sign assertion: %w", err)
+	}
+	// The schema puts the signature right after the issuer.
+	assertion.insert(1, signature)
+
+	response := newResponse(responseID, a.Issuer, a.Destination, a.InResponseTo, a.IssueInstant)
+	response.add(
+		newElement("samlp:Status").add(
+			newElement("samlp:StatusCode").attr("Value", StatusSuccess),
+		),
+		assertion,
+	)
+
+	return []byte(response.String()), nil
+}
+
+// NewErrorResponse writes an unsigned response that reports the top-level
+// status code status, refined by the second-level code subStatus if set.
+func NewErrorResponse(
+	issuer string,
+	destination string,
+	inResponseTo string,
+	status string,
+	subStatus string,
+	now time.Time,
+) ([]byte, error) {
+	responseID, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode := newElement("samlp:StatusCode").attr("Value", status)
+	if subStatus != "" {
+		statusCode.add(newElement("samlp:StatusCode").attr("Value", subStatus))
+	}
+
+	response := newResponse(responseID, issuer, destination, inResponseTo, now)
+	response.add(newElement("samlp:Status").add(statusCode))
+
+	return []byte(response.String()), nil
+}
+
+func newResponse(
+	id string,
+	issuer string,
+	destination string,
+	inResponseTo string,
+	now time.Time,
+) *element {
+	return newElement("samlp:Response").
+		declare("samlp", NamespaceProtocol).
+		declare("saml", NamespaceAssertion).
+		attr("Destination", destination).
+		attr("ID", id).
+		attr("InResponseTo", inResponseTo).
+		attr("IssueInstant", formatTime(now)).
+		attr("Version", "2.0").
+		add(newElement("saml:Issuer").setText(issuer))
+}
+
+// sign returns the enveloped signature of e, which is referenced by id.
+// The digest covers e without the signature, as the enveloped signature
+// transform removes it again before verification.
+func sign(e *element, id string, signer Signer, certificate []byte) (*element, error) {
+	digest := sha256.Sum256([]byte(e.String()))
+
+	signedInfo := newElement("ds:SignedInfo").
+		// Canonicalizing SignedInfo on its own declares the namespace here.
+		declare("ds", NamespaceSignature).
+		add(
+			newElement("ds:CanonicalizationMethod").attr("Algorithm", algorithmExcC14N),
+			newElement("ds:SignatureMethod").attr("Algorithm", algorithmRSASHA256),
+			newElement("ds:Reference").attr("URI", "#"+id).add(
+				newElement("ds:Transforms").add(
+					newElement("ds:Transform").attr("Algorithm", algorithmEnvelopedSignature),
+					newElement("ds:Transform").attr("Algorithm", algorithmExcC14N),
+				),
+				newElement("ds:DigestMethod").attr("Algorithm", algorithmSHA256),
+				newElement("ds:DigestValue").setText(base64.StdEncoding.EncodeToString(digest[:])),
+			),
+		)
+
+	signatureValue, err := signer.SignSHA256([]byte(signedInfo.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	return newElement("ds:Signature").
+		declare("ds", NamespaceSignature).
+		add(
+			signedInfo,
+			newElement("ds:SignatureValue").setText(base64.StdEncoding.EncodeToString(signatureValue)),
+			keyInfo(certificate),
+		), nil
+}
+
+func keyInfo(certificate []byte) *element {
+	return newElement("ds:KeyInfo").add(
+		newElement("ds:X509Data").add(
+			newElement("ds:X509Certificate").setText(base64.StdEncoding.EncodeToString(certificate)),
+		),
+	)
+}
+
+// newID returns a random message ID. IDs must not start with a digit.
+func newID() (string, error) {
+	id, err := random.Token(20)
+	if err != nil {
+		return "", err
+	}
+
+	return "_" + id, nil
+}
@@ -0,0 +1,275 @@
+package saml_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VariableSan/gia-sso/pkg/jwt"
+	"github.com/VariableSan/gia-sso/pkg/saml"
+)
+
+// responseXML is the part of a response the tests look at.
+type responseXML struct {
+	Status struct {
+		StatusCode struct {
+			Value      string `xml:"Value,attr"`
+			StatusCode struct {
+				Value string `xml:"Value,attr"`
+			} `xml:"StatusCode"`
+		} `xml:"StatusCode"`
+	} `xml:"Status"`
+	Assertion *struct {
+		Signature struct {
+			DigestValue     string `xml:"SignedInfo>Reference>DigestValue"`
+			SignatureValue  string `xml:"SignatureValue"`
+			X509Certificate string `xml:"KeyInfo>X509Data>X509Certificate"`
+		} `xml:"Signature"`
+		NameID     string `xml:"Subject>NameID"`
+		Attributes []struct {
+			Name   string   `xml:"Name,attr"`
+			Values []string `xml:"AttributeValue"`
+		} `xml:"AttributeStatement>Attribute"`
+	} `xml:"Assertion"`
+}
+
+func newSigningKey(t *testing.T) (*jwt.SigningKey, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := jwt.NewSigningKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := signingKey.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signingKey, certificate
+}
+
+func newResponse(t *testing.T, signer saml.Signer, certificate []byte) []byte {
+	t.Helper()
+
+	now := time.Now()
+
+	// Values that need escaping must not break the signature.
+	response, err := saml.NewResponse(saml.Assertion{
+		Issuer:       "https://sso.test/saml",
+		Audience:     "https://sp.test",
+		Destination:  "https://sp.test/acs?a=1&b=2",
+		InResponseTo: "_request",
+		NameID:       "o'brien&co <admin>@example.com",
+		NameIDFormat: saml.NameIDFormatEmail,
+		SessionIndex: "session",
+		AuthnInstant: now,
+		AuthnContext: saml.AuthnContextPasswordProtectedTransport,
+		Attributes: []saml.Attribute{
+			{Name: "groups", Values: []string{"R&D", `"quoted"`}},
+		},
+		IssueInstant: now,
+		NotOnOrAfter: now.Add(5 * time.Minute),
+	}, signer, certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
+
+// between returns the part of s from the start of open to the end of the
+// first close after it.
+func between(t *testing.T, s string, open string, close string) string {
+	t.Helper()
+
+	start := strings.Index(s, open)
+	end := strings.Index(s[max(start, 0):], close)
+	if start < 0 || end < 0 {
+		t.Fatalf("no %s...%s in %s", open, close, s)
+	}
+
+	return s[start : start+end+len(close)]
+}
+
+// verify checks the enveloped signature of the assertion in response the
+// way a service provider does. The response is written in canonical form,
+// so canonicalizing the assertion and SignedInfo leaves them unchanged.
+func verify(t *testing.T, response []byte) error {
+	t.Helper()
+
+	var parsed responseXML
+	if err := xml.Unmarshal(response, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Assertion == nil {
+		t.Fatal("response has no assertion")
+	}
+	signature := parsed.Assertion.Signature
+
+	assertion := between(t, string(response), "<saml:Assertion ", "</saml:Assertion>")
+	signedInfo := between(t, assertion, "<ds:SignedInfo ", "</ds:SignedInfo>")
+
+	// The enveloped signature transform.
+	unsigned := strings.Replace(assertion, between(t, assertion, "<ds:Signature ", "</ds:Signature>"), "", 1)
+	digest := sha256.Sum256([]byte(unsigned))
+	if base64.StdEncoding.EncodeToString(digest[:]) != signature.DigestValue {
+		return rsa.ErrVerification
+	}
+
+	der, err := base64.StdEncoding.DecodeString(signature.X509Certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(signature.SignatureValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256([]byte(signedInfo))
+
+	return rsa.VerifyPKCS1v15(certificate.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], value)
+}
+
+func TestNewResponse(t *testing.T) {
+	signingKey, certificate := newSigningKey(t)
+	response := newResponse(t, signingKey, certificate)
+
+	if err := verify(t, response); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+
+	var parsed responseXML
+	if err := xml.Unmarshal(response, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Status.StatusCode.Value != saml.StatusSuccess {
+		t.Errorf("status = %q, want success", parsed.Status.StatusCode.Value)
+	}
+	if parsed.Assertion.NameID != "o'brien&co <admin>@example.com" {
+		t.Errorf("name id = %q", parsed.Assertion.NameID)
+	}
+	if len(parsed.Assertion.Attributes) != 1 || strings.Join(parsed.Assertion.Attributes[0].Values, ",") != `R&D,"quoted"` {
+		t.Errorf("attributes = %+v", parsed.Assertion.Attributes)
+	}
+}
+
+func TestNewResponseTampered(t *testing.T) {
+	signingKey, certificate := newSigningKey(t)
+	otherKey, _ := newSigningKey(t)
+
+	tests := []struct {
+		name     string
+		response func() []byte
+	}{
+		{
+			name: "changed name id",
+			response: func() []byte {
+				response := newResponse(t, signingKey, certificate)
+				return []byte(strings.Replace(string(response), "@example.com", "@evil.test", 1))
+			},
+		},
+		{
+			name: "changed audience",
+			response: func() []byte {
+				response := newResponse(t, signingKey, certificate)
+				return []byte(strings.Replace(string(response), "<saml:Audience>https://sp.test<", "<saml:Audience>https://evil.test<", 1))
+			},
+		},
+		{
+			// Signed by another key than the certificate names.
+			name: "wrong key",
+			response: func() []byte {
+				return newResponse(t, otherKey, certificate)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verify(t, tt.response()); err == nil {
+				t.Fatal("signature verifies")
+			}
+		})
+	}
+}
+
+// TestNewResponseCanonical checks that what the signature covers is
+// written the way an exclusive canonicalization yields it: the assertion
+// without its signature, which is digested, and SignedInfo on its own,
+// which is signed. It needs xmllint.
+func TestNewResponseCanonical(t *testing.T) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not installed")
+	}
+
+	signingKey, certificate := newSigningKey(t)
+	response := newResponse(t, signingKey, certificate)
+
+	assertion := between(t, string(response), "<saml:Assertion ", "</saml:Assertion>")
+	signature := between(t, assertion, "<ds:Signature ", "</ds:Signature>")
+
+	for name, signed := range map[string]string{
+		"assertion":  strings.Replace(assertion, signature, "", 1),
+		"signedinfo": between(t, signature, "<ds:SignedInfo ", "</ds:SignedInfo>"),
+	} {
+		path := filepath.Join(t.TempDir(), name+".xml")
+		if err := os.WriteFile(path, []byte(signed), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		canonical, err := exec.Command(xmllint, "--exc-c14n", path).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(canonical) != signed {
+			t.Errorf("%s is not canonical:\n got %s\nwant %s", name, signed, canonical)
+		}
+	}
+}
+
+func TestNewErrorResponse(t *testing.T) {
+	response, err := saml.NewErrorResponse(
+		"https://sso.test/saml",
+		"https://sp.test/acs",
+		"_request",
+		saml.StatusResponder,
+		saml.StatusNoPassive,
+		time.Now(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed responseXML
+	if err := xml.Unmarshal(response, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	code := parsed.Status.StatusCode
+	if code.Value != saml.StatusResponder || code.StatusCode.Value != saml.StatusNoPassive {
+		t.Errorf("status = %s / %s, want responder / no passive", code.Value, code.StatusCode.Value)
+	}
+	if parsed.Assertion != nil {
+		t.Error("error response carries an assertion")
+	}
+}
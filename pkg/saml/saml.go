@@ -0,0 +1,222 @@
+// Package saml implements the parts of SAML 2.0 gia-sso needs to act as an
+// identity provider: reading authentication requests, writing signed
+// responses and describing itself in metadata.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Namespaces of SAML 2.0 and XML signatures.
+const (
+	NamespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	NamespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	NamespaceMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	NamespaceSignature = "http://www.w3.org/2000/09/xmldsig#"
+)
+
+// Bindings define how messages travel between providers.
+const (
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+)
+
+// Name identifier formats.
+const (
+	NameIDFormatEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+)
+
+// Status codes of responses. The first three are top-level codes, the
+// others are second-level codes that refine them.
+const (
+	StatusSuccess             = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	StatusRequester           = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+	StatusResponder           = "urn:oasis:names:tc:SAML:2.0:status:Responder"
+	StatusAuthnFailed         = "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed"
+	StatusInvalidNameIDPolicy = "urn:oasis:names:tc:SAML:2.0:status:InvalidNameIDPolicy"
+	StatusNoPassive           = "urn:oasis:names:tc:SAML:2.0:status:NoPassive"
+	StatusRequestDenied       = "urn:oasis:names:tc:SAML:2.0:status:RequestDenied"
+)
+
+// AuthnContextPasswordProtectedTransport is the authentication context of
+// a login with a password over TLS.
+const AuthnContextPasswordProtectedTransport = "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+
+// AuthnContextUnspecified is the authentication context of other logins,
+// such as those at upstream identity providers.
+const AuthnContextUnspecified = "urn:oasis:names:tc:SAML:2.0:ac:classes:unspecified"
+
+// maxMessageSize bounds decoded messages, which keeps deflated requests
+// from expanding without limit.
+const maxMessageSize = 64 << 10
+
+var ErrInvalidMessage = errors.New("invalid saml message")
+
+// AuthnRequest is an authentication request of a service provider.
+type AuthnRequest struct {
+	ID           string
+	Issuer       string
+	IssueInstant time.Time
+	Destination  string
+	// ACSURL or ACSIndex pick the assertion consumer service to answer at;
+	// without either the default one of the service provider is used.
+	ACSURL   string
+	ACSIndex *int
+	// ProtocolBinding is the binding the response is asked for with.
+	ProtocolBinding string
+	NameIDFormat    string
+	ForceAuthn      bool
+	IsPassive       bool
+}
+
+type authnRequestXML struct {
+	XMLName                       xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                            string   `xml:"ID,attr"`
+	Version                       string   `xml:"Version,attr"`
+	IssueInstant                  string   `xml:"IssueInstant,attr"`
+	Destination                   string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL   string   `xml:"AssertionConsumerServiceURL,attr"`
+	AssertionConsumerServiceIndex string   `xml:"AssertionConsumerServiceIndex,attr"`
+	ProtocolBinding               string   `xml:"ProtocolBinding,attr"`
+	ForceAuthn                    string   `xml:"ForceAuthn,attr"`
+	IsPassive                     string   `xml:"IsPassive,attr"`
+	Issuer                        string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                  struct {
+		Format string `xml:"Format,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+// ParseAuthnRequest reads an AuthnRequest. Signatures on requests are not
+// checked; the assertion consumer services they are answered at are
+// checked against the registration of the service provider instead.
+func ParseAuthnRequest(data []byte) (AuthnRequest, error) {
+	var raw authnRequestXML
+	if err := xml.Unmarshal(data, &raw); err != nil {
+		return AuthnRequest{}, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	if raw.Version != "2.0" {
+		return AuthnRequest{}, fmt.Errorf("%w: unsupported version %q", ErrInvalidMessage, raw.Version)
+	}
+	if raw.ID == "" || raw.Issuer == "" {
+		return AuthnRequest{}, fmt.Errorf("%w: missing id or issuer", ErrInvalidMessage)
+	}
+
+	issueInstant, err := time.Parse(time.RFC3339, raw.IssueInstant)
+	if err != nil {
+		return AuthnRequest{}, fmt.Errorf("%w: invalid issue instant", ErrInvalidMessage)
+	}
+
+	req := AuthnRequest{
+		ID:              raw.ID,
+		Issuer:          strings.TrimSpace(raw.Issuer),
+		IssueInstant:    issueInstant,
+		Destination:     raw.Destination,
+		ACSURL:          raw.AssertionConsumerServiceURL,
+		ProtocolBinding: raw.ProtocolBinding,
+		NameIDFormat:    raw.NameIDPolicy.Format,
+	}
+
+	if raw.AssertionConsumerServiceIndex != "" {
+		index, err := strconv.Atoi(raw.AssertionConsumerServiceIndex)
+		if err != nil || index < 0 {
+			return AuthnRequest{}, fmt.Errorf("%w: invalid assertion consumer service index", ErrInvalidMessage)
+		}
+		req.ACSIndex = &index
+	}
+
+	for _, flag := range []struct {
+		value string
+		dest  *bool
+	}{
+		{raw.ForceAuthn, &req.ForceAuthn},
+		{raw.IsPassive, &req.IsPassive},
+	} {
+		if flag.value == "" {
+			continue
+		}
+		value, err := strconv.ParseBool(flag.value)
+		if err != nil {
+			return AuthnRequest{}, fmt.Errorf("%w: invalid boolean %q", ErrInvalidMessage, flag.value)
+		}
+		*flag.dest = value
+	}
+
+	return req, nil
+}
+
+// DecodeRedirect decodes a SAMLRequest parameter of the HTTP-Redirect
+// binding, which is deflated and base64 encoded.
+func DecodeRedirect(value string) ([]byte, error) {
+	compressed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), maxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if len(data) > maxMessageSize {
+		return nil, fmt.Errorf("%w: message too large", ErrInvalidMessage)
+	}
+
+	return data, nil
+}
+
+// EncodeRedirect encodes a message for the HTTP-Redirect binding.
+func EncodeRedirect(data []byte) (string, error) {
+	var compressed bytes.Buffer
+
+	w, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(compressed.Bytes()), nil
+}
+
+// DecodePost decodes a SAMLRequest parameter of the HTTP-POST binding,
+// which is base64 encoded.
+func DecodePost(value string) ([]byte, error) {
+	// Some service providers wrap the encoded message into lines.
+	value = strings.Join(strings.Fields(value), "")
+
+	if base64.StdEncoding.DecodedLen(len(value)) > maxMessageSize {
+		return nil, fmt.Errorf("%w: message too large", ErrInvalidMessage)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	return data, nil
+}
+
+// EncodePost encodes a message for the HTTP-POST binding.
+func EncodePost(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// formatTime formats t as an xs:dateTime in UTC.
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
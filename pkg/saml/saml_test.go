@@ -0,0 +1,122 @@
+package saml_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/VariableSan/gia-sso/pkg/saml"
+)
+
+const authnRequest = `<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"
+    xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"
+    ID="_request" Version="2.0" IssueInstant="2026-01-02T03:04:05Z"
+    AssertionConsumerServiceIndex="1" ForceAuthn="true" IsPassive="0">
+  <saml:Issuer> https://sp.test </saml:Issuer>
+  <samlp:NameIDPolicy Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"/>
+</samlp:AuthnRequest>`
+
+func TestParseAuthnRequest(t *testing.T) {
+	req, err := saml.ParseAuthnRequest([]byte(authnRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.ID != "_request" || req.Issuer != "https://sp.test" || req.NameIDFormat != saml.NameIDFormatEmail {
+		t.Errorf("request = %+v", req)
+	}
+	if req.ACSIndex == nil || *req.ACSIndex != 1 {
+		t.Errorf("acs index = %v, want 1", req.ACSIndex)
+	}
+	if !req.ForceAuthn || req.IsPassive {
+		t.Errorf("force authn = %t, is passive = %t, want true and false", req.ForceAuthn, req.IsPassive)
+	}
+}
+
+func TestParseAuthnRequestInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+	}{
+		{name: "not xml", old: "<samlp:AuthnRequest", new: "AuthnRequest"},
+		{name: "other message", old: `xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"`, new: `xmlns:samlp="urn:example"`},
+		{name: "saml 1.1", old: `Version="2.0"`, new: `Version="1.1"`},
+		{name: "no id", old: `ID="_request"`, new: ""},
+		{name: "no issuer", old: "<saml:Issuer> https://sp.test </saml:Issuer>", new: ""},
+		{name: "bad issue instant", old: "2026-01-02T03:04:05Z", new: "yesterday"},
+		{name: "negative acs index", old: `AssertionConsumerServiceIndex="1"`, new: `AssertionConsumerServiceIndex="-1"`},
+		{name: "bad boolean", old: `ForceAuthn="true"`, new: `ForceAuthn="yes"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := strings.Replace(authnRequest, tt.old, tt.new, 1)
+
+			if _, err := saml.ParseAuthnRequest([]byte(data)); !errors.Is(err, saml.ErrInvalidMessage) {
+				t.Fatalf("err = %v, want %v", err, saml.ErrInvalidMessage)
+			}
+		})
+	}
+}
+
+func TestRedirectBinding(t *testing.T) {
+	encoded, err := saml.EncodeRedirect([]byte(authnRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := saml.DecodeRedirect(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != authnRequest {
+		t.Errorf("decoded %q, want the request", data)
+	}
+
+	// Deflated messages must not expand without limit.
+	bomb, err := saml.EncodeRedirect([]byte(strings.Repeat(" ", 1<<20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, value := range map[string]string{
+		"not base64":   "%%%",
+		"not deflated": base64.StdEncoding.EncodeToString([]byte(authnRequest)),
+		"too large":    bomb,
+	} {
+		if _, err := saml.DecodeRedirect(value); !errors.Is(err, saml.ErrInvalidMessage) {
+			t.Errorf("%s: err = %v, want %v", name, err, saml.ErrInvalidMessage)
+		}
+	}
+}
+
+func TestPostBinding(t *testing.T) {
+	encoded := saml.EncodePost([]byte(authnRequest))
+
+	// Some service providers wrap the encoded message into lines.
+	var wrapped strings.Builder
+	for len(encoded) > 76 {
+		wrapped.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	wrapped.WriteString(encoded)
+
+	data, err := saml.DecodePost(wrapped.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != authnRequest {
+		t.Errorf("decoded %q, want the request", data)
+	}
+
+	for name, value := range map[string]string{
+		"not base64": "%%%",
+		"too large":  saml.EncodePost([]byte(strings.Repeat(" ", 1<<20))),
+	} {
+		if _, err := saml.DecodePost(value); !errors.Is(err, saml.ErrInvalidMessage) {
+			t.Errorf("%s: err = %v, want %v", name, err, saml.ErrInvalidMessage)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package saml
+
+import (
+	"slices"
+	"strings"
+)
+
+// element is an XML element written in exclusive canonical form
+// (https://www.w3.org/TR/xml-exc-c14n/), so that the bytes that are signed
+// are the bytes relying parties canonicalize the parsed document back to.
+// This holds as long as each element declares the namespaces it uses
+// unless its parent already declares them.
+type element struct {
+	name       string
+	namespaces []attr
+	attrs      []attr
+	children   []*element
+	text       string
+}
+
+type attr struct {
+	name  string
+	value string
+}
+
+func newElement(name string) *element {
+	return &element{name: name}
+}
+
+// declare adds the namespace declaration xmlns:prefix="uri".
+func (e *element) declare(prefix string, uri string) *element {
+	e.namespaces = append(e.namespaces, attr{name: "xmlns:" + prefix, value: uri})
+	return e
+}
+
+// attr sets an attribute, leaving it out when value is empty.
+func (e *element) attr(name string, value string) *element {
+	if value != "" {
+		e.attrs = append(e.attrs, attr{name: name, value: value})
+	}
+	return e
+}
+
+func (e *element) add(children ...*element) *element {
+	e.children = append(e.children, children...)
+	return e
+}
+
+func (e *element) setText(text string) *element {
+	e.text = text
+	return e
+}
+
+// insert adds child at index i of the children of e.
+func (e *element) insert(i int, child *element) {
+	e.children = slices.Insert(e.children, i, child)
+}
+
+func (e *element) String() string {
+	var b strings.Builder
+	e.write(&b)
+	return b.String()
+}
+
+func (e *element) write(b *strings.Builder) {
+	b.WriteString("<")
+	b.WriteString(e.name)
+
+	// Namespace declarations come first and attributes after, each sorted.
+	// All attributes written here are unqualified, which sorts them by name.
+	for _, list := range [][]attr{e.namespaces, e.attrs} {
+		sorted := slices.SortedFunc(slices.Values(list), func(a, b attr) int {
+			return strings.Compare(a.name, b.name)
+		})
+		for _, a := range sorted {
+			b.WriteString(" ")
+			b.WriteString(a.name)
+			b.WriteString(`="`)
+			b.WriteString(attrEscaper.Replace(a.value))
+			b.WriteString(`"`)
+		}
+	}
+
+	b.WriteString(">")
+	b.WriteString(textEscaper.Replace(e.text))
+
+	for _, child := range e.children {
+		child.write(b)
+	}
+
+	// Canonical XML has no empty-element tags.
+	b.WriteString("</")
+	b.WriteString(e.name)
+	b.WriteString(">")
+}
+
+var (
+	textEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		"\r", "&#xD;",
+	)
+	attrEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		`"`, "&quot;",
+		"\t", "&#x9;",
+		"\n", "&#xA;",
+		"\r", "&#xD;",
+	)
+)
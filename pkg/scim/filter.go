@@ -0,0 +1,546 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter is a parsed filter of RFC 7644 section 3.4.2.2, such as
+// `userName eq "bjensen" and emails[type eq "work" and value co "@example.com"]`.
+type Filter struct {
+	expr expr
+}
+
+// ParseFilter parses a filter. Its errors are invalidFilter errors.
+func ParseFilter(s string) (*Filter, error) {
+	expr, err := parseExpr(s)
+	if err != nil {
+		return nil, BadRequest(ErrorInvalidFilter, err.Error())
+	}
+
+	return &Filter{expr: expr}, nil
+}
+
+// Match reports whether resource matches the filter.
+func (f *Filter) Match(resource map[string]any) bool {
+	return f.expr.match(resource)
+}
+
+func parseExpr(s string) (expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return e, nil
+}
+
+type expr interface {
+	match(object map[string]any) bool
+}
+
+type andExpr struct{ left, right expr }
+
+func (e andExpr) match(object map[string]any) bool {
+	return e.left.match(object) && e.right.match(object)
+}
+
+type orExpr struct{ left, right expr }
+
+func (e orExpr) match(object map[string]any) bool {
+	return e.left.match(object) || e.right.match(object)
+}
+
+type notExpr struct{ expr expr }
+
+func (e notExpr) match(object map[string]any) bool {
+	return !e.expr.match(object)
+}
+
+// presentExpr is "attrPath pr".
+type presentExpr struct{ path Path }
+
+func (e presentExpr) match(object map[string]any) bool {
+	for _, value := range values(object, e.path) {
+		if present(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compareExpr is "attrPath op value". Multi-valued attributes match when
+// any of their values does.
+type compareExpr struct {
+	path  Path
+	op    string
+	value any
+}
+
+func (e compareExpr) match(object map[string]any) bool {
+	attrValues := values(object, e.path)
+
+	if e.value == nil {
+		// "eq null" asks for absent attributes, "ne null" for present ones.
+		isPresent := false
+		for _, value := range attrValues {
+			isPresent = isPresent || present(value)
+		}
+		return (e.op == "ne") == isPresent
+	}
+
+	for _, value := range attrValues {
+		if compare(value, e.op, e.value) {
+			return true
+		}
+	}
+
+	return e.op == "ne" && len(attrValues) == 0
+}
+
+// valuePathExpr is "attrPath[valFilter]", which matches when one value of
+// a multi-valued complex attribute matches valFilter as a whole.
+type valuePathExpr struct {
+	path   Path
+	filter expr
+}
+
+func (e valuePathExpr) match(object map[string]any) bool {
+	value, ok := lookup(container(object, e.path, false), e.path.Attr)
+	if !ok {
+		return false
+	}
+
+	for _, element := range elements(value) {
+		if element, ok := element.(map[string]any); ok && e.filter.match(element) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// values returns the values the attribute path refers to in object. Paths
+// to multi-valued complex attributes without a sub-attribute refer to
+// their "value" sub-attributes.
+func values(object map[string]any, path Path) []any {
+	value, ok := lookup(container(object, path, false), path.Attr)
+	if !ok {
+		return nil
+	}
+	_, multiValued := value.([]any)
+
+	var result []any
+	for _, element := range elements(value) {
+		complexValue, isComplex := element.(map[string]any)
+		switch {
+		case path.Sub != "" && isComplex:
+			if sub, ok := lookup(complexValue, path.Sub); ok {
+				result = append(result, elements(sub)...)
+			}
+		case path.Sub != "":
+		case isComplex && multiValued:
+			if sub, ok := lookup(complexValue, "value"); ok {
+				result = append(result, sub)
+			}
+		default:
+			result = append(result, element)
+		}
+	}
+
+	return result
+}
+
+// elements returns the values of a multi-valued attribute, or value itself
+// for single-valued ones.
+func elements(value any) []any {
+	if list, ok := value.([]any); ok {
+		return list
+	}
+	if value == nil {
+		return nil
+	}
+
+	return []any{value}
+}
+
+func present(value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return false
+	case string:
+		return value != ""
+	case []any:
+		return len(value) > 0
+	case map[string]any:
+		return len(value) > 0
+	default:
+		return true
+	}
+}
+
+// compare applies op to an attribute value and a filter value. Strings are
+// compared case-insensitively; timestamps are strings in a fixed format and
+// compare correctly as such.
+func compare(value any, op string, filterValue any) bool {
+	switch filterValue := filterValue.(type) {
+	case string:
+		value, ok := value.(string)
+		if !ok {
+			return false
+		}
+		value, filterValue = strings.ToLower(value), strings.ToLower(filterValue)
+
+		switch op {
+		case "eq":
+			return value == filterValue
+		case "ne":
+			return value != filterValue
+		case "co":
+			return strings.Contains(value, filterValue)
+		case "sw":
+			return strings.HasPrefix(value, filterValue)
+		case "ew":
+			return strings.HasSuffix(value, filterValue)
+		case "gt":
+			return value > filterValue
+		case "ge":
+			return value >= filterValue
+		case "lt":
+			return value < filterValue
+		case "le":
+			return value <= filterValue
+		}
+	case bool:
+		value, ok := value.(bool)
+		if !ok {
+			return false
+		}
+
+		switch op {
+		case "eq":
+			return value == filterValue
+		case "ne":
+			return value != filterValue
+		}
+	case float64:
+		value, ok := number(value)
+		if !ok {
+			return false
+		}
+
+		switch op {
+		case "eq":
+			return value == filterValue
+		case "ne":
+			return value != filterValue
+		case "gt":
+			return value > filterValue
+		case "ge":
+			return value >= filterValue
+		case "lt":
+			return value < filterValue
+		case "le":
+			return value <= filterValue
+		}
+	}
+
+	return false
+}
+
+func number(value any) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case json.Number:
+		f, err := value.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+var compareOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, token{kind: tokenPunct, text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+
+			var value string
+			if err := json.Unmarshal([]byte(s[i:end+1]), &value); err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[i:end+1])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value})
+			i = end + 1
+		default:
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t\n\r()[]\"", rune(s[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: s[i:end]})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+// parser is a recursive descent parser of the filter grammar, in which
+// "not" binds tighter than "and", which binds tighter than "or".
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peekWord(word string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenWord && strings.EqualFold(p.tokens[p.pos].text, word)
+}
+
+func (p *parser) peekPunct(punct string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenPunct && p.tokens[p.pos].text == punct
+}
+
+func (p *parser) expectPunct(punct string) error {
+	if !p.peekPunct(punct) {
+		return fmt.Errorf("expected %q", punct)
+	}
+	p.pos++
+
+	return nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if !p.peekWord("not") {
+		return p.parseAtom()
+	}
+	p.pos++
+
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+
+	return notExpr{expr: e}, nil
+}
+
+func (p *parser) parseAtom() (expr, error) {
+	if p.peekPunct("(") {
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenWord {
+		return nil, fmt.Errorf("expected attribute path, got %q", tok.text)
+	}
+	p.pos++
+
+	path, err := parsePath(tok.text)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekPunct("[") {
+		p.pos++
+		if path.Sub != "" {
+			return nil, fmt.Errorf("value filter on sub-attribute %s", path)
+		}
+
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return nil, err
+		}
+
+		return valuePathExpr{path: path, filter: filter}, nil
+	}
+
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenWord {
+		return nil, fmt.Errorf("expected operator after %s", path)
+	}
+	op := strings.ToLower(p.tokens[p.pos].text)
+	p.pos++
+
+	if op == "pr" {
+		return presentExpr{path: path}, nil
+	}
+	if !compareOps[op] {
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if _, isString := value.(string); !isString && value != nil && op != "eq" && op != "ne" {
+		if _, isNumber := value.(float64); !isNumber || op == "co" || op == "sw" || op == "ew" {
+			return nil, fmt.Errorf("operator %q cannot compare %v", op, value)
+		}
+	}
+
+	return compareExpr{path: path, op: op, value: value}, nil
+}
+
+func (p *parser) parseValue() (any, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("expected value")
+	}
+
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	switch {
+	case tok.kind == tokenString:
+		return tok.text, nil
+	case tok.kind != tokenWord:
+		return nil, fmt.Errorf("expected value, got %q", tok.text)
+	case tok.text == "true":
+		return true, nil
+	case tok.text == "false":
+		return false, nil
+	case tok.text == "null":
+		return nil, nil
+	}
+
+	value, err := strconv.ParseFloat(tok.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", tok.text)
+	}
+
+	return value, nil
+}
+
+// equalities returns the sub-attribute values an element must have to
+// match a value filter made of "eq" comparisons joined with "and", such as
+// `type eq "work"`. It is how PATCH adds a value that a filter asks for.
+func equalities(e expr) (map[string]any, bool) {
+	switch e := e.(type) {
+	case compareExpr:
+		if e.op != "eq" || e.value == nil || e.path.Sub != "" || e.path.URN != "" {
+			return nil, false
+		}
+		return map[string]any{e.path.Attr: e.value}, true
+	case andExpr:
+		left, ok := equalities(e.left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := equalities(e.right)
+		if !ok {
+			return nil, false
+		}
+		for key, value := range right {
+			left[key] = value
+		}
+		return left, true
+	}
+
+	return nil, false
+}
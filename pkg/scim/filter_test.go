@@ -0,0 +1,125 @@
+package scim_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/VariableSan/gia-sso/pkg/scim"
+)
+
+const testUser = `{
+	"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+	"id": "42",
+	"userName": "bjensen",
+	"active": true,
+	"name": {"givenName": "Barbara", "familyName": "Jensen"},
+	"emails": [
+		{"type": "work", "value": "bjensen@example.com", "primary": true},
+		{"type": "home", "value": "babs@home.test"}
+	],
+	"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"employeeNumber": "701984"},
+	"meta": {"lastModified": "2026-01-02T03:04:05Z"},
+	"loginCount": 3
+}`
+
+// resource decodes a JSON object the way request bodies are decoded.
+func resource(t *testing.T, s string) map[string]any {
+	t.Helper()
+
+	var object map[string]any
+	if err := json.Unmarshal([]byte(s), &object); err != nil {
+		t.Fatal(err)
+	}
+
+	return object
+}
+
+// wantSCIMError fails unless err is a bad request of errorType.
+func wantSCIMError(t *testing.T, err error, errorType string) {
+	t.Helper()
+
+	var scimErr *scim.Error
+	if !errors.As(err, &scimErr) || scimErr.Status != http.StatusBadRequest || scimErr.Type != errorType {
+		t.Fatalf("err = %v, want a bad request of type %s", err, errorType)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	user := resource(t, testUser)
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "bjensen"`, true},
+		{`USERNAME EQ "BJENSEN"`, true},
+		{`userName ne "bjensen"`, false},
+		{`userName sw "bj" and userName ew "sen"`, true},
+		{`userName co "xyz" or name.givenName eq "Barbara"`, true},
+		{`not (userName eq "bjensen")`, false},
+		{`title pr`, false},
+		{`name pr`, true},
+		{`title eq null`, true},
+		{`title ne null`, false},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`loginCount gt 2 and loginCount le 3`, true},
+		{`meta.lastModified gt "2026-01-01T00:00:00Z"`, true},
+		{`emails co "@home.test"`, true},
+		{`emails.type eq "home"`, true},
+		{`emails[type eq "work" and value co "@example.com"]`, true},
+		// Both conditions must hold for the same email.
+		{`emails[type eq "home" and value co "@example.com"]`, false},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber eq "701984"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "bjensen"`, true},
+		{`userName eq "a" or userName eq "b" and userName eq "bjensen"`, false},
+		{`(userName eq "a" or userName eq "bjensen") and active eq true`, true},
+		{`displayName eq "Babs \"B\" Jensen"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			filter, err := scim.ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := filter.Match(user); got != tt.want {
+				t.Errorf("match = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	tests := []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName is "bjensen"`,
+		`userName eq bjensen`,
+		`userName eq "bjensen`,
+		`userName eq "bad \escape"`,
+		`"bjensen" eq userName`,
+		`(userName eq "bjensen"`,
+		`userName eq "bjensen")`,
+		`userName eq "bjensen" and`,
+		`not userName eq "bjensen"`,
+		`userName co true`,
+		`loginCount sw 3`,
+		`active gt false`,
+		`emails[type eq "work"`,
+		`name.givenName[value eq "Barbara"]`,
+		`1userName eq "bjensen"`,
+		`name.given.name eq "Barbara"`,
+	}
+
+	for _, filter := range tests {
+		t.Run(filter, func(t *testing.T) {
+			_, err := scim.ParseFilter(filter)
+			wantSCIMError(t, err, scim.ErrorInvalidFilter)
+		})
+	}
+}
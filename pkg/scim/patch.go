@@ -0,0 +1,354 @@
+package scim
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// PatchRequest is the body of a PATCH request.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation adds, removes or replaces the values at Path.
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// readOnlyAttributes cannot be changed by clients.
+var readOnlyAttributes = []string{"id", "meta"}
+
+// Patch applies operations to resource in order, as described in RFC 7644
+// section 3.5.2. Operation names are case-insensitive, since some clients
+// send "Replace" and the like.
+//
+// Beyond the RFC, removing a multi-valued attribute with a value removes
+// just the values listed in it, as Azure AD does to remove group members.
+func Patch(resource map[string]any, operations []PatchOperation) error {
+	for _, operation := range operations {
+		var err error
+		switch strings.ToLower(operation.Op) {
+		case "add":
+			err = patchSet(resource, operation, true)
+		case "replace":
+			err = patchSet(resource, operation, false)
+		case "remove":
+			err = patchRemove(resource, operation)
+		default:
+			err = BadRequest(ErrorInvalidSyntax, fmt.Sprintf("unknown operation %q", operation.Op))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// patchPath is the path of a PATCH operation: an attribute path, or a
+// value filter on a multi-valued attribute with an optional sub-attribute,
+// such as `emails[type eq "work"].value`.
+type patchPath struct {
+	Path
+	filter expr
+}
+
+func parsePatchPath(s string) (patchPath, error) {
+	open := strings.Index(s, "[")
+	if open < 0 {
+		path, err := parsePath(s)
+		if err != nil {
+			return patchPath{}, BadRequest(ErrorInvalidPath, err.Error())
+		}
+		return patchPath{Path: path}, checkMutable(path)
+	}
+
+	closing := strings.LastIndex(s, "]")
+	if closing < open {
+		return patchPath{}, BadRequest(ErrorInvalidPath, fmt.Sprintf("unbalanced brackets in %q", s))
+	}
+
+	path, err := parsePath(s[:open])
+	if err != nil || path.Sub != "" {
+		return patchPath{}, BadRequest(ErrorInvalidPath, fmt.Sprintf("invalid path %q", s))
+	}
+
+	filter, err := parseExpr(s[open+1 : closing])
+	if err != nil {
+		return patchPath{}, BadRequest(ErrorInvalidFilter, err.Error())
+	}
+
+	if rest := s[closing+1:]; rest != "" {
+		sub, ok := strings.CutPrefix(rest, ".")
+		if !ok || !validAttrName(sub) {
+			return patchPath{}, BadRequest(ErrorInvalidPath, fmt.Sprintf("invalid path %q", s))
+		}
+		path.Sub = sub
+	}
+
+	return patchPath{Path: path, filter: filter}, checkMutable(path)
+}
+
+func checkMutable(path Path) error {
+	for _, attr := range readOnlyAttributes {
+		if (path.URN == "" || isCoreSchema(path.URN)) && strings.EqualFold(path.Attr, attr) {
+			return BadRequest(ErrorMutability, fmt.Sprintf("%s is read-only", attr))
+		}
+	}
+
+	return nil
+}
+
+// patchSet applies an add or replace operation. They differ in that add
+// appends to multi-valued attributes where replace overwrites them, and
+// in that add creates the value a filter asks for when there is none.
+func patchSet(resource map[string]any, operation PatchOperation, add bool) error {
+	if operation.Path == "" {
+		object, ok := operation.Value.(map[string]any)
+		if !ok {
+			return BadRequest(ErrorInvalidValue, "operations without a path need an object value")
+		}
+
+		for key, value := range object {
+			if urn, ok := schemaURN(key); ok && len(urn) == len(key) {
+				if isCoreSchema(urn) {
+					if err := patchSet(resource, PatchOperation{Op: operation.Op, Value: value}, add); err != nil {
+						return err
+					}
+					continue
+				}
+
+				extension, ok := value.(map[string]any)
+				if !ok {
+					return BadRequest(ErrorInvalidValue, fmt.Sprintf("%s must be an object", key))
+				}
+				target := container(resource, Path{URN: urn}, true)
+				for attr, attrValue := range extension {
+					if err := setAttr(target, Path{Attr: attr}, attrValue, add); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			path, err := parsePatchPath(key)
+			if err != nil {
+				return err
+			}
+			if path.filter != nil {
+				return BadRequest(ErrorInvalidPath, fmt.Sprintf("invalid attribute name %q", key))
+			}
+			if err := setAttr(container(resource, path.Path, true), path.Path, value, add); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	path, err := parsePatchPath(operation.Path)
+	if err != nil {
+		return err
+	}
+
+	target := container(resource, path.Path, true)
+	if path.filter == nil {
+		return setAttr(target, path.Path, operation.Value, add)
+	}
+
+	key := findKey(target, path.Attr)
+	list, _ := target[key].([]any)
+
+	matched := false
+	for i, element := range list {
+		object, ok := element.(map[string]any)
+		if !ok || !path.filter.match(object) {
+			continue
+		}
+		matched = true
+
+		switch {
+		case path.Sub != "":
+			object[findKey(object, path.Sub)] = operation.Value
+		case add:
+			value, ok := operation.Value.(map[string]any)
+			if !ok {
+				return BadRequest(ErrorInvalidValue, fmt.Sprintf("values of %s must be objects", path.Attr))
+			}
+			merge(object, value)
+		default:
+			list[i] = operation.Value
+		}
+	}
+
+	if matched {
+		return nil
+	}
+	if !add {
+		return BadRequest(ErrorNoTarget, fmt.Sprintf("no value of %s matches the filter", path.Attr))
+	}
+
+	element, ok := equalities(path.filter)
+	if !ok {
+		return BadRequest(ErrorNoTarget, fmt.Sprintf("no value of %s matches the filter", path.Attr))
+	}
+	if path.Sub != "" {
+		element[path.Sub] = operation.Value
+	} else if value, ok := operation.Value.(map[string]any); ok {
+		merge(element, value)
+	}
+	target[key] = append(list, element)
+
+	return nil
+}
+
+// setAttr sets the attribute at path of object, where path has no filter.
+func setAttr(object map[string]any, path Path, value any, add bool) error {
+	key := findKey(object, path.Attr)
+
+	if path.Sub != "" {
+		parent, ok := object[key].(map[string]any)
+		if !ok {
+			if _, exists := object[key]; exists && object[key] != nil {
+				return BadRequest(ErrorInvalidPath, fmt.Sprintf("%s is not a complex attribute", path.Attr))
+			}
+			parent = map[string]any{}
+			object[key] = parent
+		}
+		parent[findKey(parent, path.Sub)] = value
+		return nil
+	}
+
+	switch current := object[key].(type) {
+	case []any:
+		if !add {
+			break
+		}
+		for _, element := range elements(value) {
+			if !containsValue(current, element) {
+				current = append(current, element)
+			}
+		}
+		object[key] = current
+		return nil
+	case map[string]any:
+		// Sub-attributes left out of the value are kept, by add and replace
+		// alike.
+		if value, ok := value.(map[string]any); ok {
+			merge(current, value)
+			return nil
+		}
+	}
+
+	object[key] = value
+
+	return nil
+}
+
+func patchRemove(resource map[string]any, operation PatchOperation) error {
+	if operation.Path == "" {
+		return BadRequest(ErrorNoTarget, "remove operations need a path")
+	}
+
+	path, err := parsePatchPath(operation.Path)
+	if err != nil {
+		return err
+	}
+
+	target := container(resource, path.Path, false)
+	if target == nil {
+		return nil
+	}
+	key := findKey(target, path.Attr)
+
+	if path.filter == nil {
+		switch {
+		case path.Sub != "":
+			if parent, ok := target[key].(map[string]any); ok {
+				delete(parent, findKey(parent, path.Sub))
+			}
+		case operation.Value != nil:
+			list, ok := target[key].([]any)
+			if !ok {
+				delete(target, key)
+				break
+			}
+			remaining := list[:0]
+			for _, element := range list {
+				if !containsValue(elements(operation.Value), element) {
+					remaining = append(remaining, element)
+				}
+			}
+			setList(target, key, remaining)
+		default:
+			delete(target, key)
+		}
+
+		return nil
+	}
+
+	list, _ := target[key].([]any)
+	remaining := list[:0]
+	for _, element := range list {
+		object, ok := element.(map[string]any)
+		if !ok || !path.filter.match(object) {
+			remaining = append(remaining, element)
+			continue
+		}
+		if path.Sub != "" {
+			delete(object, findKey(object, path.Sub))
+			remaining = append(remaining, element)
+		}
+	}
+	setList(target, key, remaining)
+
+	return nil
+}
+
+// setList stores a multi-valued attribute, which becomes unassigned once
+// its last value is removed.
+func setList(object map[string]any, key string, list []any) {
+	if len(list) == 0 {
+		delete(object, key)
+		return
+	}
+
+	object[key] = list
+}
+
+// containsValue reports whether list holds value. Complex values are the
+// same when their "value" sub-attributes are.
+func containsValue(list []any, value any) bool {
+	for _, element := range list {
+		if sameValue(element, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameValue(a any, b any) bool {
+	objectA, okA := a.(map[string]any)
+	objectB, okB := b.(map[string]any)
+	if okA && okB {
+		valueA, hasA := lookup(objectA, "value")
+		valueB, hasB := lookup(objectB, "value")
+		if hasA && hasB {
+			return reflect.DeepEqual(valueA, valueB)
+		}
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// merge copies the attributes of value into object.
+func merge(object map[string]any, value map[string]any) {
+	for key, attrValue := range value {
+		object[findKey(object, key)] = attrValue
+	}
+}
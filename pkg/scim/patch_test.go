@@ -0,0 +1,246 @@
+package scim_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/VariableSan/gia-sso/pkg/scim"
+)
+
+// operations decodes the Operations of a PATCH request body.
+func operations(t *testing.T, s string) []scim.PatchOperation {
+	t.Helper()
+
+	var req scim.PatchRequest
+	if err := json.Unmarshal([]byte(`{"Operations": `+s+`}`), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	return req.Operations
+}
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		resource   string
+		operations string
+		want       string
+	}{
+		{
+			name:       "replace",
+			resource:   `{"userName": "bjensen", "active": true}`,
+			operations: `[{"op": "Replace", "path": "active", "value": false}]`,
+			want:       `{"userName": "bjensen", "active": false}`,
+		},
+		{
+			name:       "replace without path",
+			resource:   `{"userName": "bjensen", "name": {"givenName": "Barbara", "familyName": "Jensen"}}`,
+			operations: `[{"op": "replace", "value": {"userName": "babs", "name": {"givenName": "Babs"}}}]`,
+			want:       `{"userName": "babs", "name": {"givenName": "Babs", "familyName": "Jensen"}}`,
+		},
+		{
+			name:     "add extension without path",
+			resource: `{"userName": "bjensen"}`,
+			operations: `[{"op": "add", "value": {
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D"}
+			}}]`,
+			want: `{"userName": "bjensen", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D"}}`,
+		},
+		{
+			name:       "add extension attribute by urn",
+			resource:   `{"userName": "bjensen"}`,
+			operations: `[{"op": "add", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "value": "R&D"}]`,
+			want:       `{"userName": "bjensen", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D"}}`,
+		},
+		{
+			name:       "add sub-attribute",
+			resource:   `{"userName": "bjensen"}`,
+			operations: `[{"op": "add", "path": "name.givenName", "value": "Barbara"}]`,
+			want:       `{"userName": "bjensen", "name": {"givenName": "Barbara"}}`,
+		},
+		{
+			name:       "add to multi-valued attribute",
+			resource:   `{"members": [{"value": "1"}]}`,
+			operations: `[{"op": "add", "path": "members", "value": [{"value": "1"}, {"value": "2"}]}]`,
+			want:       `{"members": [{"value": "1"}, {"value": "2"}]}`,
+		},
+		{
+			name:       "replace multi-valued attribute",
+			resource:   `{"members": [{"value": "1"}]}`,
+			operations: `[{"op": "replace", "path": "members", "value": [{"value": "2"}]}]`,
+			want:       `{"members": [{"value": "2"}]}`,
+		},
+		{
+			name:       "replace sub-attribute of filtered values",
+			resource:   `{"emails": [{"type": "work", "value": "old@example.com"}, {"type": "home", "value": "home@example.com"}]}`,
+			operations: `[{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "new@example.com"}]`,
+			want:       `{"emails": [{"type": "work", "value": "new@example.com"}, {"type": "home", "value": "home@example.com"}]}`,
+		},
+		{
+			// Add creates the value the filter asks for.
+			name:       "add to filtered values without a match",
+			resource:   `{"emails": [{"type": "home", "value": "home@example.com"}]}`,
+			operations: `[{"op": "add", "path": "emails[type eq \"work\"].value", "value": "work@example.com"}]`,
+			want:       `{"emails": [{"type": "home", "value": "home@example.com"}, {"type": "work", "value": "work@example.com"}]}`,
+		},
+		{
+			name:       "remove attribute",
+			resource:   `{"userName": "bjensen", "title": "Tour Guide"}`,
+			operations: `[{"op": "remove", "path": "title"}]`,
+			want:       `{"userName": "bjensen"}`,
+		},
+		{
+			name:       "remove filtered values",
+			resource:   `{"members": [{"value": "1"}, {"value": "2"}]}`,
+			operations: `[{"op": "remove", "path": "members[value eq \"1\"]"}]`,
+			want:       `{"members": [{"value": "2"}]}`,
+		},
+		{
+			// As Azure AD removes group members.
+			name:       "remove listed values",
+			resource:   `{"members": [{"value": "1"}, {"value": "2"}, {"value": "3"}]}`,
+			operations: `[{"op": "remove", "path": "members", "value": [{"value": "1"}, {"value": "3"}]}]`,
+			want:       `{"members": [{"value": "2"}]}`,
+		},
+		{
+			name:       "remove last value",
+			resource:   `{"userName": "bjensen", "members": [{"value": "1"}]}`,
+			operations: `[{"op": "remove", "path": "members[value eq \"1\"]"}]`,
+			want:       `{"userName": "bjensen"}`,
+		},
+		{
+			name:       "attribute names are case-insensitive",
+			resource:   `{"userName": "bjensen"}`,
+			operations: `[{"op": "replace", "path": "USERNAME", "value": "babs"}]`,
+			want:       `{"userName": "babs"}`,
+		},
+		{
+			name:     "operations apply in order",
+			resource: `{"userName": "bjensen"}`,
+			operations: `[
+				{"op": "add", "path": "title", "value": "Tour Guide"},
+				{"op": "remove", "path": "title"},
+				{"op": "replace", "path": "userName", "value": "babs"}
+			]`,
+			want: `{"userName": "babs"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resource(t, tt.resource)
+
+			if err := scim.Patch(got, operations(t, tt.operations)); err != nil {
+				t.Fatal(err)
+			}
+
+			if want := resource(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("resource = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPatchInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations string
+		want       string
+	}{
+		{
+			name:       "unknown operation",
+			operations: `[{"op": "move", "path": "userName", "value": "babs"}]`,
+			want:       scim.ErrorInvalidSyntax,
+		},
+		{
+			name:       "read-only attribute",
+			operations: `[{"op": "replace", "path": "id", "value": "43"}]`,
+			want:       scim.ErrorMutability,
+		},
+		{
+			name:       "read-only attribute by urn",
+			operations: `[{"op": "remove", "path": "urn:ietf:params:scim:schemas:core:2.0:User:meta"}]`,
+			want:       scim.ErrorMutability,
+		},
+		{
+			name:       "read-only attribute without path",
+			operations: `[{"op": "replace", "value": {"id": "43"}}]`,
+			want:       scim.ErrorMutability,
+		},
+		{
+			name:       "invalid attribute name",
+			operations: `[{"op": "replace", "path": "user name", "value": "babs"}]`,
+			want:       scim.ErrorInvalidPath,
+		},
+		{
+			name:       "unbalanced brackets",
+			operations: `[{"op": "replace", "path": "emails[type eq \"work\"", "value": "x"}]`,
+			want:       scim.ErrorInvalidPath,
+		},
+		{
+			name:       "text after the filter",
+			operations: `[{"op": "replace", "path": "emails[type eq \"work\"]value", "value": "x"}]`,
+			want:       scim.ErrorInvalidPath,
+		},
+		{
+			name:       "filter on a sub-attribute",
+			operations: `[{"op": "replace", "path": "name.givenName[value eq \"x\"]", "value": "x"}]`,
+			want:       scim.ErrorInvalidPath,
+		},
+		{
+			name:       "invalid filter",
+			operations: `[{"op": "replace", "path": "emails[type is \"work\"]", "value": "x"}]`,
+			want:       scim.ErrorInvalidFilter,
+		},
+		{
+			name:       "filter in a path without operation path",
+			operations: `[{"op": "add", "value": {"emails[type eq \"work\"]": {"value": "x"}}}]`,
+			want:       scim.ErrorInvalidPath,
+		},
+		{
+			name:       "sub-attribute of a simple attribute",
+			operations: `[{"op": "add", "path": "userName.first", "value": "x"}]`,
+			want:       scim.ErrorInvalidPath,
+		},
+		{
+			name:       "replace without a match",
+			operations: `[{"op": "replace", "path": "emails[type eq \"other\"].value", "value": "x"}]`,
+			want:       scim.ErrorNoTarget,
+		},
+		{
+			name:       "add to a filter that is not made of equalities",
+			operations: `[{"op": "add", "path": "emails[type sw \"other\"].value", "value": "x"}]`,
+			want:       scim.ErrorNoTarget,
+		},
+		{
+			name:       "remove without path",
+			operations: `[{"op": "remove"}]`,
+			want:       scim.ErrorNoTarget,
+		},
+		{
+			name:       "value without path that is not an object",
+			operations: `[{"op": "replace", "value": "babs"}]`,
+			want:       scim.ErrorInvalidValue,
+		},
+		{
+			name:       "extension that is not an object",
+			operations: `[{"op": "add", "value": {"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": "x"}}]`,
+			want:       scim.ErrorInvalidValue,
+		},
+		{
+			name:       "add to filtered values that is not an object",
+			operations: `[{"op": "add", "path": "emails[type eq \"work\"]", "value": "x"}]`,
+			want:       scim.ErrorInvalidValue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := resource(t, testUser)
+
+			err := scim.Patch(user, operations(t, tt.operations))
+			wantSCIMError(t, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,286 @@
+// Package scim implements the protocol parts of SCIM 2.0 (RFC 7643 and
+// RFC 7644) that gia-sso needs to be provisioned by HR systems and other
+// identity managers: filters, PATCH operations and error responses.
+//
+// Resources are handled as decoded JSON objects, so that filters and
+// PATCH operations work on exactly what clients see.
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Schema URNs of resources and messages.
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaEnterpriseUser        = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// schemas are the schemas whose attributes can be addressed by their full
+// URN. Attributes of the core schemas are stored at the top level of
+// resources, those of extensions in an object named after the extension.
+var schemas = []string{SchemaUser, SchemaGroup, SchemaEnterpriseUser}
+
+// Error types of RFC 7644 section 3.12.
+const (
+	ErrorInvalidFilter = "invalidFilter"
+	ErrorTooMany       = "tooMany"
+	ErrorUniqueness    = "uniqueness"
+	ErrorMutability    = "mutability"
+	ErrorInvalidSyntax = "invalidSyntax"
+	ErrorInvalidPath   = "invalidPath"
+	ErrorNoTarget      = "noTarget"
+	ErrorInvalidValue  = "invalidValue"
+)
+
+// Error is a SCIM error response.
+type Error struct {
+	Status int
+	// Type is one of the Error* constants. It is only set for some 400 and
+	// 409 responses.
+	Type   string
+	Detail string
+}
+
+func (e *Error) Error() string {
+	if e.Type != "" {
+		return fmt.Sprintf("scim %d %s: %s", e.Status, e.Type, e.Detail)
+	}
+
+	return fmt.Sprintf("scim %d: %s", e.Status, e.Detail)
+}
+
+// Response returns the error response body.
+func (e *Error) Response() map[string]any {
+	res := map[string]any{
+		"schemas": []string{SchemaError},
+		"status":  strconv.Itoa(e.Status),
+		"detail":  e.Detail,
+	}
+	if e.Type != "" {
+		res["scimType"] = e.Type
+	}
+
+	return res
+}
+
+// BadRequest returns a 400 error of type errorType.
+func BadRequest(errorType string, detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, Type: errorType, Detail: detail}
+}
+
+// NotFound returns the error for a resource that does not exist.
+func NotFound(detail string) *Error {
+	return &Error{Status: http.StatusNotFound, Detail: detail}
+}
+
+// Conflict returns the error for a resource that would not be unique.
+func Conflict(detail string) *Error {
+	return &Error{Status: http.StatusConflict, Type: ErrorUniqueness, Detail: detail}
+}
+
+// ListResponse is the response to queries of resources.
+type ListResponse struct {
+	Schemas      []string         `json:"schemas"`
+	TotalResults int              `json:"totalResults"`
+	StartIndex   int              `json:"startIndex"`
+	ItemsPerPage int              `json:"itemsPerPage"`
+	Resources    []map[string]any `json:"Resources"`
+}
+
+// NewListResponse returns the page of resources that starts at the
+// 1-based startIndex and holds at most count of them.
+func NewListResponse(resources []map[string]any, startIndex int, count int) ListResponse {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	page := []map[string]any{}
+	if startIndex <= len(resources) {
+		page = resources[startIndex-1:]
+		page = page[:min(max(count, 0), len(page))]
+	}
+
+	return ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
+
+// Project returns resource with only the requested attributes, or without
+// the excluded ones, as asked for by the attributes and excludedAttributes
+// parameters. The id and schemas are always returned. Attributes are
+// projected by their top-level name.
+func Project(resource map[string]any, attributes []string, excluded []string) map[string]any {
+	if len(attributes) == 0 && len(excluded) == 0 {
+		return resource
+	}
+
+	keep := func(key string) bool {
+		if key == "id" || key == "schemas" {
+			return true
+		}
+		if len(attributes) > 0 {
+			return containsAttribute(attributes, key)
+		}
+		return !containsAttribute(excluded, key)
+	}
+
+	projected := make(map[string]any, len(resource))
+	for key, value := range resource {
+		if keep(key) {
+			projected[key] = value
+		}
+	}
+
+	return projected
+}
+
+func containsAttribute(attributes []string, key string) bool {
+	for _, attribute := range attributes {
+		path, err := parsePath(strings.TrimSpace(attribute))
+		if err != nil {
+			continue
+		}
+
+		name := path.Attr
+		if path.URN != "" && !isCoreSchema(path.URN) {
+			name = path.URN
+		}
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Path is an attribute path, such as "name.givenName" or
+// "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department".
+type Path struct {
+	// URN is the schema of the attribute, if the path names one.
+	URN  string
+	Attr string
+	Sub  string
+}
+
+func (p Path) String() string {
+	s := p.Attr
+	if p.Sub != "" {
+		s += "." + p.Sub
+	}
+	if p.URN != "" {
+		s = p.URN + ":" + s
+	}
+
+	return s
+}
+
+func parsePath(s string) (Path, error) {
+	var path Path
+
+	if urn, ok := schemaURN(s); ok {
+		path.URN = urn
+		s = strings.TrimPrefix(s[len(urn):], ":")
+	} else if i := strings.LastIndex(s, ":"); i >= 0 {
+		path.URN, s = s[:i], s[i+1:]
+	}
+
+	path.Attr, path.Sub, _ = strings.Cut(s, ".")
+	if !validAttrName(path.Attr) || strings.Contains(s, ".") && !validAttrName(path.Sub) {
+		return Path{}, fmt.Errorf("invalid attribute path %q", s)
+	}
+
+	return path, nil
+}
+
+// schemaURN returns the known schema s starts with.
+func schemaURN(s string) (string, bool) {
+	for _, schema := range schemas {
+		if len(s) >= len(schema) && strings.EqualFold(s[:len(schema)], schema) &&
+			(len(s) == len(schema) || s[len(schema)] == ':') {
+			return schema, true
+		}
+	}
+
+	return "", false
+}
+
+func isCoreSchema(urn string) bool {
+	return strings.EqualFold(urn, SchemaUser) || strings.EqualFold(urn, SchemaGroup)
+}
+
+// validAttrName checks ATTRNAME of RFC 7644: ALPHA *(nameChar), where
+// nameChar is "-", "_", DIGIT or ALPHA. "$ref" is allowed as well.
+func validAttrName(name string) bool {
+	if name == "$ref" {
+		return true
+	}
+	if name == "" || !isAlpha(name[0]) {
+		return false
+	}
+
+	for i := 1; i < len(name); i++ {
+		c := name[i]
+		if !isAlpha(c) && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// container returns the object that holds the attribute of path in
+// resource, creating the object of an extension when create is set.
+func container(resource map[string]any, path Path, create bool) map[string]any {
+	if path.URN == "" || isCoreSchema(path.URN) {
+		return resource
+	}
+
+	key := findKey(resource, path.URN)
+	object, ok := resource[key].(map[string]any)
+	if !ok && create {
+		object = map[string]any{}
+		resource[key] = object
+	}
+
+	return object
+}
+
+// findKey returns the key of object that matches name, which is compared
+// case-insensitively like all attribute names. name is returned when object
+// has no such key.
+func findKey(object map[string]any, name string) string {
+	if _, ok := object[name]; ok {
+		return name
+	}
+
+	for key := range object {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+
+	return name
+}
+
+func lookup(object map[string]any, name string) (any, bool) {
+	value, ok := object[findKey(object, name)]
+	return value, ok
+}
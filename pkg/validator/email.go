@@ -0,0 +1,194 @@
+package validator
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// EmailNormalizer turns email addresses into the canonical form used to
+// tell whether two addresses belong to the same user.
+type EmailNormalizer struct {
+	// ProviderRules enables mailbox provider specific rules, such as Gmail
+	// ignoring dots and "+tag" suffixes in the local part.
+	ProviderRules bool
+}
+
+// providerDomains maps domains onto the provider's primary domain and says
+// which local part features the provider ignores.
+var providerDomains = map[string]struct {
+	canonicalDomain string
+	ignoreDots      bool
+	ignorePlusTag   bool
+}{
+	"gmail.com":      {canonicalDomain: "gmail.com", ignoreDots: true, ignorePlusTag: true},
+	"googlemail.com": {canonicalDomain: "gmail.com", ignoreDots: true, ignorePlusTag: true},
+	"outlook.com":    {canonicalDomain: "outlook.com", ignorePlusTag: true},
+	"hotmail.com":    {canonicalDomain: "hotmail.com", ignorePlusTag: true},
+	"live.com":       {canonicalDomain: "live.com", ignorePlusTag: true},
+	"icloud.com":     {canonicalDomain: "icloud.com", ignorePlusTag: true},
+	"me.com":         {canonicalDomain: "icloud.com", ignorePlusTag: true},
+	"mac.com":        {canonicalDomain: "icloud.com", ignorePlusTag: true},
+	"fastmail.com":   {canonicalDomain: "fastmail.com", ignorePlusTag: true},
+	"protonmail.com": {canonicalDomain: "proton.me", ignorePlusTag: true},
+	"proton.me":      {canonicalDomain: "proton.me", ignorePlusTag: true},
+}
+
+// Normalize returns the canonical form of email: surrounding whitespace is
+// removed, the address is case folded and the domain is converted to its
+// ASCII (punycode) form.
+func (n EmailNormalizer) Normalize(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+
+	local := strings.ToLower(email[:at])
+
+	domain, err := EmailDomain(email)
+	if err != nil {
+		return "", err
+	}
+
+	if n.ProviderRules {
+		if provider, ok := providerDomains[domain]; ok {
+			domain = provider.canonicalDomain
+			if provider.ignorePlusTag {
+				local, _, _ = strings.Cut(local, "+")
+			}
+			if provider.ignoreDots {
+				local = strings.ReplaceAll(local, ".", "")
+			}
+			if local == "" {
+				return "", ErrInvalidEmail
+			}
+		}
+	}
+
+	return local + "@" + domain, nil
+}
+
+// EmailDomain returns the lower-cased ASCII form of the domain of email.
+func EmailDomain(email string) (string, error) {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return "", ErrInvalidEmail
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(strings.TrimSpace(email[at+1:]), "."))
+	if err != nil || domain == "" {
+		return "", ErrInvalidEmail
+	}
+
+	return strings.ToLower(domain), nil
+}
+
+// EmailDomainPolicy restricts which email domains may register.
+type EmailDomainPolicy struct {
+	// Allowed, when not empty, is the only set of domains accepted.
+	Allowed []string
+	// Denied domains are always rejected, e.g. disposable email providers.
+	Denied map[string]struct{}
+}
+
+// NewEmailDomainPolicy builds a policy from an allow list, a deny list and
+// an optional file of denied domains with one domain per line.
+func NewEmailDomainPolicy(allowed []string, denied []string, deniedPath string) (*EmailDomainPolicy, error) {
+	policy := &EmailDomainPolicy{
+		Denied: make(map[string]struct{}),
+	}
+
+	for _, domain := range allowed {
+		domain, err := EmailDomain("@" + domain)
+		if err != nil {
+			return nil, err
+		}
+		policy.Allowed = append(policy.Allowed, domain)
+	}
+
+	addDenied := func(domain string) error {
+		domain, err := EmailDomain("@" + domain)
+		if err != nil {
+			return err
+		}
+		policy.Denied[domain] = struct{}{}
+		return nil
+	}
+
+	for _, domain := range denied {
+		if err := addDenied(domain); err != nil {
+			return nil, err
+		}
+	}
+
+	if deniedPath != "" {
+		if _, err := os.Stat(deniedPath); err != nil {
+			return nil, err
+		}
+
+		var addErr error
+		err := readLines(deniedPath, func(line string) {
+			if addErr == nil {
+				addErr = addDenied(line)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if addErr != nil {
+			return nil, addErr
+		}
+	}
+
+	return policy, nil
+}
+
+// Permits reports whether an address at email's domain may register.
+func (p *EmailDomainPolicy) Permits(email string) bool {
+	domain, err := EmailDomain(email)
+	if err != nil {
+		return false
+	}
+
+	for candidate := domain; ; {
+		if _, ok := p.Denied[candidate]; ok {
+			return false
+		}
+
+		_, parent, ok := strings.Cut(candidate, ".")
+		if !ok {
+			break
+		}
+		candidate = parent
+	}
+
+	if len(p.Allowed) == 0 {
+		return true
+	}
+
+	for _, allowed := range p.Allowed {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetEmailDomainPolicy installs the policy enforced by the "emailDomain"
+// validation tag. A nil policy permits every domain.
+func SetEmailDomainPolicy(policy *EmailDomainPolicy) {
+	_ = validate.RegisterValidation(
+		"emailDomain",
+		func(fl validator.FieldLevel) bool {
+			return policy == nil || policy.Permits(fl.Field().String())
+		},
+	)
+}
@@ -0,0 +1,240 @@
+package validator
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is the longest password bcrypt can hash; anything beyond it
+// would be silently ignored.
+const bcryptMaxBytes = 72
+
+// sha1PrefixLength is the length of the hash prefix HIBP range files are
+// keyed by.
+const sha1PrefixLength = 5
+
+// PasswordPolicy describes the rules new passwords have to satisfy.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// RejectEmail rejects passwords that contain the local part of the
+	// user's email address.
+	RejectEmail bool
+	// Breached is an optional list of common or breached passwords.
+	Breached *BreachedPasswords
+}
+
+// FieldViolation describes why the value of a single request field is invalid.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// CheckPassword returns every rule of the policy that password breaks.
+func (p *PasswordPolicy) CheckPassword(field string, password string, email string) []FieldViolation {
+	var violations []FieldViolation
+	violate := func(format string, args ...any) {
+		violations = append(violations, FieldViolation{
+			Field:       field,
+			Description: fmt.Sprintf(format, args...),
+		})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violate("must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violate("must be at most %d characters long", p.MaxLength)
+	}
+	if len(password) > bcryptMaxBytes {
+		violate("must be at most %d bytes long", bcryptMaxBytes)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsLetter(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		violate("must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		violate("must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violate("must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violate("must contain a symbol")
+	}
+
+	if p.RejectEmail {
+		localPart, _, _ := strings.Cut(email, "@")
+		// Very short local parts would reject far too many passwords.
+		if len(localPart) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(localPart)) {
+			violate("must not contain your email address")
+		}
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violate("is too common or has appeared in a data breach")
+	}
+
+	return violations
+}
+
+// BreachedPasswords is a set of known bad passwords stored as SHA-1 hashes
+// split into a 5 character prefix and the remaining suffix, the same layout
+// the HIBP k-anonymity range API and its downloadable dumps use.
+type BreachedPasswords struct {
+	ranges map[string]map[string]struct{}
+}
+
+// LoadBreachedPasswords reads a list of bad passwords from path.
+//
+// If path is a file, every line is either a full SHA-1 hash optionally
+// followed by ":count", as in HIBP dumps, or a plain text password. If path
+// is a directory, it is read as HIBP range files: each file is named after
+// a hash prefix (e.g. "5BAA6.txt") and lists "SUFFIX:count" lines.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &BreachedPasswords{ranges: make(map[string]map[string]struct{})}
+
+	if !info.IsDir() {
+		err := readLines(path, func(line string) {
+			if hash, ok := parseHashLine(line, 40); ok {
+				list.add(hash[:sha1PrefixLength], hash[sha1PrefixLength:])
+				return
+			}
+
+			hash := sha1Hex(line)
+			list.add(hash[:sha1PrefixLength], hash[sha1PrefixLength:])
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return list, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		prefix := strings.ToUpper(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		if _, ok := parseHashLine(prefix, sha1PrefixLength); !ok {
+			continue
+		}
+
+		err := readLines(filepath.Join(path, entry.Name()), func(line string) {
+			if suffix, ok := parseHashLine(line, 40-sha1PrefixLength); ok {
+				list.add(prefix, suffix)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+// Contains reports whether password is on the list.
+func (b *BreachedPasswords) Contains(password string) bool {
+	hash := sha1Hex(password)
+
+	_, ok := b.ranges[hash[:sha1PrefixLength]][hash[sha1PrefixLength:]]
+	return ok
+}
+
+// Len returns the number of passwords on the list.
+func (b *BreachedPasswords) Len() int {
+	n := 0
+	for _, suffixes := range b.ranges {
+		n += len(suffixes)
+	}
+
+	return n
+}
+
+func (b *BreachedPasswords) add(prefix string, suffix string) {
+	suffixes, ok := b.ranges[prefix]
+	if !ok {
+		suffixes = make(map[string]struct{})
+		b.ranges[prefix] = suffixes
+	}
+
+	suffixes[suffix] = struct{}{}
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// parseHashLine extracts an upper-cased hex string of the given length from
+// a "HEX" or "HEX:count" line.
+func parseHashLine(line string, length int) (string, bool) {
+	hash, _, _ := strings.Cut(line, ":")
+	if len(hash) != length {
+		return "", false
+	}
+
+	for _, r := range hash {
+		if !unicode.Is(unicode.ASCII_Hex_Digit, r) {
+			return "", false
+		}
+	}
+
+	return strings.ToUpper(hash), true
+}
+
+func readLines(path string, fn func(line string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fn(line)
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,55 @@
+package validator
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// e164Regex matches a number in E.164 form: a plus sign, a country code
+// that does not start with 0 and at most 15 digits in total.
+var e164Regex = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// phoneSeparators are the characters people commonly group the digits of a
+// phone number with.
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "/", "")
+
+// NormalizePhone returns phone in E.164 form, e.g. "+14155550100". Grouping
+// characters are dropped and the international call prefix "00" is taken
+// for the plus sign. Numbers without a country code are rejected, as the
+// region they are dialled in is not known.
+func NormalizePhone(phone string) (string, error) {
+	phone = phoneSeparators.Replace(strings.TrimSpace(phone))
+
+	if rest, ok := strings.CutPrefix(phone, "00"); ok {
+		phone = "+" + rest
+	}
+
+	if !e164Regex.MatchString(phone) {
+		return "", ErrInvalidPhone
+	}
+
+	return phone, nil
+}
+
+// IsE164 reports whether phone is already in the form NormalizePhone
+// returns.
+func IsE164(phone string) bool {
+	return e164Regex.MatchString(phone)
+}
+
+// registerPhoneValidation installs the "phone" validation tag, which
+// accepts any number NormalizePhone can normalize.
+func registerPhoneValidation(validate *validator.Validate) {
+	_ = validate.RegisterValidation(
+		"phone",
+		func(fl validator.FieldLevel) bool {
+			_, err := NormalizePhone(fl.Field().String())
+			return err == nil
+		},
+	)
+}
@@ -6,6 +6,7 @@ import (
 	ssov1 "github.com/VariableSan/gia-protos/gen/go/sso"
 
 	"github.com/go-playground/validator/v10"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -13,8 +14,16 @@ import (
 var validate *validator.Validate
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
 
+// tagDescriptions replaces the generic validator message for custom tags
+var tagDescriptions = map[string]string{
+	"emailDomain": "email domain is not allowed to register",
+	"phone":       "must be a phone number with country code, e.g. +14155550100",
+}
+
 func init() {
 	validate = validator.New()
+	SetEmailDomainPolicy(nil)
+	registerPhoneValidation(validate)
 }
 
 // Register custom validators
@@ -38,22 +47,56 @@ func Validate(s interface{}) error {
 	if err := validate.Struct(s); err != nil {
 		validationErrors := err.(validator.ValidationErrors)
 		if len(validationErrors) > 0 {
-			return status.Errorf(codes.InvalidArgument, "validation failed: %v", validationErrors[0])
+			violations := make([]FieldViolation, 0, len(validationErrors))
+			for _, fieldErr := range validationErrors {
+				description, ok := tagDescriptions[fieldErr.Tag()]
+				if !ok {
+					description = fieldErr.Error()
+				}
+				violations = append(violations, FieldViolation{
+					Field:       fieldErr.Field(),
+					Description: description,
+				})
+			}
+			return FieldViolationsError(violations)
 		}
 	}
 	return nil
 }
 
+// FieldViolationsError returns an InvalidArgument gRPC error carrying the
+// violations as BadRequest error details
+func FieldViolationsError(violations []FieldViolation) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.Field,
+			Description: violation.Description,
+		})
+	}
+
+	st := status.Newf(codes.InvalidArgument, "validation failed: %s: %s", violations[0].Field, violations[0].Description)
+
+	detailed, err := st.WithDetails(badRequest)
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
 // LoginRequestValidator validates LoginRequest
 type LoginRequestValidator struct {
 	Email    string `validate:"required,email"`
-	Password string `validate:"required,min=6"`
+	Password string `validate:"required"`
 }
 
-// RegisterRequestValidator validates RegisterRequest
+// RegisterRequestValidator validates RegisterRequest. The password itself is
+// checked against the configured PasswordPolicy by the auth service.
 type RegisterRequestValidator struct {
-	Email    string `validate:"required,email"`
-	Password string `validate:"required,min=6"`
+	Email          string `validate:"required,email,emailDomain"`
+	Password       string `validate:"required"`
+	InvitationCode string `validate:"max=128"`
 }
 
 // LogoutRequestValidator validates LogoutRequest
@@ -66,6 +109,267 @@ type IsAdminRequestValidator struct {
 	UserID int64 `validate:"required,gt=0"`
 }
 
+// RefreshTokenRequestValidator validates RefreshTokenRequest
+type RefreshTokenRequestValidator struct {
+	RefreshToken string `validate:"required"`
+}
+
+// ValidateTokenRequestValidator validates ValidateTokenRequest
+type ValidateTokenRequestValidator struct {
+	Token  string `validate:"required"`
+	MinACR string `validate:"max=100"`
+	MaxAge int64  `validate:"gte=0"`
+}
+
+// ListSessionsRequestValidator validates ListSessionsRequest
+type ListSessionsRequestValidator struct {
+	UserID int64 `validate:"gte=0"`
+}
+
+// RevokeSessionRequestValidator validates RevokeSessionRequest
+type RevokeSessionRequestValidator struct {
+	SessionID string `validate:"required"`
+}
+
+// RevokeAllOtherSessionsRequestValidator validates RevokeAllOtherSessionsRequest
+type RevokeAllOtherSessionsRequestValidator struct {
+	UserID int64 `validate:"gte=0"`
+}
+
+// SetUserStatusRequestValidator validates SetUserStatusRequest
+type SetUserStatusRequestValidator struct {
+	UserID int64  `validate:"required,gt=0"`
+	Status string `validate:"required,oneof=active disabled locked pending_verification"`
+	Reason string `validate:"max=500"`
+}
+
+// DeleteUserRequestValidator validates DeleteUserRequest
+type DeleteUserRequestValidator struct {
+	UserID int64  `validate:"required,gt=0"`
+	Reason string `validate:"max=500"`
+}
+
+// ChangePasswordRequestValidator validates ChangePasswordRequest
+type ChangePasswordRequestValidator struct {
+	Email       string `validate:"required,email"`
+	OldPassword string `validate:"required"`
+	NewPassword string `validate:"required,nefield=OldPassword"`
+}
+
+// DeleteMyAccountRequestValidator validates DeleteMyAccountRequest. The
+// password may be empty for users who have none and have recently logged in.
+type DeleteMyAccountRequestValidator struct {
+	Password string `validate:"max=1000"`
+}
+
+// ClientCredentialsRequestValidator validates ClientCredentialsRequest.
+// Clients authenticate with either a secret or a signed client assertion.
+type ClientCredentialsRequestValidator struct {
+	ClientID        string `validate:"required_without=ClientAssertion"`
+	ClientSecret    string `validate:"required_without=ClientAssertion,excluded_with=ClientAssertion"`
+	ClientAssertion string `validate:"omitempty,jwt"`
+	Scope           string `validate:"max=1000"`
+	Audience        string `validate:"max=1000"`
+}
+
+// TokenExchangeRequestValidator validates TokenExchangeRequest.
+type TokenExchangeRequestValidator struct {
+	ClientID         string   `validate:"required_without=ClientAssertion"`
+	ClientSecret     string   `validate:"required_without=ClientAssertion,excluded_with=ClientAssertion"`
+	ClientAssertion  string   `validate:"omitempty,jwt"`
+	SubjectToken     string   `validate:"required"`
+	SubjectTokenType string   `validate:"required"`
+	ActorToken       string   `validate:"omitempty,jwt"`
+	ActorTokenType   string   `validate:"required_with=ActorToken"`
+	Audience         []string `validate:"dive,max=255"`
+	Scope            string   `validate:"max=1000"`
+}
+
+// ClientValidator validates the metadata of an OAuth client. The OAuth
+// service checks what the values mean.
+type ClientValidator struct {
+	ClientID                string   `validate:"max=255"`
+	ClientName              string   `validate:"max=255"`
+	RedirectURIs            []string `validate:"max=50,dive,required,max=2000"`
+	GrantTypes              []string `validate:"max=10,dive,required"`
+	TokenEndpointAuthMethod string   `validate:"omitempty,oneof=client_secret_basic client_secret_post private_key_jwt none"`
+	Scopes                  []string `validate:"max=100,dive,required,max=255"`
+	Audience                []string `validate:"max=50,dive,required,max=255"`
+	JWKS                    string   `validate:"omitempty,json,max=65536"`
+	PostLogoutRedirectURIs  []string `validate:"max=50,dive,required,max=2000"`
+	FrontchannelLogoutURI   string   `validate:"omitempty,url,max=2000"`
+	BackchannelLogoutURI    string   `validate:"omitempty,url,max=2000"`
+	AccessTokenTTLSeconds   int64    `validate:"gte=0"`
+	RefreshTokenTTLSeconds  int64    `validate:"gte=0"`
+	ServiceAccountID        int64    `validate:"gte=0"`
+}
+
+// CreateClientRequestValidator validates CreateClientRequest
+type CreateClientRequestValidator struct {
+	Client *ClientValidator `validate:"required"`
+}
+
+// UpdateClientRequestValidator validates UpdateClientRequest
+type UpdateClientRequestValidator struct {
+	Client   *ClientValidator `validate:"required"`
+	ClientID string           `validate:"required"`
+}
+
+// ClientIDRequestValidator validates requests about a single OAuth client
+type ClientIDRequestValidator struct {
+	ClientID string `validate:"required,max=255"`
+}
+
+// ServiceProviderValidator validates the registration of a SAML service
+// provider. The SAML service checks what the values mean.
+type ServiceProviderValidator struct {
+	EntityID     string            `validate:"required,max=1024"`
+	Name         string            `validate:"max=255"`
+	ACSURLs      []string          `validate:"max=20,dive,required,max=2000"`
+	NameIDFormat string            `validate:"max=255"`
+	Attributes   map[string]string `validate:"max=50,dive,keys,required,max=255,endkeys,required"`
+}
+
+// ServiceProviderRequestValidator validates CreateSAMLServiceProviderRequest
+// and UpdateSAMLServiceProviderRequest
+type ServiceProviderRequestValidator struct {
+	ServiceProvider *ServiceProviderValidator `validate:"required"`
+}
+
+// EntityIDRequestValidator validates requests about a single SAML service
+// provider
+type EntityIDRequestValidator struct {
+	EntityID string `validate:"required,max=1024"`
+}
+
+// LinkIdentityRequestValidator validates LinkIdentityRequest
+type LinkIdentityRequestValidator struct {
+	Provider string `validate:"required,max=255"`
+}
+
+// UnlinkIdentityRequestValidator validates UnlinkIdentityRequest
+type UnlinkIdentityRequestValidator struct {
+	Provider string `validate:"required,max=255"`
+	Subject  string `validate:"required,max=255"`
+}
+
+// CreateAPIKeyRequestValidator validates CreateAPIKeyRequest
+type CreateAPIKeyRequestValidator struct {
+	Name             string   `validate:"required,max=100"`
+	Scopes           []string `validate:"max=100,dive,required,max=255"`
+	ServiceAccountID int64    `validate:"gte=0"`
+}
+
+// ListAPIKeysRequestValidator validates ListAPIKeysRequest
+type ListAPIKeysRequestValidator struct {
+	UserID int64 `validate:"gte=0"`
+}
+
+// RevokeAPIKeyRequestValidator validates RevokeAPIKeyRequest
+type RevokeAPIKeyRequestValidator struct {
+	ID string `validate:"required,max=255"`
+}
+
+// CreateServiceAccountRequestValidator validates CreateServiceAccountRequest
+type CreateServiceAccountRequestValidator struct {
+	Name        string `validate:"required,max=100"`
+	Description string `validate:"max=1000"`
+	OwnerID     int64  `validate:"gte=0"`
+}
+
+// ServiceAccountIDRequestValidator validates requests about a single service account
+type ServiceAccountIDRequestValidator struct {
+	ID int64 `validate:"required,gt=0"`
+}
+
+// ListServiceAccountsRequestValidator validates ListServiceAccountsRequest
+type ListServiceAccountsRequestValidator struct {
+	OwnerID int64 `validate:"gte=0"`
+}
+
+// SetServiceAccountRolesRequestValidator validates SetServiceAccountRolesRequest
+type SetServiceAccountRolesRequestValidator struct {
+	ID    int64    `validate:"required,gt=0"`
+	Roles []string `validate:"max=20,dive,required,max=100"`
+}
+
+// StepUpRequestValidator validates StepUpRequest. Users step up with their
+// password, the code of an email login or the code of an SMS challenge.
+type StepUpRequestValidator struct {
+	Password       string `validate:"required_without_all=EmailLoginID SMSChallengeID"`
+	EmailLoginID   string `validate:"excluded_with=Password SMSChallengeID,max=64"`
+	EmailCode      string `validate:"required_with=EmailLoginID,omitempty,numeric,max=16"`
+	SMSChallengeID string `validate:"excluded_with=Password EmailLoginID,max=64"`
+	SMSCode        string `validate:"required_with=SMSChallengeID,omitempty,numeric,max=16"`
+	ACR            string `validate:"max=100"`
+}
+
+// CreateInvitationRequestValidator validates CreateInvitationRequest
+type CreateInvitationRequestValidator struct {
+	Email   string `validate:"required,email,emailDomain"`
+	Role    string `validate:"max=100"`
+	OrgID   int64  `validate:"gte=0"`
+	OrgRole string `validate:"max=100"`
+}
+
+// RevokeInvitationRequestValidator validates RevokeInvitationRequest
+type RevokeInvitationRequestValidator struct {
+	ID string `validate:"required,max=64"`
+}
+
+// CreateOrgRequestValidator validates CreateOrgRequest
+type CreateOrgRequestValidator struct {
+	Name    string `validate:"required,max=200"`
+	OwnerID int64  `validate:"gte=0"`
+}
+
+// ListOrgMembersRequestValidator validates ListOrgMembersRequest
+type ListOrgMembersRequestValidator struct {
+	OrgID int64 `validate:"required,gt=0"`
+}
+
+// GetProfileRequestValidator validates GetProfileRequest
+type GetProfileRequestValidator struct {
+	UserID int64 `validate:"gte=0"`
+}
+
+// UpdateProfileRequestValidator validates UpdateProfileRequest. Fields left
+// out of UpdateMask are ignored, and clearing a field sets it empty.
+type UpdateProfileRequestValidator struct {
+	UserID        int64    `validate:"gte=0"`
+	DisplayName   string   `validate:"max=200"`
+	GivenName     string   `validate:"max=100"`
+	FamilyName    string   `validate:"max=100"`
+	Locale        string   `validate:"omitempty,bcp47_language_tag"`
+	Timezone      string   `validate:"omitempty,timezone"`
+	AvatarURL     string   `validate:"omitempty,http_url,max=2048"`
+	Phone         string   `validate:"omitempty,phone"`
+	Metadata      string   `validate:"omitempty,json,max=16384"`
+	AdminMetadata string   `validate:"omitempty,json,max=16384"`
+	UpdateMask    []string `validate:"min=1,max=16,dive,required"`
+}
+
+// ConfirmPhoneVerificationRequestValidator validates
+// ConfirmPhoneVerificationRequest
+type ConfirmPhoneVerificationRequestValidator struct {
+	VerificationID string `validate:"required,max=64"`
+	Code           string `validate:"required,numeric,max=16"`
+}
+
+// StartEmailLoginRequestValidator validates StartEmailLoginRequest
+type StartEmailLoginRequestValidator struct {
+	Email string `validate:"required,email"`
+}
+
+// CompleteEmailLoginRequestValidator validates CompleteEmailLoginRequest.
+// Logins are completed either with the login id and code or with the token
+// of a magic link.
+type CompleteEmailLoginRequestValidator struct {
+	LoginID string `validate:"required_without=Token,max=64"`
+	Code    string `validate:"required_with=LoginID,omitempty,numeric,max=16"`
+	Token   string `validate:"max=128"`
+}
+
 // ValidateLoginRequest validates LoginRequest fields
 func ValidateLoginRequest(req *ssov1.LoginRequest) error {
 	return Validate(LoginRequestValidator{
@@ -77,8 +381,9 @@ func ValidateLoginRequest(req *ssov1.LoginRequest) error {
 // ValidateRegisterRequest validates RegisterRequest fields
 func ValidateRegisterRequest(req *ssov1.RegisterRequest) error {
 	return Validate(RegisterRequestValidator{
-		Email:    req.GetEmail(),
-		Password: req.GetPassword(),
+		Email:          req.GetEmail(),
+		Password:       req.GetPassword(),
+		InvitationCode: req.GetInvitationCode(),
 	})
 }
 
@@ -95,3 +400,380 @@ func ValidateIsAdminRequest(req *ssov1.IsAdminRequest) error {
 		UserID: req.GetUserId(),
 	})
 }
+
+// ValidateRefreshTokenRequest validates RefreshTokenRequest fields
+func ValidateRefreshTokenRequest(req *ssov1.RefreshTokenRequest) error {
+	return Validate(RefreshTokenRequestValidator{
+		RefreshToken: req.GetRefreshToken(),
+	})
+}
+
+// ValidateValidateTokenRequest validates ValidateTokenRequest fields
+func ValidateValidateTokenRequest(req *ssov1.ValidateTokenRequest) error {
+	return Validate(ValidateTokenRequestValidator{
+		Token:  req.GetToken(),
+		MinACR: req.GetMinAcr(),
+		MaxAge: req.GetMaxAge(),
+	})
+}
+
+// ValidateListSessionsRequest validates ListSessionsRequest fields
+func ValidateListSessionsRequest(req *ssov1.ListSessionsRequest) error {
+	return Validate(ListSessionsRequestValidator{
+		UserID: req.GetUserId(),
+	})
+}
+
+// ValidateRevokeSessionRequest validates RevokeSessionRequest fields
+func ValidateRevokeSessionRequest(req *ssov1.RevokeSessionRequest) error {
+	return Validate(RevokeSessionRequestValidator{
+		SessionID: req.GetSessionId(),
+	})
+}
+
+// ValidateRevokeAllOtherSessionsRequest validates RevokeAllOtherSessionsRequest fields
+func ValidateRevokeAllOtherSessionsRequest(req *ssov1.RevokeAllOtherSessionsRequest) error {
+	return Validate(RevokeAllOtherSessionsRequestValidator{
+		UserID: req.GetUserId(),
+	})
+}
+
+// ValidateSetUserStatusRequest validates SetUserStatusRequest fields
+func ValidateSetUserStatusRequest(req *ssov1.SetUserStatusRequest) error {
+	return Validate(SetUserStatusRequestValidator{
+		UserID: req.GetUserId(),
+		Status: req.GetStatus(),
+		Reason: req.GetReason(),
+	})
+}
+
+// ValidateDeleteUserRequest validates DeleteUserRequest fields
+func ValidateDeleteUserRequest(req *ssov1.DeleteUserRequest) error {
+	return Validate(DeleteUserRequestValidator{
+		UserID: req.GetUserId(),
+		Reason: req.GetReason(),
+	})
+}
+
+// ValidateDeleteMyAccountRequest validates DeleteMyAccountRequest fields
+func ValidateDeleteMyAccountRequest(req *ssov1.DeleteMyAccountRequest) error {
+	return Validate(DeleteMyAccountRequestValidator{
+		Password: req.GetPassword(),
+	})
+}
+
+// ValidateChangePasswordRequest validates ChangePasswordRequest fields
+func ValidateChangePasswordRequest(req *ssov1.ChangePasswordRequest) error {
+	return Validate(ChangePasswordRequestValidator{
+		Email:       req.GetEmail(),
+		OldPassword: req.GetOldPassword(),
+		NewPassword: req.GetNewPassword(),
+	})
+}
+
+// ValidateClientCredentialsRequest validates ClientCredentialsRequest fields
+func ValidateClientCredentialsRequest(req *ssov1.ClientCredentialsRequest) error {
+	return Validate(ClientCredentialsRequestValidator{
+		ClientID:        req.GetClientId(),
+		ClientSecret:    req.GetClientSecret(),
+		ClientAssertion: req.GetClientAssertion(),
+		Scope:           req.GetScope(),
+		Audience:        req.GetAudience(),
+	})
+}
+
+// ValidateTokenExchangeRequest validates TokenExchangeRequest fields
+func ValidateTokenExchangeRequest(req *ssov1.TokenExchangeRequest) error {
+	return Validate(TokenExchangeRequestValidator{
+		ClientID:         req.GetClientId(),
+		ClientSecret:     req.GetClientSecret(),
+		ClientAssertion:  req.GetClientAssertion(),
+		SubjectToken:     req.GetSubjectToken(),
+		SubjectTokenType: req.GetSubjectTokenType(),
+		ActorToken:       req.GetActorToken(),
+		ActorTokenType:   req.GetActorTokenType(),
+		Audience:         req.GetAudience(),
+		Scope:            req.GetScope(),
+	})
+}
+
+// ValidateCreateClientRequest validates CreateClientRequest fields
+func ValidateCreateClientRequest(req *ssov1.CreateClientRequest) error {
+	return Validate(CreateClientRequestValidator{
+		Client: clientValidator(req.GetClient()),
+	})
+}
+
+// ValidateUpdateClientRequest validates UpdateClientRequest fields
+func ValidateUpdateClientRequest(req *ssov1.UpdateClientRequest) error {
+	return Validate(UpdateClientRequestValidator{
+		Client:   clientValidator(req.GetClient()),
+		ClientID: req.GetClient().GetClientId(),
+	})
+}
+
+// ValidateGetClientRequest validates GetClientRequest fields
+func ValidateGetClientRequest(req *ssov1.GetClientRequest) error {
+	return Validate(ClientIDRequestValidator{
+		ClientID: req.GetClientId(),
+	})
+}
+
+// ValidateRotateClientSecretRequest validates RotateClientSecretRequest fields
+func ValidateRotateClientSecretRequest(req *ssov1.RotateClientSecretRequest) error {
+	return Validate(ClientIDRequestValidator{
+		ClientID: req.GetClientId(),
+	})
+}
+
+// ValidateRevokeGrantRequest validates RevokeGrantRequest fields
+func ValidateRevokeGrantRequest(req *ssov1.RevokeGrantRequest) error {
+	return Validate(ClientIDRequestValidator{
+		ClientID: req.GetClientId(),
+	})
+}
+
+// ValidateLinkIdentityRequest validates LinkIdentityRequest fields
+func ValidateLinkIdentityRequest(req *ssov1.LinkIdentityRequest) error {
+	return Validate(LinkIdentityRequestValidator{
+		Provider: req.GetProvider(),
+	})
+}
+
+// ValidateUnlinkIdentityRequest validates UnlinkIdentityRequest fields
+func ValidateUnlinkIdentityRequest(req *ssov1.UnlinkIdentityRequest) error {
+	return Validate(UnlinkIdentityRequestValidator{
+		Provider: req.GetProvider(),
+		Subject:  req.GetSubject(),
+	})
+}
+
+// ValidateCreateSAMLServiceProviderRequest validates
+// CreateSAMLServiceProviderRequest fields
+func ValidateCreateSAMLServiceProviderRequest(req *ssov1.CreateSAMLServiceProviderRequest) error {
+	return Validate(ServiceProviderRequestValidator{
+		ServiceProvider: serviceProviderValidator(req.GetServiceProvider()),
+	})
+}
+
+// ValidateUpdateSAMLServiceProviderRequest validates
+// UpdateSAMLServiceProviderRequest fields
+func ValidateUpdateSAMLServiceProviderRequest(req *ssov1.UpdateSAMLServiceProviderRequest) error {
+	return Validate(ServiceProviderRequestValidator{
+		ServiceProvider: serviceProviderValidator(req.GetServiceProvider()),
+	})
+}
+
+// ValidateGetSAMLServiceProviderRequest validates
+// GetSAMLServiceProviderRequest fields
+func ValidateGetSAMLServiceProviderRequest(req *ssov1.GetSAMLServiceProviderRequest) error {
+	return Validate(EntityIDRequestValidator{
+		EntityID: req.GetEntityId(),
+	})
+}
+
+// ValidateDeleteSAMLServiceProviderRequest validates
+// DeleteSAMLServiceProviderRequest fields
+func ValidateDeleteSAMLServiceProviderRequest(req *ssov1.DeleteSAMLServiceProviderRequest) error {
+	return Validate(EntityIDRequestValidator{
+		EntityID: req.GetEntityId(),
+	})
+}
+
+// ValidateDeleteClientRequest validates DeleteClientRequest fields
+func ValidateDeleteClientRequest(req *ssov1.DeleteClientRequest) error {
+	return Validate(ClientIDRequestValidator{
+		ClientID: req.GetClientId(),
+	})
+}
+
+// ValidateCreateAPIKeyRequest validates CreateAPIKeyRequest fields
+func ValidateCreateAPIKeyRequest(req *ssov1.CreateAPIKeyRequest) error {
+	return Validate(CreateAPIKeyRequestValidator{
+		Name:             req.GetName(),
+		Scopes:           req.GetScopes(),
+		ServiceAccountID: req.GetServiceAccountId(),
+	})
+}
+
+// ValidateListAPIKeysRequest validates ListAPIKeysRequest fields
+func ValidateListAPIKeysRequest(req *ssov1.ListAPIKeysRequest) error {
+	return Validate(ListAPIKeysRequestValidator{
+		UserID: req.GetUserId(),
+	})
+}
+
+// ValidateRevokeAPIKeyRequest validates RevokeAPIKeyRequest fields
+func ValidateRevokeAPIKeyRequest(req *ssov1.RevokeAPIKeyRequest) error {
+	return Validate(RevokeAPIKeyRequestValidator{
+		ID: req.GetId(),
+	})
+}
+
+// ValidateCreateServiceAccountRequest validates CreateServiceAccountRequest fields
+func ValidateCreateServiceAccountRequest(req *ssov1.CreateServiceAccountRequest) error {
+	return Validate(CreateServiceAccountRequestValidator{
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		OwnerID:     req.GetOwnerId(),
+	})
+}
+
+// ValidateGetServiceAccountRequest validates GetServiceAccountRequest fields
+func ValidateGetServiceAccountRequest(req *ssov1.GetServiceAccountRequest) error {
+	return Validate(ServiceAccountIDRequestValidator{
+		ID: req.GetId(),
+	})
+}
+
+// ValidateListServiceAccountsRequest validates ListServiceAccountsRequest fields
+func ValidateListServiceAccountsRequest(req *ssov1.ListServiceAccountsRequest) error {
+	return Validate(ListServiceAccountsRequestValidator{
+		OwnerID: req.GetOwnerId(),
+	})
+}
+
+// ValidateDeleteServiceAccountRequest validates DeleteServiceAccountRequest fields
+func ValidateDeleteServiceAccountRequest(req *ssov1.DeleteServiceAccountRequest) error {
+	return Validate(ServiceAccountIDRequestValidator{
+		ID: req.GetId(),
+	})
+}
+
+// ValidateSetServiceAccountRolesRequest validates SetServiceAccountRolesRequest fields
+func ValidateSetServiceAccountRolesRequest(req *ssov1.SetServiceAccountRolesRequest) error {
+	return Validate(SetServiceAccountRolesRequestValidator{
+		ID:    req.GetId(),
+		Roles: req.GetRoles(),
+	})
+}
+
+// ValidateStartEmailLoginRequest validates StartEmailLoginRequest fields
+func ValidateStartEmailLoginRequest(req *ssov1.StartEmailLoginRequest) error {
+	return Validate(StartEmailLoginRequestValidator{
+		Email: req.GetEmail(),
+	})
+}
+
+// ValidateCompleteEmailLoginRequest validates CompleteEmailLoginRequest fields
+func ValidateCompleteEmailLoginRequest(req *ssov1.CompleteEmailLoginRequest) error {
+	return Validate(CompleteEmailLoginRequestValidator{
+		LoginID: req.GetLoginId(),
+		Code:    req.GetCode(),
+		Token:   req.GetToken(),
+	})
+}
+
+// ValidateStepUpRequest validates StepUpRequest fields
+func ValidateStepUpRequest(req *ssov1.StepUpRequest) error {
+	return Validate(StepUpRequestValidator{
+		Password:       req.GetPassword(),
+		EmailLoginID:   req.GetEmailLoginId(),
+		EmailCode:      req.GetEmailCode(),
+		SMSChallengeID: req.GetSmsChallengeId(),
+		SMSCode:        req.GetSmsCode(),
+		ACR:            req.GetAcr(),
+	})
+}
+
+// ValidateCreateInvitationRequest validates CreateInvitationRequest fields
+func ValidateCreateInvitationRequest(req *ssov1.CreateInvitationRequest) error {
+	return Validate(CreateInvitationRequestValidator{
+		Email:   req.GetEmail(),
+		Role:    req.GetRole(),
+		OrgID:   req.GetOrgId(),
+		OrgRole: req.GetOrgRole(),
+	})
+}
+
+// ValidateRevokeInvitationRequest validates RevokeInvitationRequest fields
+func ValidateRevokeInvitationRequest(req *ssov1.RevokeInvitationRequest) error {
+	return Validate(RevokeInvitationRequestValidator{
+		ID: req.GetId(),
+	})
+}
+
+// ValidateCreateOrgRequest validates CreateOrgRequest fields
+func ValidateCreateOrgRequest(req *ssov1.CreateOrgRequest) error {
+	return Validate(CreateOrgRequestValidator{
+		Name:    req.GetName(),
+		OwnerID: req.GetOwnerId(),
+	})
+}
+
+// ValidateListOrgMembersRequest validates ListOrgMembersRequest fields
+func ValidateListOrgMembersRequest(req *ssov1.ListOrgMembersRequest) error {
+	return Validate(ListOrgMembersRequestValidator{
+		OrgID: req.GetOrgId(),
+	})
+}
+
+// ValidateGetProfileRequest validates GetProfileRequest fields
+func ValidateGetProfileRequest(req *ssov1.GetProfileRequest) error {
+	return Validate(GetProfileRequestValidator{
+		UserID: req.GetUserId(),
+	})
+}
+
+// ValidateUpdateProfileRequest validates UpdateProfileRequest fields
+func ValidateUpdateProfileRequest(req *ssov1.UpdateProfileRequest) error {
+	return Validate(UpdateProfileRequestValidator{
+		UserID:        req.GetUserId(),
+		DisplayName:   req.GetDisplayName(),
+		GivenName:     req.GetGivenName(),
+		FamilyName:    req.GetFamilyName(),
+		Locale:        req.GetLocale(),
+		Timezone:      req.GetTimezone(),
+		AvatarURL:     req.GetAvatarUrl(),
+		Phone:         req.GetPhone(),
+		Metadata:      req.GetMetadata(),
+		AdminMetadata: req.GetAdminMetadata(),
+		UpdateMask:    req.GetUpdateMask(),
+	})
+}
+
+// ValidateConfirmPhoneVerificationRequest validates
+// ConfirmPhoneVerificationRequest fields
+func ValidateConfirmPhoneVerificationRequest(req *ssov1.ConfirmPhoneVerificationRequest) error {
+	return Validate(ConfirmPhoneVerificationRequestValidator{
+		VerificationID: req.GetVerificationId(),
+		Code:           req.GetCode(),
+	})
+}
+
+func clientValidator(client *ssov1.OAuthClient) *ClientValidator {
+	if client == nil {
+		return nil
+	}
+
+	return &ClientValidator{
+		ClientID:                client.GetClientId(),
+		ClientName:              client.GetClientName(),
+		RedirectURIs:            client.GetRedirectUris(),
+		GrantTypes:              client.GetGrantTypes(),
+		TokenEndpointAuthMethod: client.GetTokenEndpointAuthMethod(),
+		Scopes:                  client.GetScopes(),
+		Audience:                client.GetAudience(),
+		JWKS:                    client.GetJwks(),
+		PostLogoutRedirectURIs:  client.GetPostLogoutRedirectUris(),
+		FrontchannelLogoutURI:   client.GetFrontchannelLogoutUri(),
+		BackchannelLogoutURI:    client.GetBackchannelLogoutUri(),
+		AccessTokenTTLSeconds:   client.GetAccessTokenTtlSeconds(),
+		RefreshTokenTTLSeconds:  client.GetRefreshTokenTtlSeconds(),
+		ServiceAccountID:        client.GetServiceAccountId(),
+	}
+}
+
+func serviceProviderValidator(sp *ssov1.SAMLServiceProvider) *ServiceProviderValidator {
+	if sp == nil {
+		return nil
+	}
+
+	return &ServiceProviderValidator{
+		EntityID:     sp.GetEntityId(),
+		Name:         sp.GetName(),
+		ACSURLs:      sp.GetAcsUrls(),
+		NameIDFormat: sp.GetNameIdFormat(),
+		Attributes:   sp.GetAttributes(),
+	}
+}